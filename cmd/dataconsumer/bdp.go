@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/consumer"
+)
+
+const (
+	// autoWorkersWindow is how long auto_workers measures each source
+	// before a session starts.
+	autoWorkersWindow = 3 * time.Second
+	// maxAutoWorkers caps the worker count auto_workers applies.
+	maxAutoWorkers = 1024
+)
+
+// pipeTarget is the rate the workers must fill: the target rate, or the
+// bandwidth ceiling if that is lower.
+func pipeTarget(config *configs.Config) configs.Rate {
+	if config.MaxBandwidth > 0 && config.MaxBandwidth < config.TargetRate {
+		return config.MaxBandwidth
+	}
+	return config.TargetRate
+}
+
+// estimatePipes estimates the streams needed for every enabled source,
+// one after the other or, with parallel, all at once.
+func estimatePipes(ctx context.Context, dataConsumer *consumer.Consumer, sources []configs.Source, target configs.Rate, window time.Duration, parallel bool) ([]consumer.PipeEstimate, map[string]int) {
+	var enabled []configs.Source
+	weights := make(map[string]int)
+	for _, source := range sources {
+		if source.IsEnabled() {
+			enabled = append(enabled, source)
+			weights[source.URL] = source.EffectiveWeight()
+		}
+	}
+	estimates := make([]consumer.PipeEstimate, len(enabled))
+	var wg sync.WaitGroup
+	for i, source := range enabled {
+		if !parallel {
+			estimates[i] = dataConsumer.EstimatePipe(ctx, source, target, window)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, source configs.Source) {
+			defer wg.Done()
+			estimates[i] = dataConsumer.EstimatePipe(ctx, source, target, window)
+		}(i, source)
+	}
+	wg.Wait()
+	return estimates, weights
+}
+
+// runBDP measures the round-trip time and single-stream throughput of
+// every source for window each and recommends the worker count that
+// fills the bandwidth-delay product at the target rate. With writeConfig
+// the recommendation is saved as concurrency_factor in the config file at
+// configPath.
+func runBDP(config *configs.Config, configPath string, window time.Duration, writeConfig bool) int {
+	if writeConfig && configPath == "" {
+		fmt.Fprintln(os.Stderr, "-write-config needs a configuration file")
+		return 2
+	}
+	if window <= 0 {
+		fmt.Fprintln(os.Stderr, "-bdp-window must be positive")
+		return 2
+	}
+	dataConsumer, err := consumer.NewConsumer(consumer.WithConfig(config))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	target := pipeTarget(config)
+	fmt.Printf("Measuring each source for %s to fill %s\n\n", window, target)
+	estimates, weights := estimatePipes(ctx, dataConsumer, config.DataSources, target, window, false)
+	for _, estimate := range estimates {
+		if estimate.LastError != "" {
+			fmt.Printf("%s\n  failed: %s\n", estimate.URL, estimate.LastError)
+			continue
+		}
+		fmt.Printf("%s\n  RTT %s, %s per stream (window %s), BDP %s: %d streams\n",
+			estimate.URL, estimate.RTT.Round(time.Microsecond), estimate.StreamRate, estimate.Window, estimate.BDP, estimate.Streams)
+	}
+	workers := min(consumer.RecommendedStreams(estimates, weights, target), maxAutoWorkers)
+	if workers <= 0 {
+		fmt.Println("\nNo source could be measured; check the sources with 'dataconsumer doctor'.")
+		return 1
+	}
+	fmt.Printf("\nRecommended concurrency_factor: %d\n", workers)
+	if ctx.Err() != nil {
+		fmt.Println("The measurement was interrupted, so the recommendation may be off.")
+	}
+	if writeConfig {
+		if err := configs.UpdateFile(configPath, map[string]interface{}{"concurrency_factor": workers}); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to update %s: %v\n", configPath, err)
+			return 1
+		}
+		fmt.Printf("Saved to %s (the original is in %s.bak).\n", configPath, configPath)
+	}
+	return 0
+}
+
+// autoWorkers measures the sources at once when auto_workers is set and
+// returns the worker count that fills the pipe at the target rate, or 0
+// to keep the default.
+func autoWorkers(config *configs.Config, dataConsumer *consumer.Consumer) int {
+	if !config.AutoWorkers || config.TargetRPS > 0 {
+		return 0
+	}
+	target := pipeTarget(config)
+	ctx, cancel := context.WithTimeout(context.Background(), autoWorkersWindow+sizeProbeTimeout)
+	defer cancel()
+	estimates, weights := estimatePipes(ctx, dataConsumer, config.DataSources, target, autoWorkersWindow, true)
+	workers := min(consumer.RecommendedStreams(estimates, weights, target), maxAutoWorkers)
+	if workers <= 0 {
+		logger.Warn("auto_workers could not measure any source, keeping the default worker count")
+		return 0
+	}
+	logger.Info("sized workers to the bandwidth-delay product", "workers", workers, "target", target)
+	return workers
+}
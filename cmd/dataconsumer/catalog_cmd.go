@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/catalog"
+	"dataconsumer/pkg/consumer"
+)
+
+// runSourcesUpdate merges the working sources of the signed catalog that
+// the config does not list yet into the config file.
+func runSourcesUpdate(args []string) int {
+	fs := flag.NewFlagSet("sources update", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to configuration file")
+	catalogURL := fs.String("catalog", "", "URL of the source catalog (overrides config)")
+	publicKey := fs.String("public-key", "", "Base64 Ed25519 key the catalog must be signed with (overrides config)")
+	timeout := fs.Duration("timeout", 15*time.Second, "Timeout for fetching the catalog and for checking each source")
+	dryRun := fs.Bool("dry-run", false, "Show what would be added without changing the config file")
+	parseFlags(fs, args)
+
+	config := loadConfiguration(*configPath)
+	if config.Catalog != nil {
+		if *catalogURL == "" {
+			*catalogURL = config.Catalog.URL
+		}
+		if *publicKey == "" {
+			*publicKey = config.Catalog.PublicKey
+		}
+	}
+	if *catalogURL == "" && *publicKey == "" {
+		*catalogURL, *publicKey = catalog.DefaultURL, catalog.DefaultPublicKey
+	}
+	if *catalogURL == "" || *publicKey == "" {
+		fmt.Fprintln(os.Stderr, "A catalog other than the default needs both catalog.url and catalog.public_key in the config, or -catalog and -public-key")
+		return 2
+	}
+	key, err := catalog.ParsePublicKey(*publicKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	path := resolveConfigPath(*configPath)
+	if !*dryRun && path == "" {
+		fmt.Fprintln(os.Stderr, "sources update needs a configuration file to write to, or -dry-run")
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	fetched, err := catalog.Fetch(ctx, &http.Client{}, *catalogURL, key)
+	cancel()
+	if errors.Is(err, catalog.ErrBadSignature) {
+		fmt.Fprintf(os.Stderr, "Refusing the catalog at %s: %v\n", *catalogURL, err)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to fetch the catalog: %v\n", err)
+		return 1
+	}
+	seenPath, err := catalog.DefaultSeenPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot check the catalog against the last one accepted: %v\n", err)
+		return 1
+	}
+	seen, err := catalog.LoadSeen(seenPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot check the catalog against the last one accepted: %v\n", err)
+		return 1
+	}
+	if err := seen.Check(fetched, key); err != nil {
+		fmt.Fprintf(os.Stderr, "Refusing the catalog at %s: %v\n", *catalogURL, err)
+		return 1
+	}
+	if !*dryRun {
+		seen.Accept(fetched, key)
+		if err := seen.Save(seenPath); err != nil {
+			logger.Warn("not remembering the catalog accepted", "path", seenPath, "error", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Catalog of %s lists %d sources\n", fetched.Updated.Format(time.DateOnly), len(fetched.Sources))
+
+	known := make(map[string]bool)
+	for _, source := range config.DataSources {
+		known[source.URL] = true
+	}
+	var candidates []configs.Source
+	for _, entry := range fetched.Sources {
+		if !known[entry.URL] {
+			known[entry.URL] = true
+			candidates = append(candidates, configs.Source{URL: entry.URL})
+		}
+	}
+	if len(candidates) == 0 {
+		fmt.Println("The config already lists every source in the catalog")
+		return 0
+	}
+
+	dataConsumer, err := consumer.NewConsumer(consumer.WithConfig(config))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize consumer: %v\n", err)
+		return 1
+	}
+	checks := checkAll(dataConsumer, candidates, *timeout)
+	var added []configs.Source
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULT\tURL\tSIZE\tNOTE")
+	for i, check := range checks {
+		result, size := "ADD", "-"
+		if !check.OK() {
+			result = "FAIL"
+		} else {
+			added = append(added, candidates[i])
+		}
+		if check.Size >= 0 {
+			size = configs.Size(check.Size).String()
+		}
+		note := check.Error
+		if note == "" {
+			note = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result, check.URL, size, note)
+	}
+	tw.Flush()
+
+	switch {
+	case len(added) == 0:
+		fmt.Println("None of the new sources in the catalog is working")
+		return 0
+	case *dryRun:
+		fmt.Printf("Would add %d sources\n", len(added))
+		return 0
+	}
+	if err := configs.AddSources(path, config.DataSources, added); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to update %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Printf("Added %d sources to %s (original kept as %s.bak)\n", len(added), path, path)
+	return 0
+}
+
+// checkAll checks every source at once.
+func checkAll(dataConsumer *consumer.Consumer, sources []configs.Source, timeout time.Duration) []consumer.SourceCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	checks := make([]consumer.SourceCheck, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source configs.Source) {
+			defer wg.Done()
+			checks[i] = dataConsumer.Check(ctx, source)
+		}(i, source)
+	}
+	wg.Wait()
+	return checks
+}
+
+// runSourcesSignCatalog signs a catalog for publishing, or generates the
+// key pair to sign with.
+func runSourcesSignCatalog(args []string) int {
+	fs := flag.NewFlagSet("sources sign-catalog", flag.ExitOnError)
+	keyFile := fs.String("key", "", "File holding the base64 Ed25519 private key")
+	generate := fs.Bool("generate-key", false, "Write a new private key to -key and print its public key")
+	parseFlags(fs, args)
+	if *keyFile == "" {
+		fmt.Fprintln(os.Stderr, "usage: dataconsumer sources sign-catalog -key file [-generate-key | catalog.json]")
+		return 2
+	}
+
+	if *generate {
+		public, private, err := catalog.GenerateKey()
+		if err == nil {
+			err = os.WriteFile(*keyFile, []byte(private+"\n"), 0600)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to generate a key: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Private key written to %s. Public key:\n%s\n", *keyFile, public)
+		return 0
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: dataconsumer sources sign-catalog -key file [-generate-key | catalog.json]")
+		return 2
+	}
+	encoded, err := os.ReadFile(*keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	key, err := catalog.ParsePrivateKey(string(encoded))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	path := fs.Arg(0)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if _, err := catalog.Verify(data, catalog.Sign(data, key), key.Public().(ed25519.PublicKey)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := os.WriteFile(path+".sig", catalog.Sign(data, key), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Signature written to %s.sig\n", path)
+	return 0
+}
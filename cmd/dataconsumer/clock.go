@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"dataconsumer/internal/systemd"
+)
+
+// clockFlag is a point in time given as a time of day ("23:00",
+// "23:00:30"), meaning its next occurrence, or as a date and time
+// ("2025-07-01T06:00", RFC 3339).
+type clockFlag struct {
+	value string
+	// daily is set for a time of day, of which at holds only the clock.
+	daily bool
+	at    time.Time
+}
+
+var (
+	timeOfDayLayouts = []string{"15:04", "15:04:05"}
+	dateTimeLayouts  = []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02 15:04:05"}
+)
+
+func (f *clockFlag) String() string {
+	return f.value
+}
+
+func (f *clockFlag) Set(value string) error {
+	for _, layout := range timeOfDayLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			*f = clockFlag{value: value, daily: true, at: t}
+			return nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		*f = clockFlag{value: value, at: t}
+		return nil
+	}
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			*f = clockFlag{value: value, at: t}
+			return nil
+		}
+	}
+	return fmt.Errorf("expected a time like 23:00 or 2025-07-01T06:00")
+}
+
+func (f *clockFlag) isSet() bool {
+	return f.value != ""
+}
+
+// after returns the point in time the flag names, taking a time of day to
+// mean its first occurrence after from.
+func (f *clockFlag) after(from time.Time) time.Time {
+	if !f.daily {
+		return f.at
+	}
+	year, month, day := from.Date()
+	hour, min, sec := f.at.Clock()
+	t := time.Date(year, month, day, hour, min, sec, 0, from.Location())
+	if !t.After(from) {
+		t = time.Date(year, month, day+1, hour, min, sec, 0, from.Location())
+	}
+	return t
+}
+
+// runWindow returns when a run starts, after -start-at if it is set, and
+// when -until ends it, or the zero time without -until.
+func runWindow(startAt, until clockFlag) (start, end time.Time, err error) {
+	start = time.Now()
+	if startAt.isSet() {
+		start = startAt.after(start)
+	}
+	if until.isSet() {
+		end = until.after(start)
+		if !end.After(start) {
+			return start, end, fmt.Errorf("-until %s is not after the start of the run", until.value)
+		}
+	}
+	return start, end, nil
+}
+
+// waitUntil blocks until at, returning false if a signal arrives first.
+func waitUntil(at time.Time, sigChan <-chan os.Signal) bool {
+	wait := time.Until(at)
+	if wait <= 0 {
+		return true
+	}
+	fmt.Printf("Waiting until %s to start\n", at.Format(time.RFC1123))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-sigChan:
+		systemd.Notify(systemd.Stopping)
+		fmt.Println("\nReceived interrupt while waiting, exiting")
+		return false
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"dataconsumer/pkg/metrics"
+)
+
+// exitRegression is the exit status of metrics compare when the second
+// run regressed beyond a threshold.
+const exitRegression = 3
+
+// compareThresholds are the regressions metrics compare tolerates.
+// Negative values disable a check.
+type compareThresholds struct {
+	// avgDrop, peakDrop and sourceDrop are relative drops in percent.
+	avgDrop    float64
+	peakDrop   float64
+	sourceDrop float64
+	// errorRise is the rise of the error rate in percentage points.
+	errorRise float64
+}
+
+func runMetricsCompare(args []string) int {
+	fs := flag.NewFlagSet("metrics compare", flag.ExitOnError)
+	var t compareThresholds
+	fs.Float64Var(&t.avgDrop, "max-avg-drop", 5, "Regression if the average rate drops by more than this percentage (negative disables)")
+	fs.Float64Var(&t.peakDrop, "max-peak-drop", 10, "Regression if the peak rate drops by more than this percentage (negative disables)")
+	fs.Float64Var(&t.errorRise, "max-error-rise", 1, "Regression if the error rate rises by more than this many percentage points (negative disables)")
+	fs.Float64Var(&t.sourceDrop, "max-source-drop", -1, "Regression if any source's rate drops by more than this percentage (negative disables)")
+	parseFlags(fs, args)
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: dataconsumer metrics compare [flags] <before> <after>")
+		return 2
+	}
+
+	before, err := metrics.LoadStatsFromFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load metrics: %v\n", err)
+		return 1
+	}
+	after, err := metrics.LoadStatsFromFile(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load metrics: %v\n", err)
+		return 1
+	}
+	regressions := compareRuns(os.Stdout, before, after, t)
+	if len(regressions) > 0 {
+		fmt.Println()
+		for _, r := range regressions {
+			fmt.Println("REGRESSION: " + r)
+		}
+		return exitRegression
+	}
+	fmt.Println("\nNo regressions.")
+	return 0
+}
+
+// compareRuns prints before and after side by side and returns the
+// regressions beyond the thresholds.
+func compareRuns(w io.Writer, before, after metrics.Stats, t compareThresholds) []string {
+	var regressions []string
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tBEFORE\tAFTER\tCHANGE")
+
+	rate := func(name string, b, a, threshold float64) {
+		change := relativeChange(b, a)
+		fmt.Fprintf(tw, "%s\t%.2f MB/min\t%.2f MB/min\t%s\n", name, b, a, formatChange(change))
+		if threshold >= 0 && b > 0 && -change > threshold {
+			regressions = append(regressions, fmt.Sprintf("%s dropped by %.1f%% (limit %g%%)", name, -change, threshold))
+		}
+	}
+	rate("Average rate", before.AverageRate, after.AverageRate, t.avgDrop)
+	rate("Peak rate", before.PeakRate, after.PeakRate, t.peakDrop)
+
+	b, bOK := before.Attainment()
+	a, aOK := after.Attainment()
+	fmt.Fprintf(tw, "Attainment\t%s\t%s\t%s\n", formatPercent(b, bOK), formatPercent(a, aOK), formatPoints(a-b, aOK && bOK))
+
+	b, bOK = before.ErrorRate()
+	a, aOK = after.ErrorRate()
+	fmt.Fprintf(tw, "Error rate\t%s\t%s\t%s\n", formatPercent(b, bOK), formatPercent(a, aOK), formatPoints(a-b, aOK && bOK))
+	if t.errorRise >= 0 && aOK && bOK && a-b > t.errorRise {
+		regressions = append(regressions, fmt.Sprintf("Error rate rose by %.2f points (limit %g)", a-b, t.errorRise))
+	}
+
+	fmt.Fprintf(tw, "Data\t%.2f MB\t%.2f MB\t\n", before.TotalMegabytes, after.TotalMegabytes)
+	fmt.Fprintf(tw, "Duration\t%s\t%s\t\n", before.ElapsedTime.Round(time.Second), after.ElapsedTime.Round(time.Second))
+	tw.Flush()
+
+	if len(before.Sources) == 0 && len(after.Sources) == 0 {
+		return regressions
+	}
+	fmt.Fprintln(w, "\nPer source:")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "URL\tBEFORE\tAFTER\tCHANGE\tERRORS BEFORE\tERRORS AFTER")
+	for _, url := range sourceURLsOf(before, after) {
+		bs, bFound := findSource(before, url)
+		as, aFound := findSource(after, url)
+		bRate, aRate := sourceRate(bs, before), sourceRate(as, after)
+		change := "-"
+		if bFound && aFound {
+			change = formatChange(relativeChange(bRate, aRate))
+			if d := -relativeChange(bRate, aRate); t.sourceDrop >= 0 && bRate > 0 && d > t.sourceDrop {
+				regressions = append(regressions, fmt.Sprintf("%s dropped by %.1f%% (limit %g%%)", url, d, t.sourceDrop))
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", url,
+			formatSourceRate(bRate, bFound), formatSourceRate(aRate, aFound), change,
+			formatSourceErrors(bs, bFound), formatSourceErrors(as, aFound))
+	}
+	tw.Flush()
+	return regressions
+}
+
+// relativeChange returns the change from b to a in percent.
+func relativeChange(b, a float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return (a - b) / b * 100
+}
+
+func formatChange(change float64) string {
+	return fmt.Sprintf("%+.1f%%", change)
+}
+
+func formatPercent(value float64, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", value)
+}
+
+func formatPoints(value float64, ok bool) string {
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%+.2f pts", value)
+}
+
+// sourceURLsOf returns the sources of both runs, those of before first.
+func sourceURLsOf(before, after metrics.Stats) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, stats := range []metrics.Stats{before, after} {
+		for _, source := range stats.Sources {
+			if !seen[source.URL] {
+				seen[source.URL] = true
+				urls = append(urls, source.URL)
+			}
+		}
+	}
+	return urls
+}
+
+func findSource(stats metrics.Stats, url string) (metrics.SourceStats, bool) {
+	for _, source := range stats.Sources {
+		if source.URL == url {
+			return source, true
+		}
+	}
+	return metrics.SourceStats{}, false
+}
+
+// sourceRate returns a source's average rate over the run in MB/min.
+func sourceRate(source metrics.SourceStats, run metrics.Stats) float64 {
+	if run.ElapsedTime <= 0 {
+		return 0
+	}
+	return float64(source.BytesTransferred) / 1024 / 1024 / run.ElapsedTime.Minutes()
+}
+
+func formatSourceRate(rate float64, found bool) string {
+	if !found {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f MB/min", rate)
+}
+
+func formatSourceErrors(source metrics.SourceStats, found bool) string {
+	if !found || source.Requests == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d (%.1f%%)", source.Failures, source.Requests, float64(source.Failures)/float64(source.Requests)*100)
+}
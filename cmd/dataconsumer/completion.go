@@ -0,0 +1,313 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const completionUsage = `usage: dataconsumer completion bash|zsh|fish|powershell
+
+Prints a completion script for the shell. To enable it:
+  bash:        source <(dataconsumer completion bash)
+  zsh:         dataconsumer completion zsh > "${fpath[1]}/_dataconsumer"
+  fish:        dataconsumer completion fish > ~/.config/fish/completions/dataconsumer.fish
+  powershell:  dataconsumer completion powershell | Out-String | Invoke-Expression`
+
+func runCompletionCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, completionUsage)
+		return 2
+	}
+	specs := describeCommands()
+	switch args[0] {
+	case "bash":
+		writeBashCompletion(os.Stdout, specs)
+	case "zsh":
+		writeZshCompletion(os.Stdout, specs)
+	case "fish":
+		writeFishCompletion(os.Stdout, specs)
+	case "powershell":
+		writePowerShellCompletion(os.Stdout, specs)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown shell %q\n\n%s\n", args[0], completionUsage)
+		return 2
+	}
+	return 0
+}
+
+// topLevel returns the specs of the commands themselves, leaving out
+// subcommands.
+func topLevel(specs []commandSpec) []commandSpec {
+	var top []commandSpec
+	for _, spec := range specs {
+		if !strings.Contains(spec.name, " ") {
+			top = append(top, spec)
+		}
+	}
+	return top
+}
+
+func flagNames(flags []*flag.Flag) string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "-" + f.Name
+	}
+	return strings.Join(names, " ")
+}
+
+func writeBashCompletion(w io.Writer, specs []commandSpec) {
+	var names, valueFlags []string
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		for _, f := range spec.flags {
+			if takesValue(f) && !seen[f.Name] {
+				seen[f.Name] = true
+				valueFlags = append(valueFlags, "-"+f.Name)
+			}
+		}
+	}
+	for _, spec := range topLevel(specs) {
+		names = append(names, spec.name)
+	}
+
+	fmt.Fprintln(w, `# bash completion for dataconsumer, generated by "dataconsumer completion bash".`)
+	fmt.Fprintln(w, `_dataconsumer() {`)
+	fmt.Fprintln(w, `	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}`)
+	fmt.Fprintln(w, `	local commands="`+strings.Join(names, " ")+`"`)
+	fmt.Fprintln(w, `	case " `+strings.Join(valueFlags, " ")+` " in`)
+	fmt.Fprintln(w, `	*" $prev "*) return ;;`)
+	fmt.Fprintln(w, `	esac`)
+	fmt.Fprintln(w, `	local cmd= sub= word i`)
+	fmt.Fprintln(w, `	for ((i = 1; i < COMP_CWORD; i++)); do`)
+	fmt.Fprintln(w, `		word=${COMP_WORDS[i]}`)
+	fmt.Fprintln(w, `		if [[ -z $cmd && " $commands " == *" $word "* ]]; then`)
+	fmt.Fprintln(w, `			cmd=$word`)
+	fmt.Fprintln(w, `		elif [[ -n $cmd && -z $sub && $word != -* ]]; then`)
+	fmt.Fprintln(w, `			sub=$word`)
+	fmt.Fprintln(w, `		fi`)
+	fmt.Fprintln(w, `	done`)
+	fmt.Fprintln(w, `	if [[ -z $cmd && $cur != -* ]]; then`)
+	fmt.Fprintln(w, `		COMPREPLY=($(compgen -W "$commands" -- "$cur"))`)
+	fmt.Fprintln(w, `		return`)
+	fmt.Fprintln(w, `	fi`)
+	fmt.Fprintln(w, `	local flags= subs=`)
+	fmt.Fprintln(w, `	case ${cmd:-run} in`)
+	for _, spec := range topLevel(specs) {
+		fmt.Fprintf(w, "\t%s)\n", spec.name)
+		fmt.Fprintf(w, "\t\tflags=%q\n", flagNames(spec.flags))
+		if len(spec.subcommands) > 0 {
+			fmt.Fprintf(w, "\t\tsubs=%q\n", strings.Join(spec.subcommands, " "))
+		}
+		var cases []string
+		for _, sub := range specs {
+			if name, ok := strings.CutPrefix(sub.name, spec.name+" "); ok {
+				cases = append(cases, fmt.Sprintf("\t\t%s) flags=%q ;;\n", name, flagNames(sub.flags)))
+			}
+		}
+		if len(cases) > 0 {
+			fmt.Fprintln(w, "\t\tcase $sub in")
+			fmt.Fprint(w, strings.Join(cases, ""))
+			fmt.Fprintln(w, "\t\tesac")
+		}
+		fmt.Fprintln(w, "\t\t;;")
+	}
+	fmt.Fprintln(w, `	esac`)
+	fmt.Fprintln(w, `	if [[ $cur == -* ]]; then`)
+	fmt.Fprintln(w, `		COMPREPLY=($(compgen -W "$flags" -- "$cur"))`)
+	fmt.Fprintln(w, `	elif [[ -z $sub ]]; then`)
+	fmt.Fprintln(w, `		COMPREPLY=($(compgen -W "$subs" -- "$cur"))`)
+	fmt.Fprintln(w, `	fi`)
+	fmt.Fprintln(w, `}`)
+	fmt.Fprintln(w, `complete -o default -F _dataconsumer dataconsumer`)
+}
+
+// zshQuote quotes s as a single-quoted zsh word.
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func zshArguments(w io.Writer, flags []*flag.Flag) {
+	// Brackets and colons in descriptions would end them early.
+	escape := strings.NewReplacer(`[`, `\[`, `]`, `\]`, `:`, `\:`)
+	fmt.Fprint(w, "_arguments -s")
+	for _, f := range flags {
+		arg, usage := flag.UnquoteUsage(f)
+		spec := "-" + f.Name + "[" + escape.Replace(usage) + "]"
+		switch {
+		case arg == "string":
+			spec += ":" + arg + ":_files"
+		case takesValue(f):
+			spec += ":" + arg + ":"
+		}
+		fmt.Fprintf(w, " \\\n\t\t\t%s", zshQuote(spec))
+	}
+	fmt.Fprintln(w, ` \`)
+	fmt.Fprintln(w, "\t\t\t'*:file:_files' ;;")
+}
+
+func writeZshCompletion(w io.Writer, specs []commandSpec) {
+	fmt.Fprintln(w, `#compdef dataconsumer`)
+	fmt.Fprintln(w, `# zsh completion for dataconsumer, generated by "dataconsumer completion zsh".`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `_dataconsumer() {`)
+	fmt.Fprintln(w, `	local -a commands subs`)
+	fmt.Fprintln(w, `	commands=(`)
+	for _, spec := range topLevel(specs) {
+		fmt.Fprintf(w, "\t\t%s\n", zshQuote(spec.name+":"+spec.summary))
+	}
+	fmt.Fprintln(w, `	)`)
+	fmt.Fprintln(w, `	local cmd=run`)
+	fmt.Fprintln(w, `	if [[ ${words[2]} != -* ]]; then`)
+	fmt.Fprintln(w, `		if (( CURRENT == 2 )); then`)
+	fmt.Fprintln(w, `			_describe -t commands 'dataconsumer command' commands`)
+	fmt.Fprintln(w, `			return`)
+	fmt.Fprintln(w, `		fi`)
+	fmt.Fprintln(w, `		cmd=${words[2]}`)
+	fmt.Fprintln(w, `		shift words`)
+	fmt.Fprintln(w, `		(( CURRENT-- ))`)
+	fmt.Fprintln(w, `	fi`)
+	fmt.Fprintln(w, `	case $cmd in`)
+	for _, spec := range topLevel(specs) {
+		if len(spec.subcommands) > 0 {
+			fmt.Fprintf(w, "\t%s) subs=(%s) ;;\n", spec.name, strings.Join(spec.subcommands, " "))
+		}
+	}
+	fmt.Fprintln(w, `	esac`)
+	fmt.Fprintln(w, `	if (( ${#subs} )); then`)
+	fmt.Fprintln(w, `		if (( CURRENT == 2 )) && [[ $PREFIX != -* ]]; then`)
+	fmt.Fprintln(w, `			compadd -- $subs`)
+	fmt.Fprintln(w, `			return`)
+	fmt.Fprintln(w, `		fi`)
+	fmt.Fprintln(w, `		if (( ${subs[(I)${words[2]}]} )); then`)
+	fmt.Fprintln(w, `			cmd="$cmd ${words[2]}"`)
+	fmt.Fprintln(w, `			shift words`)
+	fmt.Fprintln(w, `			(( CURRENT-- ))`)
+	fmt.Fprintln(w, `		fi`)
+	fmt.Fprintln(w, `	fi`)
+	fmt.Fprintln(w, `	case $cmd in`)
+	for _, spec := range specs {
+		if len(spec.flags) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\t%s)\n\t\t", zshQuote(spec.name))
+		zshArguments(w, spec.flags)
+	}
+	fmt.Fprintln(w, `	*) _files ;;`)
+	fmt.Fprintln(w, `	esac`)
+	fmt.Fprintln(w, `}`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `_dataconsumer "$@"`)
+}
+
+// fishQuote quotes s as a single-quoted fish string.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func writeFishCompletion(w io.Writer, specs []commandSpec) {
+	top := topLevel(specs)
+	var names []string
+	for _, spec := range top {
+		names = append(names, spec.name)
+	}
+	fmt.Fprintln(w, `# fish completion for dataconsumer, generated by "dataconsumer completion fish".`)
+	for _, spec := range top {
+		fmt.Fprintf(w, "complete -c dataconsumer -n __fish_use_subcommand -f -a %s -d %s\n", spec.name, fishQuote(spec.summary))
+	}
+	fishFlags := func(condition string, flags []*flag.Flag) {
+		for _, f := range flags {
+			_, usage := flag.UnquoteUsage(f)
+			option := "-o " + f.Name
+			if takesValue(f) {
+				option += " -r"
+			}
+			fmt.Fprintf(w, "complete -c dataconsumer -n %s %s -d %s\n", fishQuote(condition), option, fishQuote(usage))
+		}
+	}
+	// Without a command, the flags are those of run.
+	fishFlags("__fish_use_subcommand", findSpec(specs, "run").flags)
+	for _, spec := range specs {
+		cmd, sub, isSub := strings.Cut(spec.name, " ")
+		condition := "__fish_seen_subcommand_from " + cmd
+		if isSub {
+			condition += "; and __fish_seen_subcommand_from " + sub
+		} else if len(spec.subcommands) > 0 {
+			subs := strings.Join(spec.subcommands, " ")
+			fmt.Fprintf(w, "complete -c dataconsumer -n %s -f -a %s\n",
+				fishQuote(condition+"; and not __fish_seen_subcommand_from "+subs), fishQuote(subs))
+		}
+		fishFlags(condition, spec.flags)
+	}
+}
+
+// psQuote quotes s as a single-quoted PowerShell string.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func writePowerShellCompletion(w io.Writer, specs []commandSpec) {
+	fmt.Fprintln(w, `# PowerShell completion for dataconsumer, generated by "dataconsumer completion powershell".`)
+	fmt.Fprintln(w, `Register-ArgumentCompleter -Native -CommandName dataconsumer, dataconsumer.exe -ScriptBlock {`)
+	fmt.Fprintln(w, `	param($wordToComplete, $commandAst, $cursorPosition)`)
+	fmt.Fprintln(w, `	$commands = [ordered]@{`)
+	for _, spec := range topLevel(specs) {
+		fmt.Fprintf(w, "\t\t%s = %s\n", psQuote(spec.name), psQuote(spec.summary))
+	}
+	fmt.Fprintln(w, `	}`)
+	fmt.Fprintln(w, `	$subcommands = @{`)
+	for _, spec := range topLevel(specs) {
+		if len(spec.subcommands) > 0 {
+			quoted := make([]string, len(spec.subcommands))
+			for i, sub := range spec.subcommands {
+				quoted[i] = psQuote(sub)
+			}
+			fmt.Fprintf(w, "\t\t%s = @(%s)\n", psQuote(spec.name), strings.Join(quoted, ", "))
+		}
+	}
+	fmt.Fprintln(w, `	}`)
+	fmt.Fprintln(w, `	$flags = @{`)
+	for _, spec := range specs {
+		if len(spec.flags) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\t\t%s = [ordered]@{\n", psQuote(spec.name))
+		for _, f := range spec.flags {
+			_, usage := flag.UnquoteUsage(f)
+			fmt.Fprintf(w, "\t\t\t%s = %s\n", psQuote("-"+f.Name), psQuote(usage))
+		}
+		fmt.Fprintln(w, "\t\t}")
+	}
+	fmt.Fprintln(w, `	}`)
+	fmt.Fprint(w, `	$words = @($commandAst.CommandElements | Select-Object -Skip 1 |
+		Where-Object { $_.Extent.EndOffset -lt $cursorPosition } | ForEach-Object { $_.ToString() })
+	$positional = @($words | Where-Object { $_ -notlike '-*' })
+	$cmd = 'run'
+	if ($positional.Count -gt 0 -and $commands.Contains($positional[0])) {
+		$cmd = $positional[0]
+		$subs = $subcommands[$cmd]
+		if ($subs -and $positional.Count -gt 1 -and $subs -contains $positional[1]) {
+			$cmd = "$cmd $($positional[1])"
+		} elseif ($subs -and $positional.Count -eq 1 -and $wordToComplete -notlike '-*') {
+			$subs | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+				[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+			}
+			return
+		}
+	} elseif ($positional.Count -eq 0 -and $wordToComplete -notlike '-*') {
+		$commands.Keys | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+			[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $commands[$_])
+		}
+		return
+	}
+	$options = $flags[$cmd]
+	if ($options) {
+		$options.Keys | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+			[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterName', $options[$_])
+		}
+	}
+}
+`)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"dataconsumer/configs"
+)
+
+const configUsage = `usage: dataconsumer config <command>
+
+commands:
+  dump-default [-format json|yaml]               print the built-in defaults
+  show [-config file] [-format json|yaml]        print the config file after includes and migrations
+  migrate <file>...                              rewrite files in the current schema
+  path                                           print the default config file location
+
+concurrency_factor defaults to the number of CPUs of the host. Settings
+taken from the environment, such as $DATACONSUMER_TOKEN, are not shown.`
+
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+	switch args[0] {
+	case "dump-default":
+		return runConfigDumpDefault(args[1:])
+	case "show":
+		return runConfigShow(args[1:])
+	case "migrate":
+		return runConfigMigrate(args[1:])
+	case "path":
+		return runConfigPath()
+	}
+	fmt.Fprintf(os.Stderr, "unknown config command %q\n", args[0])
+	return 2
+}
+
+func runConfigMigrate(paths []string) int {
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: dataconsumer config migrate <file>...")
+		return 2
+	}
+	status := 0
+	for _, path := range paths {
+		changed, err := configs.MigrateFile(path)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			status = 1
+		case changed:
+			fmt.Printf("%s: migrated to version %d (original saved as %s.bak)\n", path, configs.CurrentVersion, path)
+		default:
+			fmt.Printf("%s: already at version %d\n", path, configs.CurrentVersion)
+		}
+	}
+	return status
+}
+
+func runConfigDumpDefault(args []string) int {
+	fs := flag.NewFlagSet("config dump-default", flag.ExitOnError)
+	format := fs.String("format", "json", "Output format: json or yaml")
+	parseFlags(fs, args)
+	// The only default that differs from host to host.
+	fmt.Fprintf(os.Stderr, "concurrency_factor defaults to the number of CPUs, %d on this host\n", runtime.NumCPU())
+	return printConfig(configs.DefaultConfig(), *format)
+}
+
+func runConfigShow(args []string) int {
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to configuration file")
+	format := fs.String("format", "json", "Output format: json or yaml")
+	parseFlags(fs, args)
+	return printConfig(loadConfiguration(*configPath), *format)
+}
+
+func printConfig(config *configs.Config, format string) int {
+	var data []byte
+	var err error
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(config, "", "  ")
+		data = append(data, '\n')
+	case "yaml":
+		data, err = marshalYAML(config)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q (want json or yaml)\n", format)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode config: %v\n", err)
+		return 1
+	}
+	os.Stdout.Write(data)
+	return 0
+}
+
+func runConfigPath() int {
+	path, err := configs.DefaultConfigPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot determine config directory: %v\n", err)
+		return 1
+	}
+	if _, err := os.Stat(path); err != nil {
+		fmt.Printf("%s (not found)\n", path)
+		return 0
+	}
+	fmt.Println(path)
+	return 0
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/control"
+	"dataconsumer/internal/jobs"
+	"dataconsumer/internal/scheduler"
+	"dataconsumer/pkg/consumer"
+	"dataconsumer/pkg/metrics"
+)
+
+var errNoSession = control.Conflict("no consumption session is running")
+
+// sessionController exposes whichever session is currently running to the
+// control socket and HTTP API.
+type sessionController struct {
+	mu        sync.Mutex
+	config    *configs.Config
+	consumer  *consumer.Consumer
+	collector *metrics.Collector
+	// stop ends the current session; start asks an idle daemon to begin a
+	// new one and is nil when sessions cannot be started on request.
+	stop  chan struct{}
+	start chan struct{}
+	// reschedule is signalled when the schedules change; it is nil unless
+	// the process runs schedules.
+	reschedule chan struct{}
+	// events are streamed by the HTTP API's /events endpoint.
+	events control.Broadcaster
+	// jobs is the job queue; it is nil unless the daemon runs jobs.
+	jobs *jobs.Queue
+}
+
+func newSessionController(config *configs.Config, canStart bool) *sessionController {
+	controller := &sessionController{config: config, stop: make(chan struct{}, 1)}
+	if canStart {
+		controller.start = make(chan struct{}, 1)
+	}
+	if len(config.Schedules) > 0 {
+		controller.reschedule = make(chan struct{}, 1)
+	}
+	return controller
+}
+
+// snapshot returns a copy of the current configuration for a new session.
+func (s *sessionController) snapshot() *configs.Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config := *s.config
+	return &config
+}
+
+func (s *sessionController) attach(c *consumer.Consumer, m *metrics.Collector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case c != nil:
+		s.events.Publish("session_started", "target_rate", c.TargetRate())
+		go s.forwardEvents(c.Events())
+	case s.collector != nil:
+		stats := s.collector.GetStats()
+		s.events.Publish("session_ended", "bytes_transferred", stats.BytesTransferred, "average_rate", configs.RateFromMBPerMinute(stats.AverageRate))
+	}
+	s.consumer, s.collector = c, m
+	// Drop a stop request that arrived between sessions.
+	select {
+	case <-s.stop:
+	default:
+	}
+}
+
+// forwardEvents publishes the consumer's events that matter to API
+// clients until the consumer stops. Completed transfers are left out as
+// too frequent.
+func (s *sessionController) forwardEvents(events <-chan consumer.Event) {
+	for event := range events {
+		switch event.Type {
+		case consumer.SourceFailed:
+			s.events.Publish(string(event.Type), "url", event.Source, "error", event.Err.Error())
+		case consumer.RateTargetMissed:
+			s.events.Publish(string(event.Type), "rate", event.Rate, "target_rate", event.TargetRate)
+		case consumer.WorkersScaled:
+			s.events.Publish(string(event.Type), "workers", event.Workers)
+		case consumer.ClockStepped:
+			s.events.Publish(string(event.Type), "step", event.Duration.String())
+		case consumer.SourceDraining:
+			s.events.Publish(string(event.Type), "url", event.Source, "requests", event.Requests)
+		case consumer.SourceDrained:
+			detail := []any{"url", event.Source, "requests", event.Requests, "bytes", event.Bytes, "duration", event.Duration.Round(time.Millisecond).String()}
+			if event.Err != nil {
+				detail = append(detail, "error", event.Err.Error())
+			}
+			s.events.Publish(string(event.Type), detail...)
+		}
+	}
+}
+
+func (s *sessionController) detach() {
+	s.attach(nil, nil)
+}
+
+// Subscribe implements control.EventSource.
+func (s *sessionController) Subscribe() (<-chan control.Event, func()) {
+	return s.events.Subscribe()
+}
+
+func (s *sessionController) current() (*consumer.Consumer, *metrics.Collector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.consumer, s.collector
+}
+
+func (s *sessionController) Status() control.Status {
+	c, m := s.current()
+	if c == nil {
+		return control.Status{State: "idle"}
+	}
+	state := "running"
+	if c.Paused() {
+		state = "paused"
+	} else if _, walled := c.CaptivePortal(); walled {
+		state = "captive_portal"
+	} else if _, offline := c.Outage(); offline {
+		state = "waiting_for_connectivity"
+	}
+	memory := c.Memory()
+	return control.Status{State: state, RateLimit: c.RateLimit(), Stats: m.GetStats(), Memory: &memory}
+}
+
+// rateWarmup is how long a session runs before the rate readiness check
+// applies, so ramp-up doesn't report the instance as not ready.
+const rateWarmup = 30 * time.Second
+
+func (s *sessionController) Readiness() control.Readiness {
+	c, m := s.current()
+	if c == nil {
+		return control.Readiness{Checks: []control.Check{{Name: "consumer", Detail: "no session running"}}}
+	}
+
+	checks := []control.Check{{Name: "consumer", OK: !c.Paused(), Detail: "running"}}
+	if c.Paused() {
+		checks[0].Detail = "paused"
+	}
+
+	healthy, sources := 0, c.SourceHealth()
+	for _, source := range sources {
+		if source.Healthy {
+			healthy++
+		}
+	}
+	checks = append(checks, control.Check{
+		Name:   "sources",
+		OK:     healthy > 0,
+		Detail: fmt.Sprintf("%d of %d sources healthy", healthy, len(sources)),
+	})
+
+	if s.config.API != nil && s.config.API.ReadyRateTolerance > 0 {
+		stats := m.GetStats()
+		target := c.TargetRate().MBPerMinute()
+		minimum := target * (1 - s.config.API.ReadyRateTolerance/100)
+		check := control.Check{
+			Name:   "rate",
+			OK:     stats.ElapsedTime < rateWarmup || stats.CurrentRate >= minimum,
+			Detail: fmt.Sprintf("%.2f MB/min, target %.2f MB/min", stats.CurrentRate, target),
+		}
+		checks = append(checks, check)
+	}
+
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.OK
+	}
+	return control.Readiness{Ready: ready, Checks: checks}
+}
+
+func (s *sessionController) Start() error {
+	if c, _ := s.current(); c != nil {
+		return control.Conflict("a session is already running")
+	}
+	if s.start == nil {
+		return control.Conflict("sessions cannot be started on request in this mode")
+	}
+	select {
+	case s.start <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *sessionController) Pause() error {
+	c, _ := s.current()
+	if c == nil {
+		return errNoSession
+	}
+	c.Pause()
+	s.events.Publish("paused")
+	return nil
+}
+
+func (s *sessionController) Resume() error {
+	c, _ := s.current()
+	if c == nil {
+		return errNoSession
+	}
+	c.Resume()
+	s.events.Publish("resumed")
+	return nil
+}
+
+func (s *sessionController) SetRate(rate configs.Rate) error {
+	c, _ := s.current()
+	if c == nil {
+		return errNoSession
+	}
+	c.SetRateLimit(rate)
+	s.events.Publish("rate_changed", "rate_limit", rate)
+	return nil
+}
+
+func (s *sessionController) Stop() error {
+	if c, _ := s.current(); c == nil {
+		return errNoSession
+	}
+	select {
+	case s.stop <- struct{}{}:
+	default:
+	}
+	s.events.Publish("stop_requested")
+	return nil
+}
+
+func (s *sessionController) Sources() []configs.Source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.config.DataSources
+}
+
+func (s *sessionController) Settings() control.Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settingsLocked()
+}
+
+func (s *sessionController) settingsLocked() control.Settings {
+	return control.Settings{
+		TargetRate:   s.config.TargetRate,
+		MaxBandwidth: s.config.MaxBandwidth,
+		DataSources:  s.config.DataSources,
+		Schedules:    s.config.Schedules,
+	}
+}
+
+// UpdateSettings applies patch to the running session, if any, and to the
+// configuration of later sessions. Every changed setting is logged.
+func (s *sessionController) UpdateSettings(patch control.SettingsPatch, origin string) (control.Settings, error) {
+	if err := s.validatePatch(patch); err != nil {
+		return control.Settings{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	audit := func(setting string, old, new any) {
+		logger.Info("setting changed", "setting", setting, "old", old, "new", new, "origin", origin)
+		s.events.Publish("setting_changed", "setting", setting, "old", old, "new", new)
+	}
+	c := s.consumer
+	if patch.DataSources != nil {
+		if c != nil {
+			if err := c.SetSources(patch.DataSources); err != nil {
+				return control.Settings{}, control.Invalid(err)
+			}
+		}
+		audit("data_sources", sourceURLs(s.config.DataSources), sourceURLs(patch.DataSources))
+		s.config.DataSources = patch.DataSources
+	}
+	if patch.TargetRate != nil {
+		audit("target_rate", s.config.TargetRate, *patch.TargetRate)
+		s.config.TargetRate = *patch.TargetRate
+		if c != nil {
+			c.SetTargetRate(*patch.TargetRate)
+		}
+	}
+	if patch.MaxBandwidth != nil {
+		audit("max_bandwidth", s.config.MaxBandwidth, *patch.MaxBandwidth)
+		s.config.MaxBandwidth = *patch.MaxBandwidth
+		if c != nil {
+			c.SetRateLimit(*patch.MaxBandwidth)
+		}
+	}
+	if patch.Schedules != nil {
+		audit("schedules", scheduleNames(s.config.Schedules), scheduleNames(patch.Schedules))
+		s.config.Schedules = patch.Schedules
+		select {
+		case s.reschedule <- struct{}{}:
+		default:
+		}
+	}
+	return s.settingsLocked(), nil
+}
+
+func (s *sessionController) validatePatch(patch control.SettingsPatch) error {
+	if patch.DataSources != nil {
+		if err := consumer.ValidateSources(patch.DataSources); err != nil {
+			return control.Invalid(err)
+		}
+	}
+	for _, rate := range []*configs.Rate{patch.TargetRate, patch.MaxBandwidth} {
+		if rate != nil && *rate < 0 {
+			return control.Invalid(errors.New("rates must not be negative"))
+		}
+	}
+	if patch.Schedules != nil {
+		if s.reschedule == nil {
+			return control.Conflict("schedules can only be changed when running with schedules")
+		}
+		if len(patch.Schedules) == 0 {
+			return control.Invalid(errors.New("at least one schedule is required"))
+		}
+		if _, err := scheduler.New(patch.Schedules); err != nil {
+			return control.Invalid(err)
+		}
+	}
+	return nil
+}
+
+func sourceURLs(sources []configs.Source) []string {
+	urls := make([]string, 0, len(sources))
+	for _, source := range sources {
+		urls = append(urls, source.URL)
+	}
+	return urls
+}
+
+func scheduleNames(schedules []configs.Schedule) []string {
+	names := make([]string, 0, len(schedules))
+	for _, schedule := range schedules {
+		names = append(names, schedule.Name)
+	}
+	return names
+}
+
+// serveAPI starts the HTTP and gRPC control APIs for the configured
+// addresses.
+func serveAPI(config *configs.Config, controller control.Controller) {
+	if config.API == nil {
+		return
+	}
+	security := apiSecurity(config.API)
+	if config.API.Listen != "" {
+		handler := security.Handler(control.NewHTTPHandler(controller), "/healthz", "/readyz")
+		server := &http.Server{Addr: config.API.Listen, Handler: handler}
+		go func() {
+			if err := security.ListenAndServe(server); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Warn("control API stopped", "error", err)
+			}
+		}()
+		logger.Info("control API listening", "url", security.Scheme()+"://"+config.API.Listen, "token", security.Token != "")
+	}
+	if config.API.GRPCListen != "" {
+		tlsConfig, err := security.TLSConfig(config.API.GRPCListen)
+		if err != nil {
+			logger.Warn("failed to start gRPC API", "error", err)
+			return
+		}
+		listener, err := net.Listen("tcp", config.API.GRPCListen)
+		if err != nil {
+			logger.Warn("failed to start gRPC API", "error", err)
+			return
+		}
+		go control.ServeGRPC(listener, controller, security.Token, tlsConfig)
+		logger.Info("gRPC API listening", "addr", config.API.GRPCListen, "tls", tlsConfig != nil, "token", security.Token != "")
+	}
+}
+
+// applyAPIFlags overrides the configured API addresses with the values of
+// the -api-addr and -grpc-addr flags.
+func applyAPIFlags(config *configs.Config, httpAddr, grpcAddr string) {
+	if httpAddr == "" && grpcAddr == "" {
+		return
+	}
+	api := configs.APIConfig{}
+	if config.API != nil {
+		api = *config.API
+	}
+	if httpAddr != "" {
+		api.Listen = httpAddr
+	}
+	if grpcAddr != "" {
+		api.GRPCListen = grpcAddr
+	}
+	config.API = &api
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+
+	"dataconsumer/configs"
+)
+
+// exitCriteriaNotMet is the exit status of a run that missed its success
+// criteria.
+const exitCriteriaNotMet = 3
+
+// applySuccessFlags merges the success criteria flags into the config.
+func applySuccessFlags(config *configs.Config, minAverageRate configs.Rate, maxErrorRate float64, requireTarget bool) {
+	if minAverageRate == 0 && maxErrorRate == 0 && !requireTarget {
+		return
+	}
+	if config.Success == nil {
+		config.Success = &configs.SuccessCriteria{}
+	}
+	if minAverageRate > 0 {
+		config.Success.MinAverageRate = minAverageRate
+	}
+	if maxErrorRate > 0 {
+		config.Success.MaxErrorRate = maxErrorRate
+	}
+	if requireTarget {
+		config.Success.RequireTarget = true
+	}
+}
+
+// checkSuccess reports whether the session met the criteria and returns
+// the process exit status. job names the config job the session ran for;
+// it is empty for a run's own session and for the jobs taken together.
+func checkSuccess(job string, criteria *configs.SuccessCriteria, result sessionResult) int {
+	if criteria == nil {
+		return 0
+	}
+	failures := unmetCriteria(criteria, result)
+	emitResult(job, failures)
+	label := "Success criteria"
+	if job != "" {
+		label = fmt.Sprintf("Job %s success criteria", job)
+	}
+	if len(failures) == 0 {
+		fmt.Printf("%s: PASSED\n", label)
+		return 0
+	}
+	fmt.Printf("%s: FAILED\n", label)
+	for _, failure := range failures {
+		fmt.Printf("  - %s\n", failure)
+	}
+	return exitCriteriaNotMet
+}
+
+// sessionStatus checks the session against the criteria and returns its
+// exit status, which is exitStopCondition if a stop condition ended it.
+func sessionStatus(job string, criteria *configs.SuccessCriteria, result sessionResult) int {
+	status := checkSuccess(job, criteria, result)
+	if result.stoppedByCondition() {
+		return exitStopCondition
+	}
+	return status
+}
+
+// firstFailure returns the first non-zero exit status, so that a run of
+// several sessions fails with the status of the first that failed.
+func firstFailure(statuses ...int) int {
+	for _, status := range statuses {
+		if status != 0 {
+			return status
+		}
+	}
+	return 0
+}
+
+func unmetCriteria(criteria *configs.SuccessCriteria, result sessionResult) []string {
+	var failures []string
+	if min := criteria.MinAverageRate; min > 0 {
+		if average := configs.RateFromMBPerMinute(result.stats.AverageRate); average < min {
+			failures = append(failures, fmt.Sprintf("average rate %s is below %s", average, min))
+		}
+	}
+	if criteria.MaxErrorRate > 0 {
+		var requests, failed int64
+		for _, h := range result.health {
+			requests += h.Successes + h.Failures
+			failed += h.Failures
+		}
+		if requests > 0 {
+			if errorRate := float64(failed) / float64(requests) * 100; errorRate > criteria.MaxErrorRate {
+				failures = append(failures, fmt.Sprintf("%.1f%% of requests failed, more than %g%%", errorRate, criteria.MaxErrorRate))
+			}
+		}
+	}
+	if criteria.RequireTarget && !result.reachedTarget() {
+		failures = append(failures, fmt.Sprintf("run ended by %s before reaching its duration or data cap", result.reason))
+	}
+	return failures
+}
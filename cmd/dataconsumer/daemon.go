@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/control"
+	"dataconsumer/internal/jobs"
+	"dataconsumer/internal/secure"
+	"dataconsumer/internal/systemd"
+)
+
+func runDaemonCommand(args []string) int {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	return runDaemon(args, sigChan)
+}
+
+// runDaemon runs the daemon until a value arrives on sigChan.
+func runDaemon(args []string, sigChan chan os.Signal) int {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to configuration file")
+	socketPath := fs.String("socket", control.DefaultSocketPath(), "Path of the control socket")
+	apiAddr := fs.String("api-addr", "", "Address for the HTTP control API (overrides config)")
+	grpcAddr := fs.String("grpc-addr", "", "Address for the gRPC control API (overrides config)")
+	outputMetrics := fs.String("metrics", "dataconsumer_metrics.json", "Path to save metrics")
+	saveInterval := fs.Int("save-interval", 60, "Save metrics every N seconds")
+	output := fs.String("output", "text", "Status output format: text, json for newline-delimited JSON on stdout, or speedtest or ookla for a result document in that tool's JSON format")
+	lockFile := fs.String("lock-file", "", "Refuse to run while another instance holds this lock file (overrides config)")
+	force := fs.Bool("force", false, "Run even if another instance holds the lock file")
+	jobsMode := fs.Bool("jobs", false, "Stay idle and run jobs submitted through the HTTP control API")
+	jobsFile := fs.String("jobs-file", "dataconsumer_jobs.json", "File keeping the job queue and results (empty keeps them in memory)")
+	verbosity := addVerbosityFlags(fs)
+	logOptions := addLogFlags(fs)
+	parseFlags(fs, args)
+	if err := setOutputFormat(*output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	config := loadConfiguration(*configPath)
+	if *jobsMode && len(config.Schedules) > 0 {
+		fmt.Fprintln(os.Stderr, "-jobs cannot be combined with schedules")
+		return 2
+	}
+	if *jobsMode && len(config.Jobs) > 0 {
+		fmt.Fprintln(os.Stderr, "-jobs cannot be combined with jobs in the config")
+		return 2
+	}
+	verbosity.apply(config)
+	closeLog, err := setupLogging(config, logOptions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer closeLog()
+	if *lockFile != "" {
+		config.LockFile = *lockFile
+	}
+	unlock, ok := acquireLock(config.LockFile, *force)
+	if !ok {
+		return 1
+	}
+	defer unlock()
+	config.MetricsFile = *outputMetrics
+	applyAPIFlags(config, *apiAddr, *grpcAddr)
+	if *jobsMode && (config.API == nil || config.API.Listen == "") {
+		fmt.Fprintln(os.Stderr, "-jobs needs the HTTP control API, set -api-addr")
+		return 2
+	}
+
+	listener, err := control.Listen(*socketPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open control socket: %v\n", err)
+		return 1
+	}
+	defer listener.Close()
+
+	controller := newSessionController(config, len(config.Schedules) == 0 && !*jobsMode)
+	if *jobsMode {
+		if controller.jobs, err = jobs.Open(*jobsFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load jobs: %v\n", err)
+			return 1
+		}
+	}
+	var api control.Controller = controller
+	var group *jobGroup
+	if len(config.Jobs) > 0 {
+		if group, err = newJobGroup(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid jobs: %v\n", err)
+			return 1
+		}
+		api = group
+	}
+	go control.Serve(listener, api)
+	logger.Info("control socket listening", "path", *socketPath)
+	serveAPI(config, api)
+	ready := announceReady()
+	defer close(ready)
+
+	opts := runOptions{
+		saveInterval: *saveInterval,
+		sigChan:      sigChan,
+		stop:         controller.stop,
+		headless:     true,
+		onStart:      controller.attach,
+		onEnd:        controller.detach,
+	}
+	if group != nil {
+		return group.run(opts)
+	}
+	if len(config.Schedules) > 0 {
+		return runSchedules(controller, opts)
+	}
+	if controller.jobs != nil {
+		runJobs(controller, opts)
+		return 0
+	}
+
+	// Without schedules the daemon starts consuming immediately; after a
+	// stop request it stays idle until asked to start again.
+	for {
+		if runSession(controller.snapshot(), opts).interrupted() {
+			return 0
+		}
+		logger.Info("session stopped, waiting for a start request")
+		select {
+		case <-controller.start:
+		case <-sigChan:
+			systemd.Notify(systemd.Stopping)
+			return 0
+		}
+	}
+}
+
+func runCtlCommand(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	socketPath := fs.String("socket", control.DefaultSocketPath(), "Path of the daemon's control socket")
+	grpcAddr := fs.String("grpc-addr", "", "Use the gRPC API at this address instead of the socket")
+	useTLS := fs.Bool("tls", false, "Connect to the gRPC API over TLS")
+	security := addClientSecurityFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dataconsumer ctl [-socket path | -grpc-addr host:port [-tls] [-token token]] status|start|pause|resume|set-rate <rate>|stop|watch")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	security.resolve()
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *grpcAddr != "" {
+		var tlsConfig *tls.Config
+		if *useTLS || security.caFile != "" {
+			var err error
+			if tlsConfig, err = secure.ClientTLSConfig(security.caFile); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to load CA file: %v\n", err)
+				return 1
+			}
+		}
+		return runCtlGRPC(*grpcAddr, security.token, tlsConfig, fs.Args())
+	}
+
+	req := control.Request{Command: fs.Arg(0)}
+	if req.Command == "set-rate" {
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return 2
+		}
+		req.Rate = fs.Arg(1)
+	}
+	resp, err := control.Send(*socketPath, req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", req.Command, err)
+		return 1
+	}
+	if resp.Status != nil {
+		printControlStatus(*resp.Status)
+	} else {
+		fmt.Println("ok")
+	}
+	return 0
+}
+
+func runCtlGRPC(addr, token string, tlsConfig *tls.Config, args []string) int {
+	client, err := control.DialGRPC(addr, token, tlsConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to %s: %v\n", addr, err)
+		return 1
+	}
+	defer client.Close()
+
+	if args[0] == "watch" {
+		return watchGRPC(client)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var status control.Status
+	switch args[0] {
+	case "status":
+		status, err = client.Status(ctx)
+	case "start":
+		status, err = client.Start(ctx)
+	case "stop":
+		status, err = client.Stop(ctx)
+	case "pause":
+		status, err = client.Pause(ctx)
+	case "resume":
+		status, err = client.Resume(ctx)
+	case "set-rate":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: dataconsumer ctl set-rate <rate>")
+			return 2
+		}
+		var rate configs.Rate
+		if err := rate.Set(args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		status, err = client.SetRate(ctx, rate)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown ctl command %q\n", args[0])
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", args[0], err)
+		return 1
+	}
+	printControlStatus(status)
+	return 0
+}
+
+func watchGRPC(client *control.GRPCClient) int {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	stream, err := client.WatchStats(ctx, 10*time.Second)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "watch failed: %v\n", err)
+		return 1
+	}
+	for {
+		status, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0
+			}
+			fmt.Fprintf(os.Stderr, "watch failed: %v\n", err)
+			return 1
+		}
+		printControlStatus(status)
+	}
+}
+
+func printControlStatus(status control.Status) {
+	fmt.Printf("State: %s\n", status.State)
+	if status.State == "idle" {
+		return
+	}
+	limit := "none"
+	if status.RateLimit > 0 {
+		limit = status.RateLimit.String()
+	}
+	stats := status.Stats
+	fmt.Printf("Rate limit: %s\n", limit)
+	if memory := status.Memory; memory != nil {
+		budget := "none"
+		if memory.Limit > 0 {
+			budget = fmt.Sprintf("%s (%d transfers)", configs.Size(memory.Limit), memory.MaxTransfers)
+		}
+		fmt.Printf("Memory: %s reserved by %d transfers, %s heap, budget %s\n",
+			configs.Size(memory.Reserved), memory.Transfers, configs.Size(memory.Heap), budget)
+	}
+	fmt.Printf("Data: %.2f MB | Rate: %.2f MB/min | Avg: %.2f MB/min | Peak: %.2f MB/min | Time: %s\n",
+		stats.TotalMegabytes, stats.CurrentRate, stats.AverageRate, stats.PeakRate, stats.ElapsedTime.Round(time.Second))
+}
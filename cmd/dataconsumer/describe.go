@@ -0,0 +1,123 @@
+package main
+
+import "flag"
+
+// subcommands lists the words each command accepts as its first
+// argument, for shell completion and the manual. Those marked with flags
+// define a flag set of their own.
+var subcommands = map[string][]subcommand{
+	"ctl":        {{name: "status"}, {name: "start"}, {name: "pause"}, {name: "resume"}, {name: "set-rate"}, {name: "stop"}, {name: "watch"}},
+	"service":    {{name: "install"}, {name: "uninstall"}, {name: "start"}, {name: "stop"}},
+	"sources":    {{"list", true}, {"bench", true}, {"validate", true}, {"update", true}, {"sign-catalog", true}},
+	"metrics":    {{"show", true}, {"export", true}, {"sessions", true}, {"compare", true}},
+	"config":     {{"dump-default", true}, {"show", true}, {name: "migrate"}, {name: "path"}},
+	"completion": {{name: "bash"}, {name: "zsh"}, {name: "fish"}, {name: "powershell"}},
+	"docs":       {{name: "man"}},
+	"schedule":   {{"show", true}},
+}
+
+// flagless lists the commands that define no flags themselves.
+var flagless = map[string]bool{
+	"service":    true,
+	"sources":    true,
+	"schedule":   true,
+	"metrics":    true,
+	"config":     true,
+	"completion": true,
+	"docs":       true,
+	"version":    true,
+	"help":       true,
+}
+
+type subcommand struct {
+	name  string
+	flags bool
+}
+
+// commandSpec describes a command, or a subcommand such as
+// "sources bench", with its flags.
+type commandSpec struct {
+	name        string
+	summary     string
+	flags       []*flag.Flag
+	subcommands []string
+}
+
+// describeCommands returns every command followed by its subcommands that
+// have flags.
+func describeCommands() []commandSpec {
+	var specs []commandSpec
+	for _, cmd := range commands {
+		spec := commandSpec{name: cmd.name, summary: cmd.summary}
+		if !flagless[cmd.name] {
+			spec.flags = describeFlags(cmd.run, nil)
+		}
+		for _, sub := range subcommands[cmd.name] {
+			spec.subcommands = append(spec.subcommands, sub.name)
+		}
+		specs = append(specs, spec)
+		for _, sub := range subcommands[cmd.name] {
+			if sub.flags {
+				specs = append(specs, commandSpec{
+					name:  cmd.name + " " + sub.name,
+					flags: describeFlags(cmd.run, []string{sub.name}),
+				})
+			}
+		}
+	}
+	return specs
+}
+
+// flagsDescribed carries a command's flag set out of parseFlags while the
+// command is being described.
+type flagsDescribed struct {
+	fs *flag.FlagSet
+}
+
+// describing is set while describeFlags runs a command.
+var describing bool
+
+// parseFlags parses a command's arguments. While describeFlags runs the
+// command, it stops the command instead, before it does anything.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	if describing {
+		panic(flagsDescribed{fs})
+	}
+	fs.Parse(args)
+}
+
+// describeFlags runs a command with args up to parseFlags and returns the
+// flags it defined, sorted by name.
+func describeFlags(run func([]string) int, args []string) (flags []*flag.Flag) {
+	describing = true
+	defer func() {
+		describing = false
+		r := recover()
+		d, ok := r.(flagsDescribed)
+		if !ok {
+			if r != nil {
+				panic(r)
+			}
+			return
+		}
+		d.fs.VisitAll(func(f *flag.Flag) { flags = append(flags, f) })
+	}()
+	run(args)
+	return nil
+}
+
+// takesValue reports whether a flag needs an argument.
+func takesValue(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
+// findSpec returns the spec with the given name.
+func findSpec(specs []commandSpec, name string) commandSpec {
+	for _, spec := range specs {
+		if spec.name == name {
+			return spec
+		}
+	}
+	return commandSpec{name: name}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/dnsload"
+)
+
+// startDNSLoad sends the configured DNS queries alongside the downloads.
+// The returned function stops them and reports their outcome.
+func startDNSLoad(config configs.DNSLoadConfig) func() {
+	load := dnsload.New(config)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		load.Run(ctx)
+	}()
+	logger.Info("sending DNS queries", "resolver", config.Resolver, "domain", config.Domain, "qps", config.QPS)
+	return func() {
+		cancel()
+		<-done
+		printDNSStats(load.Stats())
+	}
+}
+
+func printDNSStats(stats dnsload.Stats) {
+	logger.Info("DNS load finished", "sent", stats.Sent, "answered", stats.Answered, "not_found", stats.NotFound,
+		"failed", stats.Failed, "dropped", stats.Dropped, "latency", stats.Latency)
+	if machineOutput() {
+		return
+	}
+	fmt.Printf("DNS queries: %d sent at %.1f/s, %d answered, %d NXDOMAIN, %d failed, mean latency %s\n",
+		stats.Sent, stats.QPS(), stats.Answered, stats.NotFound, stats.Failed, stats.Latency.Round(time.Microsecond))
+	if stats.Dropped > 0 {
+		fmt.Printf("DNS queries dropped because too many awaited an answer: %d\n", stats.Dropped)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const docsUsage = `usage: dataconsumer docs man
+
+Prints the manual page in roff format, e.g.
+  dataconsumer docs man > dataconsumer.1`
+
+func runDocsCommand(args []string) int {
+	if len(args) != 1 || args[0] != "man" {
+		fmt.Fprintln(os.Stderr, docsUsage)
+		return 2
+	}
+	writeManPage(os.Stdout, describeCommands())
+	return 0
+}
+
+// roffEscape escapes backslashes and dashes, and keeps a leading period or
+// quote from being read as a request.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// isZeroDefault reports whether a flag's default is its type's zero
+// value, which the manual leaves out.
+func isZeroDefault(f *flag.Flag) bool {
+	switch f.DefValue {
+	case "", "0", "0s", "false", "-1":
+		return true
+	}
+	return false
+}
+
+func writeManPage(w io.Writer, specs []commandSpec) {
+	fmt.Fprintf(w, ".TH DATACONSUMER 1 \"\" \"dataconsumer %s\" \"User Commands\"\n", roffEscape(version))
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintln(w, `dataconsumer \- consume data from HTTP sources at a target rate`)
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintln(w, ".B dataconsumer")
+	fmt.Fprintln(w, `[\fIcommand\fR] [\fIflags\fR] [\fIarguments\fR]`)
+	fmt.Fprintln(w, ".SH DESCRIPTION")
+	fmt.Fprintln(w, "dataconsumer downloads from the configured data sources with many concurrent")
+	fmt.Fprintln(w, "workers and reports the rate it achieves. Without a command it behaves like")
+	fmt.Fprintln(w, ".BR run .")
+	fmt.Fprintln(w, ".SH COMMANDS")
+	for _, spec := range topLevel(specs) {
+		fmt.Fprintln(w, ".TP")
+		name := `\fB` + roffEscape(spec.name) + `\fR`
+		if len(spec.subcommands) > 0 {
+			name += ` \fI` + roffEscape(strings.Join(spec.subcommands, "|")) + `\fR`
+		}
+		fmt.Fprintln(w, name)
+		fmt.Fprintln(w, roffEscape(spec.summary))
+	}
+	fmt.Fprintln(w, ".SH OPTIONS")
+	for _, spec := range specs {
+		if len(spec.flags) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, ".SS %s\n", roffEscape(spec.name))
+		for _, f := range spec.flags {
+			arg, usage := flag.UnquoteUsage(f)
+			fmt.Fprintln(w, ".TP")
+			line := `\fB\-` + roffEscape(f.Name) + `\fR`
+			if arg != "" {
+				line += ` \fI` + roffEscape(arg) + `\fR`
+			}
+			fmt.Fprintln(w, line)
+			if !isZeroDefault(f) {
+				usage += fmt.Sprintf(" (default %s)", f.DefValue)
+			}
+			fmt.Fprintln(w, roffEscape(usage))
+		}
+	}
+	fmt.Fprintln(w, ".SH EXIT STATUS")
+	fmt.Fprintln(w, `0 on success, 1 on errors, 2 for invalid usage, 3 when the success criteria of`)
+	fmt.Fprintln(w, `\fBrun\fR are not met and 4 when a stop condition ended the run.`)
+	fmt.Fprintln(w, ".SH SEE ALSO")
+	fmt.Fprintln(w, `\fBdataconsumer completion\fR prints shell completion scripts.`)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/pac"
+	"dataconsumer/pkg/consumer"
+)
+
+const (
+	// clockSkewWarning and clockSkewFailure are the offsets from the
+	// servers' clocks at which doctor warns and fails; TLS certificate
+	// checks start failing at large offsets.
+	clockSkewWarning = 5 * time.Second
+	clockSkewFailure = 5 * time.Minute
+)
+
+// doctorReport prints check results and counts the failures.
+type doctorReport struct {
+	failed int
+}
+
+func (r *doctorReport) section(name string) {
+	fmt.Printf("\n%s\n", name)
+}
+
+func (r *doctorReport) result(result, subject, detail string) {
+	if result == "FAIL" {
+		r.failed++
+	}
+	fmt.Printf("  %-5s %s  %s\n", result, subject, detail)
+}
+
+func runDoctorCommand(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to configuration file")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for each network check")
+	duration := fs.Duration("duration", 5*time.Second, "How long to measure single-stream throughput")
+	parseFlags(fs, args)
+
+	config := loadConfiguration(*configPath)
+	dataConsumer, err := consumer.NewConsumer(consumer.WithConfig(config))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize consumer: %v\n", err)
+		return 1
+	}
+	var sources []configs.Source
+	for _, source := range config.DataSources {
+		if source.IsEnabled() {
+			sources = append(sources, source)
+		}
+	}
+
+	report := &doctorReport{}
+	fmt.Println("dataconsumer doctor")
+	checkDNS(report, sources, *timeout)
+	checkReachability(report, sources, *timeout)
+	checkProxy(report, config.Proxy, sources, *timeout)
+	passed, offsets := checkSources(report, dataConsumer, sources, *timeout)
+	checkThroughput(report, dataConsumer, passed, *duration)
+	checkClock(report, offsets)
+
+	fmt.Println()
+	if report.failed > 0 {
+		fmt.Printf("%d checks failed\n", report.failed)
+		return 1
+	}
+	fmt.Println("All checks passed")
+	return 0
+}
+
+// sourceHosts returns the distinct host:port pairs of the sources.
+func sourceHosts(sources []configs.Source) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		u, err := url.Parse(source.URL)
+		if err != nil {
+			continue
+		}
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		host := net.JoinHostPort(u.Hostname(), port)
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+func checkDNS(report *doctorReport, sources []configs.Source, timeout time.Duration) {
+	report.section("DNS")
+	for _, hostPort := range sourceHosts(sources) {
+		host, _, _ := net.SplitHostPort(hostPort)
+		if net.ParseIP(host) != nil {
+			report.result("SKIP", host, "IP address")
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		started := time.Now()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		cancel()
+		if err != nil {
+			report.result("FAIL", host, err.Error())
+			continue
+		}
+		v4, v6 := 0, 0
+		for _, addr := range addrs {
+			if addr.IP.To4() != nil {
+				v4++
+			} else {
+				v6++
+			}
+		}
+		report.result("OK", host, fmt.Sprintf("%d IPv4, %d IPv6 addresses in %s", v4, v6, time.Since(started).Round(time.Millisecond)))
+	}
+}
+
+func checkReachability(report *doctorReport, sources []configs.Source, timeout time.Duration) {
+	report.section("Reachability")
+	for _, host := range sourceHosts(sources) {
+		name, _, _ := net.SplitHostPort(host)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		addrs, _ := net.DefaultResolver.LookupIPAddr(ctx, name)
+		cancel()
+		has := map[string]bool{}
+		for _, addr := range addrs {
+			if addr.IP.To4() != nil {
+				has["tcp4"] = true
+			} else {
+				has["tcp6"] = true
+			}
+		}
+		reachable := false
+		for _, network := range []string{"tcp4", "tcp6"} {
+			family := "IPv4"
+			if network == "tcp6" {
+				family = "IPv6"
+			}
+			if !has[network] {
+				report.result("SKIP", family+" "+host, "no "+family+" address")
+				continue
+			}
+			started := time.Now()
+			conn, err := net.DialTimeout(network, host, timeout)
+			if err != nil {
+				report.result("WARN", family+" "+host, err.Error())
+				continue
+			}
+			conn.Close()
+			reachable = true
+			report.result("OK", family+" "+host, fmt.Sprintf("connected in %s", time.Since(started).Round(time.Millisecond)))
+		}
+		if !reachable {
+			report.result("FAIL", host, "not reachable over IPv4 or IPv6")
+		}
+	}
+}
+
+func checkProxy(report *doctorReport, proxy *configs.ProxyConfig, sources []configs.Source, timeout time.Duration) {
+	report.section("Proxy")
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		if value := os.Getenv(name); value != "" {
+			report.result("INFO", name, "is set but not used; configure proxies in the config's proxy block")
+			break
+		}
+	}
+	if proxy != nil && proxy.PAC != "" {
+		checkPAC(report, proxy.PAC, sources, timeout)
+		return
+	}
+	if proxy == nil || proxy.URL == "" {
+		report.result("OK", "direct", "no proxy configured")
+		return
+	}
+	u, err := url.Parse(proxy.URL)
+	if err != nil {
+		report.result("FAIL", proxy.URL, err.Error())
+		return
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, timeout)
+	if err != nil {
+		report.result("FAIL", u.Redacted(), err.Error())
+		return
+	}
+	conn.Close()
+	report.result("OK", u.Redacted(), "proxy accepts connections")
+}
+
+// checkPAC loads the PAC file at location and reports the proxy it picks
+// for every source.
+func checkPAC(report *doctorReport, location string, sources []configs.Source, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	script, err := pac.Load(ctx, location)
+	if err != nil {
+		report.result("FAIL", location, err.Error())
+		return
+	}
+	report.result("OK", location, "PAC file loaded")
+	for _, source := range sources {
+		if source.Proxy != "" {
+			continue
+		}
+		u, err := url.Parse(source.URL)
+		if err != nil {
+			continue
+		}
+		result, err := script.FindProxy(source.URL, u.Hostname())
+		if err == nil {
+			_, err = pac.Proxies(result)
+		}
+		if err != nil {
+			report.result("FAIL", source.URL, err.Error())
+			continue
+		}
+		if result == "" {
+			result = "DIRECT"
+		}
+		report.result("OK", source.URL, result)
+	}
+}
+
+// checkSources requests every source once and returns those that passed
+// and how far the local clock is ahead of each server's.
+func checkSources(report *doctorReport, dataConsumer *consumer.Consumer, sources []configs.Source, timeout time.Duration) ([]configs.Source, []time.Duration) {
+	report.section("HTTP and TLS")
+	var passed []configs.Source
+	var offsets []time.Duration
+	for _, source := range sources {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		check := dataConsumer.Check(ctx, source)
+		cancel()
+		if !check.ServerTime.IsZero() {
+			// The Date header is truncated to the second, on average by
+			// half a second.
+			offsets = append(offsets, time.Since(check.ServerTime)-500*time.Millisecond)
+		}
+		if !check.OK() {
+			report.result("FAIL", source.URL, check.Error)
+			continue
+		}
+		passed = append(passed, source)
+		detail := fmt.Sprintf("status %d", check.StatusCode)
+		if !check.TLSExpiry.IsZero() {
+			detail += ", certificate valid until " + check.TLSExpiry.Format("2006-01-02")
+		}
+		result := "OK"
+		if !check.TLSExpiry.IsZero() && time.Until(check.TLSExpiry) < 14*24*time.Hour {
+			result = "WARN"
+		}
+		report.result(result, source.URL, detail)
+	}
+	return passed, offsets
+}
+
+func checkThroughput(report *doctorReport, dataConsumer *consumer.Consumer, sources []configs.Source, duration time.Duration) {
+	report.section("Single-stream throughput")
+	if len(sources) == 0 {
+		report.result("SKIP", "-", "no source passed the HTTP check")
+		return
+	}
+	result := dataConsumer.Bench(context.Background(), sources[0], duration)
+	if result.Bytes == 0 {
+		report.result("FAIL", result.URL, "received no data: "+result.LastError)
+		return
+	}
+	report.result("OK", result.URL, fmt.Sprintf("%s over %s", result.Rate(), result.Duration.Round(time.Second)))
+}
+
+func checkClock(report *doctorReport, offsets []time.Duration) {
+	report.section("Clock")
+	if len(offsets) == 0 {
+		report.result("SKIP", "-", "no server reported its time")
+		return
+	}
+	// The median discards servers with a wrong clock.
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	skew := offsets[len(offsets)/2].Round(time.Second)
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	result := "OK"
+	switch {
+	case abs >= clockSkewFailure:
+		result = "FAIL"
+	case abs >= clockSkewWarning:
+		result = "WARN"
+	}
+	report.result(result, "skew", fmt.Sprintf("local clock is %s off the servers' (%d readings)", skew, len(offsets)))
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/scheduler"
+	"dataconsumer/pkg/consumer"
+)
+
+// maxPlannedWindows caps the scheduled windows a dry run lists.
+const maxPlannedWindows = 10
+
+// printPlan prints what a run with config would do, starting at start and
+// ending at until if that is set, without sending any traffic. The jobs of
+// the config are planned one after the other.
+func printPlan(config *configs.Config, start, until time.Time) int {
+	fmt.Println("Execution plan (dry run, no traffic is sent)")
+	if len(config.Jobs) == 0 {
+		return printSessionPlan(config, start, until)
+	}
+	fmt.Printf("\n%d jobs run side by side; the merged metrics go to %s\n", len(config.Jobs), config.MetricsFile)
+	for _, job := range config.Jobs {
+		jobConfig, err := config.ForJob(job)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("\n== Job %s ==\n", job.Name)
+		if status := printSessionPlan(jobConfig, start, until); status != 0 {
+			return status
+		}
+	}
+	return 0
+}
+
+// printSessionPlan prints the plan of a run or of one job of it.
+func printSessionPlan(config *configs.Config, start, until time.Time) int {
+	var enabled []configs.Source
+	totalWeight := 0
+	for _, source := range config.DataSources {
+		if source.IsEnabled() {
+			enabled = append(enabled, source)
+			totalWeight += source.EffectiveWeight()
+		}
+	}
+	fmt.Printf("\nSources: %d enabled, %d disabled\n", len(enabled), len(config.DataSources)-len(enabled))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  WEIGHT\tSHARE\tURL")
+	for _, source := range config.DataSources {
+		if !source.IsEnabled() {
+			fmt.Fprintf(tw, "  -\tdisabled\t%s\n", source.URL)
+			continue
+		}
+		share := 100 * float64(source.EffectiveWeight()) / float64(totalWeight)
+		fmt.Fprintf(tw, "  %d\t%.0f%%\t%s%s\n", source.EffectiveWeight(), share, source.URL, describeSource(source))
+	}
+	tw.Flush()
+	if config.Catalog != nil {
+		fmt.Printf("  plus the sources of the catalog at %s\n", config.Catalog.URL)
+	}
+	if config.Proxy != nil && config.Proxy.PAC != "" {
+		fmt.Printf("  through the proxies picked by the PAC file %s\n", config.Proxy.PAC)
+	}
+
+	workers := fmt.Sprintf("%d", consumer.StartWorkers(config))
+	if config.AutoWorkers && config.TargetRPS <= 0 {
+		workers += fmt.Sprintf(", resized to the bandwidth-delay product before each session (at most %d)", maxAutoWorkers)
+	}
+	fmt.Printf("\nWorkers: %s\n", workers)
+	if config.MaxConnsPerSource > 0 {
+		fmt.Printf("At most %d connections per source host\n", config.MaxConnsPerSource)
+	}
+
+	rate := plannedRate(config)
+	switch {
+	case config.TargetRPS > 0 && config.ObjectSize > 0:
+		fmt.Printf("Rate: %g requests/s of %s each, about %s\n", config.TargetRPS, config.ObjectSize, rate)
+	case config.TargetRPS > 0:
+		fmt.Printf("Rate: %g requests/s; the data rate depends on the response sizes\n", config.TargetRPS)
+	case config.MaxBandwidth > 0 && config.MaxBandwidth < config.TargetRate:
+		fmt.Printf("Rate: %s (target %s, capped by max_bandwidth)\n", rate, config.TargetRate)
+	default:
+		fmt.Printf("Rate: %s\n", describeTarget(config))
+	}
+	if config.FairShare != nil {
+		fmt.Printf("  at most %g%% of the measured link capacity (fair_share), which may be lower\n", config.FairShare.Percent)
+	}
+	if len(config.ProfileRules) > 0 {
+		fmt.Println("  changed by the profile rules, see 'dataconsumer schedule show'")
+	}
+	if config.Coordinator != "" {
+		fmt.Printf("  shared with the other instances of the coordinator at %s\n", config.Coordinator)
+	}
+
+	if len(config.Schedules) > 0 {
+		return printPlannedWindows(config, start)
+	}
+
+	duration := time.Duration(config.Duration)
+	if !until.IsZero() {
+		if left := until.Sub(start); duration <= 0 || left < duration {
+			duration = left
+		}
+	}
+	if !start.IsZero() && time.Until(start) > 0 {
+		fmt.Printf("\nStarts: %s\n", start.Format(time.RFC1123))
+	} else {
+		fmt.Println()
+	}
+	if duration > 0 {
+		fmt.Printf("Duration: %s (until %s)\n", duration.Round(time.Second), start.Add(duration).Format(time.RFC1123))
+	} else {
+		fmt.Println("Duration: indefinite")
+	}
+	if config.MaxData > 0 {
+		fmt.Printf("Data cap: %s\n", config.MaxData)
+	}
+	fmt.Printf("Expected data: %s\n", describeVolume(rate, duration, config.MaxData))
+	printPlanOutputs(config)
+	return 0
+}
+
+// printPlannedWindows lists the next scheduled windows and the data each
+// is expected to consume.
+func printPlannedWindows(config *configs.Config, from time.Time) int {
+	sched, err := scheduler.New(config.Schedules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid schedule: %v\n", err)
+		return 1
+	}
+	fmt.Println("\nScheduled windows:")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  OPENS\tWINDOW\tDURATION\tRATE\tEXPECTED DATA")
+	t := from
+	for i := 0; i < maxPlannedWindows; i++ {
+		entry, at, ok := sched.Next(t)
+		if !ok {
+			break
+		}
+		window, err := config.ForSchedule(entry)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		duration := time.Duration(window.Duration)
+		rate := plannedRate(window)
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", at.Format("Mon 2006-01-02 15:04"), entry.Name, duration,
+			rate, describeVolume(rate, duration, window.MaxData))
+		t = at
+	}
+	tw.Flush()
+	if config.MaxData > 0 {
+		fmt.Printf("Each window stops at the data cap of %s.\n", config.MaxData)
+	}
+	printPlanOutputs(config)
+	return 0
+}
+
+// printPlanOutputs prints where the run writes its results.
+func printPlanOutputs(config *configs.Config) {
+	fmt.Printf("\nMetrics: %s\n", config.MetricsFile)
+	if config.SaveTo != nil && config.SaveTo.Dir != "" {
+		s := "Objects saved to " + config.SaveTo.Dir
+		if config.SaveTo.Quota > 0 {
+			s += ", up to " + config.SaveTo.Quota.String()
+		}
+		fmt.Println(s)
+	}
+}
+
+// plannedRate is the data rate a run with config aims for, or 0 if it
+// cannot be known in advance.
+func plannedRate(config *configs.Config) configs.Rate {
+	if config.TargetRPS > 0 {
+		return configs.Rate(config.TargetRPS * float64(config.ObjectSize))
+	}
+	return pipeTarget(config)
+}
+
+// describeTarget describes how a session holds to its target rate.
+func describeTarget(config *configs.Config) string {
+	switch config.TargetMode {
+	case configs.AtMost:
+		return "at most " + config.TargetRate.String()
+	case configs.Unpaced:
+		return config.TargetRate.String() + ", as fast as possible without pacing to it"
+	}
+	return "at least " + config.TargetRate.String()
+}
+
+// describeVolume describes the data consumed at rate for duration, up to
+// maxData.
+func describeVolume(rate configs.Rate, duration time.Duration, maxData configs.Size) string {
+	switch {
+	case rate <= 0 && maxData > 0:
+		return "up to " + maxData.String()
+	case rate <= 0:
+		return "unknown"
+	case duration <= 0 && maxData > 0:
+		return fmt.Sprintf("%s, reached after about %s", maxData, time.Duration(float64(maxData)/rate.BytesPerSecond()*float64(time.Second)).Round(time.Second))
+	case duration <= 0:
+		return fmt.Sprintf("%s per hour, %s per day, until stopped", configs.Size(rate.BytesPerSecond()*3600), configs.Size(rate.BytesPerSecond()*86400))
+	}
+	volume := configs.Size(rate.BytesPerSecond() * duration.Seconds())
+	if maxData > 0 && volume > maxData {
+		return fmt.Sprintf("%s, capped by the data cap (%s at the full rate)", maxData, volume)
+	}
+	return volume.String()
+}
+
+// describeSource notes the settings that change how a source is fetched.
+func describeSource(source configs.Source) string {
+	var notes []string
+	if source.Protocol != "" {
+		notes = append(notes, "protocol "+source.Protocol)
+	}
+	if source.Proxy != "" {
+		proxy := source.Proxy
+		if u, err := url.Parse(proxy); err == nil {
+			proxy = u.Redacted()
+		}
+		notes = append(notes, "proxy "+proxy)
+	}
+	if source.Auth != nil {
+		notes = append(notes, "auth "+source.Auth.Type)
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(notes, ", ") + ")"
+}
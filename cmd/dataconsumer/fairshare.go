@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/consumer"
+)
+
+// watchFairShare re-measures the link capacity every fair_share interval,
+// starting right away, and sets the bandwidth ceiling to the configured
+// share of it, until done is closed. While paused no probe is made and the
+// last ceiling stays in effect.
+func watchFairShare(config *configs.Config, dataConsumer *consumer.Consumer, done <-chan struct{}) {
+	if config.FairShare == nil {
+		return
+	}
+	share := config.FairShare.WithDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+	go func() {
+		ticker := time.NewTicker(time.Duration(share.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			if !dataConsumer.Paused() {
+				applyFairShare(ctx, share, config.MaxBandwidth, dataConsumer)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// applyFairShare probes the capacity and sets the ceiling to its share,
+// never above maxBandwidth.
+func applyFairShare(ctx context.Context, share configs.FairShareConfig, maxBandwidth configs.Rate, dataConsumer *consumer.Consumer) {
+	capacity, err := dataConsumer.ProbeCapacity(ctx, time.Duration(share.Probe)*time.Second)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Warn("capacity probe failed, keeping the current rate limit", "error", err)
+		}
+		return
+	}
+	if capacity <= 0 {
+		logger.Warn("capacity probe received no data, keeping the current rate limit")
+		return
+	}
+	limit := configs.Rate(float64(capacity) * share.Percent / 100)
+	if maxBandwidth > 0 && maxBandwidth < limit {
+		limit = maxBandwidth
+	}
+	dataConsumer.SetRateLimit(limit)
+	logger.Info("applied fair share", "capacity", capacity, "percent", share.Percent, "rate_limit", limit)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/fleet"
+	"dataconsumer/internal/secure"
+)
+
+// agentReportInterval is how often agents report to the controller until
+// it assigns a heartbeat interval, and the timeout of each request.
+const agentReportInterval = 5 * time.Second
+
+func runControllerCommand(args []string) int {
+	fs := flag.NewFlagSet("controller", flag.ExitOnError)
+	addr := fs.String("addr", ":9400", "Address to listen on")
+	configPath := fs.String("config", "", "Configuration file with the data sources and rates to distribute")
+	var targetRate, maxBandwidth configs.Rate
+	fs.Var(&targetRate, "target-rate", "Fleet-wide target rate, split evenly between agents (overrides config)")
+	fs.Var(&maxBandwidth, "max-bandwidth", "Fleet-wide bandwidth ceiling, split evenly between agents (overrides config)")
+	heartbeat := fs.Duration("heartbeat", 5*time.Second, fmt.Sprintf("How often agents report; an agent silent for %d intervals is considered lost", fleet.MissedHeartbeats))
+	security := addServerSecurityFlags(fs)
+	parseFlags(fs, args)
+	security.Token = secure.Token(security.Token)
+	if err := security.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *heartbeat < time.Second {
+		fmt.Fprintln(os.Stderr, "-heartbeat must be at least 1s")
+		return 2
+	}
+
+	config := loadConfiguration(*configPath)
+	plan := fleet.Assignment{
+		DataSources:       config.DataSources,
+		TargetRate:        config.TargetRate,
+		MaxBandwidth:      config.MaxBandwidth,
+		HeartbeatInterval: *heartbeat,
+	}
+	if targetRate > 0 {
+		plan.TargetRate = targetRate
+	}
+	if maxBandwidth > 0 {
+		plan.MaxBandwidth = maxBandwidth
+	}
+	controller := fleet.NewController(plan)
+
+	server := &http.Server{Addr: *addr, Handler: security.Handler(fleet.NewHTTPHandler(controller))}
+	failed := make(chan error, 1)
+	go func() { failed <- security.ListenAndServe(server) }()
+	fmt.Printf("Fleet controller listening on %s, dashboard at %s://%s/\n", *addr, security.Scheme(), *addr)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(*heartbeat)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case err := <-failed:
+			fmt.Fprintf(os.Stderr, "Controller failed: %v\n", err)
+			return 1
+		case <-ticker.C:
+			for _, id := range controller.Expire() {
+				logger.Warn("agent lost, redistributing its share", "agent", id)
+			}
+		case <-sigChan:
+			running = false
+		}
+	}
+	server.Close()
+	printFleetSummary(controller.Summary())
+	return 0
+}
+
+func printFleetSummary(summary fleet.Summary) {
+	fmt.Println("\nFleet summary")
+	for _, agent := range summary.Agents {
+		fmt.Printf("  %-24s %-10s %12s  %s average\n", agent.ID, agent.State,
+			configs.Size(agent.BytesTransferred), configs.RateFromMBPerMinute(agent.AverageRate))
+	}
+	fmt.Printf("%d agents (%d alive), %s consumed in total\n", len(summary.Agents), summary.LiveAgents, configs.Size(summary.BytesTransferred))
+}
+
+func runAgentCommand(args []string) int {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	controllerURL := fs.String("controller", "", "URL of the fleet controller, e.g. http://10.0.0.5:9400")
+	configPath := fs.String("config", "", "Path to configuration file for local settings")
+	name := fs.String("name", "", "Name to register as (default: the hostname)")
+	outputMetrics := fs.String("metrics", "dataconsumer_metrics.json", "Path to save metrics")
+	saveInterval := fs.Int("save-interval", 60, "Save metrics every N seconds")
+	verbosity := addVerbosityFlags(fs)
+	logOptions := addLogFlags(fs)
+	clientSecurity := addClientSecurityFlags(fs)
+	parseFlags(fs, args)
+	clientSecurity.resolve()
+	if *controllerURL == "" {
+		fmt.Fprintln(os.Stderr, "agent needs -controller")
+		return 2
+	}
+	if *name == "" {
+		*name, _ = os.Hostname()
+	}
+
+	config := loadConfiguration(*configPath)
+	verbosity.apply(config)
+	closeLog, err := setupLogging(config, logOptions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer closeLog()
+	config.MetricsFile = *outputMetrics
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	httpClient, err := secure.NewClient(clientSecurity.token, clientSecurity.caFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up the controller connection: %v\n", err)
+		return 1
+	}
+	agent := &fleetAgent{client: fleet.NewClient(*controllerURL, httpClient), name: *name}
+	if !agent.register(sigChan) {
+		return 0
+	}
+	controller := newSessionController(config, false)
+	stopReporting, reportingStopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		agent.reportLoop(controller, stopReporting)
+		close(reportingStopped)
+	}()
+	defer func() {
+		close(stopReporting)
+		<-reportingStopped
+		agent.deregister()
+	}()
+
+	opts := runOptions{
+		saveInterval: *saveInterval,
+		sigChan:      sigChan,
+		stop:         controller.stop,
+		headless:     true,
+		onStart:      controller.attach,
+		onEnd:        controller.detach,
+	}
+	// A stop request means the controller changed the sources, so start a
+	// new session with them.
+	for {
+		sessionConfig := agent.sessionConfig(config)
+		if runSession(sessionConfig, opts).reason != "stop_request" {
+			return 0
+		}
+		logger.Info("restarting with the sources assigned by the controller")
+	}
+}
+
+// fleetAgent registers with the controller and keeps the running session in
+// line with the assignment it receives.
+type fleetAgent struct {
+	client *fleet.Client
+	name   string
+
+	mu         sync.Mutex
+	id         string
+	assignment fleet.Assignment
+	// sources are the sources of the running session.
+	sources []configs.Source
+}
+
+// register registers with the controller and fetches the first
+// assignment, retrying until it succeeds. It returns false if interrupted.
+func (a *fleetAgent) register(sigChan <-chan os.Signal) bool {
+	for {
+		err := a.registerOnce()
+		if err == nil {
+			return true
+		}
+		logger.Warn("failed to register with controller, retrying", "error", err)
+		select {
+		case <-time.After(agentReportInterval):
+		case <-sigChan:
+			return false
+		}
+	}
+}
+
+func (a *fleetAgent) registerOnce() error {
+	ctx, cancel := context.WithTimeout(context.Background(), agentReportInterval)
+	defer cancel()
+	id, err := a.client.Register(ctx, a.name)
+	if err != nil {
+		return err
+	}
+	assignment, err := a.client.Report(ctx, id, fleet.Report{State: "starting"})
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.id, a.assignment = id, assignment
+	a.mu.Unlock()
+	logger.Info("registered with controller", "id", id, "sources", len(assignment.DataSources))
+	return nil
+}
+
+// sessionConfig returns config with the assigned sources and rates.
+func (a *fleetAgent) sessionConfig(config *configs.Config) *configs.Config {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sessionConfig := *config
+	sessionConfig.DataSources = a.assignment.DataSources
+	if a.assignment.TargetRate > 0 {
+		sessionConfig.TargetRate = a.assignment.TargetRate
+	}
+	if a.assignment.MaxBandwidth > 0 {
+		sessionConfig.MaxBandwidth = a.assignment.MaxBandwidth
+	}
+	a.sources = a.assignment.DataSources
+	return &sessionConfig
+}
+
+// deregister tells the controller that the agent is leaving, so its share
+// is redistributed without waiting for the heartbeat timeout.
+func (a *fleetAgent) deregister() {
+	a.mu.Lock()
+	id := a.id
+	a.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), agentReportInterval)
+	defer cancel()
+	if err := a.client.Deregister(ctx, id); err != nil {
+		logger.Warn("failed to deregister from controller", "error", err)
+	}
+}
+
+// reportLoop reports the session's metrics to the controller at its
+// heartbeat interval until stop is closed, and applies the assignment it
+// returns: new rates take effect immediately, new sources restart the
+// session.
+func (a *fleetAgent) reportLoop(controller *sessionController, stop <-chan struct{}) {
+	interval := agentReportInterval
+	a.mu.Lock()
+	if a.assignment.HeartbeatInterval > 0 {
+		interval = a.assignment.HeartbeatInterval
+	}
+	a.mu.Unlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		status := controller.Status()
+		report := fleet.Report{
+			State:            status.State,
+			BytesTransferred: status.Stats.BytesTransferred,
+			CurrentRate:      status.Stats.CurrentRate,
+			AverageRate:      status.Stats.AverageRate,
+		}
+		if status.State != "idle" {
+			stats := status.Stats
+			stats.RateHistory = nil
+			report.Stats = &stats
+		}
+		a.mu.Lock()
+		id := a.id
+		a.mu.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), agentReportInterval)
+		assignment, err := a.client.Report(ctx, id, report)
+		cancel()
+		if errors.Is(err, fleet.ErrUnknownAgent) {
+			logger.Warn("controller does not know this agent, registering again")
+			err = a.registerOnce()
+			if err == nil {
+				a.mu.Lock()
+				assignment = a.assignment
+				a.mu.Unlock()
+			}
+		}
+		if err != nil {
+			logger.Warn("failed to report to controller", "error", err)
+			continue
+		}
+		if assignment.HeartbeatInterval > 0 && assignment.HeartbeatInterval != interval {
+			interval = assignment.HeartbeatInterval
+			ticker.Reset(interval)
+		}
+		a.apply(assignment, controller)
+	}
+}
+
+func (a *fleetAgent) apply(assignment fleet.Assignment, controller *sessionController) {
+	a.mu.Lock()
+	a.assignment = assignment
+	sourcesChanged := !reflect.DeepEqual(a.sources, assignment.DataSources)
+	a.mu.Unlock()
+	if sourcesChanged {
+		controller.Stop()
+		return
+	}
+	c, _ := controller.current()
+	if c != nil && assignment.MaxBandwidth > 0 && c.RateLimit() != assignment.MaxBandwidth {
+		c.SetRateLimit(assignment.MaxBandwidth)
+		logger.Info("applied rate limit from controller", "rate_limit", assignment.MaxBandwidth)
+	}
+	if c != nil && assignment.TargetRate > 0 && c.TargetRate() != assignment.TargetRate {
+		c.SetTargetRate(assignment.TargetRate)
+		logger.Info("applied target rate from controller", "target_rate", assignment.TargetRate)
+	}
+}
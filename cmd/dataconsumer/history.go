@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/history"
+)
+
+const sessionTimeFormat = "20060102T150405"
+
+// sessionMetricsFile returns the metrics file of a scheduled session,
+// derived from the configured one, e.g. metrics-nightly-20250101T020000.json.
+func sessionMetricsFile(base, window string, start time.Time) string {
+	ext := filepath.Ext(base)
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, window)
+	return fmt.Sprintf("%s-%s-%s%s", strings.TrimSuffix(base, ext), name, start.Format(sessionTimeFormat), ext)
+}
+
+// sessionIndexFile returns the index of past sessions kept next to the
+// configured metrics file, e.g. metrics-sessions.jsonl.
+func sessionIndexFile(base string) string {
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-sessions.jsonl"
+}
+
+// recordSession adds a finished scheduled session to the index.
+func recordSession(indexFile, window, metricsFile string, result sessionResult) {
+	session := history.Session{
+		RunID:            result.stats.RunID,
+		Window:           window,
+		Start:            result.stats.StartTime,
+		End:              result.stats.StartTime.Add(result.stats.ElapsedTime),
+		Reason:           result.reason,
+		BytesTransferred: result.stats.BytesTransferred,
+		AverageRate:      result.stats.AverageRate,
+		PeakRate:         result.stats.PeakRate,
+		MetricsFile:      metricsFile,
+	}
+	for _, egress := range result.stats.Egress {
+		if !slices.Contains(session.PublicIPs, egress.PublicIP) {
+			session.PublicIPs = append(session.PublicIPs, egress.PublicIP)
+		}
+	}
+	if err := history.Append(indexFile, session); err != nil {
+		logger.Warn("failed to update session index", "file", indexFile, "error", err)
+	}
+}
+
+func runMetricsSessions(args []string) int {
+	fs := flag.NewFlagSet("metrics sessions", flag.ExitOnError)
+	index := fs.String("index", sessionIndexFile("dataconsumer_metrics.json"), "Session index to read")
+	parseFlags(fs, args)
+
+	sessions, err := history.Load(*index)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load session index: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%-16s %-20s %-10s %-12s %12s %16s  %s\n", "WINDOW", "START", "DURATION", "ENDED BY", "CONSUMED", "AVERAGE", "METRICS")
+	for _, s := range sessions {
+		fmt.Printf("%-16s %-20s %-10s %-12s %12s %16s  %s\n", s.Window, s.Start.Local().Format("2006-01-02 15:04:05"),
+			s.End.Sub(s.Start).Round(time.Second), s.Reason, configs.Size(s.BytesTransferred),
+			configs.RateFromMBPerMinute(s.AverageRate), s.MetricsFile)
+	}
+	return 0
+}
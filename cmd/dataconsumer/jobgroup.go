@@ -0,0 +1,397 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/control"
+	"dataconsumer/internal/scheduler"
+	"dataconsumer/internal/systemd"
+	"dataconsumer/pkg/consumer"
+	"dataconsumer/pkg/metrics"
+)
+
+// jobGroup runs the jobs of a config side by side, each with its own
+// session controller, consumer and metrics files, and presents them to the
+// control APIs and on the terminal as one.
+type jobGroup struct {
+	config *configs.Config
+	names  []string
+	jobs   []*sessionController
+
+	mu sync.Mutex
+	// last holds the final stats of each job's latest session.
+	last []*metrics.Stats
+	// events are the jobs' events with the job's name added.
+	events control.Broadcaster
+}
+
+// newJobGroup prepares the jobs of config. The group runs the DNS load
+// once for all jobs, and each job pushes its metrics to the Pushgateway
+// with a dataconsumer_job label.
+func newJobGroup(config *configs.Config) (*jobGroup, error) {
+	group := &jobGroup{config: config}
+	for _, job := range config.Jobs {
+		jobConfig, err := config.ForJob(job)
+		if err != nil {
+			return nil, err
+		}
+		if err := consumer.ValidateSources(jobConfig.DataSources); err != nil {
+			return nil, fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		if _, err := scheduler.New(jobConfig.Schedules); err != nil {
+			return nil, fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		jobConfig.DNS = nil
+		if push := jobConfig.Pushgateway; push != nil {
+			labeled := *push
+			labeled.Labels = map[string]string{"dataconsumer_job": job.Name}
+			for name, value := range push.Labels {
+				labeled.Labels[name] = value
+			}
+			jobConfig.Pushgateway = &labeled
+		}
+		group.names = append(group.names, job.Name)
+		group.jobs = append(group.jobs, newSessionController(jobConfig, false))
+	}
+	group.last = make([]*metrics.Stats, len(group.jobs))
+	return group, nil
+}
+
+// run runs every job until all have ended or a signal arrives. Meanwhile
+// it prints a status line for the whole group every 10 seconds and saves
+// the merged stats of the jobs to the config's metrics file. Each job is
+// then checked against its success criteria and the jobs together against
+// the config's; the returned exit status is that of the first that failed.
+func (g *jobGroup) run(opts runOptions) int {
+	if g.config.DNS != nil {
+		defer startDNSLoad(*g.config.DNS)()
+	}
+	signals := make([]chan os.Signal, len(g.jobs))
+	// Jobs with schedules check each of their sessions as it ends; the
+	// results of the others are checked once all jobs have ended.
+	results := make([]*sessionResult, len(g.jobs))
+	statuses := make([]int, len(g.jobs))
+	var wg sync.WaitGroup
+	for i, job := range g.jobs {
+		i, job := i, job
+		signals[i] = make(chan os.Signal, 1)
+		jobOpts := runOptions{
+			saveInterval: opts.saveInterval,
+			sigChan:      signals[i],
+			headless:     true,
+			stop:         job.stop,
+			tracer:       opts.tracer,
+			onStart:      job.attach,
+			onEnd: func() {
+				g.ended(i)
+				job.detach()
+			},
+			job: g.names[i],
+		}
+		events, _ := job.Subscribe()
+		go g.forwardEvents(i, events)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if len(job.config.Schedules) > 0 {
+				statuses[i] = runSchedules(job, jobOpts)
+				return
+			}
+			jobOpts.until = opts.until
+			result := runSession(job.snapshot(), jobOpts)
+			results[i] = &result
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	fmt.Printf("Running %d jobs: %s\n", len(g.jobs), strings.Join(g.names, ", "))
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	saveTicker := time.NewTicker(time.Duration(opts.saveInterval) * time.Second)
+	defer saveTicker.Stop()
+	started := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			g.printStatus(opts.headless)
+		case <-saveTicker.C:
+			g.saveMetrics()
+		case sig := <-opts.sigChan:
+			systemd.Notify(systemd.Stopping)
+			fmt.Printf("\n\nReceived %s, stopping all jobs...\n", sig)
+			for _, jobSignals := range signals {
+				select {
+				case jobSignals <- sig:
+				default:
+				}
+			}
+		case <-done:
+			g.saveMetrics()
+			g.printSummary(time.Since(started))
+			return g.checkSuccess(results, statuses)
+		}
+	}
+}
+
+// checkSuccess checks the result of every job that ran a single session
+// against its criteria, then the jobs together against the config's, and
+// returns the first failing exit status among those and statuses.
+func (g *jobGroup) checkSuccess(results []*sessionResult, statuses []int) int {
+	_, merged := g.stats()
+	combined := sessionResult{reason: "duration", stats: merged}
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		statuses[i] = sessionStatus(g.names[i], g.jobs[i].config.Success, *result)
+		combined.health = append(combined.health, result.health...)
+		if !result.reachedTarget() && combined.reachedTarget() {
+			combined.reason = result.reason
+		}
+	}
+	return firstFailure(append(statuses, sessionStatus("", g.config.Success, combined))...)
+}
+
+// ended records the final stats of job i's session as it ends.
+func (g *jobGroup) ended(i int) {
+	_, m := g.jobs[i].current()
+	if m == nil {
+		return
+	}
+	stats := m.GetStats()
+	stats.CurrentRate = 0
+	g.mu.Lock()
+	g.last[i] = &stats
+	g.mu.Unlock()
+}
+
+// stats returns the stats of every job: those of its running session, or
+// of its latest session, or nil if it has not run yet. merged combines
+// them, averaged over the time the longest of them ran.
+func (g *jobGroup) stats() (jobs []*metrics.Stats, merged metrics.Stats) {
+	var all []metrics.Stats
+	for i, job := range g.jobs {
+		var stats *metrics.Stats
+		if _, m := job.current(); m != nil {
+			current := m.GetStats()
+			stats = &current
+		} else {
+			g.mu.Lock()
+			stats = g.last[i]
+			g.mu.Unlock()
+		}
+		jobs = append(jobs, stats)
+		if stats != nil {
+			all = append(all, *stats)
+		}
+	}
+	merged = metrics.Merge(all...)
+	if merged.ElapsedTime > 0 {
+		merged.AverageRate = merged.TotalMegabytes / merged.ElapsedTime.Minutes()
+	}
+	return jobs, merged
+}
+
+func (g *jobGroup) saveMetrics() {
+	if !g.config.SaveMetrics {
+		return
+	}
+	_, merged := g.stats()
+	if err := metrics.SaveStats(g.config.MetricsFile, merged); err != nil {
+		logger.Warn("failed to save metrics", "file", g.config.MetricsFile, "error", err)
+	}
+}
+
+// printStatus prints the current rate of every job and the totals of the
+// group.
+func (g *jobGroup) printStatus(headless bool) {
+	jobs, merged := g.stats()
+	systemd.Status(fmt.Sprintf("%d jobs, %.2f MB consumed at %.2f MB/min", len(g.jobs), merged.TotalMegabytes, merged.CurrentRate))
+	if jsonOutput != nil {
+		emitEvent("status", "", merged, merged.CurrentRate)
+		return
+	}
+	if resultOutput != nil || g.config.Verbosity == configs.Quiet {
+		return
+	}
+	var line strings.Builder
+	if !headless {
+		line.WriteString("\r\033[K")
+	}
+	for i, stats := range jobs {
+		if stats == nil {
+			fmt.Fprintf(&line, "%s: waiting | ", g.names[i])
+			continue
+		}
+		fmt.Fprintf(&line, "%s: %.2f MB/min | ", g.names[i], stats.CurrentRate)
+	}
+	fmt.Fprintf(&line, "Total: %.2f MB at %.2f MB/min | Time: %s", merged.TotalMegabytes, merged.CurrentRate, merged.ElapsedTime.Round(time.Second))
+	if headless {
+		line.WriteString("\n")
+	}
+	fmt.Print(line.String())
+}
+
+// printSummary prints how much each job consumed and the summary of the
+// whole group.
+func (g *jobGroup) printSummary(runtime time.Duration) {
+	jobs, merged := g.stats()
+	fmt.Println("\nJobs:")
+	for i, stats := range jobs {
+		if stats == nil {
+			fmt.Printf("  %s: did not run\n", g.names[i])
+			continue
+		}
+		fmt.Printf("  %s: %.2f MB at %.2f MB/min on average in %s, metrics in %s\n", g.names[i],
+			stats.TotalMegabytes, stats.AverageRate, stats.ElapsedTime.Round(time.Second), g.jobs[i].config.MetricsFile)
+	}
+	printSummary(merged, runtime)
+	emitEvent("summary", "jobs", merged, merged.CurrentRate)
+}
+
+// endJobSession stops the session of a config job and saves its metrics,
+// leaving the summary to the job group.
+func endJobSession(job, reason string, dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, metricsFile string) {
+	dataConsumer.Stop()
+	if err := metricsCollector.SaveStatsToFile(metricsFile); err != nil {
+		logger.Warn("failed to save final metrics", "job", job, "file", metricsFile, "error", err)
+	}
+	logger.Info("job session ended", "job", job, "reason", reason, "metrics_file", metricsFile)
+}
+
+// forwardEvents publishes the events of job i with its name added.
+func (g *jobGroup) forwardEvents(i int, events <-chan control.Event) {
+	for event := range events {
+		detail := []any{"job", g.names[i]}
+		for key, value := range event.Detail {
+			detail = append(detail, key, value)
+		}
+		g.events.Publish(event.Type, detail...)
+	}
+}
+
+// Subscribe implements control.EventSource.
+func (g *jobGroup) Subscribe() (<-chan control.Event, func()) {
+	return g.events.Subscribe()
+}
+
+// running returns the consumers of the sessions running now.
+func (g *jobGroup) running() []*consumer.Consumer {
+	var consumers []*consumer.Consumer
+	for _, job := range g.jobs {
+		if c, _ := job.current(); c != nil {
+			consumers = append(consumers, c)
+		}
+	}
+	return consumers
+}
+
+// Status reports the merged stats of the jobs, as "running" while any job
+// runs and "paused" once all running jobs are paused.
+func (g *jobGroup) Status() control.Status {
+	running := g.running()
+	if len(running) == 0 {
+		return control.Status{State: "idle"}
+	}
+	state := "paused"
+	for _, c := range running {
+		if !c.Paused() {
+			state = "running"
+		}
+	}
+	_, merged := g.stats()
+	return control.Status{State: state, Stats: merged}
+}
+
+// Readiness combines the checks of every running job, prefixed with its
+// name.
+func (g *jobGroup) Readiness() control.Readiness {
+	readiness := control.Readiness{Ready: true}
+	for i, job := range g.jobs {
+		if c, _ := job.current(); c == nil {
+			continue
+		}
+		jobReadiness := job.Readiness()
+		readiness.Ready = readiness.Ready && jobReadiness.Ready
+		for _, check := range jobReadiness.Checks {
+			check.Name = g.names[i] + "/" + check.Name
+			readiness.Checks = append(readiness.Checks, check)
+		}
+	}
+	if len(readiness.Checks) == 0 {
+		return control.Readiness{Checks: []control.Check{{Name: "consumer", Detail: "no job running"}}}
+	}
+	return readiness
+}
+
+func (g *jobGroup) Start() error {
+	return control.Conflict("jobs cannot be started on request")
+}
+
+// each calls fn for every job with a running session.
+func (g *jobGroup) each(fn func(*sessionController) error) error {
+	ran := false
+	for _, job := range g.jobs {
+		if c, _ := job.current(); c == nil {
+			continue
+		}
+		if err := fn(job); err != nil && !errors.Is(err, errNoSession) {
+			return err
+		}
+		ran = true
+	}
+	if !ran {
+		return errNoSession
+	}
+	return nil
+}
+
+func (g *jobGroup) Pause() error {
+	return g.each((*sessionController).Pause)
+}
+
+func (g *jobGroup) Resume() error {
+	return g.each((*sessionController).Resume)
+}
+
+func (g *jobGroup) Stop() error {
+	return g.each((*sessionController).Stop)
+}
+
+func (g *jobGroup) SetRate(configs.Rate) error {
+	return control.Conflict("set the rate of each job in the config")
+}
+
+func (g *jobGroup) Sources() []configs.Source {
+	var sources []configs.Source
+	for _, job := range g.jobs {
+		sources = append(sources, job.Sources()...)
+	}
+	return sources
+}
+
+// Settings reports the sources of all jobs and the sum of their target
+// rates.
+func (g *jobGroup) Settings() control.Settings {
+	var settings control.Settings
+	for _, job := range g.jobs {
+		jobSettings := job.Settings()
+		settings.TargetRate += jobSettings.TargetRate
+		settings.DataSources = append(settings.DataSources, jobSettings.DataSources...)
+	}
+	return settings
+}
+
+func (g *jobGroup) UpdateSettings(control.SettingsPatch, string) (control.Settings, error) {
+	return control.Settings{}, control.Conflict("settings cannot be changed while running the jobs of the config")
+}
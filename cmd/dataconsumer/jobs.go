@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/control"
+	"dataconsumer/internal/jobs"
+	"dataconsumer/internal/systemd"
+	"dataconsumer/pkg/consumer"
+)
+
+var errNoJobs = control.Conflict("jobs are not enabled, start the daemon with -jobs")
+
+// SubmitJob implements control.JobQueue.
+func (s *sessionController) SubmitJob(spec jobs.Spec) (jobs.Job, error) {
+	if s.jobs == nil {
+		return jobs.Job{}, errNoJobs
+	}
+	if err := spec.Validate(); err != nil {
+		return jobs.Job{}, control.Invalid(err)
+	}
+	if spec.DataSources != nil {
+		if err := consumer.ValidateSources(spec.DataSources); err != nil {
+			return jobs.Job{}, control.Invalid(err)
+		}
+	}
+	job, err := s.jobs.Submit(spec, time.Now())
+	if err != nil {
+		logger.Warn("failed to save jobs", "error", err)
+	}
+	logger.Info("job submitted", "job", job.ID, "starts_at", job.StartAt.Format(time.RFC1123))
+	s.events.Publish("job_submitted", "id", job.ID, "start_at", job.StartAt)
+	return job, nil
+}
+
+// Jobs implements control.JobQueue.
+func (s *sessionController) Jobs() ([]jobs.Job, error) {
+	if s.jobs == nil {
+		return nil, errNoJobs
+	}
+	return s.jobs.List(), nil
+}
+
+// Job implements control.JobQueue.
+func (s *sessionController) Job(id string) (jobs.Job, error) {
+	if s.jobs == nil {
+		return jobs.Job{}, errNoJobs
+	}
+	return s.jobs.Get(id)
+}
+
+// CancelJob implements control.JobQueue. A running job is stopped and
+// recorded as canceled once its session has ended.
+func (s *sessionController) CancelJob(id string) (jobs.Job, error) {
+	if s.jobs == nil {
+		return jobs.Job{}, errNoJobs
+	}
+	job, err := s.jobs.Cancel(id, time.Now())
+	switch {
+	case errors.Is(err, jobs.ErrFinished):
+		return job, control.Conflict(fmt.Sprintf("job %s has already ended", id))
+	case errors.Is(err, jobs.ErrNotFound):
+		return job, err
+	case err != nil:
+		logger.Warn("failed to save jobs", "error", err)
+	}
+	if job.State == jobs.Running {
+		if err := s.Stop(); err != nil {
+			return job, err
+		}
+	}
+	logger.Info("job canceled", "job", id)
+	return job, nil
+}
+
+// runJobs runs the queued jobs one at a time, each when it is due, until
+// interrupted. Each job writes its own metrics file and is recorded in the
+// session index under "job-<id>".
+func runJobs(controller *sessionController, opts runOptions) {
+	queue := controller.jobs
+	for {
+		// Next sees every change made so far.
+		select {
+		case <-queue.Changed():
+		default:
+		}
+		job, ok := queue.Next()
+		// Without a queued job, wait for a submission.
+		wait := time.NewTimer(time.Hour)
+		if ok {
+			wait.Reset(time.Until(job.StartAt))
+			logger.Info("waiting for job", "job", job.ID, "starts_at", job.StartAt.Format(time.RFC1123))
+		} else {
+			logger.Info("waiting for jobs")
+		}
+
+		select {
+		case <-wait.C:
+			if !ok {
+				continue
+			}
+		case <-queue.Changed():
+			wait.Stop()
+			continue
+		case <-opts.sigChan:
+			wait.Stop()
+			systemd.Notify(systemd.Stopping)
+			fmt.Println("\nReceived interrupt while waiting, exiting")
+			return
+		}
+		// The job may have been canceled just before it became due.
+		if current, err := queue.Get(job.ID); err != nil || current.State != jobs.Queued {
+			continue
+		}
+		if runJob(controller, job, opts).interrupted() {
+			return
+		}
+	}
+}
+
+// runJob runs a single job and records its result.
+func runJob(controller *sessionController, job jobs.Job, opts runOptions) sessionResult {
+	config := controller.snapshot()
+	window := "job-" + job.ID
+	sessionConfig := jobConfig(config, job.Spec)
+	sessionConfig.MetricsFile = sessionMetricsFile(config.MetricsFile, window, time.Now())
+	if err := controller.jobs.Start(job.ID, time.Now()); err != nil {
+		logger.Warn("failed to save jobs", "error", err)
+	}
+	logger.Info("job started", "job", job.ID, "max_data", sessionConfig.MaxData, "duration", sessionConfig.Duration, "metrics_file", sessionConfig.MetricsFile)
+	controller.events.Publish("job_started", "id", job.ID)
+
+	result := runSession(sessionConfig, opts)
+	state := jobState(result)
+	err := controller.jobs.Finish(job.ID, state, jobs.Result{
+		Reason:           result.reason,
+		BytesTransferred: result.stats.BytesTransferred,
+		Elapsed:          result.stats.ElapsedTime,
+		AverageRate:      result.stats.AverageRate,
+		PeakRate:         result.stats.PeakRate,
+		MetricsFile:      sessionConfig.MetricsFile,
+	}, time.Now())
+	if err != nil {
+		logger.Warn("failed to save jobs", "error", err)
+	}
+	recordSession(sessionIndexFile(config.MetricsFile), window, sessionConfig.MetricsFile, result)
+	logger.Info("job finished", "job", job.ID, "state", state, "reason", result.reason)
+	controller.events.Publish("job_finished", "id", job.ID, "state", state, "bytes_transferred", result.stats.BytesTransferred)
+	return result
+}
+
+// jobConfig returns the configuration of a job's session: the job's
+// targets replace the configured ones.
+func jobConfig(config *configs.Config, spec jobs.Spec) *configs.Config {
+	jobConfig := *config
+	jobConfig.MaxData = spec.MaxData
+	jobConfig.Duration = spec.Duration
+	if spec.Rate > 0 {
+		jobConfig.TargetRate = spec.Rate
+		jobConfig.MaxBandwidth = spec.Rate
+	}
+	if spec.DataSources != nil {
+		jobConfig.DataSources = spec.DataSources
+	}
+	return &jobConfig
+}
+
+// jobState maps how a job's session ended to the job's final state.
+func jobState(result sessionResult) jobs.State {
+	switch {
+	case result.reachedTarget():
+		return jobs.Completed
+	case result.reason == "stop_request":
+		return jobs.Canceled
+	case result.interrupted():
+		return jobs.Interrupted
+	default:
+		return jobs.Failed
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/consumer"
+	"dataconsumer/pkg/metrics"
+)
+
+const (
+	// rateStep is the fraction by which + and - change the rate limit.
+	rateStep = 0.1
+	// workerStep is the number of workers w and W add or remove.
+	workerStep = 10
+)
+
+const keyHelp = "Keys: +/- rate limit, 0 no limit, w/W add/remove workers, p pause/resume, s save metrics, h help"
+
+// startKeyboard switches the terminal to key-at-a-time input and returns
+// the key presses together with a function restoring the terminal. The
+// channel is nil if stdin is not a terminal.
+func startKeyboard() (<-chan byte, func()) {
+	restore, err := enableKeyInput()
+	if err != nil {
+		return nil, func() {}
+	}
+	keys := make(chan byte)
+	go func() {
+		for {
+			key, err := stdin.ReadByte()
+			if err != nil {
+				return
+			}
+			keys <- key
+		}
+	}()
+	return keys, restore
+}
+
+// handleKey applies a live control key during an interactive session.
+func handleKey(key byte, dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, config *configs.Config) {
+	switch key {
+	case '+', '=':
+		adjustRateLimit(dataConsumer, metricsCollector, 1+rateStep)
+	case '-', '_':
+		adjustRateLimit(dataConsumer, metricsCollector, 1-rateStep)
+	case '0':
+		dataConsumer.SetRateLimit(0)
+		keyNotice("Rate limit removed")
+	case 'w':
+		dataConsumer.SetWorkers(dataConsumer.Workers() + workerStep)
+		keyNotice(fmt.Sprintf("Workers: %d", dataConsumer.Workers()))
+	case 'W':
+		dataConsumer.SetWorkers(max(dataConsumer.Workers()-workerStep, 1))
+		keyNotice(fmt.Sprintf("Workers: %d", dataConsumer.Workers()))
+	case 'p':
+		if dataConsumer.Paused() {
+			dataConsumer.Resume()
+			keyNotice("Resumed")
+		} else {
+			dataConsumer.Pause()
+			keyNotice("Paused, press p to resume")
+		}
+	case 's':
+		if err := metricsCollector.SaveStatsToFile(config.MetricsFile); err != nil {
+			keyNotice(fmt.Sprintf("Failed to save metrics: %v", err))
+		} else {
+			keyNotice("Metrics saved to " + config.MetricsFile)
+		}
+	case 'h', '?':
+		keyNotice(keyHelp)
+	}
+}
+
+// adjustRateLimit scales the rate limit by factor. Without a limit, lowering
+// starts from the current rate.
+func adjustRateLimit(dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, factor float64) {
+	limit := dataConsumer.RateLimit()
+	if limit == 0 {
+		if factor > 1 {
+			keyNotice("No rate limit set")
+			return
+		}
+		limit = configs.RateFromMBPerMinute(metricsCollector.GetStats().CurrentRate)
+		if limit == 0 {
+			keyNotice("No rate measured yet")
+			return
+		}
+	}
+	limit = configs.Rate(float64(limit) * factor)
+	dataConsumer.SetRateLimit(limit)
+	keyNotice("Rate limit: " + limit.String())
+}
+
+// keyNotice prints a message on its own line, clearing the status line.
+func keyNotice(message string) {
+	fmt.Printf("\r\033[K%s\n", message)
+}
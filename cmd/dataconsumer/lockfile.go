@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"dataconsumer/internal/lock"
+)
+
+// acquireLock takes the lock file at path, if any, and returns a function
+// releasing it. It reports false if another instance holds the lock and
+// force is not set.
+func acquireLock(path string, force bool) (func(), bool) {
+	if path == "" {
+		return func() {}, true
+	}
+	l, err := lock.Acquire(path)
+	var held *lock.HeldError
+	switch {
+	case err == nil:
+		return func() { l.Release() }, true
+	case errors.As(err, &held) && !force:
+		fmt.Fprintf(os.Stderr, "%v; use -force to run anyway\n", err)
+		return nil, false
+	case errors.As(err, &held):
+		logger.Warn("running despite the lock held by another instance", "error", err)
+	default:
+		logger.Warn("failed to take lock file, running without it", "file", path, "error", err)
+	}
+	return func() {}, true
+}
@@ -1,250 +1,79 @@
 package main
 
 import (
-	"flag"
 	"fmt"
-	"log"
 	"os"
-	"os/signal"
-	"path/filepath"
 	"runtime"
-	"strconv"
-	"syscall"
-	"time"
-
-	"dataconsumer/configs"
-	"dataconsumer/internal/consumer"
-	"dataconsumer/internal/metrics"
+	"strings"
 )
 
-func main() {
-	configPath := flag.String("config", "", "Path to configuration file")
-	duration := flag.Int("duration", 0, "Duration to run in minutes (0 for indefinite)")
-	outputMetrics := flag.String("metrics", "dataconsumer_metrics.json", "Path to save metrics")
-	saveInterval := flag.Int("save-interval", 60, "Save metrics every N seconds")
-	flag.Parse()
-
-	fmt.Println("╔════════════════════════════════════════════╗")
-	fmt.Println("║                 DATA CONSUMER v2.0                 ║")
-	fmt.Println("║      High-Performance Network Data Consumer      ║")
-	fmt.Println("║      High-Performance Network Data Consumer      ║")
-	fmt.Println("╚════════════════════════════════════════════╝")
-	fmt.Printf("Running on %s with %d CPU cores\n\n", runtime.GOOS, runtime.NumCPU())
-
-	config := loadConfiguration(*configPath)
-	config = promptForUserInput(config)
-	config.Duration = *duration
-	config.MetricsFile = *outputMetrics
-
-	metricsCollector := metrics.NewCollector()
-	enableMetricsLogging(config, metricsCollector)
-	os.MkdirAll(filepath.Dir(config.MetricsFile), 0755)
-
-	dataConsumer, err := consumer.NewConsumer(config, metricsCollector)
-	if err != nil {
-		log.Fatalf("Failed to initialize consumer: %v", err)
-	}
+// version is overridden at build time with -ldflags "-X main.version=...".
+var version = "2.0.0"
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	startTime := time.Now()
-	fmt.Printf("Starting data consumption targeting at least %d MB/minute\n", config.TargetRate)
-	dataConsumer.Start()
-
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	metricsSaveTicker := time.NewTicker(time.Duration(*saveInterval) * time.Second)
-	defer metricsSaveTicker.Stop()
-
-	fmt.Println("Data consumption started...")
-	fmt.Println("Press Ctrl+C to stop")
-
-	durationTimer := setupDurationTimer(config.Duration)
-	if durationTimer != nil {
-		defer durationTimer.Stop()
-	}
-
-	lastBytes := int64(0)
-	lastTime := time.Now()
-
-	for {
-		select {
-		case <-ticker.C:
-			handleTicker(metricsCollector, &lastBytes, &lastTime)
-		case <-metricsSaveTicker.C:
-			handleMetricsSave(config, metricsCollector)
-		case <-sigChan:
-			handleSignal(dataConsumer, metricsCollector, config.MetricsFile, startTime)
-			return
-		case <-func() <-chan time.Time {
-			if durationTimer != nil {
-				return durationTimer.C
-			}
-			return make(chan time.Time)
-		}():
-			handleDurationComplete(dataConsumer, metricsCollector, config.MetricsFile, startTime)
-			return
-		}
-	}
-}
-
-func loadConfiguration(configPath string) *configs.Config {
-	config := configs.DefaultConfig()
-	if configPath != "" {
-		var err error
-		config, err = configs.LoadConfig(configPath)
-		if err != nil {
-			log.Fatalf("Failed to load configuration: %v", err)
-		}
-	}
-	return config
-}
-
-func promptForUserInput(config *configs.Config) *configs.Config {
-	config = promptForTargetRate(config)
-	config = promptForVerboseLogging(config)
-	config = promptForWorkerCount(config)
-	return config
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
 }
 
-func promptForTargetRate(config *configs.Config) *configs.Config {
-	var targetRateInput string
-	defaultRate := config.TargetRate
-	fmt.Printf("Enter target data consumption rate in MB/min (default: %d, or press Enter for default): ", defaultRate)
-	fmt.Scanln(&targetRateInput)
-	if targetRateInput != "" {
-		if rate, err := strconv.Atoi(targetRateInput); err == nil {
-			config.TargetRate = rate
-		} else {
-			fmt.Printf("Invalid target rate '%s'. Using default: %d MB/min.\n", targetRateInput, defaultRate)
-		}
-	} else {
-		fmt.Printf("Using default target rate: %d MB/min.\n", defaultRate)
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "consume data from the configured sources (default)", runRunCommand},
+		{"daemon", "run headless, controlled through a local socket", runDaemonCommand},
+		{"ctl", "control a running daemon (status, pause, resume, set-rate, stop)", runCtlCommand},
+		{"tray", "show a running daemon's rate in the system tray, with pause and resume", runTrayCommand},
+		{"service", "install and control the Windows service", runServiceCommand},
+		{"serve", "serve test payloads for local consumption runs", runServeCommand},
+		{"coordinator", "share a data cap and bandwidth between instances", runCoordinatorCommand},
+		{"controller", "distribute sources and rates to agents and aggregate their metrics", runControllerCommand},
+		{"agent", "consume data as assigned by a fleet controller", runAgentCommand},
+		{"sources", "inspect the configured data sources", runSourcesCommand},
+		{"schedule", "show when schedules and profile rules apply", runScheduleCommand},
+		{"doctor", "diagnose connectivity to the configured sources", runDoctorCommand},
+		{"metrics", "inspect saved metrics files", runMetricsCommand},
+		{"config", "inspect and migrate configuration files", runConfigCommand},
+		{"report", "print a summary report from a saved metrics file", runReportCommand},
+		{"completion", "print a shell completion script (bash, zsh, fish, powershell)", runCompletionCommand},
+		{"docs", "generate documentation, e.g. the man page", runDocsCommand},
+		{"version", "print version information", runVersionCommand},
+		{"help", "show this help", runHelpCommand},
 	}
-	return config
 }
 
-func promptForVerboseLogging(config *configs.Config) *configs.Config {
-	var verboseInput string
-	defaultVerbose := "N"
-	if config.VerboseLogging {
-		defaultVerbose = "Y"
-	}
-	fmt.Printf("Enable verbose logging? (y/N, default: %s, or press Enter for default): ", defaultVerbose)
-	fmt.Scanln(&verboseInput)
-	if verboseInput == "y" || verboseInput == "Y" {
-		config.VerboseLogging = true
-	} else if verboseInput != "" && verboseInput != "n" && verboseInput != "N" {
-		fmt.Printf("Invalid input '%s'. Using default: %s.\n", verboseInput, defaultVerbose)
-		config.VerboseLogging = defaultVerbose == "Y"
-	} else {
-		fmt.Printf("Using default verbose logging: %s.\n", defaultVerbose)
-	}
-	return config
-}
-
-func promptForWorkerCount(config *configs.Config) *configs.Config {
-	var workersInput string
-	defaultWorkers := runtime.NumCPU()
-	fmt.Printf("Enter the number of workers to use (default: %d, or press Enter for default): ", defaultWorkers)
-	fmt.Scanln(&workersInput)
-	if workersInput != "" {
-		if workers, err := strconv.Atoi(workersInput); err == nil {
-			config.ConcurrencyFactor = workers
-		} else {
-			fmt.Printf("Invalid number of workers '%s'. Using default: %d.\n", workersInput, defaultWorkers)
-		}
-	} else {
-		config.ConcurrencyFactor = defaultWorkers
-		fmt.Printf("Using default number of workers: %d.\n", defaultWorkers)
+func main() {
+	args := os.Args[1:]
+	// Without a subcommand (or with only flags) behave like "run" so
+	// existing invocations keep working.
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		os.Exit(runRunCommand(args))
 	}
-	return config
-}
-
-func enableMetricsLogging(config *configs.Config, metricsCollector *metrics.Collector) {
-	if config.SaveMetrics {
-		logFile := fmt.Sprintf("dataconsumer_log_%s.csv", time.Now().Format("20060102_150405"))
-		if err := metricsCollector.EnableFileLogging(logFile); err != nil {
-			fmt.Printf("Warning: Failed to enable metrics logging: %v\n", err)
-		} else {
-			fmt.Printf("Logging metrics to %s\n", logFile)
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			os.Exit(cmd.run(args[1:]))
 		}
 	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	printUsage()
+	os.Exit(2)
 }
 
-func setupDurationTimer(duration int) *time.Timer {
-	if duration > 0 {
-		fmt.Printf("Will run for %d minutes\n", duration)
-		return time.NewTimer(time.Duration(duration) * time.Minute)
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: dataconsumer <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.name, cmd.summary)
 	}
-	return nil
-}
-
-func handleTicker(metricsCollector *metrics.Collector, lastBytes *int64, lastTime *time.Time) {
-	stats := metricsCollector.GetStats()
-	now := time.Now()
-	bytesSinceLast := stats.BytesTransferred - *lastBytes
-	timeSinceLast := now.Sub(*lastTime).Seconds()
-	currentRate := calculateCurrentRate(bytesSinceLast, timeSinceLast)
-	*lastBytes = stats.BytesTransferred
-	*lastTime = now
-
-	fmt.Printf("\r\033[KData: %.2f MB | Rate: %.2f MB/min | Avg: %.2f MB/min | Peak: %.2f MB/min | Time: %s",
-		float64(stats.BytesTransferred)/1024/1024,
-		currentRate,
-		stats.AverageRate,
-		stats.PeakRate,
-		stats.ElapsedTime.Round(time.Second))
+	fmt.Fprintln(os.Stderr, "\nRun 'dataconsumer <command> -h' for the flags of a command.")
 }
 
-func calculateCurrentRate(bytesSinceLast int64, timeSinceLast float64) float64 {
-	if timeSinceLast > 0 {
-		return float64(bytesSinceLast) / timeSinceLast * 60 / 1024 / 1024
-	}
+func runHelpCommand(args []string) int {
+	printUsage()
 	return 0
 }
 
-func handleMetricsSave(config *configs.Config, metricsCollector *metrics.Collector) {
-	if config.SaveMetrics {
-		if err := metricsCollector.SaveStatsToFile(config.MetricsFile); err != nil {
-			fmt.Printf("\nWarning: Failed to save metrics: %v\n", err)
-		}
-	}
-}
-
-func handleSignal(dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, metricsFile string, startTime time.Time) {
-	fmt.Println("\n\nReceived interrupt, shutting down...")
-	dataConsumer.Stop()
-	saveAndPrintSummary(metricsCollector, metricsFile, startTime)
-}
-
-func handleDurationComplete(dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, metricsFile string, startTime time.Time) {
-	fmt.Println("\n\nDuration completed, shutting down...")
-	dataConsumer.Stop()
-	saveAndPrintSummary(metricsCollector, metricsFile, startTime)
-}
-
-func saveAndPrintSummary(m *metrics.Collector, metricsFile string, startTime time.Time) {
-	stats := m.GetStats()
-	totalRuntime := time.Since(startTime)
-
-	if err := m.SaveStatsToFile(metricsFile); err != nil {
-		fmt.Printf("Warning: Failed to save final metrics: %v\n", err)
-	} else {
-		fmt.Printf("Final metrics saved to %s\n", metricsFile)
-	}
-
-	fmt.Println("\n╔════════════════════════════════════════════╗")
-	fmt.Println("║                   FINAL SUMMARY                  ║")
-	fmt.Println("╚════════════════════════════════════════════╝")
-	fmt.Printf("Total data consumed: %.2f MB (%.2f GB)\n", stats.TotalMegabytes, stats.TotalMegabytes/1024)
-	fmt.Printf("Average rate: %.2f MB/min\n", stats.AverageRate)
-	fmt.Printf("Peak rate: %.2f MB/min\n", stats.PeakRate)
-	fmt.Printf("Last rate: %.2f MB/min\n", stats.CurrentRate)
-	fmt.Printf("Total runtime: %s\n", totalRuntime.Round(time.Second))
+func runVersionCommand(args []string) int {
+	fmt.Printf("dataconsumer %s (%s, %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return 0
 }
-
-// cat
-// dog
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"dataconsumer/pkg/metrics"
+)
+
+const metricsUsage = `usage: dataconsumer metrics <command>
+
+commands:
+  show [-format json|yaml] <file>    print a saved metrics file
+  export [flags] <file>              export latency distributions for HdrHistogram tools
+  sessions [-index file]             list past scheduled sessions
+  compare [flags] <before> <after>   compare two runs and flag regressions`
+
+func runMetricsCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, metricsUsage)
+		return 2
+	}
+	switch args[0] {
+	case "show":
+		return runMetricsShow(args[1:])
+	case "export":
+		return runMetricsExport(args[1:])
+	case "sessions":
+		return runMetricsSessions(args[1:])
+	case "compare":
+		return runMetricsCompare(args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "unknown metrics command %q\n", args[0])
+	return 2
+}
+
+func runMetricsShow(args []string) int {
+	fs := flag.NewFlagSet("metrics show", flag.ExitOnError)
+	format := fs.String("format", "json", "Output format: json or yaml")
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, metricsUsage)
+		return 2
+	}
+
+	stats, err := metrics.LoadStatsFromFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load metrics: %v\n", err)
+		return 1
+	}
+	var data []byte
+	switch *format {
+	case "json":
+		data, err = json.MarshalIndent(stats, "", "  ")
+		data = append(data, '\n')
+	case "yaml":
+		data, err = marshalYAML(stats)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q (want json or yaml)\n", *format)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode metrics: %v\n", err)
+		return 1
+	}
+	os.Stdout.Write(data)
+	return 0
+}
+
+func runMetricsExport(args []string) int {
+	fs := flag.NewFlagSet("metrics export", flag.ExitOnError)
+	format := fs.String("format", "hdr", "Output format: hdr (HdrHistogram log) or percentiles (.hgrm table)")
+	histogram := fs.String("histogram", "latency", "Distribution to export: latency (whole requests) or ttfb (time to first byte)")
+	output := fs.String("o", "", "Write to this file instead of stdout")
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, metricsUsage)
+		return 2
+	}
+
+	stats, err := metrics.LoadStatsFromFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load metrics: %v\n", err)
+		return 1
+	}
+	var h *metrics.Histogram
+	switch *histogram {
+	case "latency":
+		h = stats.Latency
+	case "ttfb":
+		h = stats.TTFB
+	default:
+		fmt.Fprintf(os.Stderr, "unknown histogram %q (want latency or ttfb)\n", *histogram)
+		return 2
+	}
+	if *format != "hdr" && *format != "percentiles" {
+		fmt.Fprintf(os.Stderr, "unknown format %q (want hdr or percentiles)\n", *format)
+		return 2
+	}
+	if h.Count() == 0 {
+		fmt.Fprintf(os.Stderr, "%s has no %s distribution\n", fs.Arg(0), *histogram)
+		return 1
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", *output, err)
+			return 1
+		}
+	}
+	if *format == "hdr" {
+		err = metrics.WriteHistogramLog(out, h, stats.StartTime, stats.LastUpdated)
+	} else {
+		err = metrics.WritePercentiles(out, h)
+	}
+	if out != os.Stdout {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export metrics: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runReportCommand(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: dataconsumer report <metrics file>")
+		return 2
+	}
+
+	stats, err := metrics.LoadStatsFromFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load metrics: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Run started %s\n", stats.StartTime.Format(time.RFC1123))
+	printSummary(stats, stats.ElapsedTime)
+	return 0
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/logging"
+	"dataconsumer/pkg/metrics"
+)
+
+// logger is the command line's logger; setupLogging replaces it.
+var logger = slog.Default()
+
+// logLevel is the level of the logger installed by setupLogging, kept
+// separately so it can follow verbosity changes made at the prompts.
+var logLevel = new(slog.LevelVar)
+
+// logFlags holds the logging flags of a command.
+type logFlags struct {
+	target     string
+	format     string
+	file       string
+	maxSize    configs.Size
+	interval   time.Duration
+	maxBackups int
+	retention  time.Duration
+}
+
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	l := &logFlags{maxSize: 10 << 20}
+	fs.StringVar(&l.target, "log-target", "", "Where to log: stderr, file, syslog, syslog://host:port, journald or eventlog (default stderr, or file with -log-file)")
+	fs.StringVar(&l.format, "log-format", "text", "Log format: text or json")
+	fs.StringVar(&l.file, "log-file", "", "Write logs to this file instead of stderr")
+	fs.Var(&l.maxSize, "log-max-size", "Rotate the log file at this size, e.g. 10MiB (0 disables)")
+	fs.DurationVar(&l.interval, "log-rotate-every", 0, "Rotate the log file after this long, e.g. 24h (0 disables)")
+	fs.IntVar(&l.maxBackups, "log-max-backups", 5, "Number of rotated log files to keep (0 keeps all)")
+	fs.DurationVar(&l.retention, "log-retention", 0, "Delete rotated log files older than this, e.g. 168h (0 disables)")
+	return l
+}
+
+// setupLogging installs a logger at the level implied by the configured
+// verbosity, writing to the -log-target: stderr, the -log-file or the
+// host's logging system. It becomes slog's default, which the consumer
+// and metrics collector pick up. The returned function closes the log
+// file or connection.
+func setupLogging(config *configs.Config, flags *logFlags) (func(), error) {
+	logLevel.Set(logging.LevelFor(config.Verbosity))
+	target := flags.target
+	if target == "" {
+		target = "stderr"
+		if flags.file != "" {
+			target = "file"
+		}
+	}
+	switch target {
+	case "stderr":
+		if flags.file != "" {
+			return nil, fmt.Errorf("-log-file needs -log-target file")
+		}
+	case "file":
+		if flags.file == "" {
+			return nil, fmt.Errorf("-log-target file needs -log-file")
+		}
+	default:
+		base, closeTarget, err := logging.OpenTarget(target, logLevel)
+		if err != nil {
+			return nil, err
+		}
+		installLogger(base)
+		return func() { closeTarget() }, nil
+	}
+
+	var w io.Writer = os.Stderr
+	closeLog := func() {}
+	if flags.file != "" {
+		file, err := logging.NewRotatingFile(flags.file, logging.RotateOptions{
+			MaxSize:    flags.maxSize.Bytes(),
+			Interval:   flags.interval,
+			MaxBackups: flags.maxBackups,
+			Retention:  flags.retention,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("opening log file: %w", err)
+		}
+		w = file
+		closeLog = func() { file.Close() }
+	}
+
+	base, err := logging.New(w, flags.format, logLevel)
+	if err != nil {
+		closeLog()
+		return nil, err
+	}
+	installLogger(base)
+	return closeLog, nil
+}
+
+// installLogger makes base, with the run ID added, slog's default and
+// derives the command line's logger from it.
+func installLogger(base *slog.Logger) {
+	base = base.With("run_id", runID)
+	slog.SetDefault(base)
+	logger = base.With("component", "main")
+}
+
+// jsonOutput is set when -output json is selected. Status updates are then
+// written to it as newline-delimited JSON and all other output goes to
+// stderr.
+var jsonOutput *json.Encoder
+
+// outputEvent is one line of -output json.
+type outputEvent struct {
+	Event            string       `json:"event"`
+	Time             time.Time    `json:"time"`
+	RunID            string       `json:"run_id"`
+	Job              string       `json:"job,omitempty"`
+	Reason           string       `json:"reason,omitempty"`
+	TargetRate       configs.Rate `json:"target_rate,omitempty"`
+	BytesTransferred int64        `json:"bytes_transferred"`
+	TotalMegabytes   float64      `json:"total_mb"`
+	CurrentRate      float64      `json:"current_rate_mb_min"`
+	AverageRate      float64      `json:"average_rate_mb_min"`
+	PeakRate         float64      `json:"peak_rate_mb_min"`
+	ElapsedSeconds   float64      `json:"elapsed_seconds"`
+	Passed           *bool        `json:"passed,omitempty"`
+	Failures         []string     `json:"failures,omitempty"`
+}
+
+// setOutputFormat selects "text", "json", "speedtest" or "ookla" output.
+func setOutputFormat(format string) error {
+	switch format {
+	case "", "text":
+		return nil
+	case "json":
+		jsonOutput = json.NewEncoder(os.Stdout)
+	case "speedtest", "ookla":
+		resultOutput = json.NewEncoder(os.Stdout)
+		resultOutput.SetEscapeHTML(false)
+		resultFormat = format
+	default:
+		return fmt.Errorf("unknown output format %q (want text, json, speedtest or ookla)", format)
+	}
+	// Anything printed outside the JSON documents goes to stderr so stdout
+	// stays parseable.
+	os.Stdout = os.Stderr
+	return nil
+}
+
+// emitEvent writes a JSON event when -output json is active.
+func emitEvent(event, reason string, stats metrics.Stats, currentRate float64) {
+	if jsonOutput == nil {
+		return
+	}
+	jsonOutput.Encode(outputEvent{
+		Event:            event,
+		Time:             time.Now(),
+		RunID:            runID,
+		Reason:           reason,
+		BytesTransferred: stats.BytesTransferred,
+		TotalMegabytes:   float64(stats.BytesTransferred) / 1024 / 1024,
+		CurrentRate:      currentRate,
+		AverageRate:      stats.AverageRate,
+		PeakRate:         stats.PeakRate,
+		ElapsedSeconds:   stats.ElapsedTime.Seconds(),
+	})
+}
+
+// emitStart writes the JSON event for the start of a session.
+func emitStart(targetRate configs.Rate) {
+	if jsonOutput == nil {
+		return
+	}
+	jsonOutput.Encode(outputEvent{Event: "start", Time: time.Now(), RunID: runID, TargetRate: targetRate})
+}
+
+// emitResult writes the JSON event for the success criteria outcome of
+// the run, or of one of its config jobs if job is set.
+func emitResult(job string, failures []string) {
+	if jsonOutput == nil {
+		return
+	}
+	passed := len(failures) == 0
+	jsonOutput.Encode(outputEvent{Event: "result", Time: time.Now(), RunID: runID, Job: job, Passed: &passed, Failures: failures})
+}
+
+// verbosityFlags holds the -q, -v and -vv flags of a command.
+type verbosityFlags struct {
+	quiet, verbose, debug bool
+}
+
+func addVerbosityFlags(fs *flag.FlagSet) *verbosityFlags {
+	v := &verbosityFlags{}
+	fs.BoolVar(&v.quiet, "q", false, "Quiet: no banner or periodic status lines")
+	fs.BoolVar(&v.quiet, "quiet", false, "Same as -q")
+	fs.BoolVar(&v.verbose, "v", false, "Verbose: also report per-request errors and retries")
+	fs.BoolVar(&v.verbose, "verbose", false, "Same as -v")
+	fs.BoolVar(&v.debug, "vv", false, "Debug: also trace connections and completed requests")
+	return v
+}
+
+// apply overrides the configured verbosity if one of the flags was given
+// and reports whether it did.
+func (v *verbosityFlags) apply(config *configs.Config) bool {
+	switch {
+	case v.debug:
+		config.Verbosity = configs.Debug
+	case v.verbose:
+		config.Verbosity = configs.Verbose
+	case v.quiet:
+		config.Verbosity = configs.Quiet
+	default:
+		return false
+	}
+	return true
+}
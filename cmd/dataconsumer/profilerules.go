@@ -0,0 +1,59 @@
+package main
+
+import (
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/scheduler"
+	"dataconsumer/pkg/consumer"
+)
+
+// profileRuleCheck is how often a session checks which profile rule is in
+// effect.
+const profileRuleCheck = 30 * time.Second
+
+// watchProfileRules applies the target rate and bandwidth ceiling of the
+// profile whose rule is in effect to the running consumer, and the
+// session's own settings while no rule is, until done is closed.
+func watchProfileRules(config *configs.Config, dataConsumer *consumer.Consumer, done <-chan struct{}) {
+	if len(config.ProfileRules) == 0 {
+		return
+	}
+	rules, err := scheduler.NewRules(config.ProfileRules, config.Profiles)
+	if err != nil {
+		logger.Warn("ignoring invalid profile rules", "error", err)
+		return
+	}
+	var current configs.ProfileRule
+	active := false
+	apply := func(now time.Time) {
+		rule, ok := rules.At(now)
+		if ok == active && rule.Profile == current.Profile {
+			return
+		}
+		current, active = rule, ok
+		settings := config
+		if ok {
+			settings, _ = config.WithProfile(rule.Profile)
+			logger.Info("profile rule in effect", "profile", rule.Profile, "days", rule.Days, "from", rule.From, "to", rule.To)
+		} else {
+			logger.Info("no profile rule in effect, using the session's settings")
+		}
+		dataConsumer.SetTargetRate(settings.TargetRate)
+		dataConsumer.SetRateLimit(settings.MaxBandwidth)
+	}
+	// Without a rule in effect at the start there is nothing to change.
+	apply(time.Now())
+	go func() {
+		ticker := time.NewTicker(profileRuleCheck)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				apply(now)
+			}
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/state"
+	"dataconsumer/pkg/metrics"
+)
+
+// progressWidth is the number of cells in the progress bar.
+const progressWidth = 30
+
+// progressBar draws the progress of a session towards its duration and
+// data cap, whichever it will reach first, in place of the status line.
+type progressBar struct {
+	duration time.Duration
+	maxData  configs.Size
+	// doneTime and doneBytes are the progress of a resumed run before
+	// this session, counted towards the same targets.
+	doneTime  time.Duration
+	doneBytes int64
+}
+
+// newProgressBar returns a bar for the remaining duration and data cap, or
+// nil if the session has neither.
+func newProgressBar(duration time.Duration, maxData configs.Size, resumed *state.State) *progressBar {
+	if duration <= 0 && maxData <= 0 {
+		return nil
+	}
+	bar := &progressBar{duration: duration, maxData: maxData}
+	if resumed != nil {
+		bar.doneTime = resumed.Elapsed
+		bar.doneBytes = resumed.BytesTransferred
+	}
+	return bar
+}
+
+// fraction returns how far the session is towards its nearest target,
+// between 0 and 1, and the estimated time left.
+func (b *progressBar) fraction(stats metrics.Stats) (float64, time.Duration) {
+	var done float64
+	eta := time.Duration(-1)
+	if b.duration > 0 {
+		done = float64(b.doneTime+stats.ElapsedTime) / float64(b.doneTime+b.duration)
+		eta = b.duration - stats.ElapsedTime
+	}
+	if b.maxData > 0 {
+		total := b.doneBytes + b.maxData.Bytes()
+		if f := float64(b.doneBytes+stats.BytesTransferred) / float64(total); f > done {
+			done = f
+		}
+		rate := configs.RateFromMBPerMinute(stats.AverageRate).BytesPerSecond()
+		if rate > 0 {
+			left := float64(b.maxData.Bytes()-stats.BytesTransferred) / rate
+			if dataETA := time.Duration(left * float64(time.Second)); eta < 0 || dataETA < eta {
+				eta = dataETA
+			}
+		}
+	}
+	return min(done, 1), eta
+}
+
+// draw redraws the bar on the current terminal line.
+func (b *progressBar) draw(stats metrics.Stats) {
+	done, eta := b.fraction(stats)
+	filled := int(done * progressWidth)
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressWidth-filled)
+
+	amount := configs.Size(b.doneBytes + stats.BytesTransferred).String()
+	if b.maxData > 0 {
+		amount += " / " + configs.Size(b.doneBytes+b.maxData.Bytes()).String()
+	}
+	remaining := "--"
+	if eta >= 0 {
+		remaining = eta.Round(time.Second).String()
+	}
+	fmt.Printf("\r\033[K%3.0f%% %s %s | %.2f MB/min | ETA %s", done*100, bar, amount, stats.CurrentRate, remaining)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/pushgateway"
+	"dataconsumer/pkg/metrics"
+)
+
+// startPushing adds a sink pushing the session's metrics to the configured
+// Pushgateway, if any. It pushes while the session runs and once more
+// with the final metrics when the collector stops.
+func startPushing(config *configs.PushgatewayConfig, metricsCollector *metrics.Collector) {
+	if config == nil || config.URL == "" {
+		return
+	}
+	job, instance := config.Job, config.Instance
+	if job == "" {
+		job = "dataconsumer"
+	}
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	labels := map[string]string{"instance": instance}
+	for name, value := range config.Labels {
+		labels[name] = value
+	}
+	pusher := pushgateway.New(config.URL, job, labels)
+	metricsCollector.AddSink(pusher.Sink(time.Duration(config.Interval) * time.Second))
+}
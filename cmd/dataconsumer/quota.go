@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/quota"
+	"dataconsumer/internal/secure"
+	"dataconsumer/pkg/consumer"
+	"dataconsumer/pkg/metrics"
+)
+
+const (
+	// quotaInterval is how often instances report to the coordinator.
+	quotaInterval = 5 * time.Second
+	// quotaExpiry is how long an instance keeps its share of the bandwidth
+	// after its last report.
+	quotaExpiry = 3 * quotaInterval
+)
+
+func runCoordinatorCommand(args []string) int {
+	fs := flag.NewFlagSet("coordinator", flag.ExitOnError)
+	addr := fs.String("addr", ":9300", "Address to listen on")
+	var limits quota.Limits
+	fs.Var(&limits.MaxData, "max-data", "Combined data cap of all instances, e.g. 500GB")
+	fs.Var(&limits.MaxBandwidth, "max-bandwidth", "Combined bandwidth ceiling, split evenly between instances")
+	fs.Var(&limits.TargetRate, "target-rate", "Combined target rate, split evenly between instances")
+	security := addServerSecurityFlags(fs)
+	parseFlags(fs, args)
+	security.Token = secure.Token(security.Token)
+	if err := security.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	coordinator := quota.NewCoordinator(limits, quotaExpiry)
+	fmt.Printf("Coordinating instances on %s://%s\n", security.Scheme(), *addr)
+	server := &http.Server{Addr: *addr, Handler: security.Handler(quota.NewHTTPHandler(coordinator))}
+	if err := security.ListenAndServe(server); err != nil {
+		fmt.Fprintf(os.Stderr, "Coordinator failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// quotaInstanceName identifies a session of this process to the
+// coordinator. Every session reports the bytes of its own collector from
+// zero, so each needs a name of its own for the coordinator to add them up.
+func quotaInstanceName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "dataconsumer"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), newRunID()[:8])
+}
+
+// watchQuota reports progress to the configured coordinator, applies the
+// granted share of the combined bandwidth ceiling and reports when the
+// combined data cap has been reached. While the coordinator cannot be
+// reached the last grant stays in effect.
+func watchQuota(config *configs.Config, dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, done <-chan struct{}) <-chan struct{} {
+	if config.Coordinator == "" {
+		return nil
+	}
+	httpClient, err := envHTTPClient()
+	if err != nil {
+		logger.Warn("not reporting to the coordinator", "coordinator", config.Coordinator, "error", err)
+		return nil
+	}
+	client := quota.NewClient(config.Coordinator, quotaInstanceName(), httpClient)
+	exhausted := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(quotaInterval)
+		defer ticker.Stop()
+		reachable := true
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), quotaInterval)
+			grant, err := client.Report(ctx, metricsCollector.GetStats().BytesTransferred)
+			cancel()
+			switch {
+			case err != nil:
+				if reachable {
+					logger.Warn("coordinator unreachable, keeping the current share", "coordinator", config.Coordinator, "error", err)
+				}
+				reachable = false
+			case grant.Exhausted:
+				close(exhausted)
+				return
+			default:
+				if !reachable {
+					logger.Info("coordinator reachable again", "coordinator", config.Coordinator)
+				}
+				reachable = true
+				applyGrant(grant, config, dataConsumer)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return exhausted
+}
+
+// applyGrant sets the rate limit to this instance's share, never above the
+// local max_bandwidth.
+func applyGrant(grant quota.Grant, config *configs.Config, dataConsumer *consumer.Consumer) {
+	limit := grant.RateLimit
+	if local := config.MaxBandwidth; local > 0 && (limit == 0 || local < limit) {
+		limit = local
+	}
+	if limit != dataConsumer.RateLimit() {
+		dataConsumer.SetRateLimit(limit)
+		logger.Info("applied coordinator share", "rate_limit", limit, "target_rate", grant.TargetRate, "instances", grant.Instances)
+	}
+}
+
+func handleSharedCapReached(dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, metricsFile string, startTime time.Time) {
+	fmt.Println("\n\nShared data cap reached, shutting down...")
+	dataConsumer.Stop()
+	saveAndPrintSummary(metricsCollector, metricsFile, startTime, "data_cap")
+}
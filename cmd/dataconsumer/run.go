@@ -0,0 +1,1075 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/control"
+	"dataconsumer/internal/logging"
+	"dataconsumer/internal/plugin"
+	"dataconsumer/internal/scheduler"
+	"dataconsumer/internal/state"
+	"dataconsumer/internal/systemd"
+	"dataconsumer/pkg/consumer"
+	"dataconsumer/pkg/metrics"
+)
+
+func runRunCommand(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to configuration file")
+	var duration configs.Duration
+	fs.Var(&duration, "duration", "How long to run, e.g. 90s or 2h30m; a bare number is minutes (0 for indefinite; overrides config)")
+	var until, startAt clockFlag
+	fs.Var(&until, "until", "Stop at this time, e.g. 23:00 or 2025-07-01T06:00")
+	fs.Var(&until, "end-at", "Same as -until (overrides end_at in config)")
+	fs.Var(&startAt, "start-at", "Wait until this time before starting, e.g. 22:00 or 2025-07-01T01:00")
+	outputMetrics := fs.String("metrics", "dataconsumer_metrics.json", "Path to save metrics")
+	saveInterval := fs.Int("save-interval", 60, "Save metrics every N seconds")
+	var maxBandwidth configs.Rate
+	var maxData configs.Size
+	fs.Var(&maxBandwidth, "max-bandwidth", "Bandwidth ceiling, e.g. 200Mbps or 1.5 GB/min")
+	fairShare := fs.Float64("fair-share", 0, "Keep consumption at this percentage of the measured link capacity, e.g. 60 (overrides config)")
+	fs.Var(&maxData, "max-data", "Stop after consuming this much data, e.g. 50GiB")
+	targetRPS := fs.Float64("target-rps", 0, "Aim for this many requests per second instead of a data rate (overrides config)")
+	var objectSize configs.Size
+	fs.Var(&objectSize, "object-size", "Download only this much of each response, e.g. 64KiB, using Range requests (overrides config)")
+	printEffective := fs.String("print-config", "", "Print the effective config (defaults, config file, flags and prompts) as json or yaml and exit")
+	dryRun := fs.Bool("dry-run", false, "Print the sources, workers, rate, schedule and expected data volume of the run and exit without sending traffic")
+	apiAddr := fs.String("api-addr", "", "Address for the HTTP control API (overrides config)")
+	grpcAddr := fs.String("grpc-addr", "", "Address for the gRPC control API (overrides config)")
+	output := fs.String("output", "text", "Status output format: text, json for newline-delimited JSON on stdout, or speedtest or ookla for a result document in that tool's JSON format")
+	verbosity := addVerbosityFlags(fs)
+	logOptions := addLogFlags(fs)
+	var minAverageRate configs.Rate
+	fs.Var(&minAverageRate, "min-avg-rate", "Fail (exit 3) if the average rate stays below this, e.g. 500MB/min")
+	maxErrorRate := fs.Float64("max-error-rate", 0, "Fail (exit 3) if more than this percentage of requests fail")
+	requireTarget := fs.Bool("require-target", false, "Fail (exit 3) unless the run reaches its duration or data cap")
+	stateFile := fs.String("state-file", "", "Checkpoint progress to this file")
+	resume := fs.Bool("resume", false, "Continue the run checkpointed in -state-file, by default in the user cache directory, towards the same duration and data cap")
+	maxErrors := fs.Int("max-errors", 0, "Stop (exit 4) after this many failed requests")
+	var abortBelow abortFlag
+	fs.Var(&abortBelow, "abort-if-below", "Stop (exit 4) once the rate stays below RATE for DURATION, e.g. \"50MB/min for 5m\"")
+	coordinator := fs.String("coordinator", "", "URL of a quota coordinator to share the data cap and bandwidth with other instances")
+	pushgatewayURL := fs.String("pushgateway", "", "Push metrics to the Prometheus Pushgateway at this URL (overrides config)")
+	saveTo := fs.String("save-to", "", "Save the downloaded objects under this directory instead of discarding them (overrides config)")
+	traceFile := fs.String("trace", "", "Append HTTP transaction traces of sampled requests to this file as JSON lines")
+	traceSample := fs.Float64("trace-sample", 0.1, "Fraction of requests to trace with -trace (0 to 1)")
+	lockFile := fs.String("lock-file", "", "Refuse to run while another instance holds this lock file (overrides config)")
+	progress := fs.Bool("progress", false, "Show a progress bar with ETA towards -duration or -max-data instead of the status line")
+	force := fs.Bool("force", false, "Run even if another instance holds the lock file")
+	shutdownGrace := fs.Int("shutdown-grace", -1, "Seconds to wait for downloads to stop before closing their connections (0 waits indefinitely; default from config)")
+	mode := fs.String("mode", "run", "run, sweep to measure the rate at 1, 2, 4, ... workers, or bdp to size the workers to the bandwidth-delay product, and recommend a concurrency_factor")
+	sweepWindow := fs.Duration("sweep-window", 10*time.Second, "How long -mode sweep measures each worker count")
+	sweepMax := fs.Int("sweep-max", 256, "Highest worker count -mode sweep measures")
+	bdpWindow := fs.Duration("bdp-window", 5*time.Second, "How long -mode bdp measures each source")
+	writeConfig := fs.Bool("write-config", false, "With -mode sweep or bdp, save the recommended concurrency_factor to the config file")
+	maxConnsPerSource := fs.Int("max-conns-per-source", 0, "Send at most this many requests to one source host at once (overrides config)")
+	autoWorkersFlag := fs.Bool("auto-workers", false, "Size the workers to the bandwidth-delay product of the sources before starting (overrides config)")
+	var targetRate configs.Rate
+	fs.Var(&targetRate, "target-rate", "Target data rate, e.g. 1024 or 1.5 GB/min, instead of asking for it (overrides config)")
+	workers := fs.Int("workers", 0, "Number of workers, instead of asking for it (overrides config)")
+	nonInteractive := fs.Bool("non-interactive", false, "Do not prompt; use the values of the config and flags")
+	fs.BoolVar(nonInteractive, "yes", false, "Same as -non-interactive")
+	parseFlags(fs, args)
+	if *workers < 0 || *workers > configs.MaxConcurrency {
+		fmt.Fprintf(os.Stderr, "-workers must be between 1 and %d\n", configs.MaxConcurrency)
+		return 2
+	}
+	if *mode != "run" && *mode != "sweep" && *mode != "bdp" {
+		fmt.Fprintf(os.Stderr, "unknown -mode %q, want run, sweep or bdp\n", *mode)
+		return 2
+	}
+	if err := setOutputFormat(*output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *traceSample < 0 || *traceSample > 1 {
+		fmt.Fprintln(os.Stderr, "-trace-sample must be between 0 and 1")
+		return 2
+	}
+
+	config := loadConfiguration(*configPath)
+	verbositySet := verbosity.apply(config)
+	closeLog, err := setupLogging(config, logOptions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer closeLog()
+	if *lockFile != "" {
+		config.LockFile = *lockFile
+	}
+	if !*dryRun {
+		unlock, ok := acquireLock(config.LockFile, *force)
+		if !ok {
+			return 1
+		}
+		defer unlock()
+	}
+	if !machineOutput() && !*dryRun && config.Verbosity > configs.Quiet {
+		printBanner()
+	}
+	if path := resolveConfigPath(*configPath); path != "" {
+		logger.Info("using configuration", "path", path)
+	}
+	if targetRate > 0 {
+		config.TargetRate = targetRate
+	}
+	if *workers > 0 {
+		config.ConcurrencyFactor = *workers
+	}
+	if *mode == "sweep" {
+		return runSweep(config, resolveConfigPath(*configPath), *sweepWindow, *sweepMax, *writeConfig)
+	}
+	if *mode == "bdp" {
+		return runBDP(config, resolveConfigPath(*configPath), *bdpWindow, *writeConfig)
+	}
+	if *autoWorkersFlag {
+		config.AutoWorkers = true
+	}
+	if *targetRPS > 0 {
+		config.TargetRPS = *targetRPS
+	}
+	if objectSize > 0 {
+		config.ObjectSize = objectSize
+	}
+	// Machine output is meant for wrapper scripts, which cannot answer
+	// prompts, and a dry run shows the plan the config describes.
+	if !machineOutput() && !*dryRun && !*nonInteractive {
+		config = promptForUserInput(config, prompts{
+			targetRate: targetRate <= 0,
+			verbosity:  !verbositySet,
+			workers:    *workers == 0,
+		})
+		logLevel.Set(logging.LevelFor(config.Verbosity))
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "duration" {
+			config.Duration = duration
+		}
+	})
+	if until.isSet() {
+		config.EndAt = until.value
+	} else if config.EndAt != "" {
+		// loadConfiguration has checked it.
+		until.Set(config.EndAt)
+	}
+	config.MetricsFile = *outputMetrics
+	if maxBandwidth > 0 {
+		config.MaxBandwidth = maxBandwidth
+	}
+	if maxData > 0 {
+		config.MaxData = maxData
+	}
+	if *maxConnsPerSource > 0 {
+		config.MaxConnsPerSource = *maxConnsPerSource
+	}
+	if *fairShare != 0 {
+		if config.FairShare == nil {
+			config.FairShare = &configs.FairShareConfig{}
+		}
+		config.FairShare.Percent = *fairShare
+		if err := config.FairShare.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "-fair-share: %v\n", err)
+			return 2
+		}
+	}
+	applyAPIFlags(config, *apiAddr, *grpcAddr)
+	applySuccessFlags(config, minAverageRate, *maxErrorRate, *requireTarget)
+	applyStopFlags(config, *maxErrors, abortBelow)
+	if *coordinator != "" {
+		config.Coordinator = *coordinator
+	}
+	if *pushgatewayURL != "" {
+		if config.Pushgateway == nil {
+			config.Pushgateway = &configs.PushgatewayConfig{}
+		}
+		config.Pushgateway.URL = *pushgatewayURL
+	}
+	if *shutdownGrace >= 0 {
+		config.ShutdownGrace = *shutdownGrace
+	}
+	if *saveTo != "" {
+		if config.SaveTo == nil {
+			config.SaveTo = &configs.SaveToConfig{}
+		}
+		config.SaveTo.Dir = *saveTo
+	}
+	if *printEffective != "" {
+		return printConfig(config, *printEffective)
+	}
+	if *dryRun {
+		start, end, err := runWindow(startAt, until)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		return printPlan(config, start, end)
+	}
+	var resumed *state.State
+	if *resume {
+		if *stateFile == "" {
+			if *stateFile, err = state.DefaultPath(); err != nil {
+				fmt.Fprintf(os.Stderr, "-resume needs a -state-file: %v\n", err)
+				return 1
+			}
+		}
+		resumed, err = loadResumeState(*stateFile, config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if resumed != nil && resumed.Completed {
+			fmt.Println("The checkpointed run has already completed, nothing to resume")
+			return 0
+		}
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	controller := newSessionController(config, false)
+	var api control.Controller = controller
+	var group *jobGroup
+	if len(config.Jobs) > 0 {
+		if group, err = newJobGroup(config); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid jobs: %v\n", err)
+			return 1
+		}
+		api = group
+	}
+	serveAPI(config, api)
+	ready := announceReady()
+	defer close(ready)
+	opts := runOptions{
+		saveInterval: *saveInterval,
+		progress:     *progress,
+		sigChan:      sigChan,
+		stop:         controller.stop,
+		onStart:      controller.attach,
+		onEnd:        controller.detach,
+	}
+	if *traceFile != "" {
+		file, err := os.OpenFile(*traceFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open trace file: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		opts.tracer = consumer.NewTracer(file, *traceSample)
+		logger.Info("tracing requests", "file", *traceFile, "sample", *traceSample)
+	}
+	start, end, err := runWindow(startAt, until)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if group != nil {
+		// Checkpoints and key presses control a single session.
+		opts.until = end
+		if !waitUntil(start, sigChan) {
+			return 0
+		}
+		return group.run(opts)
+	}
+	if !machineOutput() {
+		keys, restore := startKeyboard()
+		defer restore()
+		opts.keys = keys
+	}
+	if len(config.Schedules) > 0 {
+		return runSchedules(controller, opts)
+	}
+	// Checkpoints track a single run, not a series of scheduled windows.
+	opts.statePath = *stateFile
+	opts.resumed = resumed
+	opts.until = end
+	if !waitUntil(start, sigChan) {
+		return 0
+	}
+	result := runSession(controller.snapshot(), opts)
+	return sessionStatus("", config.Success, result)
+}
+
+// loadResumeState reads the checkpoint at path. A missing file means there
+// is nothing to resume and yields nil. The returned state is marked
+// completed if its progress already meets the configured targets.
+func loadResumeState(path string, config *configs.Config) (*state.State, error) {
+	resumed, err := state.Load(path)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Info("no checkpoint to resume, starting from zero", "file", path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading checkpoint: %w", err)
+	}
+	leftTime, leftData := resumed.Remaining(config.Duration, config.MaxData)
+	if (config.Duration > 0 && leftTime <= 0) || (config.MaxData > 0 && leftData <= 0) {
+		resumed.Completed = true
+	}
+	if !resumed.Completed {
+		logger.Info("resuming checkpointed run", "file", path,
+			"consumed", configs.Size(resumed.BytesTransferred).String(), "elapsed", resumed.Elapsed.Round(time.Second).String())
+	}
+	return resumed, nil
+}
+
+func printBanner() {
+	fmt.Println("╔════════════════════════════════════════════╗")
+	fmt.Println("║                 DATA CONSUMER v2.0                 ║")
+	fmt.Println("║      High-Performance Network Data Consumer      ║")
+	fmt.Println("║      High-Performance Network Data Consumer      ║")
+	fmt.Println("╚════════════════════════════════════════════╝")
+	fmt.Printf("Running on %s with %d CPU cores\n\n", runtime.GOOS, runtime.NumCPU())
+}
+
+// runOptions controls how a session is driven and reported.
+type runOptions struct {
+	saveInterval int
+	sigChan      <-chan os.Signal
+	// headless prints status updates as plain lines instead of
+	// redrawing a single terminal line.
+	headless bool
+	// progress shows a progress bar towards the duration or data cap
+	// instead of the status line, if the session has either.
+	progress bool
+	// stop ends the session on request, e.g. from the control API.
+	stop <-chan struct{}
+	// keys delivers key presses for live control of interactive runs.
+	keys <-chan byte
+	// statePath, if set, receives checkpoints of the session's progress,
+	// counted on top of the resumed progress if any.
+	statePath string
+	resumed   *state.State
+	// tracer, if set, records sampled HTTP transactions.
+	tracer *consumer.Tracer
+	// until, if set, ends the session at that time or after its duration,
+	// whichever comes first.
+	until time.Time
+	// onStart, if set, is called once the session's consumer is running
+	// and onEnd after it has shut down.
+	onStart func(*consumer.Consumer, *metrics.Collector)
+	onEnd   func()
+	// job names the config job the session runs for. Its status line and
+	// summary are then left to the job group, which reports all its jobs.
+	job string
+}
+
+// sessionResult describes how a session ended.
+type sessionResult struct {
+	// reason is "signal", "stop_request", "duration" or "data_cap".
+	reason string
+	stats  metrics.Stats
+	health []consumer.SourceHealth
+}
+
+func (r sessionResult) interrupted() bool {
+	return r.reason == "signal"
+}
+
+// stoppedByCondition reports whether a stop condition ended the session.
+func (r sessionResult) stoppedByCondition() bool {
+	return r.reason == "max_errors" || r.reason == "low_rate"
+}
+
+// reachedTarget reports whether the session ran to its duration or data cap.
+func (r sessionResult) reachedTarget() bool {
+	return r.reason == "duration" || r.reason == "data_cap"
+}
+
+// runSession consumes data until the duration or data cap is reached, a
+// stop is requested or a signal arrives.
+func runSession(config *configs.Config, opts runOptions) sessionResult {
+	metricsCollector := metrics.NewCollector()
+	enableMetricsLogging(config, metricsCollector, opts.job)
+	os.MkdirAll(filepath.Dir(config.MetricsFile), 0755)
+
+	dataConsumer, err := consumer.NewConsumer(consumer.WithConfig(config), consumer.WithCollector(metricsCollector), consumer.WithRunID(runID))
+	if err != nil {
+		log.Fatalf("Failed to initialize consumer: %v", err)
+	}
+	if config.MemoryLimit > 0 {
+		// Make the garbage collector keep the whole process near the budget.
+		debug.SetMemoryLimit(config.MemoryLimit.Bytes())
+	}
+	if opts.tracer != nil {
+		dataConsumer.SetTracer(opts.tracer)
+	}
+	applySmallSources(config.SmallSources, dataConsumer, config.DataSources)
+	workers := autoWorkers(config, dataConsumer)
+
+	startTime := time.Now()
+	switch {
+	case opts.job != "":
+		logger.Info("job session started", "job", opts.job, "target_rate", config.TargetRate, "metrics_file", config.MetricsFile)
+	case config.TargetRPS > 0:
+		fmt.Printf("Starting data consumption targeting %.1f requests/s%s\n", config.TargetRPS, describeObjectSize(config.ObjectSize))
+	default:
+		fmt.Printf("Starting data consumption targeting %s\n", describeTarget(config))
+	}
+	if opts.job == "" {
+		emitStart(config.TargetRate)
+	}
+	dataConsumer.Start()
+	if workers > 0 {
+		dataConsumer.SetWorkers(workers)
+	}
+	if opts.onStart != nil {
+		opts.onStart(dataConsumer, metricsCollector)
+	}
+	if opts.onEnd != nil {
+		defer opts.onEnd()
+	}
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	metricsSaveTicker := time.NewTicker(time.Duration(opts.saveInterval) * time.Second)
+	defer metricsSaveTicker.Stop()
+
+	statusVerbosity := config.Verbosity
+	if opts.job != "" {
+		statusVerbosity = configs.Quiet
+	} else {
+		fmt.Println("Data consumption started...")
+	}
+	if !opts.headless && statusVerbosity > configs.Quiet {
+		fmt.Println("Press Ctrl+C to stop")
+		if opts.keys != nil {
+			fmt.Println(keyHelp)
+		}
+	}
+
+	duration := time.Duration(config.Duration)
+	maxData := config.MaxData
+	if opts.resumed != nil {
+		duration, maxData = opts.resumed.Remaining(config.Duration, config.MaxData)
+	}
+	if !opts.until.IsZero() {
+		if left := time.Until(opts.until); duration <= 0 || left < duration {
+			duration = left
+		}
+	}
+	durationTimer := setupDurationTimer(duration, opts.job == "")
+	if durationTimer != nil {
+		defer durationTimer.Stop()
+	}
+	done := make(chan struct{})
+	defer close(done)
+	dataCapReached := watchDataCap(maxData, metricsCollector, done, opts.job == "")
+	stopConditionMet := watchStopConditions(config.Stop, dataConsumer, metricsCollector, done)
+	quotaExhausted := watchQuota(config, dataConsumer, metricsCollector, done)
+	watchProfileRules(config, dataConsumer, done)
+	watchFairShare(config, dataConsumer, done)
+	startPushing(config.Pushgateway, metricsCollector)
+	if err := plugin.StartSinks(config.Plugins, metricsCollector); err != nil {
+		logger.Warn("failed to start sink plugins", "error", err)
+	}
+	if config.DNS != nil {
+		defer startDNSLoad(*config.DNS)()
+	}
+
+	lastBytes := int64(0)
+	lastTime := time.Now()
+
+	var bar *progressBar
+	var progressTick <-chan time.Time
+	if opts.progress && !opts.headless && !machineOutput() && statusVerbosity > configs.Quiet {
+		bar = newProgressBar(duration, maxData, opts.resumed)
+	}
+	if bar != nil {
+		progressTicker := time.NewTicker(time.Second)
+		defer progressTicker.Stop()
+		progressTick = progressTicker.C
+		// The bar replaces the status line.
+		statusVerbosity = configs.Quiet
+	}
+
+	var result sessionResult
+	// end shuts the session down and reports how it ended.
+	var end func()
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			// The job group reports the status of its jobs.
+			if opts.job == "" {
+				handleTicker(dataConsumer, metricsCollector, &lastBytes, &lastTime, opts.headless, statusVerbosity)
+			}
+		case <-progressTick:
+			bar.draw(metricsCollector.GetStats())
+		case <-metricsSaveTicker.C:
+			handleMetricsSave(config, metricsCollector)
+			saveCheckpoint(config, opts, metricsCollector, startTime, false)
+		case key := <-opts.keys:
+			handleKey(key, dataConsumer, metricsCollector, config)
+		case sig := <-opts.sigChan:
+			end = func() { handleSignal(sig, dataConsumer, metricsCollector, config.MetricsFile, startTime) }
+			result.reason = "signal"
+			break loop
+		case <-opts.stop:
+			end = func() { handleStopRequest(dataConsumer, metricsCollector, config.MetricsFile, startTime) }
+			result.reason = "stop_request"
+			break loop
+		case <-func() <-chan time.Time {
+			if durationTimer != nil {
+				return durationTimer.C
+			}
+			return make(chan time.Time)
+		}():
+			end = func() { handleDurationComplete(dataConsumer, metricsCollector, config.MetricsFile, startTime) }
+			result.reason = "duration"
+			break loop
+		case <-dataCapReached:
+			end = func() { handleDataCapReached(dataConsumer, metricsCollector, config.MetricsFile, startTime) }
+			result.reason = "data_cap"
+			break loop
+		case <-quotaExhausted:
+			end = func() { handleSharedCapReached(dataConsumer, metricsCollector, config.MetricsFile, startTime) }
+			result.reason = "data_cap"
+			break loop
+		case condition := <-stopConditionMet:
+			end = func() { handleStopCondition(condition, dataConsumer, metricsCollector, config.MetricsFile, startTime) }
+			result.reason = condition.reason
+			break loop
+		}
+	}
+	if opts.job != "" {
+		endJobSession(opts.job, result.reason, dataConsumer, metricsCollector, config.MetricsFile)
+	} else {
+		end()
+	}
+	saveCheckpoint(config, opts, metricsCollector, startTime, result.reachedTarget())
+	result.stats = metricsCollector.GetStats()
+	result.health = dataConsumer.SourceHealth()
+	return result
+}
+
+// runSchedules waits for each configured consumption window and runs a
+// session with the window's overrides until interrupted. Changes to the
+// schedules through the controller take effect while waiting. Each session
+// writes its own metrics file and is recorded in the session index, and
+// is checked against the success criteria. The returned exit status is
+// that of the first session that failed.
+func runSchedules(controller *sessionController, opts runOptions) int {
+	status := 0
+	for {
+		config := controller.snapshot()
+		sched, err := scheduler.New(config.Schedules)
+		if err != nil {
+			log.Fatalf("Invalid schedule: %v", err)
+		}
+		entry, at, ok := sched.Next(time.Now())
+		if !ok {
+			logger.Info("no upcoming scheduled windows, exiting")
+			return status
+		}
+		logger.Info("waiting for scheduled window", "window", entry.Name, "opens_at", at.Format(time.RFC1123))
+
+		wait := time.NewTimer(time.Until(at))
+		select {
+		case <-wait.C:
+		case <-controller.reschedule:
+			wait.Stop()
+			continue
+		case <-opts.sigChan:
+			wait.Stop()
+			systemd.Notify(systemd.Stopping)
+			fmt.Println("\nReceived interrupt while waiting, exiting")
+			return status
+		}
+
+		sessionConfig, err := config.ForSchedule(entry)
+		if err != nil {
+			log.Fatalf("Invalid schedule: %v", err)
+		}
+		sessionConfig.MetricsFile = sessionMetricsFile(config.MetricsFile, entry.Name, time.Now())
+		logger.Info("scheduled window opened", "window", entry.Name, "duration", sessionConfig.Duration, "metrics_file", sessionConfig.MetricsFile)
+		result := runSession(sessionConfig, opts)
+		recordSession(sessionIndexFile(config.MetricsFile), entry.Name, sessionConfig.MetricsFile, result)
+		status = firstFailure(status, sessionStatus(opts.job, sessionConfig.Success, result))
+		if result.interrupted() {
+			return status
+		}
+	}
+}
+
+func loadConfiguration(configPath string) *configs.Config {
+	config := configs.DefaultConfig()
+	configPath = resolveConfigPath(configPath)
+	if configPath != "" {
+		var err error
+		config, err = configs.LoadConfig(configPath)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+	}
+	if err := plugin.RegisterSources(config.Plugins); err != nil {
+		log.Fatalf("Invalid plugin: %v", err)
+	}
+	if err := config.SmallSources.Validate(); err != nil {
+		log.Fatalf("Invalid small_sources: %v", err)
+	}
+	if err := config.DNS.Validate(); err != nil {
+		log.Fatalf("Invalid dns: %v", err)
+	}
+	if err := config.FairShare.Validate(); err != nil {
+		log.Fatalf("Invalid fair_share: %v", err)
+	}
+	if err := config.Footprint.Validate(); err != nil {
+		log.Fatalf("Invalid footprint: %v", err)
+	}
+	if _, err := scheduler.NewRules(config.ProfileRules, config.Profiles); err != nil {
+		log.Fatalf("Invalid profile_rules: %v", err)
+	}
+	if err := config.ValidateJobs(); err != nil {
+		log.Fatalf("Invalid jobs: %v", err)
+	}
+	if err := config.TargetMode.Validate(); err != nil {
+		log.Fatalf("Invalid target_mode: %v", err)
+	}
+	if err := config.ValidateConcurrency(); err != nil {
+		log.Fatalf("Invalid concurrency_factor: %v", err)
+	}
+	if config.Duration < 0 {
+		log.Fatalf("Invalid duration: %s is negative", config.Duration)
+	}
+	if config.EndAt != "" {
+		var end clockFlag
+		if err := end.Set(config.EndAt); err != nil {
+			log.Fatalf("Invalid end_at: %v", err)
+		}
+	}
+	return config
+}
+
+// resolveConfigPath returns the explicit path if one was given, otherwise
+// the OS-standard config file if it exists.
+func resolveConfigPath(configPath string) string {
+	if configPath != "" {
+		return configPath
+	}
+	defaultPath, err := configs.DefaultConfigPath()
+	if err != nil {
+		return ""
+	}
+	if _, err := os.Stat(defaultPath); err != nil {
+		return ""
+	}
+	return defaultPath
+}
+
+// prompts selects what promptForUserInput asks for; flags answer the
+// others.
+type prompts struct {
+	targetRate, verbosity, workers bool
+}
+
+// promptForUserInput asks for the target rate (unless the run targets
+// requests per second), verbosity and worker count, as selected by ask.
+func promptForUserInput(config *configs.Config, ask prompts) *configs.Config {
+	if ask.targetRate && config.TargetRPS <= 0 {
+		config = promptForTargetRate(config)
+	}
+	if ask.verbosity {
+		config = promptForVerboseLogging(config)
+	}
+	if ask.workers {
+		config = promptForWorkerCount(config)
+	}
+	return config
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+func readLine() string {
+	line, _ := stdin.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+func promptForTargetRate(config *configs.Config) *configs.Config {
+	defaultRate := config.TargetRate
+	fmt.Printf("Enter target data consumption rate, e.g. 1024 or 1.5 GB/min (default: %s, or press Enter for default): ", defaultRate)
+	targetRateInput := readLine()
+	if targetRateInput != "" {
+		if rate, err := configs.ParseRate(targetRateInput); err == nil {
+			config.TargetRate = rate
+		} else {
+			fmt.Printf("Invalid target rate '%s'. Using default: %s.\n", targetRateInput, defaultRate)
+		}
+	} else {
+		fmt.Printf("Using default target rate: %s.\n", defaultRate)
+	}
+	return config
+}
+
+// describeObjectSize returns " of SIZE objects" for a limited object size.
+func describeObjectSize(size configs.Size) string {
+	if size <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" of %s objects", size)
+}
+
+func promptForVerboseLogging(config *configs.Config) *configs.Config {
+	defaultVerbose := "N"
+	if config.Verbosity >= configs.Verbose {
+		defaultVerbose = "Y"
+	}
+	fmt.Printf("Enable verbose logging? (y/N, default: %s, or press Enter for default): ", defaultVerbose)
+	verboseInput := readLine()
+	if verboseInput == "y" || verboseInput == "Y" {
+		if config.Verbosity < configs.Verbose {
+			config.Verbosity = configs.Verbose
+		}
+	} else if verboseInput != "" && verboseInput != "n" && verboseInput != "N" {
+		fmt.Printf("Invalid input '%s'. Using default: %s.\n", verboseInput, defaultVerbose)
+	} else {
+		fmt.Printf("Using default verbose logging: %s.\n", defaultVerbose)
+	}
+	return config
+}
+
+func promptForWorkerCount(config *configs.Config) *configs.Config {
+	defaultWorkers := config.ConcurrencyFactor
+	if defaultWorkers <= 0 {
+		defaultWorkers = runtime.NumCPU()
+	}
+	fmt.Printf("Enter the number of workers to use (default: %d, or press Enter for default): ", defaultWorkers)
+	workersInput := readLine()
+	if workersInput != "" {
+		if workers, err := strconv.Atoi(workersInput); err == nil && workers >= 1 && workers <= configs.MaxConcurrency {
+			config.ConcurrencyFactor = workers
+		} else {
+			config.ConcurrencyFactor = defaultWorkers
+			fmt.Printf("Invalid number of workers '%s', expected 1 to %d. Using default: %d.\n", workersInput, configs.MaxConcurrency, defaultWorkers)
+		}
+	} else {
+		config.ConcurrencyFactor = defaultWorkers
+		fmt.Printf("Using default number of workers: %d.\n", defaultWorkers)
+	}
+	return config
+}
+
+// enableMetricsLogging logs the collector's samples to a CSV file named
+// after the time and, for the sessions of a config job, the job.
+func enableMetricsLogging(config *configs.Config, metricsCollector *metrics.Collector, job string) {
+	if config.SaveMetrics {
+		if job != "" {
+			job += "_"
+		}
+		logFile := fmt.Sprintf("dataconsumer_log_%s%s.csv", job, time.Now().Format("20060102_150405"))
+		if err := metricsCollector.EnableFileLogging(logFile); err != nil {
+			logger.Warn("failed to enable metrics logging", "error", err)
+		} else {
+			logger.Info("logging metrics", "file", logFile)
+		}
+	}
+}
+
+func setupDurationTimer(duration time.Duration, announce bool) *time.Timer {
+	if duration > 0 {
+		if announce {
+			fmt.Printf("Will run for %s\n", duration.Round(time.Second))
+		}
+		return time.NewTimer(duration)
+	}
+	return nil
+}
+
+// saveCheckpoint records the progress of the session, plus any resumed
+// progress, in the state file.
+func saveCheckpoint(config *configs.Config, opts runOptions, metricsCollector *metrics.Collector, startTime time.Time, completed bool) {
+	if opts.statePath == "" {
+		return
+	}
+	stats := metricsCollector.GetStats()
+	progress := state.State{
+		StartedAt:        startTime,
+		BytesTransferred: stats.BytesTransferred,
+		Elapsed:          time.Since(startTime),
+		MaxData:          config.MaxData,
+		Duration:         config.Duration,
+		Completed:        completed,
+	}
+	if opts.resumed != nil {
+		progress.StartedAt = opts.resumed.StartedAt
+		progress.BytesTransferred += opts.resumed.BytesTransferred
+		progress.Elapsed += opts.resumed.Elapsed
+	}
+	if err := progress.Save(opts.statePath); err != nil {
+		logger.Warn("failed to save checkpoint", "file", opts.statePath, "error", err)
+	}
+}
+
+func watchDataCap(maxData configs.Size, metricsCollector *metrics.Collector, done <-chan struct{}, announce bool) <-chan struct{} {
+	if maxData <= 0 {
+		return nil
+	}
+	if announce {
+		fmt.Printf("Will stop after consuming %s\n", maxData)
+	}
+	reached := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if metricsCollector.GetStats().BytesTransferred >= maxData.Bytes() {
+					close(reached)
+					return
+				}
+			}
+		}
+	}()
+	return reached
+}
+
+func handleTicker(dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, lastBytes *int64, lastTime *time.Time, headless bool, verbosity configs.Verbosity) {
+	stats := metricsCollector.GetStats()
+	now := time.Now()
+	bytesSinceLast := stats.BytesTransferred - *lastBytes
+	timeSinceLast := now.Sub(*lastTime).Seconds()
+	currentRate := calculateCurrentRate(bytesSinceLast, timeSinceLast)
+	*lastBytes = stats.BytesTransferred
+	*lastTime = now
+	outage, offline := dataConsumer.Outage()
+	portal, walled := dataConsumer.CaptivePortal()
+	switch {
+	case walled:
+		systemd.Status(fmt.Sprintf("captive portal since %s: %s", portal.Since.Format(time.TimeOnly), portal.Reason))
+	case offline:
+		systemd.Status(fmt.Sprintf("waiting for connectivity since %s", outage.Since.Format(time.TimeOnly)))
+	default:
+		systemd.Status(fmt.Sprintf("%.2f MB consumed at %.2f MB/min", float64(stats.BytesTransferred)/1024/1024, currentRate))
+	}
+	if jsonOutput != nil {
+		reason := ""
+		if walled {
+			reason = "captive_portal"
+		} else if offline {
+			reason = "waiting_for_connectivity"
+		}
+		emitEvent("status", reason, stats, currentRate)
+		return
+	}
+	if resultOutput != nil {
+		return
+	}
+	if verbosity == configs.Quiet {
+		return
+	}
+
+	format := "\r\033[K%sData: %.2f MB | Rate: %.2f MB/min | Avg: %.2f MB/min | Peak: %.2f MB/min | Time: %s"
+	if headless {
+		format = "%sData: %.2f MB | Rate: %.2f MB/min | Avg: %.2f MB/min | Peak: %.2f MB/min | Time: %s\n"
+	}
+	waiting := ""
+	if walled {
+		waiting = fmt.Sprintf("Captive portal detected (%s), paused | ", portal.Reason)
+	} else if offline {
+		waiting = fmt.Sprintf("Waiting for connectivity (all sources failing, retry in %s) | ", time.Until(outage.RetryAt).Round(time.Second))
+	}
+	if target := dataConsumer.TargetRPS(); target > 0 {
+		waiting += fmt.Sprintf("Requests: %.1f/s avg of %.1f/s | ", stats.RequestRate(), target)
+	}
+	fmt.Printf(format,
+		waiting,
+		float64(stats.BytesTransferred)/1024/1024,
+		currentRate,
+		stats.AverageRate,
+		stats.PeakRate,
+		stats.ElapsedTime.Round(time.Second))
+}
+
+func calculateCurrentRate(bytesSinceLast int64, timeSinceLast float64) float64 {
+	if timeSinceLast > 0 {
+		return float64(bytesSinceLast) / timeSinceLast * 60 / 1024 / 1024
+	}
+	return 0
+}
+
+func handleMetricsSave(config *configs.Config, metricsCollector *metrics.Collector) {
+	if config.SaveMetrics {
+		if err := metricsCollector.SaveStatsToFile(config.MetricsFile); err != nil {
+			logger.Warn("failed to save metrics", "file", config.MetricsFile, "error", err)
+		}
+	}
+}
+
+// handleSignal shuts down on SIGINT and SIGTERM alike, so stopping the
+// service under a service manager still saves metrics and prints the summary.
+func handleSignal(sig os.Signal, dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, metricsFile string, startTime time.Time) {
+	systemd.Notify(systemd.Stopping)
+	fmt.Printf("\n\nReceived %s, shutting down...\n", sig)
+	dataConsumer.Stop()
+	saveAndPrintSummary(metricsCollector, metricsFile, startTime, "signal")
+}
+
+// announceReady tells systemd the service is up and starts the watchdog
+// pings, which stop when the returned channel is closed.
+func announceReady() chan struct{} {
+	done := make(chan struct{})
+	systemd.StartWatchdog(done)
+	systemd.Notify(systemd.Ready)
+	return done
+}
+
+func handleStopRequest(dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, metricsFile string, startTime time.Time) {
+	fmt.Println("\n\nStop requested, shutting down...")
+	dataConsumer.Stop()
+	saveAndPrintSummary(metricsCollector, metricsFile, startTime, "stop_request")
+}
+
+func handleDurationComplete(dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, metricsFile string, startTime time.Time) {
+	fmt.Println("\n\nDuration completed, shutting down...")
+	dataConsumer.Stop()
+	saveAndPrintSummary(metricsCollector, metricsFile, startTime, "duration")
+}
+
+func handleDataCapReached(dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, metricsFile string, startTime time.Time) {
+	fmt.Println("\n\nData cap reached, shutting down...")
+	dataConsumer.Stop()
+	saveAndPrintSummary(metricsCollector, metricsFile, startTime, "data_cap")
+}
+
+// saveAndPrintSummary saves the final metrics and reports them; reason says
+// why the session ended and is included in the JSON summary event.
+func saveAndPrintSummary(m *metrics.Collector, metricsFile string, startTime time.Time, reason string) {
+	stats := m.GetStats()
+	totalRuntime := time.Since(startTime)
+
+	if err := m.SaveStatsToFile(metricsFile); err != nil {
+		logger.Warn("failed to save final metrics", "file", metricsFile, "error", err)
+	} else {
+		logger.Info("final metrics saved", "file", metricsFile)
+	}
+
+	printSummary(stats, totalRuntime)
+	emitEvent("summary", reason, stats, stats.CurrentRate)
+	emitSpeedtestResult(stats)
+}
+
+func printSummary(stats metrics.Stats, totalRuntime time.Duration) {
+	fmt.Println("\n╔════════════════════════════════════════════╗")
+	fmt.Println("║                   FINAL SUMMARY                  ║")
+	fmt.Println("╚════════════════════════════════════════════╝")
+	fmt.Printf("Total data consumed: %.2f MB (%.2f GB)\n", stats.TotalMegabytes, stats.TotalMegabytes/1024)
+	fmt.Printf("Average rate: %.2f MB/min\n", stats.AverageRate)
+	fmt.Printf("Peak rate: %.2f MB/min\n", stats.PeakRate)
+	fmt.Printf("Last rate: %.2f MB/min\n", stats.CurrentRate)
+	fmt.Printf("Total runtime: %s\n", totalRuntime.Round(time.Second))
+	if rps := stats.RequestRate(); rps > 0 {
+		fmt.Printf("Request rate: %.1f requests/s\n", rps)
+	}
+	if ratio, ok := stats.CacheHitRatio(); ok {
+		fmt.Printf("Cache hits: %.0f%% of responses\n", ratio)
+	}
+	if stats.WireBytes > 0 {
+		overhead := ""
+		if stats.BytesTransferred > 0 {
+			overhead = fmt.Sprintf(", %+.1f%% over the data read", float64(stats.WireBytes-stats.BytesTransferred)/float64(stats.BytesTransferred)*100)
+		}
+		fmt.Printf("On the wire: %.2f MB in %d packets%s\n", float64(stats.WireBytes)/1024/1024, stats.WirePackets, overhead)
+	}
+	if stats.SavedObjects > 0 || stats.DuplicateObjects > 0 {
+		fmt.Printf("Saved to disk: %.2f MB in %d objects, %d duplicates skipped\n", float64(stats.SavedBytes)/1024/1024, stats.SavedObjects, stats.DuplicateObjects)
+	}
+	if stats.ClockSteps > 0 {
+		fmt.Printf("Wall clock stepped %d times by %s in total; rates and runtime are unaffected\n", stats.ClockSteps, stats.ClockStep.Round(time.Millisecond))
+	}
+	if f := stats.Footprint; f != nil {
+		factors := ""
+		if f.KWhPerGB > 0 {
+			factors = fmt.Sprintf(" (%g kWh/GB at %g g CO2e/kWh)", f.KWhPerGB, f.GridIntensity)
+		}
+		fmt.Printf("Estimated footprint: %.3f kWh, %.1f g CO2e%s\n", f.EnergyKWh, f.CO2eGrams, factors)
+	}
+	printPercentiles("Time to first byte", stats.TTFB)
+	printPercentiles("Request latency", stats.Latency)
+	if logLevel.Level() <= slog.LevelDebug {
+		for _, source := range stats.Sources {
+			cache := ""
+			if ratio, ok := source.CacheHitRatio(); ok {
+				cache = fmt.Sprintf(", %.0f%% cache hits", ratio)
+			}
+			fmt.Printf("  %s: %.2f MB in %d requests, %s read buffer%s\n",
+				source.URL, float64(source.BytesTransferred)/1024/1024, source.Requests, configs.Size(source.BufferSize), cache)
+		}
+		for _, host := range stats.Hosts {
+			fmt.Printf("  %s: at most %d connections at once\n", host.Host, host.PeakConnections)
+		}
+	}
+	printRedirects(stats.Sources)
+	if len(stats.Proxies) > 0 {
+		fmt.Println("Proxies:")
+		for _, proxy := range stats.Proxies {
+			errorRate, _ := proxy.ErrorRate()
+			pruned := ""
+			if proxy.Pruned {
+				pruned = ", pruned"
+			}
+			fmt.Printf("  %s: %.2f MB in %d requests, %.0f%% failed, %s to headers%s\n",
+				proxy.Proxy, float64(proxy.BytesTransferred)/1024/1024, proxy.Requests, errorRate, proxy.Latency.Round(time.Millisecond), pruned)
+		}
+	}
+}
+
+// printRedirects lists the sources whose requests were redirected and the
+// hosts the redirects ended at, busiest first.
+func printRedirects(sources []metrics.SourceStats) {
+	header := false
+	for _, source := range sources {
+		if source.Redirected == 0 {
+			continue
+		}
+		if !header {
+			fmt.Println("Redirects:")
+			header = true
+		}
+		hosts := make([]string, 0, len(source.RedirectHosts))
+		for host := range source.RedirectHosts {
+			hosts = append(hosts, host)
+		}
+		sort.Slice(hosts, func(i, j int) bool {
+			return source.RedirectHosts[hosts[i]] > source.RedirectHosts[hosts[j]]
+		})
+		for i, host := range hosts {
+			hosts[i] = fmt.Sprintf("%s (%d)", host, source.RedirectHosts[host])
+		}
+		fmt.Printf("  %s: %d responses redirected, %.1f hops on average, ended at %s\n",
+			source.URL, source.Redirected, float64(source.RedirectHops)/float64(source.Redirected), strings.Join(hosts, ", "))
+	}
+}
+
+// printPercentiles prints the median, tail and maximum of h, if any
+// durations were recorded.
+func printPercentiles(name string, h *metrics.Histogram) {
+	if h.Count() == 0 {
+		return
+	}
+	fmt.Printf("%s: p50 %s, p90 %s, p99 %s, max %s\n", name,
+		h.Percentile(50).Round(100*time.Microsecond), h.Percentile(90).Round(100*time.Microsecond),
+		h.Percentile(99).Round(100*time.Microsecond), h.Max().Round(100*time.Microsecond))
+}
+
+// cat
+// dog
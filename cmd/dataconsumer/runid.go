@@ -0,0 +1,20 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// runID identifies this run of the program in its logs, metrics files,
+// pushed metrics, JSON output and the requests it sends, so that the data
+// of several runs and hosts can be told apart downstream.
+var runID = newRunID()
+
+// newRunID returns a random (version 4) UUID.
+func newRunID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/scheduler"
+)
+
+const scheduleUsage = `usage: dataconsumer schedule <command>
+
+commands:
+  show [-config file] [-days 7]
+                         print the profile rules and schedules and when
+                         they apply over the coming days`
+
+// maxShownWindows caps the scheduled windows schedule show lists.
+const maxShownWindows = 50
+
+func runScheduleCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, scheduleUsage)
+		return 2
+	}
+	switch args[0] {
+	case "show":
+		return runScheduleShow(args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "unknown schedule command %q\n", args[0])
+	return 2
+}
+
+func runScheduleShow(args []string) int {
+	fs := flag.NewFlagSet("schedule show", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to configuration file")
+	days := fs.Int("days", 7, "How many days ahead to show")
+	parseFlags(fs, args)
+
+	config := loadConfiguration(*configPath)
+	rules, err := scheduler.NewRules(config.ProfileRules, config.Profiles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid profile_rules: %v\n", err)
+		return 1
+	}
+	sched, err := scheduler.New(config.Schedules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid schedule: %v\n", err)
+		return 1
+	}
+	now := time.Now()
+	until := now.AddDate(0, 0, *days)
+
+	fmt.Printf("Base settings: %s\n", describeSettings(config))
+	if len(config.ProfileRules) == 0 {
+		fmt.Println("\nNo profile rules configured.")
+	} else {
+		fmt.Println("\nProfile rules (the first matching rule applies):")
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "DAYS\tFROM\tTO\tPROFILE\tSETTINGS")
+		for _, rule := range config.ProfileRules {
+			from, to := rule.From, rule.To
+			if from == "" && to == "" {
+				from, to = "00:00", "24:00"
+			}
+			profiled, _ := config.WithProfile(rule.Profile)
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", rule.Days, from, to, rule.Profile, describeSettings(profiled))
+		}
+		tw.Flush()
+
+		if rule, ok := rules.At(now); ok {
+			fmt.Printf("\nNow: profile %q\n", rule.Profile)
+		} else {
+			fmt.Println("\nNow: base settings")
+		}
+		changes := rules.Changes(now, until)
+		if len(changes) == 0 {
+			fmt.Printf("No changes in the next %d days.\n", *days)
+		} else {
+			fmt.Printf("Changes in the next %d days:\n", *days)
+			tw = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			for _, change := range changes {
+				profile := "base settings"
+				if change.OK {
+					profile = fmt.Sprintf("profile %q", change.Rule.Profile)
+				}
+				fmt.Fprintf(tw, "  %s\t%s\n", change.At.Format("Mon 2006-01-02 15:04"), profile)
+			}
+			tw.Flush()
+		}
+	}
+
+	if len(config.Schedules) == 0 {
+		fmt.Println("\nNo scheduled windows configured.")
+		return 0
+	}
+	fmt.Printf("\nScheduled windows in the next %d days:\n", *days)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPENS\tWINDOW\tDURATION\tPROFILE")
+	shown := 0
+	for t := now; shown < maxShownWindows; shown++ {
+		entry, at, ok := sched.Next(t)
+		if !ok || at.After(until) {
+			break
+		}
+		profile := entry.Profile
+		if profile == "" {
+			profile = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", at.Format("Mon 2006-01-02 15:04"), entry.Name, entry.Duration, profile)
+		t = at
+	}
+	tw.Flush()
+	if shown == 0 {
+		fmt.Println("None.")
+	}
+	return 0
+}
+
+// describeSettings summarises the settings a profile can change.
+func describeSettings(config *configs.Config) string {
+	s := "target " + config.TargetRate.String()
+	if config.MaxBandwidth > 0 {
+		s += ", max " + config.MaxBandwidth.String()
+	}
+	return s + fmt.Sprintf(", concurrency %d", config.ConcurrencyFactor)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/secure"
+)
+
+// addServerSecurityFlags adds the token and TLS flags of a command serving
+// HTTP. After parsing, pass the token through secure.Token to fall back to
+// $DATACONSUMER_TOKEN.
+func addServerSecurityFlags(fs *flag.FlagSet) *secure.Options {
+	o := &secure.Options{}
+	fs.StringVar(&o.Token, "token", "", "Require this bearer token on every request (default $"+secure.TokenEnv+")")
+	fs.StringVar(&o.CertFile, "tls-cert", "", "Serve HTTPS with this certificate file")
+	fs.StringVar(&o.KeyFile, "tls-key", "", "Private key file for -tls-cert")
+	fs.BoolVar(&o.SelfSigned, "tls-self-signed", false, "Serve HTTPS with a generated certificate, saved to -tls-cert and -tls-key if set")
+	return o
+}
+
+// apiSecurity returns the token and TLS settings of the control APIs.
+func apiSecurity(api *configs.APIConfig) secure.Options {
+	return secure.Options{
+		Token:      secure.Token(api.Token),
+		CertFile:   api.TLSCert,
+		KeyFile:    api.TLSKey,
+		SelfSigned: api.TLSSelfSigned,
+	}
+}
+
+// clientFlags are the flags of a command talking to a secured listener.
+type clientFlags struct {
+	token  string
+	caFile string
+}
+
+func addClientSecurityFlags(fs *flag.FlagSet) *clientFlags {
+	c := &clientFlags{}
+	fs.StringVar(&c.token, "token", "", "Bearer token to send (default $"+secure.TokenEnv+")")
+	fs.StringVar(&c.caFile, "ca-file", "", "Also trust the certificates in this PEM file, e.g. a self-signed server certificate (default $"+secure.CAFileEnv+")")
+	return c
+}
+
+// resolve fills unset flags from the environment.
+func (c *clientFlags) resolve() {
+	c.token = secure.Token(c.token)
+	if c.caFile == "" {
+		c.caFile = os.Getenv(secure.CAFileEnv)
+	}
+}
+
+// envHTTPClient returns a client configured from $DATACONSUMER_TOKEN and
+// $DATACONSUMER_CA_FILE, for clients without flags of their own.
+func envHTTPClient() (*http.Client, error) {
+	c := &clientFlags{}
+	c.resolve()
+	return secure.NewClient(c.token, c.caFile)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/byteserver"
+)
+
+func runServeCommand(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "Address to listen on")
+	maxSize := configs.Size(10 << 30)
+	fs.Var(&maxSize, "max-size", "Largest payload a client may request")
+	parseFlags(fs, args)
+
+	server := byteserver.New(maxSize)
+	fmt.Printf("Serving test payloads on http://%s/bytes?size=<size>\n", *addr)
+	if err := http.ListenAndServe(*addr, server.Handler()); err != nil {
+		fmt.Fprintf(os.Stderr, "Server failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func runServiceCommand(args []string) int {
+	fmt.Fprintln(os.Stderr, "The service command is only available on Windows; use 'dataconsumer daemon' under your service manager instead.")
+	return 2
+}
@@ -0,0 +1,241 @@
+//go:build windows
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceUsage = `usage: dataconsumer service <command> [-name name]
+
+commands:
+  install [-config file] [daemon flags]    register the Windows service
+  uninstall                                remove the Windows service
+  start                                    start the service
+  stop                                     stop the service`
+
+func runServiceCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, serviceUsage)
+		return 2
+	}
+	name, daemonArgs := splitServiceName(args[1:])
+
+	var err error
+	switch args[0] {
+	case "install":
+		err = installService(name, daemonArgs)
+	case "uninstall":
+		err = uninstallService(name)
+	case "start":
+		err = startService(name)
+	case "stop":
+		err = stopService(name)
+	case "run":
+		err = runAsService(name, daemonArgs)
+	default:
+		fmt.Fprintln(os.Stderr, serviceUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "service %s failed: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// splitServiceName extracts the -name flag and returns the remaining
+// arguments, which are passed through to the daemon.
+func splitServiceName(args []string) (string, []string) {
+	name := "DataConsumer"
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case (args[i] == "-name" || args[i] == "--name") && i+1 < len(args):
+			name = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "-name="):
+			name = strings.TrimPrefix(args[i], "-name=")
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return name, rest
+}
+
+func installService(name string, daemonArgs []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.Abs(exe)
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", name)
+	}
+	args := append([]string{"service", "run", "-name", name}, daemonArgs...)
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName: "Data Consumer",
+		Description: "High-performance network data consumer",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("registering event log source: %w", err)
+	}
+	fmt.Printf("Installed service %s\n", name)
+	return nil
+}
+
+func uninstallService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	eventlog.Remove(name)
+	fmt.Printf("Removed service %s\n", name)
+	return nil
+}
+
+func startService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+	return s.Start()
+}
+
+func stopService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for service %s to stop", name)
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// windowsService runs the daemon under the service control manager.
+type windowsService struct {
+	daemonArgs []string
+}
+
+func (w *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	stop := make(chan os.Signal, 1)
+	exited := make(chan int, 1)
+	go func() {
+		exited <- runDaemon(w.daemonArgs, stop)
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case code := <-exited:
+			return false, uint32(code)
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				changes <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				stop <- os.Interrupt
+				return false, uint32(<-exited)
+			}
+		}
+	}
+}
+
+func runAsService(name string, daemonArgs []string) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return fmt.Errorf("not started by the service control manager; use 'dataconsumer daemon' instead")
+	}
+	elog, err := eventlog.Open(name)
+	if err != nil {
+		return err
+	}
+	defer elog.Close()
+	redirectOutputToEventLog(elog)
+	return svc.Run(name, &windowsService{daemonArgs: daemonArgs})
+}
+
+// redirectOutputToEventLog sends every line written to stdout or stderr to
+// the Windows event log, since services have no console.
+func redirectOutputToEventLog(elog *eventlog.Log) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	os.Stdout, os.Stderr = w, w
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				continue
+			}
+			elog.Info(1, line)
+		}
+	}()
+}
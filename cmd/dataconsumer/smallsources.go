@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/consumer"
+)
+
+const (
+	// sizeProbeTimeout bounds how long the sources are probed for their
+	// size before a session starts.
+	sizeProbeTimeout = 10 * time.Second
+	// smallSourceFactor is how many times more often the other sources
+	// are picked than a source down-weighted for being small.
+	smallSourceFactor = 10
+)
+
+// applySmallSources probes the size of every enabled source and skips or
+// down-weights those below the policy's minimum, unless every source is
+// that small.
+func applySmallSources(policy *configs.SmallSourcePolicy, dataConsumer *consumer.Consumer, sources []configs.Source) {
+	if policy == nil || policy.MinSize <= 0 {
+		return
+	}
+	sizes := probeSizes(dataConsumer, sources)
+	small := make([]bool, len(sources))
+	var smallCount, enabled int
+	for i, source := range sources {
+		if !source.IsEnabled() {
+			continue
+		}
+		enabled++
+		if sizes[i] >= 0 && sizes[i] < policy.MinSize.Bytes() {
+			small[i] = true
+			smallCount++
+		}
+	}
+	if smallCount == 0 {
+		return
+	}
+	if smallCount == enabled {
+		logger.Warn("every source is smaller than the minimum object size, using them anyway", "min_size", policy.MinSize)
+		return
+	}
+
+	adjusted := make([]configs.Source, 0, len(sources))
+	for i, source := range sources {
+		switch {
+		case !small[i]:
+			if policy.Action == configs.DownWeightSmallSources && source.IsEnabled() {
+				source.Weight = source.EffectiveWeight() * smallSourceFactor
+			}
+		case policy.Action == configs.DownWeightSmallSources:
+			logger.Info("down-weighting small source", "url", source.URL, "size", configs.Size(sizes[i]), "min_size", policy.MinSize)
+		default:
+			logger.Info("skipping small source", "url", source.URL, "size", configs.Size(sizes[i]), "min_size", policy.MinSize)
+			continue
+		}
+		adjusted = append(adjusted, source)
+	}
+	if err := dataConsumer.SetSources(adjusted); err != nil {
+		logger.Warn("failed to apply the minimum object size", "error", err)
+	}
+}
+
+// probeSizes requests every enabled source at once and returns the
+// Content-Length each advertised, or -1 where it is unknown.
+func probeSizes(dataConsumer *consumer.Consumer, sources []configs.Source) []int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), sizeProbeTimeout)
+	defer cancel()
+	sizes := make([]int64, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		sizes[i] = -1
+		if !source.IsEnabled() {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, source configs.Source) {
+			defer wg.Done()
+			if check := dataConsumer.Check(ctx, source); check.OK() {
+				sizes[i] = check.Size
+			}
+		}(i, source)
+	}
+	wg.Wait()
+	return sizes
+}
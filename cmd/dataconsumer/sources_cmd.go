@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/consumer"
+)
+
+const sourcesUsage = `usage: dataconsumer sources <command>
+
+commands:
+  list [-config file]    print the configured data sources
+  bench [-config file] [-duration 10s] [-write-weights]
+                         measure each source in turn and optionally
+                         set weights from the results
+  validate [-config file] [-timeout 15s]
+                         check that every source is reachable
+  update [-config file] [-catalog url] [-public-key key] [-dry-run]
+                         add the working sources of the signed source
+                         catalog that the config does not list yet
+  sign-catalog -key file [-generate-key | catalog.json]
+                         sign a catalog for publishing`
+
+func runSourcesCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, sourcesUsage)
+		return 2
+	}
+	switch args[0] {
+	case "list":
+		return runSourcesList(args[1:])
+	case "bench":
+		return runSourcesBench(args[1:])
+	case "validate":
+		return runSourcesValidate(args[1:])
+	case "update":
+		return runSourcesUpdate(args[1:])
+	case "sign-catalog":
+		return runSourcesSignCatalog(args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "unknown sources command %q\n", args[0])
+	return 2
+}
+
+func runSourcesList(args []string) int {
+	fs := flag.NewFlagSet("sources list", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to configuration file")
+	parseFlags(fs, args)
+
+	config := loadConfiguration(*configPath)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "URL\tWEIGHT\tENABLED\tPROXY")
+	for _, source := range config.DataSources {
+		proxy := source.Proxy
+		if proxy == "" {
+			proxy = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%t\t%s\n", source.URL, source.EffectiveWeight(), source.IsEnabled(), proxy)
+	}
+	tw.Flush()
+	return 0
+}
+
+// maxBenchWeight caps the weights written by sources bench.
+const maxBenchWeight = 10
+
+func runSourcesBench(args []string) int {
+	fs := flag.NewFlagSet("sources bench", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to configuration file")
+	duration := fs.Duration("duration", 10*time.Second, "How long to download from each source")
+	writeWeights := fs.Bool("write-weights", false, "Rewrite source weights in the config file in proportion to throughput")
+	parseFlags(fs, args)
+
+	path := resolveConfigPath(*configPath)
+	if *writeWeights && path == "" {
+		fmt.Fprintln(os.Stderr, "-write-weights needs a configuration file")
+		return 2
+	}
+	config := loadConfiguration(*configPath)
+	dataConsumer, err := consumer.NewConsumer(consumer.WithConfig(config))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize consumer: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	var results []consumer.BenchResult
+	for _, source := range config.DataSources {
+		if !source.IsEnabled() {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Benchmarking %s for %s...\n", source.URL, *duration)
+		results = append(results, dataConsumer.Bench(ctx, source, *duration))
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "Interrupted")
+			return 1
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "URL\tTHROUGHPUT\tLATENCY\tREQUESTS\tRELIABILITY\tLAST ERROR")
+	for _, r := range results {
+		lastError := r.LastError
+		if lastError == "" {
+			lastError = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%.1f Mbps\t%.1f ms\t%d\t%.0f%%\t%s\n", r.URL, r.Rate().BytesPerSecond()*8/1e6,
+			r.Latency.Seconds()*1000, r.Requests, r.Reliability()*100, lastError)
+	}
+	tw.Flush()
+
+	if !*writeWeights {
+		return 0
+	}
+	weights := benchWeights(results)
+	if len(weights) == 0 {
+		fmt.Fprintln(os.Stderr, "No source delivered any data, weights left unchanged")
+		return 1
+	}
+	updated, err := configs.SetSourceWeights(path, weights)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to update weights: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Updated the weights of %d sources in %s (original kept as %s.bak)\n", updated, path, path)
+	return 0
+}
+
+// benchWeights gives each source that delivered data a weight proportional
+// to its throughput, with the slowest at 1 and none above maxBenchWeight.
+func benchWeights(results []consumer.BenchResult) map[string]int {
+	slowest := math.Inf(1)
+	for _, r := range results {
+		if rate := r.Rate().BytesPerSecond(); rate > 0 && rate < slowest {
+			slowest = rate
+		}
+	}
+	weights := make(map[string]int)
+	for _, r := range results {
+		rate := r.Rate().BytesPerSecond()
+		if rate <= 0 {
+			continue
+		}
+		weights[r.URL] = int(math.Min(math.Round(rate/slowest), maxBenchWeight))
+	}
+	return weights
+}
+
+func runSourcesValidate(args []string) int {
+	fs := flag.NewFlagSet("sources validate", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to configuration file")
+	timeout := fs.Duration("timeout", 15*time.Second, "Timeout for each source")
+	parseFlags(fs, args)
+
+	config := loadConfiguration(*configPath)
+	dataConsumer, err := consumer.NewConsumer(consumer.WithConfig(config))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize consumer: %v\n", err)
+		return 1
+	}
+
+	failed := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULT\tURL\tSTATUS\tSIZE\tRANGES\tTLS EXPIRES\tNOTE")
+	for _, source := range config.DataSources {
+		if !source.IsEnabled() {
+			fmt.Fprintf(tw, "SKIP\t%s\t-\t-\t-\t-\tdisabled\n", source.URL)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		check := dataConsumer.Check(ctx, source)
+		cancel()
+
+		result := "PASS"
+		if !check.OK() {
+			result = "FAIL"
+			failed++
+		}
+		status, size, expiry := "-", "-", "-"
+		if check.StatusCode != 0 {
+			status = strconv.Itoa(check.StatusCode)
+		}
+		if check.Size >= 0 {
+			size = configs.Size(check.Size).String()
+		}
+		if !check.TLSExpiry.IsZero() {
+			expiry = check.TLSExpiry.Format("2006-01-02")
+		}
+		note := check.Error
+		if note == "" && check.RedirectedTo != "" {
+			note = "redirected to " + check.RedirectedTo
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n", result, source.URL, status, size, check.AcceptRanges, expiry, note)
+	}
+	tw.Flush()
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d sources failed\n", failed)
+		return 1
+	}
+	return 0
+}
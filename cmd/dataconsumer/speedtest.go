@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"dataconsumer/pkg/metrics"
+)
+
+// resultOutput is set when -output speedtest or -output ookla is selected.
+// A single result document in that tool's JSON shape is then written to
+// it at the end of each session, and all other output goes to stderr.
+var (
+	resultOutput *json.Encoder
+	resultFormat string
+)
+
+// machineOutput reports whether stdout is meant for a program rather than
+// a person, so there are no prompts, keys or status lines.
+func machineOutput() bool {
+	return jsonOutput != nil || resultOutput != nil
+}
+
+// speedtestResult is the document printed by speedtest-cli --json.
+type speedtestResult struct {
+	Download      float64         `json:"download"`
+	Upload        float64         `json:"upload"`
+	Ping          float64         `json:"ping"`
+	Server        speedtestServer `json:"server"`
+	Timestamp     string          `json:"timestamp"`
+	BytesSent     int64           `json:"bytes_sent"`
+	BytesReceived int64           `json:"bytes_received"`
+	Share         *string         `json:"share"`
+	Client        speedtestClient `json:"client"`
+}
+
+type speedtestServer struct {
+	URL     string  `json:"url"`
+	Lat     string  `json:"lat"`
+	Lon     string  `json:"lon"`
+	Name    string  `json:"name"`
+	Country string  `json:"country"`
+	CC      string  `json:"cc"`
+	Sponsor string  `json:"sponsor"`
+	ID      string  `json:"id"`
+	Host    string  `json:"host"`
+	D       float64 `json:"d"`
+	Latency float64 `json:"latency"`
+}
+
+type speedtestClient struct {
+	IP        string `json:"ip"`
+	Lat       string `json:"lat"`
+	Lon       string `json:"lon"`
+	ISP       string `json:"isp"`
+	ISPRating string `json:"isprating"`
+	Rating    string `json:"rating"`
+	ISPDLAvg  string `json:"ispdlavg"`
+	ISPULAvg  string `json:"ispulavg"`
+	LoggedIn  string `json:"loggedin"`
+	Country   string `json:"country"`
+}
+
+// ooklaResult is the document printed by the Ookla speedtest CLI with
+// --format=json.
+type ooklaResult struct {
+	Type      string        `json:"type"`
+	Timestamp string        `json:"timestamp"`
+	Ping      ooklaPing     `json:"ping"`
+	Download  ooklaTransfer `json:"download"`
+	Upload    ooklaTransfer `json:"upload"`
+	ISP       string        `json:"isp"`
+	Interface struct {
+		InternalIP string `json:"internalIp"`
+		Name       string `json:"name"`
+		MACAddr    string `json:"macAddr"`
+		IsVPN      bool   `json:"isVpn"`
+		ExternalIP string `json:"externalIp"`
+	} `json:"interface"`
+	Server ooklaServer `json:"server"`
+	Result struct {
+		ID        string `json:"id"`
+		URL       string `json:"url"`
+		Persisted bool   `json:"persisted"`
+	} `json:"result"`
+}
+
+type ooklaPing struct {
+	Jitter  float64 `json:"jitter"`
+	Latency float64 `json:"latency"`
+	Low     float64 `json:"low"`
+	High    float64 `json:"high"`
+}
+
+type ooklaTransfer struct {
+	// Bandwidth is in bytes per second and Elapsed in milliseconds.
+	Bandwidth int64 `json:"bandwidth"`
+	Bytes     int64 `json:"bytes"`
+	Elapsed   int64 `json:"elapsed"`
+}
+
+type ooklaServer struct {
+	ID       int    `json:"id"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	Country  string `json:"country"`
+	IP       string `json:"ip"`
+}
+
+// emitSpeedtestResult writes the session's result document when -output
+// speedtest or ookla is active. The download rate is the average of the
+// session, the ping the median time to first byte, its jitter their
+// standard deviation and the server the source most data came from;
+// there is no upload.
+func emitSpeedtestResult(stats metrics.Stats) {
+	if resultOutput == nil {
+		return
+	}
+	var bytesPerSecond float64
+	if stats.ElapsedTime > 0 {
+		bytesPerSecond = float64(stats.BytesTransferred) / stats.ElapsedTime.Seconds()
+	}
+	var ping ooklaPing
+	if stats.TTFB.Count() > 0 {
+		ping = ooklaPing{
+			Jitter:  milliseconds(stats.TTFB.StdDev()),
+			Latency: milliseconds(stats.TTFB.Percentile(50)),
+			Low:     milliseconds(stats.TTFB.Percentile(0)),
+			High:    milliseconds(stats.TTFB.Max()),
+		}
+	}
+	sourceURL, host, port := busiestSource(stats)
+
+	if resultFormat == "ookla" {
+		resultOutput.Encode(ooklaResult{
+			Type:      "result",
+			Timestamp: stats.StartTime.UTC().Format(time.RFC3339),
+			Ping:      ping,
+			Download: ooklaTransfer{
+				Bandwidth: int64(bytesPerSecond),
+				Bytes:     stats.BytesTransferred,
+				Elapsed:   stats.ElapsedTime.Milliseconds(),
+			},
+			Server: ooklaServer{Host: host, Port: port, Name: host},
+		})
+		return
+	}
+	resultOutput.Encode(speedtestResult{
+		Download: bytesPerSecond * 8,
+		Ping:     ping.Latency,
+		Server: speedtestServer{
+			URL:     sourceURL,
+			Name:    host,
+			Host:    net.JoinHostPort(host, strconv.Itoa(port)),
+			Latency: ping.Latency,
+		},
+		Timestamp:     stats.StartTime.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		BytesReceived: stats.BytesTransferred,
+	})
+}
+
+// busiestSource returns the URL, host and port of the source that
+// delivered the most data.
+func busiestSource(stats metrics.Stats) (string, string, int) {
+	var busiest metrics.SourceStats
+	for _, source := range stats.Sources {
+		if source.BytesTransferred > busiest.BytesTransferred {
+			busiest = source
+		}
+	}
+	u, err := url.Parse(busiest.URL)
+	if err != nil || busiest.URL == "" {
+		return busiest.URL, "", 0
+	}
+	port, _ := strconv.Atoi(u.Port())
+	if port == 0 {
+		port = 80
+		if u.Scheme == "https" {
+			port = 443
+		}
+	}
+	return busiest.URL, u.Hostname(), port
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/consumer"
+	"dataconsumer/pkg/metrics"
+)
+
+// exitStopCondition is the exit status of a run ended by a stop condition.
+const exitStopCondition = 4
+
+// abortFlag is the value of -abort-if-below, written as "RATE for DURATION",
+// e.g. "50MB/min for 5m".
+type abortFlag struct {
+	rate   configs.Rate
+	window time.Duration
+}
+
+func (f *abortFlag) String() string {
+	if f.rate == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s for %s", f.rate, f.window)
+}
+
+func (f *abortFlag) Set(value string) error {
+	rate, window, ok := strings.Cut(value, " for ")
+	if !ok {
+		return fmt.Errorf("expected RATE for DURATION, e.g. \"50MB/min for 5m\"")
+	}
+	if err := f.rate.Set(strings.TrimSpace(rate)); err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil {
+		return err
+	}
+	if d < time.Second {
+		return fmt.Errorf("duration must be at least 1s")
+	}
+	f.window = d
+	return nil
+}
+
+// applyStopFlags merges the stop condition flags into the config.
+func applyStopFlags(config *configs.Config, maxErrors int, abort abortFlag) {
+	if maxErrors == 0 && abort.rate == 0 {
+		return
+	}
+	if config.Stop == nil {
+		config.Stop = &configs.StopConditions{}
+	}
+	if maxErrors > 0 {
+		config.Stop.MaxErrors = maxErrors
+	}
+	if abort.rate > 0 {
+		config.Stop.AbortIfBelow = abort.rate
+		config.Stop.AbortAfter = int(abort.window.Seconds())
+	}
+}
+
+// stopCondition says which stop condition ended a session and why.
+type stopCondition struct {
+	reason  string
+	message string
+}
+
+// watchStopConditions checks the stop conditions every second and reports
+// the first one that is met.
+func watchStopConditions(conditions *configs.StopConditions, dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, done <-chan struct{}) <-chan stopCondition {
+	if conditions == nil || (conditions.MaxErrors <= 0 && conditions.AbortIfBelow <= 0) {
+		return nil
+	}
+	window := time.Duration(conditions.AbortAfter) * time.Second
+	met := make(chan stopCondition, 1)
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		lastBytes := metricsCollector.GetStats().BytesTransferred
+		lastTime := time.Now()
+		var belowSince time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if conditions.MaxErrors > 0 {
+					if failed := failedRequests(dataConsumer); failed >= int64(conditions.MaxErrors) {
+						met <- stopCondition{"max_errors", fmt.Sprintf("%d requests failed", failed)}
+						return
+					}
+				}
+				bytes := metricsCollector.GetStats().BytesTransferred
+				rate := configs.Rate(float64(bytes-lastBytes) / now.Sub(lastTime).Seconds())
+				lastBytes, lastTime = bytes, now
+				if conditions.AbortIfBelow <= 0 {
+					continue
+				}
+				if rate >= conditions.AbortIfBelow || dataConsumer.Paused() {
+					belowSince = time.Time{}
+					continue
+				}
+				if belowSince.IsZero() {
+					belowSince = now
+				}
+				if now.Sub(belowSince) >= window {
+					met <- stopCondition{"low_rate", fmt.Sprintf("rate stayed below %s for %s", conditions.AbortIfBelow, window)}
+					return
+				}
+			}
+		}
+	}()
+	return met
+}
+
+func failedRequests(dataConsumer *consumer.Consumer) int64 {
+	var failed int64
+	for _, h := range dataConsumer.SourceHealth() {
+		failed += h.Failures
+	}
+	return failed
+}
+
+func handleStopCondition(condition stopCondition, dataConsumer *consumer.Consumer, metricsCollector *metrics.Collector, metricsFile string, startTime time.Time) {
+	fmt.Printf("\n\nStop condition met: %s, shutting down...\n", condition.message)
+	dataConsumer.Stop()
+	saveAndPrintSummary(metricsCollector, metricsFile, startTime, condition.reason)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/consumer"
+	"dataconsumer/pkg/metrics"
+)
+
+// kneeShare is the share of the best throughput the recommended worker
+// count must reach.
+const kneeShare = 0.9
+
+// sweepLevel is the throughput measured with one worker count.
+type sweepLevel struct {
+	workers int
+	rate    float64 // MB/min
+}
+
+// runSweep measures the throughput at 1, 2, 4, ... maxWorkers workers for
+// window each, after a warm-up of a quarter window, and recommends the
+// fewest workers reaching kneeShare of the best throughput. With
+// writeConfig the recommendation is saved as concurrency_factor in the
+// config file at configPath.
+func runSweep(config *configs.Config, configPath string, window time.Duration, maxWorkers int, writeConfig bool) int {
+	if writeConfig && configPath == "" {
+		fmt.Fprintln(os.Stderr, "-write-config needs a configuration file")
+		return 2
+	}
+	if window <= 0 || maxWorkers < 1 {
+		fmt.Fprintln(os.Stderr, "-sweep-window and -sweep-max must be positive")
+		return 2
+	}
+	// The sweep measures what the link can do, so neither the rate limit,
+	// the pacing to the target nor the cap of a normal run applies.
+	config.MaxBandwidth = 0
+	config.TargetMode = configs.Unpaced
+	config.MaxData = 0
+	collector := metrics.NewCollector()
+	c, err := consumer.NewConsumer(consumer.WithConfig(config), consumer.WithCollector(collector), consumer.WithRunID(runID))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Sweeping worker counts up to %d, %s per level\n\n", maxWorkers, window)
+	fmt.Printf("%8s  %14s  %8s\n", "Workers", "Rate (MB/min)", "Gain")
+	c.Start()
+	var levels []sweepLevel
+	for workers := 1; workers <= maxWorkers && ctx.Err() == nil; workers *= 2 {
+		c.SetWorkers(workers)
+		rate, ok := measureRate(ctx, collector, window)
+		if !ok {
+			break
+		}
+		gain := "-"
+		if n := len(levels); n > 0 && levels[n-1].rate > 0 {
+			gain = fmt.Sprintf("%+.0f%%", (rate/levels[n-1].rate-1)*100)
+		}
+		fmt.Printf("%8d  %14.2f  %8s\n", workers, rate, gain)
+		levels = append(levels, sweepLevel{workers: workers, rate: rate})
+	}
+	c.Stop()
+
+	knee, ok := sweepKnee(levels)
+	if !ok {
+		fmt.Println("\nNo data was received; check the sources with 'dataconsumer doctor'.")
+		return 1
+	}
+	fmt.Printf("\nKnee: %.2f MB/min with %d worker(s), %.0f%% of the best rate.\n", knee.rate, knee.workers, knee.rate/bestRate(levels)*100)
+	fmt.Printf("Recommended concurrency_factor: %d\n", knee.workers)
+	if ctx.Err() != nil {
+		fmt.Println("The sweep was interrupted, so higher worker counts were not measured.")
+	}
+	if writeConfig {
+		if err := configs.UpdateFile(configPath, map[string]interface{}{"concurrency_factor": knee.workers}); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to update %s: %v\n", configPath, err)
+			return 1
+		}
+		fmt.Printf("Saved to %s (the original is in %s.bak).\n", configPath, configPath)
+	}
+	return 0
+}
+
+// measureRate waits a quarter window for the workers to settle and then
+// returns the rate over window. It returns false if ctx is done first.
+func measureRate(ctx context.Context, collector *metrics.Collector, window time.Duration) (float64, bool) {
+	if !sleepContext(ctx, window/4) {
+		return 0, false
+	}
+	before := collector.GetStats().BytesTransferred
+	started := time.Now()
+	if !sleepContext(ctx, window) {
+		return 0, false
+	}
+	bytes := collector.GetStats().BytesTransferred - before
+	return calculateCurrentRate(bytes, time.Since(started).Seconds()), true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func bestRate(levels []sweepLevel) float64 {
+	var best float64
+	for _, level := range levels {
+		best = max(best, level.rate)
+	}
+	return best
+}
+
+// sweepKnee returns the level with the fewest workers reaching kneeShare
+// of the best rate, or false if nothing was received.
+func sweepKnee(levels []sweepLevel) (sweepLevel, bool) {
+	best := bestRate(levels)
+	if best <= 0 {
+		return sweepLevel{}, false
+	}
+	for _, level := range levels {
+		if level.rate >= best*kneeShare {
+			return level, true
+		}
+	}
+	return sweepLevel{}, false
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"dataconsumer/internal/control"
+)
+
+// runTrayCommand shows a running daemon in the system tray. The tray
+// itself needs cgo on macOS and D-Bus on Linux, so it is only compiled
+// in with -tags tray; see tray_systray.go.
+func runTrayCommand(args []string) int {
+	fs := flag.NewFlagSet("tray", flag.ExitOnError)
+	socketPath := fs.String("socket", control.DefaultSocketPath(), "Path of the daemon's control socket")
+	interval := fs.Int("interval", 2, "Seconds between status updates")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dataconsumer tray [-socket path] [-interval seconds]")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if *interval < 1 {
+		fmt.Fprintln(os.Stderr, "-interval must be at least 1 second")
+		return 2
+	}
+	return runTray(*socketPath, time.Duration(*interval)*time.Second)
+}
+
+// trayStatusLine summarises a daemon status for the tray title, tooltip
+// and menu.
+func trayStatusLine(status *control.Status, err error) string {
+	switch {
+	case err != nil:
+		return "dataconsumer: daemon not reachable"
+	case status.State == "idle":
+		return "dataconsumer: idle"
+	case status.State == "captive_portal":
+		return "dataconsumer: paused by a captive portal"
+	case status.State == "paused":
+		return fmt.Sprintf("dataconsumer: paused, %.2f MB", status.Stats.TotalMegabytes)
+	}
+	return fmt.Sprintf("dataconsumer: %.2f MB/min, %.2f MB", status.Stats.CurrentRate, status.Stats.TotalMegabytes)
+}
@@ -0,0 +1,14 @@
+//go:build !tray
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+func runTray(socketPath string, interval time.Duration) int {
+	fmt.Fprintln(os.Stderr, "This build has no tray support; rebuild with 'go build -tags tray ./cmd/dataconsumer'.")
+	return 2
+}
@@ -0,0 +1,125 @@
+//go:build tray
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"fyne.io/systray"
+
+	"dataconsumer/internal/control"
+)
+
+func runTray(socketPath string, interval time.Duration) int {
+	if _, err := control.Send(socketPath, control.Request{Command: "status"}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: no daemon at %s yet: %v\n", socketPath, err)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		systray.Quit()
+	}()
+	systray.Run(func() { trayReady(socketPath, interval) }, nil)
+	return 0
+}
+
+// trayReady builds the menu and keeps it in step with the daemon until
+// Quit is chosen.
+func trayReady(socketPath string, interval time.Duration) {
+	systray.SetIcon(trayIcon())
+	systray.SetTitle("dataconsumer")
+	systray.SetTooltip("dataconsumer")
+	info := systray.AddMenuItem("dataconsumer", "")
+	info.Disable()
+	systray.AddSeparator()
+	pause := systray.AddMenuItem("Pause", "Pause the consumer")
+	resume := systray.AddMenuItem("Resume", "Resume the consumer")
+	systray.AddSeparator()
+	quit := systray.AddMenuItem("Quit", "Close the tray helper; the daemon keeps running")
+
+	refresh := func() {
+		resp, err := control.Send(socketPath, control.Request{Command: "status"})
+		line := trayStatusLine(resp.Status, err)
+		systray.SetTitle(line)
+		systray.SetTooltip(line)
+		info.SetTitle(line)
+		running := err == nil && resp.Status.State == "running"
+		paused := err == nil && resp.Status.State == "paused"
+		showItem(pause, running)
+		showItem(resume, paused)
+	}
+	send := func(command string) {
+		if _, err := control.Send(socketPath, control.Request{Command: command}); err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", command, err)
+		}
+		refresh()
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		refresh()
+		for {
+			select {
+			case <-ticker.C:
+				refresh()
+			case <-pause.ClickedCh:
+				send("pause")
+			case <-resume.ClickedCh:
+				send("resume")
+			case <-quit.ClickedCh:
+				systray.Quit()
+				return
+			}
+		}
+	}()
+}
+
+func showItem(item *systray.MenuItem, visible bool) {
+	if visible {
+		item.Show()
+	} else {
+		item.Hide()
+	}
+}
+
+// trayIcon draws a filled circle as a PNG, wrapped in an ICO container on
+// Windows, which is the only format its tray accepts.
+func trayIcon() []byte {
+	const size = 32
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	fill := color.NRGBA{R: 0x1e, G: 0x88, B: 0xe5, A: 0xff}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := x-size/2, y-size/2
+			if dx*dx+dy*dy <= (size/2-2)*(size/2-2) {
+				img.Set(x, y, fill)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	if runtime.GOOS != "windows" {
+		return buf.Bytes()
+	}
+	// ICONDIR followed by one ICONDIRENTRY pointing at the PNG data.
+	ico := make([]byte, 22, 22+buf.Len())
+	binary.LittleEndian.PutUint16(ico[2:], 1)
+	binary.LittleEndian.PutUint16(ico[4:], 1)
+	ico[6], ico[7] = size, size
+	binary.LittleEndian.PutUint16(ico[10:], 1)
+	binary.LittleEndian.PutUint16(ico[12:], 32)
+	binary.LittleEndian.PutUint32(ico[14:], uint32(buf.Len()))
+	binary.LittleEndian.PutUint32(ico[18:], 22)
+	return append(ico, buf.Bytes()...)
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd || windows)
+
+package main
+
+import "errors"
+
+func enableKeyInput() (func(), error) {
+	return nil, errors.New("key input is not supported on this platform")
+}
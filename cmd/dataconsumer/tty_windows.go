@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableKeyInput switches the console on stdin to deliver key presses
+// immediately and without echo, while keeping Ctrl+C working. It returns
+// a function restoring the previous mode, or an error if stdin is not a
+// console.
+func enableKeyInput() (func(), error) {
+	handle := windows.Handle(os.Stdin.Fd())
+	var saved uint32
+	if err := windows.GetConsoleMode(handle, &saved); err != nil {
+		return nil, err
+	}
+	mode := saved &^ (windows.ENABLE_LINE_INPUT | windows.ENABLE_ECHO_INPUT)
+	if err := windows.SetConsoleMode(handle, mode); err != nil {
+		return nil, err
+	}
+	return func() { windows.SetConsoleMode(handle, saved) }, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// yamlNode is a JSON value decoded with object key order preserved.
+type yamlNode struct {
+	keys   []string
+	fields []*yamlNode
+	items  []*yamlNode
+	scalar string
+	kind   byte // '{', '[' or 0 for scalars
+}
+
+// marshalYAML renders v as YAML by way of its JSON encoding, so custom
+// MarshalJSON methods (rates, sizes, sources) are honoured and field order
+// matches the JSON output.
+func marshalYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	root, err := decodeYAMLNode(decoder)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writeYAMLNode(&buf, root, 0)
+	return buf.Bytes(), nil
+}
+
+func decodeYAMLNode(decoder *json.Decoder) (*yamlNode, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		node := &yamlNode{kind: byte(t)}
+		for decoder.More() {
+			if t == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.keys = append(node.keys, key.(string))
+			}
+			child, err := decodeYAMLNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			if t == '{' {
+				node.fields = append(node.fields, child)
+			} else {
+				node.items = append(node.items, child)
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		quoted, _ := json.Marshal(t)
+		return &yamlNode{scalar: string(quoted)}, nil
+	case nil:
+		return &yamlNode{scalar: "null"}, nil
+	default:
+		return &yamlNode{scalar: fmt.Sprint(t)}, nil
+	}
+}
+
+func (n *yamlNode) inline() (string, bool) {
+	switch {
+	case n.kind == 0:
+		return n.scalar, true
+	case n.kind == '{' && len(n.keys) == 0:
+		return "{}", true
+	case n.kind == '[' && len(n.items) == 0:
+		return "[]", true
+	}
+	return "", false
+}
+
+func writeYAMLNode(buf *bytes.Buffer, n *yamlNode, indent int) {
+	pad := strings.Repeat("  ", indent)
+	if s, ok := n.inline(); ok {
+		buf.WriteString(pad + s + "\n")
+		return
+	}
+	if n.kind == '{' {
+		for i, key := range n.keys {
+			writeYAMLEntry(buf, pad+yamlKey(key)+":", n.fields[i], indent)
+		}
+		return
+	}
+	for _, item := range n.items {
+		if item.kind == '{' && len(item.keys) > 0 {
+			var nested bytes.Buffer
+			writeYAMLNode(&nested, item, indent+1)
+			buf.WriteString(pad + "- " + strings.TrimPrefix(nested.String(), pad+"  "))
+			continue
+		}
+		writeYAMLEntry(buf, pad+"-", item, indent)
+	}
+}
+
+func writeYAMLEntry(buf *bytes.Buffer, prefix string, value *yamlNode, indent int) {
+	if s, ok := value.inline(); ok {
+		buf.WriteString(prefix + " " + s + "\n")
+		return
+	}
+	buf.WriteString(prefix + "\n")
+	writeYAMLNode(buf, value, indent+1)
+}
+
+func yamlKey(key string) string {
+	for _, r := range key {
+		if !(r == '_' || r == '-' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			quoted, _ := json.Marshal(key)
+			return string(quoted)
+		}
+	}
+	return key
+}
@@ -0,0 +1,21 @@
+package configs
+
+// APIConfig configures the control APIs. The HTTP API is served on Listen
+// and the gRPC API on GRPCListen; each is disabled when its address is empty.
+//
+// ReadyRateTolerance, in percent, makes /readyz fail while the current rate
+// is more than that far below the target rate. Zero disables the check.
+//
+// Token, if set, must accompany every request to either API except
+// /healthz; without it, $DATACONSUMER_TOKEN is used. TLSCert and TLSKey
+// serve both APIs over TLS, and TLSSelfSigned does so with a generated
+// certificate, saved to TLSCert and TLSKey if they are set.
+type APIConfig struct {
+	Listen             string  `json:"listen,omitempty"`
+	GRPCListen         string  `json:"grpc_listen,omitempty"`
+	ReadyRateTolerance float64 `json:"ready_rate_tolerance,omitempty"`
+	Token              string  `json:"token,omitempty"`
+	TLSCert            string  `json:"tls_cert,omitempty"`
+	TLSKey             string  `json:"tls_key,omitempty"`
+	TLSSelfSigned      bool    `json:"tls_self_signed,omitempty"`
+}
@@ -0,0 +1,40 @@
+package configs
+
+// CanaryConfig checks before and during a run that the network really
+// reaches the internet, by fetching URL and comparing the answer with the
+// known content: Status (default 204, or 200 if Body is set) and, if set,
+// Body, compared with leading and trailing whitespace trimmed. A different
+// answer, a redirect, or the URL's host resolving to a private address
+// means a captive portal or DNS hijack, and consumption pauses until the
+// check passes again. It runs every Interval seconds, default 60.
+type CanaryConfig struct {
+	URL      string `json:"url,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Body     string `json:"body,omitempty"`
+	Interval int    `json:"interval,omitempty"`
+}
+
+// DefaultCanaryURL answers 204 No Content wherever the internet is reachable.
+const DefaultCanaryURL = "http://connectivitycheck.gstatic.com/generate_204"
+
+// WithDefaults returns c, or the zero config if c is nil, with the
+// defaults filled in.
+func (c *CanaryConfig) WithDefaults() CanaryConfig {
+	var d CanaryConfig
+	if c != nil {
+		d = *c
+	}
+	if d.URL == "" {
+		d.URL = DefaultCanaryURL
+	}
+	if d.Status == 0 {
+		d.Status = 204
+		if d.Body != "" {
+			d.Status = 200
+		}
+	}
+	if d.Interval <= 0 {
+		d.Interval = 60
+	}
+	return d
+}
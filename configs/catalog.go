@@ -0,0 +1,10 @@
+package configs
+
+// CatalogConfig names the signed source catalog that "sources update"
+// merges fresh sources from. PublicKey is the base64 Ed25519 key the
+// catalog must be signed with. Without either, the catalog published with
+// the project is used.
+type CatalogConfig struct {
+	URL       string `json:"url"`
+	PublicKey string `json:"public_key"`
+}
@@ -2,67 +2,205 @@ package configs
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 )
 
 type Config struct {
-	DataSources       []string `json:"data_sources"`
-	TargetRate        int      `json:"target_rate"`
-	Duration          int      `json:"duration"`
-	VerboseLogging    bool     `json:"verbose_logging"`
-	SaveMetrics       bool     `json:"save_metrics"`
-	MetricsFile       string   `json:"metrics_file"`
-	ConcurrencyFactor int      `json:"concurrency_factor"`
-	UseRandomization  bool     `json:"use_randomization"`
-	RequestTimeout    int      `json:"request_timeout"`
+	Version           int                `json:"version"`
+	Include           []string           `json:"include,omitempty"`
+	DataSources       []Source           `json:"data_sources"`
+	TargetRate        Rate               `json:"target_rate"`
+	TargetMode        TargetMode         `json:"target_mode,omitempty"`
+	TargetCatchUp     Duration           `json:"target_catch_up,omitempty"`
+	TargetRPS         float64            `json:"target_rps,omitempty"`
+	ObjectSize        Size               `json:"object_size,omitempty"`
+	SmallSources      *SmallSourcePolicy `json:"small_sources,omitempty"`
+	MaxBandwidth      Rate               `json:"max_bandwidth,omitempty"`
+	FairShare         *FairShareConfig   `json:"fair_share,omitempty"`
+	MaxData           Size               `json:"max_data,omitempty"`
+	Duration          Duration           `json:"duration"`
+	EndAt             string             `json:"end_at,omitempty"`
+	Verbosity         Verbosity          `json:"verbosity"`
+	SaveMetrics       bool               `json:"save_metrics"`
+	MetricsFile       string             `json:"metrics_file"`
+	ConcurrencyFactor int                `json:"concurrency_factor"`
+	AutoWorkers       bool               `json:"auto_workers,omitempty"`
+	MaxConnsPerSource int                `json:"max_conns_per_source,omitempty"`
+	UseRandomization  bool               `json:"use_randomization"`
+	HeaderPersonas    bool               `json:"header_personas,omitempty"`
+	RequestTimeout    int                `json:"request_timeout"`
+	ShutdownGrace     int                `json:"shutdown_grace"`
+	DrainGrace        int                `json:"drain_grace"`
+	ReadTimeout       int                `json:"read_timeout"`
+	BodyTimeout       int                `json:"body_timeout,omitempty"`
+	Canary            *CanaryConfig      `json:"canary,omitempty"`
+	Egress            *EgressConfig      `json:"egress,omitempty"`
+	BufferSize        Size               `json:"buffer_size,omitempty"`
+	MemoryLimit       Size               `json:"memory_limit,omitempty"`
+	WireAccounting    bool               `json:"wire_accounting,omitempty"`
+	SaveTo            *SaveToConfig      `json:"save_to,omitempty"`
+	Footprint         *FootprintConfig   `json:"footprint,omitempty"`
+	Proxy             *ProxyConfig       `json:"proxy,omitempty"`
+	Transport         *TransportConfig   `json:"transport,omitempty"`
+	Redirects         *RedirectPolicy    `json:"redirects,omitempty"`
+	API               *APIConfig         `json:"api,omitempty"`
+	Profiles          map[string]Profile `json:"profiles,omitempty"`
+	Schedules         []Schedule         `json:"schedules,omitempty"`
+	ProfileRules      []ProfileRule      `json:"profile_rules,omitempty"`
+	Jobs              []Job              `json:"jobs,omitempty"`
+	Success           *SuccessCriteria   `json:"success,omitempty"`
+	Stop              *StopConditions    `json:"stop,omitempty"`
+	Coordinator       string             `json:"coordinator,omitempty"`
+	Pushgateway       *PushgatewayConfig `json:"pushgateway,omitempty"`
+	LockFile          string             `json:"lock_file,omitempty"`
+	Plugins           []Plugin           `json:"plugins,omitempty"`
+	Catalog           *CatalogConfig     `json:"catalog,omitempty"`
+	DNS               *DNSLoadConfig     `json:"dns,omitempty"`
 }
 
+// TargetMode is how the consumer holds to its target rate.
+type TargetMode string
+
+const (
+	// AtLeast paces the consumer at the target rate, letting it run
+	// faster to make up for time spent below it, so that the average
+	// rate converges on the target from above. It is the default.
+	AtLeast TargetMode = "at_least"
+	// AtMost never lets the consumer run faster than the target rate.
+	AtMost TargetMode = "at_most"
+	// Unpaced consumes as fast as the workers can and only reports how
+	// the rate compares to the target.
+	Unpaced TargetMode = "none"
+)
+
+// Validate reports whether m is a known mode; empty means AtLeast.
+func (m TargetMode) Validate() error {
+	switch m {
+	case "", AtLeast, AtMost, Unpaced:
+		return nil
+	}
+	return fmt.Errorf("unknown target_mode %q; use %q, %q or %q", string(m), AtLeast, AtMost, Unpaced)
+}
+
+// MaxConcurrency is the largest concurrency_factor accepted.
+const MaxConcurrency = 4096
+
+// ValidateConcurrency checks that the concurrency_factor of the config and
+// its profiles is at most MaxConcurrency and not negative. Zero leaves the
+// number of workers to the consumer's default.
+func (c *Config) ValidateConcurrency() error {
+	if c.ConcurrencyFactor < 0 || c.ConcurrencyFactor > MaxConcurrency {
+		return fmt.Errorf("concurrency_factor %d is out of range; use 0 (default) or 1 to %d", c.ConcurrencyFactor, MaxConcurrency)
+	}
+	for name, profile := range c.Profiles {
+		if profile.ConcurrencyFactor < 0 || profile.ConcurrencyFactor > MaxConcurrency {
+			return fmt.Errorf("profile %q: concurrency_factor %d is out of range; use 0 (default) or 1 to %d", name, profile.ConcurrencyFactor, MaxConcurrency)
+		}
+	}
+	return nil
+}
+
+// Verbosity controls how much the consumer prints.
+type Verbosity int
+
+const (
+	// Quiet suppresses the banner and periodic status lines.
+	Quiet Verbosity = -1
+	// Normal prints the banner and periodic status lines.
+	Normal Verbosity = 0
+	// Verbose also reports per-request errors and retries.
+	Verbose Verbosity = 1
+	// Debug also traces connections and completed requests.
+	Debug Verbosity = 2
+)
+
 func DefaultConfig() *Config {
 	return &Config{
-		DataSources: []string{
-			"https://speed.cloudflare.com/1000mb.bin",                                                   // 1 GB
-			"https://ftp.arnes.si/software/ubuntu-releases/20.04/ubuntu-20.04.3-desktop-amd64.iso",      // ~2.5 GB
-			"https://releases.ubuntu.com/20.04.4/ubuntu-20.04.4-desktop-amd64.iso",                      // ~2.5 GB
-			"https://ftp.gnu.org/gnu/gcc/gcc-11.1.0/gcc-11.1.0.tar.xz",                                  // ~100 MB
-			"https://download.blender.org/release/Blender2.93/blender-2.93.0-linux64.tar.xz",            // ~200 MB
-			"https://ftp.mozilla.org/pub/firefox/releases/90.0/linux-x86_64/en-US/firefox-90.0.tar.bz2", // ~70 MB
-			"https://ftp.gnu.org/gnu/binutils/binutils-2.36.1.tar.xz",                                   // ~20 MB
+		Version: CurrentVersion,
+		DataSources: []Source{
+			{URL: "https://speed.cloudflare.com/1000mb.bin"},                                                   // 1 GB
+			{URL: "https://ftp.arnes.si/software/ubuntu-releases/20.04/ubuntu-20.04.3-desktop-amd64.iso"},      // ~2.5 GB
+			{URL: "https://releases.ubuntu.com/20.04.4/ubuntu-20.04.4-desktop-amd64.iso"},                      // ~2.5 GB
+			{URL: "https://ftp.gnu.org/gnu/gcc/gcc-11.1.0/gcc-11.1.0.tar.xz"},                                  // ~100 MB
+			{URL: "https://download.blender.org/release/Blender2.93/blender-2.93.0-linux64.tar.xz"},            // ~200 MB
+			{URL: "https://ftp.mozilla.org/pub/firefox/releases/90.0/linux-x86_64/en-US/firefox-90.0.tar.bz2"}, // ~70 MB
+			{URL: "https://ftp.gnu.org/gnu/binutils/binutils-2.36.1.tar.xz"},                                   // ~20 MB
 		},
-		TargetRate:        1024,
+		TargetRate:        RateFromMBPerMinute(1024),
 		Duration:          0,
-		VerboseLogging:    false,
+		Verbosity:         Normal,
 		SaveMetrics:       true,
 		MetricsFile:       "dataconsumer_metrics.json",
 		ConcurrencyFactor: runtime.NumCPU(),
 		UseRandomization:  true,
 		RequestTimeout:    60,
+		ShutdownGrace:     10,
+		DrainGrace:        30,
+		ReadTimeout:       30,
 	}
 }
 
+// LoadConfig reads the config file at path on top of the defaults. Files
+// listed under "include" are merged first, in order, so the including file
+// overrides anything it includes.
 func LoadConfig(path string) (*Config, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
 	config := DefaultConfig()
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(config); err != nil {
+	if err := loadInto(config, path, map[string]bool{}); err != nil {
 		return nil, err
 	}
 	return config, nil
 }
 
-func SaveConfig(config *Config, path string) error {
-	file, err := os.Create(path)
+func loadInto(config *Config, path string, visiting map[string]bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if visiting[absPath] {
+		return fmt.Errorf("config include cycle at %s", path)
+	}
+	visiting[absPath] = true
+	defer delete(visiting, absPath)
+
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	if data, err = migrateData(data); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	var header struct {
+		Include []string `json:"include"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, include := range header.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		if err := loadInto(config, include, visiting); err != nil {
+			return err
+		}
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(config)
+// DefaultConfigPath returns the OS-specific location searched when no
+// config file is given: $XDG_CONFIG_HOME (or ~/.config) on Unix, %AppData%
+// on Windows and ~/Library/Application Support on macOS.
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dataconsumer", "config.json"), nil
 }
@@ -0,0 +1,35 @@
+package configs
+
+import "fmt"
+
+// DNSLoadConfig adds DNS queries to a run, for testing a resolver's
+// capacity alongside the bandwidth consumption. Queries for random
+// subdomains of Domain, so that the resolver cannot answer from its
+// cache, are sent to Resolver at QPS queries per second, cycling through
+// Types ("A", "AAAA" or "TXT", default A).
+type DNSLoadConfig struct {
+	Resolver string   `json:"resolver"`
+	Domain   string   `json:"domain"`
+	QPS      float64  `json:"qps"`
+	Types    []string `json:"types,omitempty"`
+	// Timeout is how long to wait for each answer in seconds, default 5.
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// Validate checks the settings. A nil config is valid.
+func (c *DNSLoadConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Resolver == "" || c.Domain == "" || c.QPS <= 0 {
+		return fmt.Errorf("resolver, domain and a positive qps are required")
+	}
+	for _, t := range c.Types {
+		switch t {
+		case "A", "AAAA", "TXT":
+		default:
+			return fmt.Errorf("unsupported query type %q, want A, AAAA or TXT", t)
+		}
+	}
+	return nil
+}
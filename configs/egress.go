@@ -0,0 +1,20 @@
+package configs
+
+// EgressConfig asks the echo endpoint at URL every Interval seconds
+// (default 300) which address the requests come from and which headers
+// reach it, to record the public IP the run egresses from and any NAT or
+// proxies in between. The endpoint answers with a JSON object holding the
+// address as "origin" and the request headers as "headers", like
+// httpbin's /get and the /echo endpoint of the serve command.
+type EgressConfig struct {
+	URL      string `json:"url"`
+	Interval int    `json:"interval,omitempty"`
+}
+
+// WithDefaults returns a copy of e with the defaults filled in.
+func (e EgressConfig) WithDefaults() EgressConfig {
+	if e.Interval <= 0 {
+		e.Interval = 300
+	}
+	return e
+}
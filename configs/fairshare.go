@@ -0,0 +1,41 @@
+package configs
+
+import "fmt"
+
+// FairShareConfig keeps consumption at Percent of the measured link
+// capacity instead of a fixed rate, so that it backs off when other users
+// congest the link. Every Interval seconds (default 300) the rate limit is
+// lifted for a Probe of Probe seconds (default 5), and the bandwidth
+// ceiling is then set to Percent of the rate reached, never above
+// max_bandwidth.
+type FairShareConfig struct {
+	Percent  float64 `json:"percent"`
+	Interval int     `json:"interval,omitempty"`
+	Probe    int     `json:"probe,omitempty"`
+}
+
+// WithDefaults returns the settings with zero values replaced by the
+// defaults.
+func (c FairShareConfig) WithDefaults() FairShareConfig {
+	if c.Interval <= 0 {
+		c.Interval = 300
+	}
+	if c.Probe <= 0 {
+		c.Probe = 5
+	}
+	return c
+}
+
+// Validate checks the settings. A nil config is valid.
+func (c *FairShareConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Percent <= 0 || c.Percent > 100 {
+		return fmt.Errorf("percent must be above 0 and at most 100")
+	}
+	if d := c.WithDefaults(); d.Probe >= d.Interval {
+		return fmt.Errorf("probe must be shorter than the interval")
+	}
+	return nil
+}
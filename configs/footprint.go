@@ -0,0 +1,36 @@
+package configs
+
+import "fmt"
+
+// FootprintConfig sets the factors the energy and carbon footprint of the
+// consumed data is estimated with: KWhPerGB is the energy per gigabyte
+// transferred (default 0.06, a common estimate for fixed-line networks)
+// and GridIntensity the grams of CO2e emitted per kWh (default 475, the
+// global average of electricity generation).
+type FootprintConfig struct {
+	KWhPerGB      float64 `json:"kwh_per_gb,omitempty"`
+	GridIntensity float64 `json:"grid_intensity,omitempty"`
+}
+
+// WithDefaults returns the factors with zero values replaced by the
+// defaults.
+func (c FootprintConfig) WithDefaults() FootprintConfig {
+	if c.KWhPerGB == 0 {
+		c.KWhPerGB = 0.06
+	}
+	if c.GridIntensity == 0 {
+		c.GridIntensity = 475
+	}
+	return c
+}
+
+// Validate checks the factors. A nil config is valid.
+func (c *FootprintConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.KWhPerGB < 0 || c.GridIntensity < 0 {
+		return fmt.Errorf("kwh_per_gb and grid_intensity must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package configs
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Job is a named consumption job run side by side with the other jobs of
+// a config by its own consumer. Unset fields keep the config's values;
+// Profile is applied before the job's own settings.
+type Job struct {
+	Name         string     `json:"name"`
+	DataSources  []Source   `json:"data_sources,omitempty"`
+	TargetRate   Rate       `json:"target_rate,omitempty"`
+	MaxBandwidth Rate       `json:"max_bandwidth,omitempty"`
+	MaxData      Size       `json:"max_data,omitempty"`
+	Duration     Duration   `json:"duration,omitempty"`
+	Profile      string     `json:"profile,omitempty"`
+	Schedules    []Schedule `json:"schedules,omitempty"`
+	MetricsFile  string     `json:"metrics_file,omitempty"`
+}
+
+// jobName is what job names may contain, as they become part of file
+// names.
+var jobName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ValidateJobs checks that every job has a unique name made of letters,
+// digits, '_', '.' and '-', and refers to a known profile.
+func (c *Config) ValidateJobs() error {
+	seen := make(map[string]bool, len(c.Jobs))
+	for _, job := range c.Jobs {
+		if !jobName.MatchString(job.Name) {
+			return fmt.Errorf("job name %q must be made of letters, digits, '_', '.' and '-'", job.Name)
+		}
+		if seen[job.Name] {
+			return fmt.Errorf("duplicate job %q", job.Name)
+		}
+		seen[job.Name] = true
+		if _, ok := c.Profiles[job.Profile]; job.Profile != "" && !ok {
+			return fmt.Errorf("job %q: unknown profile %q", job.Name, job.Profile)
+		}
+	}
+	return nil
+}
+
+// ForJob returns a copy of the config that runs only the job. Its metrics
+// file defaults to the config's with the job's name appended, e.g.
+// metrics_cdn.json.
+func (c *Config) ForJob(j Job) (*Config, error) {
+	job := *c
+	job.Jobs = nil
+	if j.Profile != "" {
+		profile, ok := c.Profiles[j.Profile]
+		if !ok {
+			return nil, fmt.Errorf("job %q: unknown profile %q", j.Name, j.Profile)
+		}
+		job.applyProfile(profile)
+	}
+	if j.DataSources != nil {
+		job.DataSources = j.DataSources
+	}
+	if j.TargetRate > 0 {
+		job.TargetRate = j.TargetRate
+	}
+	if j.MaxBandwidth > 0 {
+		job.MaxBandwidth = j.MaxBandwidth
+	}
+	if j.MaxData > 0 {
+		job.MaxData = j.MaxData
+	}
+	if j.Duration > 0 {
+		job.Duration = j.Duration
+	}
+	if j.Schedules != nil {
+		job.Schedules = j.Schedules
+	}
+	job.MetricsFile = j.MetricsFile
+	if job.MetricsFile == "" {
+		ext := filepath.Ext(c.MetricsFile)
+		job.MetricsFile = strings.TrimSuffix(c.MetricsFile, ext) + "_" + j.Name + ext
+	}
+	return &job, nil
+}
@@ -0,0 +1,126 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// CurrentVersion is the config schema version written by this build.
+//
+// Version 1 is the original schema: plain URL strings for data_sources and
+// an integer target_rate in MiB per minute. Version 2 introduced unit
+// strings for rates and sizes. Version 3 replaced the verbose_logging flag
+// with a verbosity level.
+const CurrentVersion = 3
+
+// migrations[i] upgrades a raw config document from version i+1 to i+2.
+var migrations = []func(doc map[string]interface{}) error{
+	migrateV1ToV2,
+	migrateV2ToV3,
+}
+
+func migrateV1ToV2(doc map[string]interface{}) error {
+	if rate, ok := doc["target_rate"].(float64); ok {
+		doc["target_rate"] = RateFromMBPerMinute(rate)
+	}
+	return nil
+}
+
+func migrateV2ToV3(doc map[string]interface{}) error {
+	if verbose, ok := doc["verbose_logging"].(bool); ok {
+		if verbose {
+			doc["verbosity"] = int(Verbose)
+		}
+		delete(doc, "verbose_logging")
+	}
+	return nil
+}
+
+// Migrate upgrades a raw config document to CurrentVersion in place and
+// reports whether anything changed.
+func Migrate(doc map[string]interface{}) (bool, error) {
+	version := 1
+	if v, ok := doc["version"].(float64); ok {
+		version = int(v)
+	}
+	if version < 1 {
+		return false, fmt.Errorf("config version %d is not supported", version)
+	}
+	if version > CurrentVersion {
+		return false, fmt.Errorf("config version %d is newer than supported version %d", version, CurrentVersion)
+	}
+	if version == CurrentVersion {
+		return false, nil
+	}
+	for ; version < CurrentVersion; version++ {
+		if err := migrations[version-1](doc); err != nil {
+			return false, fmt.Errorf("migrating config from version %d: %w", version, err)
+		}
+	}
+	doc["version"] = CurrentVersion
+	return true, nil
+}
+
+func migrateData(data []byte) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	changed, err := Migrate(doc)
+	if err != nil || !changed {
+		return data, err
+	}
+	return json.Marshal(doc)
+}
+
+// MigrateFile rewrites the config file at path in the current schema,
+// keeping a copy of the original next to it with a ".bak" suffix. It
+// reports whether the file needed migrating.
+func MigrateFile(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	changed, err := Migrate(doc)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	return true, rewriteFile(path, data, doc)
+}
+
+// rewriteFile writes doc to path, keeping the original contents next to it
+// with a ".bak" suffix.
+func rewriteFile(path string, original []byte, doc map[string]interface{}) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".bak", original, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// UpdateFile sets the given top-level settings in the config file at path,
+// leaving the rest of the file as it is and keeping a copy of the original
+// next to it with a ".bak" suffix.
+func UpdateFile(path string, values map[string]interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for key, value := range values {
+		doc[key] = value
+	}
+	return rewriteFile(path, data, doc)
+}
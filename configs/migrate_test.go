@@ -0,0 +1,122 @@
+package configs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// v1Config is a version 1 document: no version, plain URL strings and an
+// integer target_rate in MiB per minute.
+const v1Config = `{
+  "data_sources": ["https://a.example.com/1GB.bin", "https://b.example.com/1GB.bin"],
+  "target_rate": 1024,
+  "max_data": 1073741824,
+  "concurrency_factor": 8,
+  "duration": 60,
+  "verbose_logging": true,
+  "metrics_file": "v1_metrics.json"
+}`
+
+func TestMigrateV1(t *testing.T) {
+	var doc, original map[string]interface{}
+	if err := json.Unmarshal([]byte(v1Config), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(v1Config), &original); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := Migrate(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("Migrate reported no change for a version 1 document")
+	}
+
+	if doc["version"] != CurrentVersion {
+		t.Errorf("version = %v, want %d", doc["version"], CurrentVersion)
+	}
+	data, err := json.Marshal(doc["target_rate"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"1 GiB/min"` {
+		t.Errorf("target_rate = %s, want %q", data, "1 GiB/min")
+	}
+	if doc["verbosity"] != int(Verbose) {
+		t.Errorf("verbosity = %v, want %d", doc["verbosity"], Verbose)
+	}
+	if _, ok := doc["verbose_logging"]; ok {
+		t.Error("verbose_logging was kept")
+	}
+
+	// Everything else is left as it was.
+	for _, key := range []string{"version", "target_rate", "verbosity", "verbose_logging"} {
+		delete(doc, key)
+		delete(original, key)
+	}
+	if !reflect.DeepEqual(doc, original) {
+		t.Errorf("other settings changed:\n got %v\nwant %v", doc, original)
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(v1Config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := MigrateFile(path)
+	if err != nil || !changed {
+		t.Fatalf("MigrateFile = %v, %v, want true, nil", changed, err)
+	}
+	backup, err := os.ReadFile(path + ".bak")
+	if err != nil || string(backup) != v1Config {
+		t.Errorf("backup = %q, %v, want the original file", backup, err)
+	}
+	after, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Loading migrates in memory, so the rewritten file loads the same.
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("migrated file loads as\n%+v\nwant\n%+v", after, before)
+	}
+	if want := RateFromMBPerMinute(1024); after.TargetRate != want {
+		t.Errorf("target_rate = %v, want %v", after.TargetRate, want)
+	}
+	if len(after.DataSources) != 2 || after.MaxData != 1<<30 || after.ConcurrencyFactor != 8 {
+		t.Errorf("data_sources, max_data or concurrency_factor changed: %+v", after)
+	}
+
+	if changed, err := MigrateFile(path); err != nil || changed {
+		t.Errorf("second MigrateFile = %v, %v, want false, nil", changed, err)
+	}
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	doc := map[string]interface{}{"version": float64(CurrentVersion + 1)}
+	if _, err := Migrate(doc); err == nil {
+		t.Error("Migrate accepted a newer version")
+	}
+}
+
+func TestMigrateInvalidVersion(t *testing.T) {
+	for _, version := range []string{"0", "-1"} {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(`{"version": `+version+`}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadConfig(path)
+		if err == nil || !strings.Contains(err.Error(), "config version "+version+" is not supported") {
+			t.Errorf("version %s: LoadConfig error = %v", version, err)
+		}
+	}
+}
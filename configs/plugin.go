@@ -0,0 +1,39 @@
+package configs
+
+import "fmt"
+
+// Plugin kinds.
+const (
+	// SourcePlugin provides the sources whose protocol is the plugin's
+	// name.
+	SourcePlugin = "source"
+	// SinkPlugin receives the metrics of every session.
+	SinkPlugin = "sink"
+)
+
+// Plugin is an external program integrating a proprietary source or
+// metrics system without changing dataconsumer. Command is the program
+// and its arguments; Env adds to the environment it inherits.
+type Plugin struct {
+	Name    string            `json:"name"`
+	Kind    string            `json:"kind"`
+	Command []string          `json:"command"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+// Validate reports whether the plugin can be started.
+func (p Plugin) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("plugin has no name")
+	}
+	if p.Kind != SourcePlugin && p.Kind != SinkPlugin {
+		return fmt.Errorf("plugin %s: kind must be %q or %q", p.Name, SourcePlugin, SinkPlugin)
+	}
+	if len(p.Command) == 0 || p.Command[0] == "" {
+		return fmt.Errorf("plugin %s: no command", p.Name)
+	}
+	if p.Kind == SourcePlugin && (p.Name == "http" || p.Name == "https") {
+		return fmt.Errorf("plugin %s: protocol is built in", p.Name)
+	}
+	return nil
+}
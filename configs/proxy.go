@@ -0,0 +1,23 @@
+package configs
+
+// ProxyConfig routes source traffic through an HTTP(S) or SOCKS5 proxy.
+// NoProxy entries may be host names, ".domain" suffixes, IP addresses,
+// CIDR ranges or "*"; matching hosts are fetched directly.
+//
+// With a Pool, requests rotate through URL and the pool's proxies. Username
+// and Password apply to those without credentials of their own. A pool
+// proxy failing more than MaxErrorRate percent of at least 20 requests is
+// taken out of rotation, unless it is the last one left.
+//
+// PAC instead names a proxy auto-config file, by URL or path, whose
+// FindProxyForURL picks the proxy for each source. It cannot be combined
+// with URL or Pool.
+type ProxyConfig struct {
+	URL          string   `json:"url"`
+	PAC          string   `json:"pac,omitempty"`
+	Pool         []string `json:"pool,omitempty"`
+	MaxErrorRate float64  `json:"max_error_rate,omitempty"`
+	NoProxy      []string `json:"no_proxy,omitempty"`
+	Username     string   `json:"username,omitempty"`
+	Password     string   `json:"password,omitempty"`
+}
@@ -0,0 +1,16 @@
+package configs
+
+// PushgatewayConfig pushes metrics to a Prometheus Pushgateway at URL under
+// the grouping key job/instance plus Labels. Job defaults to
+// "dataconsumer" and Instance to the hostname.
+//
+// Metrics are pushed every Interval seconds while a session runs, at the
+// collector's next rate sample (every 10 seconds), and once more when it
+// ends. Zero only pushes the final metrics.
+type PushgatewayConfig struct {
+	URL      string            `json:"url"`
+	Job      string            `json:"job,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Interval int               `json:"interval,omitempty"`
+}
@@ -0,0 +1,12 @@
+package configs
+
+// RedirectPolicy controls how redirects from the sources are followed.
+// MaxHops is the longest chain of redirects followed (default 10, the
+// limit of Go's HTTP client); a request redirected more often fails.
+// SameHost fails requests redirected to a host other than the source's,
+// and Log logs every redirect followed.
+type RedirectPolicy struct {
+	MaxHops  int  `json:"max_hops,omitempty"`
+	SameHost bool `json:"same_host,omitempty"`
+	Log      bool `json:"log,omitempty"`
+}
@@ -0,0 +1,15 @@
+package configs
+
+// SaveToConfig keeps the downloaded objects in Dir instead of discarding
+// them, e.g. to pre-seed an offline mirror while consuming the same
+// bandwidth. Each source URL is saved once per run under
+// Dir/<host>/<path>; the query string is ignored.
+//
+// Once the files in Dir add up to Quota, further objects are consumed but
+// not saved; zero means no quota. With Dedup, an object whose SHA-256
+// matches one already in Dir is not kept a second time.
+type SaveToConfig struct {
+	Dir   string `json:"dir"`
+	Quota Size   `json:"quota,omitempty"`
+	Dedup bool   `json:"dedup,omitempty"`
+}
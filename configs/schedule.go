@@ -0,0 +1,73 @@
+package configs
+
+import "fmt"
+
+// Profile is a named set of overrides that schedule entries can refer to.
+type Profile struct {
+	TargetRate        Rate `json:"target_rate,omitempty"`
+	MaxBandwidth      Rate `json:"max_bandwidth,omitempty"`
+	ConcurrencyFactor int  `json:"concurrency_factor,omitempty"`
+}
+
+// Schedule describes a recurring consumption window. The window opens at
+// every time matched by Cron and lasts Duration.
+type Schedule struct {
+	Name       string   `json:"name"`
+	Cron       string   `json:"cron"`
+	Duration   Duration `json:"duration"`
+	TargetRate Rate     `json:"target_rate,omitempty"`
+	Profile    string   `json:"profile,omitempty"`
+}
+
+// ForSchedule returns a copy of the config with the schedule's profile and
+// overrides applied.
+func (c *Config) ForSchedule(s Schedule) (*Config, error) {
+	scheduled := *c
+	if s.Profile != "" {
+		profile, ok := c.Profiles[s.Profile]
+		if !ok {
+			return nil, fmt.Errorf("schedule %q: unknown profile %q", s.Name, s.Profile)
+		}
+		scheduled.applyProfile(profile)
+	}
+	if s.TargetRate > 0 {
+		scheduled.TargetRate = s.TargetRate
+	}
+	scheduled.Duration = s.Duration
+	return &scheduled, nil
+}
+
+func (c *Config) applyProfile(p Profile) {
+	if p.TargetRate > 0 {
+		c.TargetRate = p.TargetRate
+	}
+	if p.MaxBandwidth > 0 {
+		c.MaxBandwidth = p.MaxBandwidth
+	}
+	if p.ConcurrencyFactor > 0 {
+		c.ConcurrencyFactor = p.ConcurrencyFactor
+	}
+}
+
+// ProfileRule applies a profile on the days of the week in Days, written
+// like the day-of-week field of a cron expression ("sat,sun", "mon-fri"),
+// between the times of day From and To ("09:00", "17:00"). Without From
+// and To the rule covers the whole day; a To earlier than From ends the
+// next day.
+type ProfileRule struct {
+	Days    string `json:"days"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+	Profile string `json:"profile"`
+}
+
+// WithProfile returns a copy of the config with the named profile applied.
+func (c *Config) WithProfile(name string) (*Config, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	profiled := *c
+	profiled.applyProfile(profile)
+	return &profiled, nil
+}
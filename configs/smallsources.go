@@ -0,0 +1,34 @@
+package configs
+
+import "fmt"
+
+// Actions for sources smaller than a SmallSourcePolicy's MinSize.
+const (
+	// SkipSmallSources leaves small sources out of the run.
+	SkipSmallSources = "skip"
+	// DownWeightSmallSources picks small sources less often.
+	DownWeightSmallSources = "down_weight"
+)
+
+// SmallSourcePolicy keeps sources whose objects are too small to reach a
+// good rate, because most of their time goes into connection setup, from
+// dragging down the run. Sources whose Content-Length is below MinSize
+// are skipped or down-weighted according to Action, which defaults to
+// skipping. Sources of unknown size are kept.
+type SmallSourcePolicy struct {
+	MinSize Size   `json:"min_size"`
+	Action  string `json:"action,omitempty"`
+}
+
+// Validate checks the action. A nil policy is valid.
+func (p *SmallSourcePolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Action {
+	case "", SkipSmallSources, DownWeightSmallSources:
+		return nil
+	default:
+		return fmt.Errorf("action must be %q or %q", SkipSmallSources, DownWeightSmallSources)
+	}
+}
@@ -0,0 +1,239 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Source describes a single download source. In config files a source may
+// be written either as a plain URL string or as an object.
+type Source struct {
+	URL      string            `json:"url"`
+	Weight   int               `json:"weight,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Timeout  int               `json:"timeout,omitempty"`
+	Protocol string            `json:"protocol,omitempty"`
+	Auth     *SourceAuth       `json:"auth,omitempty"`
+	Proxy    string            `json:"proxy,omitempty"`
+	Enabled  *bool             `json:"enabled,omitempty"`
+	Expect   *Expectation      `json:"expect,omitempty"`
+}
+
+// DirectProxy as a source's Proxy bypasses the global proxy settings.
+const DirectProxy = "direct"
+
+// SourceAuth holds credentials sent with every request to a source.
+// Type is "basic" (Username/Password), "bearer" (Token), "sigv4" or
+// "hmac".
+//
+// With "sigv4", requests are signed with AWS Signature Version 4 for
+// Region and Service (default "s3"). AccessKeyID, SecretAccessKey and
+// SessionToken default to $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and
+// $AWS_SESSION_TOKEN; with RoleARN, those credentials assume the role and
+// its temporary credentials sign the requests.
+//
+// With "hmac", StringToSign is signed with Key using Algorithm ("sha256",
+// the default, "sha1" or "sha512") and the signature, encoded as Encoding
+// ("hex", the default, or "base64"), is sent in Header (default
+// "Authorization") as Value (default "{signature}"). StringToSign and
+// Value may contain {method}, {host}, {path}, {query}, {date} (RFC 1123
+// in GMT), {timestamp} (Unix seconds) and {key_id} (KeyID); Value also
+// {signature}. DateHeader and TimestampHeader, if set, send {date} and
+// {timestamp} in those headers.
+type SourceAuth struct {
+	Type     string `json:"type"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	SessionToken    string `json:"session_token,omitempty"`
+	Region          string `json:"region,omitempty"`
+	Service         string `json:"service,omitempty"`
+	RoleARN         string `json:"role_arn,omitempty"`
+
+	KeyID           string `json:"key_id,omitempty"`
+	Key             string `json:"key,omitempty"`
+	Algorithm       string `json:"algorithm,omitempty"`
+	Encoding        string `json:"encoding,omitempty"`
+	StringToSign    string `json:"string_to_sign,omitempty"`
+	Header          string `json:"header,omitempty"`
+	Value           string `json:"value,omitempty"`
+	DateHeader      string `json:"date_header,omitempty"`
+	TimestampHeader string `json:"timestamp_header,omitempty"`
+}
+
+// Expectation describes what an HTTP source must deliver, so that error
+// pages, captive portal redirects and HTML interstitials answered with a
+// 2xx status are not counted as consumed data. ContentType lists the
+// accepted media types, where "video/*" accepts any subtype; empty accepts
+// any. MinSize is the smallest acceptable object, checked against the
+// Content-Length or, if the server sends none, the body itself.
+type Expectation struct {
+	ContentType []string `json:"content_type,omitempty"`
+	MinSize     Size     `json:"min_size,omitempty"`
+}
+
+// IsEnabled reports whether the source should be used. Sources are enabled
+// unless explicitly disabled.
+func (s Source) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// EffectiveWeight returns the source weight, defaulting to 1.
+func (s Source) EffectiveWeight() int {
+	if s.Weight <= 0 {
+		return 1
+	}
+	return s.Weight
+}
+
+// Validate checks that the source can be used by the consumer.
+func (s Source) Validate() error {
+	if s.URL == "" {
+		return fmt.Errorf("source has no url")
+	}
+	if s.Auth != nil {
+		if err := s.Auth.validate(); err != nil {
+			return fmt.Errorf("source %s: %w", s.URL, err)
+		}
+	}
+	if s.Expect != nil {
+		switch s.Protocol {
+		case "", "http", "https":
+		default:
+			return fmt.Errorf("source %s: expect is only supported for http sources", s.URL)
+		}
+		for _, t := range s.Expect.ContentType {
+			if !strings.Contains(t, "/") {
+				return fmt.Errorf("source %s: invalid content type %q in expect", s.URL, t)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *SourceAuth) validate() error {
+	switch a.Type {
+	case "basic", "bearer":
+	case "sigv4":
+		if a.Region == "" {
+			return fmt.Errorf("sigv4 auth needs a region")
+		}
+		if (a.AccessKeyID == "") != (a.SecretAccessKey == "") {
+			return fmt.Errorf("sigv4 auth needs both access_key_id and secret_access_key, or neither")
+		}
+	case "hmac":
+		if a.Key == "" || a.StringToSign == "" {
+			return fmt.Errorf("hmac auth needs a key and a string_to_sign")
+		}
+		switch a.Algorithm {
+		case "", "sha1", "sha256", "sha512":
+		default:
+			return fmt.Errorf("unsupported hmac algorithm %q", a.Algorithm)
+		}
+		switch a.Encoding {
+		case "", "hex", "base64":
+		default:
+			return fmt.Errorf("unsupported hmac encoding %q", a.Encoding)
+		}
+	default:
+		return fmt.Errorf("unsupported auth type %q", a.Type)
+	}
+	return nil
+}
+
+// isPlain reports whether the source carries nothing but a URL and can be
+// written back as a plain string.
+func (s Source) isPlain() bool {
+	return s.Weight == 0 && len(s.Headers) == 0 && s.Timeout == 0 &&
+		s.Protocol == "" && s.Auth == nil && s.Proxy == "" && s.Enabled == nil && s.Expect == nil
+}
+
+func (s Source) MarshalJSON() ([]byte, error) {
+	if s.isPlain() {
+		return json.Marshal(s.URL)
+	}
+	type source Source
+	return json.Marshal(source(s))
+}
+
+func (s *Source) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*s = Source{URL: url}
+		return nil
+	}
+	type source Source
+	var decoded source
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Errorf("invalid source %s: %w", data, err)
+	}
+	*s = Source(decoded)
+	return nil
+}
+
+// SetSourceWeights rewrites the weights of the data sources listed in the
+// config file at path, keyed by URL, keeping a ".bak" copy of the original.
+// Sources defined in included files are not touched. It returns the number
+// of sources updated.
+func SetSourceWeights(path string, weights map[string]int) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	sources, _ := doc["data_sources"].([]interface{})
+	updated := 0
+	for i, entry := range sources {
+		switch v := entry.(type) {
+		case string:
+			if weight, ok := weights[v]; ok {
+				sources[i] = map[string]interface{}{"url": v, "weight": weight}
+				updated++
+			}
+		case map[string]interface{}:
+			url, _ := v["url"].(string)
+			if weight, ok := weights[url]; ok {
+				v["weight"] = weight
+				updated++
+			}
+		}
+	}
+	if updated == 0 {
+		return 0, nil
+	}
+	return updated, rewriteFile(path, data, doc)
+}
+
+// AddSources appends added to the data sources in the config file at
+// path, keeping a copy of the original next to it with a ".bak" suffix.
+// If the file does not list data sources itself, it gets current, the
+// sources it used so far, followed by added.
+func AddSources(path string, current, added []Source) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	sources, ok := doc["data_sources"].([]interface{})
+	if !ok {
+		for _, source := range current {
+			sources = append(sources, source)
+		}
+	}
+	for _, source := range added {
+		sources = append(sources, source)
+	}
+	doc["data_sources"] = sources
+	return rewriteFile(path, data, doc)
+}
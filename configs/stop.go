@@ -0,0 +1,13 @@
+package configs
+
+// StopConditions end a run early when it is no longer doing useful work.
+// Zero values disable the corresponding condition.
+//
+// MaxErrors stops the run after that many failed requests. AbortIfBelow
+// stops it once the rate has stayed below that rate for AbortAfter
+// seconds; time spent paused does not count.
+type StopConditions struct {
+	MaxErrors    int  `json:"max_errors,omitempty"`
+	AbortIfBelow Rate `json:"abort_if_below,omitempty"`
+	AbortAfter   int  `json:"abort_after,omitempty"`
+}
@@ -0,0 +1,13 @@
+package configs
+
+// SuccessCriteria decides whether a run passed. Zero values disable the
+// corresponding check.
+//
+// MaxErrorRate is the highest acceptable share of failed requests, in
+// percent. RequireTarget fails runs that did not end by reaching their
+// duration or data cap, e.g. because they were interrupted.
+type SuccessCriteria struct {
+	MinAverageRate Rate    `json:"min_average_rate,omitempty"`
+	MaxErrorRate   float64 `json:"max_error_rate,omitempty"`
+	RequireTarget  bool    `json:"require_target,omitempty"`
+}
@@ -0,0 +1,40 @@
+package configs
+
+// TransportConfig tunes the HTTP connections to the sources. Zero values
+// keep the defaults, which suit fast links: up to 200 connections per host
+// and 200 idle ones, idle connections closed after 30 seconds, 5 seconds
+// to receive response headers and 10 seconds for a TLS handshake.
+// Timeouts are in seconds.
+type TransportConfig struct {
+	MaxConnsPerHost       int  `json:"max_conns_per_host,omitempty"`
+	MaxIdleConns          int  `json:"max_idle_conns,omitempty"`
+	IdleConnTimeout       int  `json:"idle_conn_timeout,omitempty"`
+	ResponseHeaderTimeout int  `json:"response_header_timeout,omitempty"`
+	TLSHandshakeTimeout   int  `json:"tls_handshake_timeout,omitempty"`
+	DisableKeepAlives     bool `json:"disable_keep_alives,omitempty"`
+}
+
+// WithDefaults returns t, or the zero config if t is nil, with the
+// defaults filled in.
+func (t *TransportConfig) WithDefaults() TransportConfig {
+	var config TransportConfig
+	if t != nil {
+		config = *t
+	}
+	if config.MaxConnsPerHost <= 0 {
+		config.MaxConnsPerHost = 200
+	}
+	if config.MaxIdleConns <= 0 {
+		config.MaxIdleConns = 200
+	}
+	if config.IdleConnTimeout <= 0 {
+		config.IdleConnTimeout = 30
+	}
+	if config.ResponseHeaderTimeout <= 0 {
+		config.ResponseHeaderTimeout = 5
+	}
+	if config.TLSHandshakeTimeout <= 0 {
+		config.TLSHandshakeTimeout = 10
+	}
+	return config
+}
@@ -0,0 +1,384 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Size is an amount of data in bytes.
+//
+// Sizes are parsed from strings such as "50GiB", "100 MB" or "750 Mbit".
+// Decimal prefixes (kB, MB, GB, TB) are powers of 1000, binary prefixes
+// (KiB, MiB, GiB, TiB) are powers of 1024 and a lower-case "b" or "bit"
+// denotes bits rather than bytes. A bare number is a count of bytes.
+type Size int64
+
+// Rate is a data rate in bytes per second.
+//
+// Rates are parsed from strings such as "1.5 GB/min", "200Mbps", "10 MiB/s"
+// or "40MBps", using the same prefix rules as Size. A bare number keeps the
+// historical meaning of MiB per minute, which is also the unit the status
+// line reports as "MB/min".
+type Rate float64
+
+// Duration is a length of time.
+//
+// Durations are parsed from Go duration strings such as "90s" or "2h30m".
+// A bare number keeps the historical meaning of minutes, and durations of
+// whole minutes are written as one.
+type Duration time.Duration
+
+const (
+	bytesPerMiB = 1024 * 1024
+)
+
+// sizeUnits are the units sizes and rates are written in, largest first.
+var sizeUnits = []struct {
+	name  string
+	bytes float64
+}{
+	{"TiB", 1 << 40},
+	{"TB", 1e12},
+	{"GiB", 1 << 30},
+	{"GB", 1e9},
+	{"MiB", 1 << 20},
+	{"MB", 1e6},
+	{"KiB", 1 << 10},
+	{"kB", 1e3},
+	{"B", 1},
+}
+
+// rateTimeUnits are the time units rates are written in, shortest first.
+var rateTimeUnits = []struct {
+	name    string
+	seconds float64
+}{
+	{"s", 1},
+	{"min", 60},
+	{"h", 3600},
+}
+
+var sizePrefixes = map[string]float64{
+	"":  1,
+	"k": 1e3,
+	"m": 1e6,
+	"g": 1e9,
+	"t": 1e12,
+}
+
+var timeUnits = map[string]float64{
+	"s":      1,
+	"sec":    1,
+	"second": 1,
+	"m":      60,
+	"min":    60,
+	"minute": 60,
+	"h":      3600,
+	"hr":     3600,
+	"hour":   3600,
+}
+
+// ParseSize parses a human readable size such as "50GiB" into bytes.
+func ParseSize(s string) (Size, error) {
+	value, unit, err := splitQuantity(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	if unit == "" {
+		return Size(value), nil
+	}
+	multiplier, ok := unitBytes(unit)
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, unit)
+	}
+	return Size(math.Round(value * multiplier)), nil
+}
+
+// ParseRate parses a human readable rate such as "1.5 GB/min" or "200Mbps".
+func ParseRate(s string) (Rate, error) {
+	value, unit, err := splitQuantity(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %w", s, err)
+	}
+	if unit == "" {
+		return RateFromMBPerMinute(value), nil
+	}
+
+	sizeUnit, perUnit := unit, "s"
+	if i := strings.Index(unit, "/"); i >= 0 {
+		sizeUnit, perUnit = strings.TrimSpace(unit[:i]), strings.TrimSpace(unit[i+1:])
+	} else if strings.HasSuffix(strings.ToLower(unit), "ps") {
+		sizeUnit = unit[:len(unit)-2]
+	} else {
+		return 0, fmt.Errorf("invalid rate %q: missing time unit", s)
+	}
+
+	multiplier, ok := unitBytes(sizeUnit)
+	if !ok {
+		return 0, fmt.Errorf("invalid rate %q: unknown unit %q", s, sizeUnit)
+	}
+	seconds, ok := timeUnit(perUnit)
+	if !ok {
+		return 0, fmt.Errorf("invalid rate %q: unknown time unit %q", s, perUnit)
+	}
+	return Rate(value * multiplier / seconds), nil
+}
+
+// timeUnit returns the seconds in a time unit such as "s", "min" or
+// "hours". Only words take a plural "s", so "ms" is not read as "m".
+func timeUnit(unit string) (float64, bool) {
+	unit = strings.ToLower(unit)
+	if seconds, ok := timeUnits[unit]; ok {
+		return seconds, true
+	}
+	if singular, ok := strings.CutSuffix(unit, "s"); ok && len(singular) > 1 {
+		seconds, ok := timeUnits[singular]
+		return seconds, ok
+	}
+	return 0, false
+}
+
+// RateFromMBPerMinute converts a rate in MiB per minute to a Rate.
+func RateFromMBPerMinute(mbPerMinute float64) Rate {
+	return Rate(mbPerMinute * bytesPerMiB / 60)
+}
+
+func splitQuantity(s string) (float64, string, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	value, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("missing number")
+	}
+	return value, strings.TrimSpace(s[i:]), nil
+}
+
+// unitBytes returns the number of bytes represented by one unit such as
+// "MB", "GiB" or "Mbit".
+func unitBytes(unit string) (float64, bool) {
+	var bits bool
+	switch {
+	case strings.HasSuffix(unit, "bit"):
+		bits, unit = true, strings.TrimSuffix(unit, "bit")
+	case strings.HasSuffix(unit, "b"):
+		bits, unit = true, strings.TrimSuffix(unit, "b")
+	case strings.HasSuffix(unit, "B"):
+		unit = strings.TrimSuffix(unit, "B")
+	default:
+		return 0, false
+	}
+
+	prefix := strings.ToLower(unit)
+	binary := strings.HasSuffix(prefix, "i")
+	prefix = strings.TrimSuffix(prefix, "i")
+	multiplier, ok := sizePrefixes[prefix]
+	if !ok || (binary && prefix == "") {
+		return 0, false
+	}
+	if binary {
+		multiplier = math.Pow(1024, math.Log10(multiplier)/3)
+	}
+	if bits {
+		multiplier /= 8
+	}
+	return multiplier, true
+}
+
+// Bytes returns the size as a byte count.
+func (s Size) Bytes() int64 {
+	return int64(s)
+}
+
+// Megabytes returns the size in MiB.
+func (s Size) Megabytes() float64 {
+	return float64(s) / bytesPerMiB
+}
+
+func (s Size) String() string {
+	switch {
+	case s >= 1<<30:
+		return formatQuantity(float64(s)/(1<<30), "GiB")
+	case s >= 1<<20:
+		return formatQuantity(float64(s)/(1<<20), "MiB")
+	case s >= 1<<10:
+		return formatQuantity(float64(s)/(1<<10), "KiB")
+	}
+	return formatQuantity(float64(s), "B")
+}
+
+// Set implements flag.Value.
+func (s *Size) Set(value string) error {
+	parsed, err := ParseSize(value)
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// MarshalJSON writes the size in the largest unit that divides it exactly,
+// so that it reads back as the same value.
+func (s Size) MarshalJSON() ([]byte, error) {
+	if s != 0 {
+		for _, unit := range sizeUnits {
+			if n := int64(unit.bytes); int64(s)%n == 0 {
+				return json.Marshal(strconv.FormatInt(int64(s)/n, 10) + " " + unit.name)
+			}
+		}
+	}
+	return json.Marshal(int64(s))
+}
+
+func (s *Size) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch v := raw.(type) {
+	case float64:
+		if v < 0 {
+			return fmt.Errorf("invalid size %s: must not be negative", data)
+		}
+		*s = Size(v)
+		return nil
+	case string:
+		return s.Set(v)
+	}
+	return fmt.Errorf("invalid size %s", data)
+}
+
+// BytesPerSecond returns the rate in bytes per second.
+func (r Rate) BytesPerSecond() float64 {
+	return float64(r)
+}
+
+// MBPerMinute returns the rate in MiB per minute.
+func (r Rate) MBPerMinute() float64 {
+	return float64(r) * 60 / bytesPerMiB
+}
+
+func (r Rate) String() string {
+	return formatQuantity(r.MBPerMinute(), "MiB/min")
+}
+
+// Set implements flag.Value.
+func (r *Rate) Set(value string) error {
+	parsed, err := ParseRate(value)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// MarshalJSON writes the rate as the smallest whole number of any unit that
+// reads back as exactly the same value, falling back to bytes per second.
+func (r Rate) MarshalJSON() ([]byte, error) {
+	text, best := strconv.FormatFloat(float64(r), 'f', -1, 64)+" B/s", math.Inf(1)
+	for _, per := range rateTimeUnits {
+		for _, size := range sizeUnits {
+			value := float64(r) * per.seconds / size.bytes
+			if value < 1 || value >= best || value != math.Trunc(value) {
+				continue
+			}
+			candidate := strconv.FormatFloat(value, 'f', -1, 64) + " " + size.name + "/" + per.name
+			if parsed, err := ParseRate(candidate); err == nil && parsed == r {
+				text, best = candidate, value
+			}
+		}
+	}
+	return json.Marshal(text)
+}
+
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch v := raw.(type) {
+	case float64:
+		if v < 0 {
+			return fmt.Errorf("invalid rate %s: must not be negative", data)
+		}
+		*r = RateFromMBPerMinute(v)
+		return nil
+	case string:
+		return r.Set(v)
+	}
+	return fmt.Errorf("invalid rate %s", data)
+}
+
+func formatQuantity(value float64, unit string) string {
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64) + " " + unit
+}
+
+// Minutes returns a duration of n minutes.
+func Minutes(n int) Duration {
+	return Duration(time.Duration(n) * time.Minute)
+}
+
+// ParseDuration parses a duration such as "2h30m", or a number of minutes.
+// Negative durations are rejected.
+func ParseDuration(s string) (Duration, error) {
+	s = strings.TrimSpace(s)
+	d, err := time.ParseDuration(s)
+	if minutes, perr := strconv.ParseFloat(s, 64); perr == nil {
+		d, err = time.Duration(minutes*float64(time.Minute)), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: expected minutes or a duration like 90s or 2h30m", s)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid duration %q: must not be negative", s)
+	}
+	return Duration(d), nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Set implements flag.Value.
+func (d *Duration) Set(value string) error {
+	parsed, err := ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	if time.Duration(d)%time.Minute == 0 {
+		return json.Marshal(int64(time.Duration(d) / time.Minute))
+	}
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch v := raw.(type) {
+	case float64:
+		if v < 0 {
+			return fmt.Errorf("invalid duration %s: must not be negative", data)
+		}
+		*d = Duration(v * float64(time.Minute))
+		return nil
+	case string:
+		return d.Set(v)
+	}
+	return fmt.Errorf("invalid duration %s", data)
+}
@@ -0,0 +1,180 @@
+package configs
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSizeRoundTrip(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"50GB", `"50 GB"`},
+		{"50GiB", `"50 GiB"`},
+		{"1234567", `"1234567 B"`},
+		{"1.5 MiB", `"1536 KiB"`},
+		{"750 Mbit", `"93750 kB"`},
+		{"1TiB", `"1 TiB"`},
+		{"0", `0`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			parsed, err := ParseSize(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(parsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("marshal %q = %s, want %s", tt.in, data, tt.want)
+			}
+			var reloaded Size
+			if err := json.Unmarshal(data, &reloaded); err != nil {
+				t.Fatal(err)
+			}
+			if reloaded != parsed {
+				t.Errorf("%q reloaded as %d bytes, want %d", tt.in, reloaded, parsed)
+			}
+		})
+	}
+}
+
+func TestRateRoundTrip(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"200Mbps", `"25 MB/s"`},
+		{"1024", `"1 GiB/min"`},
+		{"1.5 GB/min", `"25 MB/s"`},
+		{"1 GB/min", `"1 GB/min"`},
+		{"10 MiB/s", `"10 MiB/s"`},
+		{"40MBps", `"40 MB/s"`},
+		{"7 B/h", `"7 B/h"`},
+		{"0.3", ""},
+		{"123.456 kB/s", ""},
+		{"1 B/min", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			parsed, err := ParseRate(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(parsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && string(data) != tt.want {
+				t.Errorf("marshal %q = %s, want %s", tt.in, data, tt.want)
+			}
+			var reloaded Rate
+			if err := json.Unmarshal(data, &reloaded); err != nil {
+				t.Fatal(err)
+			}
+			if reloaded != parsed {
+				t.Errorf("%q saved as %s reloaded as %v B/s, want %v", tt.in, data, float64(reloaded), float64(parsed))
+			}
+		})
+	}
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"5", 5 * time.Minute},
+		{"90s", 90 * time.Second},
+		{"2h30m", 150 * time.Minute},
+		{"1.5", 90 * time.Second},
+		{"250ms", 250 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			parsed, err := ParseDuration(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if time.Duration(parsed) != tt.want {
+				t.Errorf("ParseDuration(%q) = %v, want %v", tt.in, parsed, tt.want)
+			}
+			data, err := json.Marshal(parsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var reloaded Duration
+			if err := json.Unmarshal(data, &reloaded); err != nil {
+				t.Fatal(err)
+			}
+			if reloaded != parsed {
+				t.Errorf("%q saved as %s reloaded as %v, want %v", tt.in, data, reloaded, parsed)
+			}
+		})
+	}
+}
+
+func TestParseRejectsNegative(t *testing.T) {
+	for _, in := range []string{"-5", "-90s", "-1h"} {
+		if d, err := ParseDuration(in); err == nil {
+			t.Errorf("ParseDuration(%q) = %v, want an error", in, d)
+		}
+	}
+	if s, err := ParseSize("-5GB"); err == nil {
+		t.Errorf("ParseSize(-5GB) = %v, want an error", s)
+	}
+	if r, err := ParseRate("-200Mbps"); err == nil {
+		t.Errorf("ParseRate(-200Mbps) = %v, want an error", r)
+	}
+}
+
+func TestParseRateTimeUnits(t *testing.T) {
+	const mb = 1e6
+	for in, want := range map[string]Rate{
+		"60 MB/min":     mb,
+		"60 MB/mins":    mb,
+		"60 MB/minutes": mb,
+		"60 MB/m":       mb,
+		"1 MB/sec":      mb,
+		"1 MB/secs":     mb,
+		"1 MB/Seconds":  mb,
+		"3600 MB/h":     mb,
+		"3600 MB/hrs":   mb,
+		"3600 MB/hours": mb,
+		"8 Mbps":        mb,
+	} {
+		if got, err := ParseRate(in); err != nil || got != want {
+			t.Errorf("ParseRate(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"1 MB/ms", "1 MB/hs", "1 MB/day", "1 MB/"} {
+		if r, err := ParseRate(in); err == nil {
+			t.Errorf("ParseRate(%q) = %v, want an error", in, r)
+		}
+	}
+}
+
+func TestUnmarshalRejectsNegative(t *testing.T) {
+	var size Size
+	if err := json.Unmarshal([]byte(`-5`), &size); err == nil {
+		t.Errorf("size -5 read as %v, want an error", size)
+	}
+	var rate Rate
+	if err := json.Unmarshal([]byte(`-5`), &rate); err == nil {
+		t.Errorf("rate -5 read as %v, want an error", rate)
+	}
+	var d Duration
+	if err := json.Unmarshal([]byte(`-5`), &d); err == nil {
+		t.Errorf("duration -5 read as %v, want an error", d)
+	}
+	for _, doc := range []string{`{"max_data": -5}`, `{"duration": -5}`, `{"target_rate": -5}`} {
+		var config Config
+		if err := json.Unmarshal([]byte(doc), &config); err == nil {
+			t.Errorf("%s loaded, want an error", doc)
+		}
+	}
+}
@@ -1,3 +1,17 @@
 module dataconsumer
 
 go 1.21
+
+require (
+	fyne.io/systray v1.11.0
+	golang.org/x/sys v0.21.0
+	google.golang.org/grpc v1.64.1
+)
+
+require (
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
@@ -0,0 +1,225 @@
+package byteserver
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+const (
+	defaultSize = 100 << 20
+	blockSize   = 1 << 20
+)
+
+// Server serves test payloads. GET /bytes?size=50MiB returns exactly that
+// many bytes; size defaults to 100 MiB. rate=10MB/s sends the payload at
+// that rate, and status=503 answers with that status instead, without a
+// payload unless it is a 2xx status.
+//
+// Payloads are random and do not compress unless content=zeros asks for
+// zeros, which compress well. encoding=gzip, deflate or zstd compresses
+// them, and encoding=auto negotiates the encoding from the request's
+// Accept-Encoding header. size is the size of the payload before it is
+// encoded, and the Content-Length of an encoded response is its exact
+// encoded length. length=none leaves out the Content-Length and sends
+// the body chunked.
+//
+// To test clients against degraded servers, delay=2s holds back the
+// response, stall=30s stops sending the body after stall_after=10MB of it
+// (immediately if not set), and throttle_after=10MB sends that much at
+// full speed before rate applies. jitter=500ms adds a random extra of up
+// to that to the delay and the stall; seed=42 makes it the same on every
+// request with that seed.
+//
+// GET /echo answers with the client's address and request headers as
+// JSON, for the egress checks of the consumer.
+type Server struct {
+	MaxSize configs.Size
+	blocks  map[string][]byte
+
+	mu sync.Mutex
+	// encoded caches the blocks encoded as parts of a stream, by content
+	// and encoding.
+	encoded map[[2]string][]byte
+}
+
+func New(maxSize configs.Size) *Server {
+	random := make([]byte, blockSize)
+	rand.Read(random)
+	return &Server{
+		MaxSize: maxSize,
+		blocks:  map[string][]byte{"random": random, "zeros": make([]byte, blockSize)},
+		encoded: make(map[[2]string][]byte),
+	}
+}
+
+// payload returns size bytes of content in encoding.
+func (s *Server) payload(content, encoding string, size int64) *encoded {
+	block := s.blocks[content]
+	key := [2]string{content, encoding}
+	s.mu.Lock()
+	full, ok := s.encoded[key]
+	if !ok {
+		full = encodePart(encoding, block, false)
+		s.encoded[key] = full
+	}
+	s.mu.Unlock()
+	return encode(encoding, block, full, size)
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bytes", s.serveBytes)
+	mux.HandleFunc("/echo", serveEcho)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "dataconsumer test server: GET /bytes?size=<size>[&rate=<rate>][&status=<code>][&content=random|zeros][&encoding=identity|gzip|deflate|zstd|auto][&length=none][&delay=<duration>][&jitter=<duration>][&seed=<n>][&stall=<duration>][&stall_after=<size>][&throttle_after=<size>], GET /echo")
+	})
+	return mux
+}
+
+func (s *Server) serveBytes(w http.ResponseWriter, r *http.Request) {
+	size := configs.Size(defaultSize)
+	if raw := r.URL.Query().Get("size"); raw != "" {
+		parsed, err := configs.ParseSize(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		size = parsed
+	}
+	if s.MaxSize > 0 && size > s.MaxSize {
+		http.Error(w, fmt.Sprintf("size exceeds limit of %s", s.MaxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var rate configs.Rate
+	if raw := r.URL.Query().Get("rate"); raw != "" {
+		parsed, err := configs.ParseRate(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rate = parsed
+	}
+	status := http.StatusOK
+	if raw := r.URL.Query().Get("status"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 100 || parsed > 599 {
+			http.Error(w, fmt.Sprintf("invalid status %q", raw), http.StatusBadRequest)
+			return
+		}
+		status = parsed
+	}
+	content := "random"
+	if raw := r.URL.Query().Get("content"); raw != "" {
+		if _, ok := s.blocks[raw]; !ok {
+			http.Error(w, fmt.Sprintf("invalid content %q", raw), http.StatusBadRequest)
+			return
+		}
+		content = raw
+	}
+	encoding, err := negotiate(r.URL.Query().Get("encoding"), r.Header.Get("Accept-Encoding"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	length := r.URL.Query().Get("length")
+	if length != "" && length != "exact" && length != "none" {
+		http.Error(w, fmt.Sprintf("invalid length %q", length), http.StatusBadRequest)
+		return
+	}
+	imp, err := parseImpairment(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !sleep(r.Context(), imp.jittered(imp.delay)) {
+		return
+	}
+	if status/100 != 2 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	body := s.payload(content, encoding, size.Bytes())
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if encoding != Identity {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	if r.URL.Query().Get("encoding") == "auto" {
+		w.Header().Set("Vary", "Accept-Encoding")
+	}
+	if length != "none" {
+		w.Header().Set("Content-Length", strconv.FormatInt(body.Len(), 10))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+	writePayload(r.Context(), w, body.Reader(), rate, imp)
+}
+
+// writePayload writes the body read from body, no faster than rate if it
+// is set, and impaired by imp.
+func writePayload(ctx context.Context, w io.Writer, body io.Reader, rate configs.Rate, imp impairment) {
+	perTick := int64(blockSize)
+	if tick := int64(rate.BytesPerSecond() / 10); rate > 0 && tick < perTick {
+		perTick = max(tick, 1)
+	}
+	chunk := make([]byte, blockSize)
+	stalled := imp.stall == 0
+	var written, paced int64
+	var pacedSince time.Time
+	for {
+		if !stalled && written >= imp.stallAfter {
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			if !sleep(ctx, imp.jittered(imp.stall)) {
+				return
+			}
+			// Resume the rate from here rather than catch up on the stall.
+			stalled, paced, pacedSince = true, 0, time.Time{}
+		}
+		throttled := rate > 0 && written >= imp.throttleAfter
+		size := int64(len(chunk))
+		if throttled {
+			size = perTick
+			if pacedSince.IsZero() {
+				pacedSince = time.Now()
+			}
+		} else if rate > 0 {
+			size = min(size, imp.throttleAfter-written)
+		}
+		if !stalled {
+			size = min(size, imp.stallAfter-written)
+		}
+		n, err := io.ReadFull(body, chunk[:size])
+		if n == 0 {
+			return
+		}
+		if _, err := w.Write(chunk[:n]); err != nil {
+			return
+		}
+		written += int64(n)
+		if err != nil {
+			return
+		}
+		if throttled {
+			paced += int64(n)
+			due := time.Duration(float64(paced) / rate.BytesPerSecond() * float64(time.Second))
+			time.Sleep(due - time.Since(pacedSince))
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package byteserver
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// serveEcho answers with the address the request came from as "origin" and
+// its headers as "headers", like httpbin's /get.
+func serveEcho(w http.ResponseWriter, r *http.Request) {
+	origin, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		origin = r.RemoteAddr
+	}
+	headers := make(map[string]string, len(r.Header)+1)
+	for name, values := range r.Header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	headers["Host"] = r.Host
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{"origin": origin, "headers": headers})
+}
@@ -0,0 +1,250 @@
+package byteserver
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Encodings of the payloads.
+const (
+	Zstd     = "zstd"
+	Gzip     = "gzip"
+	Deflate  = "deflate"
+	Identity = "identity"
+)
+
+// preferred lists the encodings the server compresses payloads with, in
+// the order it prefers them when negotiating.
+var preferred = []string{Zstd, Gzip, Deflate}
+
+// zstdBlockSize is the largest block a zstd frame may contain.
+const zstdBlockSize = 128 << 10
+
+// negotiate picks the encoding for a request's encoding parameter and its
+// Accept-Encoding header. "auto" picks the encoding the client accepts
+// with the highest quality, preferring zstd, then gzip, then deflate on a
+// tie, and identity if it accepts none of them.
+func negotiate(param, acceptEncoding string) (string, error) {
+	switch param {
+	case "", Identity:
+		return Identity, nil
+	case Zstd, Gzip, Deflate:
+		return param, nil
+	case "auto":
+	default:
+		return "", fmt.Errorf("invalid encoding %q", param)
+	}
+	quality := make(map[string]float64)
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(entry, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if raw, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(raw, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name != "" {
+			quality[name] = q
+		}
+	}
+	best, bestQ := Identity, 0.0
+	for _, encoding := range preferred {
+		q, ok := quality[encoding]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best, nil
+}
+
+// encoded is a payload of size bytes, made of copies of block, in an
+// encoding. Each copy of the block is compressed on its own, so the
+// length of the encoded body is known before it is sent and the block
+// only has to be compressed once.
+type encoded struct {
+	encoding string
+	block    []byte
+	// full is block encoded, and tail the rest of the payload after the
+	// last full copy, encoded as the end of the stream.
+	full, tail []byte
+	copies     int64
+	size       int64
+}
+
+// encode prepares size bytes of block's content in encoding. full is block
+// encoded as a part of a stream, as returned by encodePart.
+func encode(encoding string, block, full []byte, size int64) *encoded {
+	copies := size / int64(len(block))
+	return &encoded{
+		encoding: encoding,
+		block:    block,
+		full:     full,
+		tail:     encodePart(encoding, block[:size%int64(len(block))], true),
+		copies:   copies,
+		size:     size,
+	}
+}
+
+// Len returns the length of the encoded body.
+func (e *encoded) Len() int64 {
+	header, trailer := e.framing()
+	return int64(header) + e.copies*int64(len(e.full)) + int64(len(e.tail)) + int64(trailer)
+}
+
+// framing returns the lengths of the encoding's header and trailer.
+func (e *encoded) framing() (header, trailer int) {
+	switch e.encoding {
+	case Gzip:
+		return 10, 8
+	case Deflate:
+		return 2, 4
+	case Zstd:
+		return 14, 0
+	}
+	return 0, 0
+}
+
+// Reader returns a reader of the encoded body.
+func (e *encoded) Reader() io.Reader {
+	return &encodedReader{e: e}
+}
+
+type encodedReader struct {
+	e       *encoded
+	pending []byte
+	// step counts the parts read: the header, the copies of the block,
+	// the tail and the trailer.
+	step int64
+	sum  hash.Hash32
+}
+
+func (r *encodedReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if !r.next() {
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// next loads the next part of the body, or returns false at its end.
+func (r *encodedReader) next() bool {
+	e := r.e
+	switch step := r.step; {
+	case step == 0:
+		r.pending = r.header()
+	case step <= e.copies:
+		r.pending = e.full
+		r.checksum(e.block)
+	case step == e.copies+1:
+		r.pending = e.tail
+		r.checksum(e.block[:e.size%int64(len(e.block))])
+	case step == e.copies+2:
+		r.pending = r.trailer()
+	default:
+		return false
+	}
+	r.step++
+	return true
+}
+
+func (r *encodedReader) header() []byte {
+	switch r.e.encoding {
+	case Gzip:
+		r.sum = crc32.NewIEEE()
+		// No file name or modification time, unknown operating system.
+		return []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff}
+	case Deflate:
+		r.sum = adler32.New()
+		// zlib with a 32 KiB window and no dictionary.
+		return []byte{0x78, 0x01}
+	case Zstd:
+		// The content size in 8 bytes, a 128 KiB window and no checksum.
+		header := []byte{0x28, 0xb5, 0x2f, 0xfd, 0xc0, 0x38}
+		return binary.LittleEndian.AppendUint64(header, uint64(r.e.size))
+	}
+	return nil
+}
+
+func (r *encodedReader) checksum(data []byte) {
+	if r.sum != nil {
+		r.sum.Write(data)
+	}
+}
+
+func (r *encodedReader) trailer() []byte {
+	switch r.e.encoding {
+	case Gzip:
+		trailer := binary.LittleEndian.AppendUint32(nil, r.sum.Sum32())
+		return binary.LittleEndian.AppendUint32(trailer, uint32(r.e.size))
+	case Deflate:
+		return binary.BigEndian.AppendUint32(nil, r.sum.Sum32())
+	}
+	return nil
+}
+
+// encodePart compresses data as a part of a stream in encoding, without
+// the stream's header and trailer. Parts end on a byte boundary and refer
+// to no earlier part, so they can be concatenated; last ends the stream.
+func encodePart(encoding string, data []byte, last bool) []byte {
+	switch encoding {
+	case Gzip, Deflate:
+		var buf bytes.Buffer
+		// Random data is stored as it is, as it does not compress.
+		w, _ := flate.NewWriter(&buf, flate.BestSpeed)
+		w.Write(data)
+		if last {
+			w.Close()
+		} else {
+			w.Flush()
+		}
+		return buf.Bytes()
+	case Zstd:
+		return zstdBlocks(data, last)
+	}
+	return data
+}
+
+// zstdBlocks encodes data as zstd blocks: runs of one byte as RLE blocks
+// and anything else as raw blocks.
+func zstdBlocks(data []byte, last bool) []byte {
+	if len(data) == 0 && !last {
+		return nil
+	}
+	var out []byte
+	for {
+		chunk := data[:min(len(data), zstdBlockSize)]
+		data = data[len(chunk):]
+		header := uint32(len(chunk)) << 3
+		if last && len(data) == 0 {
+			header |= 1
+		}
+		rle := len(chunk) > 0 && bytes.Count(chunk, chunk[:1]) == len(chunk)
+		if rle {
+			header |= 1 << 1
+		}
+		out = append(out, byte(header), byte(header>>8), byte(header>>16))
+		if rle {
+			out = append(out, chunk[0])
+		} else {
+			out = append(out, chunk...)
+		}
+		if len(data) == 0 {
+			return out
+		}
+	}
+}
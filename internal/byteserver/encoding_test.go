@@ -0,0 +1,164 @@
+package byteserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// decodeZstd decodes a zstd frame of raw and RLE blocks, the only blocks
+// the server writes, checking its header.
+func decodeZstd(frame []byte) ([]byte, error) {
+	if len(frame) < 14 || binary.LittleEndian.Uint32(frame) != 0xfd2fb528 {
+		return nil, errors.New("no zstd frame header")
+	}
+	if frame[4] != 0xc0 {
+		return nil, fmt.Errorf("frame header descriptor %#x, want an 8 byte content size", frame[4])
+	}
+	size := binary.LittleEndian.Uint64(frame[6:14])
+	var out []byte
+	rest := frame[14:]
+	for {
+		if len(rest) < 3 {
+			return nil, errors.New("truncated block header")
+		}
+		header := uint32(rest[0]) | uint32(rest[1])<<8 | uint32(rest[2])<<16
+		rest = rest[3:]
+		n := int(header >> 3)
+		if n > zstdBlockSize {
+			return nil, fmt.Errorf("block of %d bytes", n)
+		}
+		switch header >> 1 & 3 {
+		case 0:
+			if len(rest) < n {
+				return nil, errors.New("truncated raw block")
+			}
+			out = append(out, rest[:n]...)
+			rest = rest[n:]
+		case 1:
+			if len(rest) < 1 {
+				return nil, errors.New("truncated RLE block")
+			}
+			out = append(out, bytes.Repeat(rest[:1], n)...)
+			rest = rest[1:]
+		default:
+			return nil, fmt.Errorf("unexpected block type %d", header>>1&3)
+		}
+		if header&1 == 1 {
+			break
+		}
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d bytes after the last block", len(rest))
+	}
+	if uint64(len(out)) != size {
+		return nil, fmt.Errorf("frame content size %d, decoded %d", size, len(out))
+	}
+	return out, nil
+}
+
+func decode(encoding string, body []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch encoding {
+	case Identity:
+		return body, nil
+	case Gzip:
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case Deflate:
+		r, err = zlib.NewReader(bytes.NewReader(body))
+	case Zstd:
+		return decodeZstd(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// Reading to the end verifies the checksum in the trailer.
+	return io.ReadAll(r)
+}
+
+// TestEncodedRoundTrip checks that every encoding of payloads shorter
+// than, as long as and longer than a block decodes to the payload, and
+// that Len is the exact length of the encoded body.
+func TestEncodedRoundTrip(t *testing.T) {
+	s := New(0)
+	sizes := []int64{0, 1, blockSize - 1, blockSize, blockSize + 1, 3*blockSize + 12345}
+	for _, encoding := range []string{Identity, Gzip, Deflate, Zstd} {
+		for _, content := range []string{"random", "zeros"} {
+			for _, size := range sizes {
+				t.Run(fmt.Sprintf("%s/%s/%d", encoding, content, size), func(t *testing.T) {
+					e := s.payload(content, encoding, size)
+					body, err := io.ReadAll(e.Reader())
+					if err != nil {
+						t.Fatal(err)
+					}
+					if int64(len(body)) != e.Len() {
+						t.Fatalf("Len() = %d, body has %d bytes", e.Len(), len(body))
+					}
+					plain, err := decode(encoding, body)
+					if err != nil {
+						t.Fatalf("decoding: %v", err)
+					}
+					want := bytes.Repeat(s.blocks[content], int(size/blockSize))
+					want = append(want, s.blocks[content][:size%blockSize]...)
+					if !bytes.Equal(plain, want) {
+						t.Fatalf("decoded %d bytes that differ from the %d byte payload", len(plain), size)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestServeEncoded(t *testing.T) {
+	server := httptest.NewServer(New(0).Handler())
+	defer server.Close()
+	// Every request sets Accept-Encoding, so that the transport neither
+	// asks for gzip nor decodes the body itself.
+	tests := []struct {
+		query, acceptEncoding, wantEncoding string
+	}{
+		{"encoding=gzip", "identity", Gzip},
+		{"encoding=zstd", "identity", Zstd},
+		{"encoding=auto", "gzip;q=0.5, deflate", Deflate},
+		{"encoding=auto", "br", ""},
+		{"encoding=deflate&length=none", "identity", Deflate},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", server.URL+"/bytes?size=1500000&content=zeros&"+tt.query, nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoding := resp.Header.Get("Content-Encoding")
+		if encoding != tt.wantEncoding {
+			t.Errorf("%s with %q: Content-Encoding %q, want %q", tt.query, tt.acceptEncoding, encoding, tt.wantEncoding)
+			continue
+		}
+		if length := resp.Header.Get("Content-Length"); length != "" && length != strconv.Itoa(len(body)) {
+			t.Errorf("%s: Content-Length %s, body has %d bytes", tt.query, length, len(body))
+		}
+		if encoding == "" {
+			encoding = Identity
+		}
+		plain, err := decode(encoding, body)
+		if err != nil || len(plain) != 1500000 {
+			t.Errorf("%s: decoded %d bytes, %v", tt.query, len(plain), err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package byteserver
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// impairment makes a response behave like one from a slow or struggling
+// server.
+type impairment struct {
+	// delay holds back the response, and stall the rest of the body once
+	// stallAfter bytes of it have been sent. Both get a random extra of up
+	// to jitter, drawn from rng.
+	delay, stall time.Duration
+	stallAfter   int64
+	jitter       time.Duration
+	rng          *rand.Rand
+	// throttleAfter is how much of the body is sent at full speed before
+	// the rate applies.
+	throttleAfter int64
+}
+
+// parseImpairment reads the delay, jitter, seed, stall, stall_after and
+// throttle_after parameters of query.
+func parseImpairment(query url.Values) (impairment, error) {
+	var imp impairment
+	durations := map[string]*time.Duration{"delay": &imp.delay, "jitter": &imp.jitter, "stall": &imp.stall}
+	for name, d := range durations {
+		if raw := query.Get(name); raw != "" {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil || parsed < 0 {
+				return impairment{}, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*d = parsed
+		}
+	}
+	sizes := map[string]*int64{"stall_after": &imp.stallAfter, "throttle_after": &imp.throttleAfter}
+	for name, n := range sizes {
+		if raw := query.Get(name); raw != "" {
+			parsed, err := configs.ParseSize(raw)
+			if err != nil {
+				return impairment{}, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*n = parsed.Bytes()
+		}
+	}
+	seed := time.Now().UnixNano()
+	if raw := query.Get("seed"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return impairment{}, fmt.Errorf("invalid seed %q", raw)
+		}
+		seed = parsed
+	}
+	imp.rng = rand.New(rand.NewSource(seed))
+	return imp, nil
+}
+
+// jittered returns d plus a random extra of up to the jitter.
+func (imp impairment) jittered(d time.Duration) time.Duration {
+	if imp.jitter == 0 {
+		return d
+	}
+	return d + time.Duration(imp.rng.Int63n(int64(imp.jitter)))
+}
+
+// sleep waits for d, and returns false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
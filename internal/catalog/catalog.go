@@ -0,0 +1,206 @@
+// Package catalog fetches a maintained list of data sources and verifies
+// its Ed25519 signature, so that configs can be refreshed as mirrors come
+// and go.
+//
+// A catalog is a JSON document served at some URL, signed by a detached
+// signature served at the same URL with ".sig" appended. The signature is
+// the base64 encoding of the Ed25519 signature of the document's exact
+// bytes.
+//
+// Every catalog accepted is remembered by its Updated time, per signing
+// key, so that a mirror replaying an older signed catalog is refused.
+package catalog
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// DefaultURL and DefaultPublicKey are the catalog published with the
+// project, used when the config names none.
+const (
+	DefaultURL       = "https://raw.githubusercontent.com/Jstarzz/DataConsumer/main/catalog/sources.json"
+	DefaultPublicKey = "vRFqGMEH6h9SkDdPdXy9AqTMikdoKnbWGi50PFDdNn8="
+)
+
+// maxSize bounds the catalog and signature downloads.
+const maxSize = 1 << 20
+
+// ErrBadSignature is returned by Fetch when the signature does not match
+// the catalog and public key.
+var ErrBadSignature = errors.New("catalog signature does not verify")
+
+// ErrReplayed is returned by Seen.Check for a catalog older than one
+// accepted before.
+var ErrReplayed = errors.New("catalog is older than the last one accepted")
+
+// Catalog is a signed list of data sources.
+type Catalog struct {
+	Version int       `json:"version"`
+	Updated time.Time `json:"updated"`
+	Sources []Entry   `json:"sources"`
+}
+
+// Entry is a source in a catalog.
+type Entry struct {
+	URL string `json:"url"`
+	// Size is the size of the file, if known.
+	Size configs.Size `json:"size,omitempty"`
+	// Region is where the server is, e.g. "eu" or "us-east".
+	Region string `json:"region,omitempty"`
+}
+
+// ParsePublicKey decodes a base64 Ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: want %d base64 encoded bytes", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// ParsePrivateKey decodes a base64 Ed25519 private key as written by
+// GenerateKey.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid private key: want %d base64 encoded bytes", ed25519.PrivateKeySize)
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+// GenerateKey returns a new key pair, base64 encoded.
+func GenerateKey() (public, private string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(priv), nil
+}
+
+// Sign returns the detached signature of a catalog document.
+func Sign(data []byte, key ed25519.PrivateKey) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)) + "\n")
+}
+
+// Verify checks sig, as returned by Sign, against data and parses the
+// catalog.
+func Verify(data, sig []byte, key ed25519.PublicKey) (*Catalog, error) {
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || !ed25519.Verify(key, data, signature) {
+		return nil, ErrBadSignature
+	}
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("invalid catalog: %w", err)
+	}
+	return &catalog, nil
+}
+
+// Fetch downloads the catalog at url and its signature and verifies them
+// with key.
+func Fetch(ctx context.Context, client *http.Client, url string, key ed25519.PublicKey) (*Catalog, error) {
+	data, err := get(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := get(ctx, client, url+".sig")
+	if err != nil {
+		return nil, err
+	}
+	return Verify(data, sig, key)
+}
+
+func get(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSize {
+		return nil, fmt.Errorf("%s: larger than %s", url, configs.Size(maxSize))
+	}
+	return data, nil
+}
+
+// Seen holds the Updated time of the last catalog accepted for each
+// signing key, by the key's base64 encoding.
+type Seen map[string]time.Time
+
+// DefaultSeenPath returns where the catalogs accepted are remembered, next
+// to the default config file.
+func DefaultSeenPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dataconsumer", "catalogs.json"), nil
+}
+
+// LoadSeen reads the catalogs accepted before. A missing file means none.
+func LoadSeen(path string) (Seen, error) {
+	seen := make(Seen)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return seen, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &seen); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return seen, nil
+}
+
+// Check returns ErrReplayed if catalog is older than the last one accepted
+// with key. The same catalog may be fetched again.
+func (s Seen) Check(catalog *Catalog, key ed25519.PublicKey) error {
+	last := s[base64.StdEncoding.EncodeToString(key)]
+	if catalog.Updated.Before(last) {
+		return fmt.Errorf("%w: updated %s, last accepted %s", ErrReplayed,
+			catalog.Updated.Format(time.RFC3339), last.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Accept records catalog as the last one accepted with key.
+func (s Seen) Accept(catalog *Catalog, key ed25519.PublicKey) {
+	s[base64.StdEncoding.EncodeToString(key)] = catalog.Updated
+}
+
+// Save writes the catalogs accepted to path, creating its directory.
+func (s Seen) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
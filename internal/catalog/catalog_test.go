@@ -0,0 +1,153 @@
+package catalog
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const document = `{"version": 1, "updated": "2025-06-01T00:00:00Z", "sources": [{"url": "https://mirror.example.com/10GB.bin", "size": "10GB", "region": "eu"}]}`
+
+// keys returns a parsed key pair from GenerateKey.
+func keys(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	public, private, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParsePublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := ParsePrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub, priv
+}
+
+func TestVerify(t *testing.T) {
+	pub, priv := keys(t)
+	otherPub, otherPriv := keys(t)
+	data := []byte(document)
+	sig := Sign(data, priv)
+
+	tests := []struct {
+		name      string
+		data, sig []byte
+		key       ed25519.PublicKey
+	}{
+		{"tampered data", bytes.Replace(data, []byte("mirror"), []byte("evil"), 1), sig, pub},
+		{"appended data", append(append([]byte{}, data...), ' '), sig, pub},
+		{"wrong key", data, sig, otherPub},
+		{"signed with another key", data, Sign(data, otherPriv), pub},
+		{"tampered signature", data, append([]byte("A"), sig[1:]...), pub},
+		{"signature not base64", data, []byte("not a signature"), pub},
+		{"no signature", data, nil, pub},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify(tt.data, tt.sig, tt.key); !errors.Is(err, ErrBadSignature) {
+				t.Errorf("Verify error = %v, want ErrBadSignature", err)
+			}
+		})
+	}
+
+	catalog, err := Verify(data, sig, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catalog.Version != 1 || !catalog.Updated.Equal(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)) ||
+		len(catalog.Sources) != 1 || catalog.Sources[0].URL != "https://mirror.example.com/10GB.bin" ||
+		catalog.Sources[0].Size.Bytes() != 10e9 || catalog.Sources[0].Region != "eu" {
+		t.Errorf("catalog = %+v", catalog)
+	}
+
+	// A signed document that is not a catalog verifies but fails to parse.
+	if _, err := Verify([]byte("[]"), Sign([]byte("[]"), priv), pub); err == nil || errors.Is(err, ErrBadSignature) {
+		t.Errorf("Verify error = %v, want an invalid catalog", err)
+	}
+}
+
+// TestDefault checks that the catalog published in the repository verifies
+// with the built-in key.
+func TestDefault(t *testing.T) {
+	key, err := ParsePublicKey(DefaultPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile("../../catalog/sources.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := os.ReadFile("../../catalog/sources.json.sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(data, sig, key); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseKeyErrors(t *testing.T) {
+	public, private, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePublicKey(private); err == nil {
+		t.Error("ParsePublicKey accepted a private key")
+	}
+	if _, err := ParsePrivateKey(public); err == nil {
+		t.Error("ParsePrivateKey accepted a public key")
+	}
+	if _, err := ParsePublicKey("not base64!"); err == nil {
+		t.Error("ParsePublicKey accepted invalid base64")
+	}
+}
+
+func TestSeen(t *testing.T) {
+	pub, _ := keys(t)
+	otherPub, _ := keys(t)
+	day := func(d int) *Catalog { return &Catalog{Updated: time.Date(2025, 6, d, 0, 0, 0, 0, time.UTC)} }
+
+	path := filepath.Join(t.TempDir(), "dataconsumer", "catalogs.json")
+	seen, err := LoadSeen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := seen.Check(day(1), pub); err != nil {
+		t.Errorf("first catalog refused: %v", err)
+	}
+	seen.Accept(day(10), pub)
+	if err := seen.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if seen, err = LoadSeen(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		catalog *Catalog
+		key     ed25519.PublicKey
+		wantErr bool
+	}{
+		{"older", day(9), pub, true},
+		{"no updated time", &Catalog{}, pub, true},
+		{"same", day(10), pub, false},
+		{"newer", day(11), pub, false},
+		{"older with another key", day(1), otherPub, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := seen.Check(tt.catalog, tt.key)
+			if tt.wantErr != errors.Is(err, ErrReplayed) {
+				t.Errorf("Check error = %v, want replayed %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/consumer"
+	"dataconsumer/pkg/metrics"
+)
+
+// Request is a single command sent over the control socket as one line
+// of JSON.
+type Request struct {
+	Command string `json:"command"`
+	Rate    string `json:"rate,omitempty"`
+}
+
+type Response struct {
+	OK     bool    `json:"ok"`
+	Error  string  `json:"error,omitempty"`
+	Status *Status `json:"status,omitempty"`
+}
+
+type Status struct {
+	State     string        `json:"state"`
+	RateLimit configs.Rate  `json:"rate_limit"`
+	Stats     metrics.Stats `json:"stats"`
+	// Memory is the session's memory budget and use.
+	Memory *consumer.MemoryUsage `json:"memory,omitempty"`
+}
+
+// Check is one named readiness condition.
+type Check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Readiness is ready only when every check passes.
+type Readiness struct {
+	Ready  bool    `json:"ready"`
+	Checks []Check `json:"checks"`
+}
+
+// Settings are the parts of the configuration that can be changed while
+// the process is running.
+type Settings struct {
+	TargetRate   configs.Rate       `json:"target_rate"`
+	MaxBandwidth configs.Rate       `json:"max_bandwidth"`
+	DataSources  []configs.Source   `json:"data_sources"`
+	Schedules    []configs.Schedule `json:"schedules,omitempty"`
+}
+
+// SettingsPatch changes the settings whose fields are present.
+type SettingsPatch struct {
+	TargetRate   *configs.Rate      `json:"target_rate,omitempty"`
+	MaxBandwidth *configs.Rate      `json:"max_bandwidth,omitempty"`
+	DataSources  []configs.Source   `json:"data_sources,omitempty"`
+	Schedules    []configs.Schedule `json:"schedules,omitempty"`
+}
+
+// Controller is implemented by whatever owns the running consumer.
+type Controller interface {
+	Status() Status
+	Readiness() Readiness
+	Start() error
+	Pause() error
+	Resume() error
+	SetRate(rate configs.Rate) error
+	Stop() error
+	Sources() []configs.Source
+	Settings() Settings
+	// UpdateSettings validates and applies patch, recording origin (e.g.
+	// the client address) in the audit log, and returns the new settings.
+	UpdateSettings(patch SettingsPatch, origin string) (Settings, error)
+}
+
+// DefaultSocketPath returns $XDG_RUNTIME_DIR/dataconsumer.sock, falling
+// back to the system temporary directory.
+func DefaultSocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "dataconsumer.sock")
+}
+
+// Listen opens the control socket, replacing a stale socket file left
+// behind by a previous process. The socket is bound in a private directory
+// and only moved to path once it is 0600, so that no other user can connect
+// in between. Closing the listener removes it.
+func Listen(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("control socket %s is already in use", path)
+	}
+	os.Remove(path)
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".dataconsumer-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	bound := filepath.Join(dir, "sock")
+	listener, err := net.Listen("unix", bound)
+	if err != nil {
+		return nil, err
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(bound, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(bound, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &socketListener{Listener: listener, path: path}, nil
+}
+
+// socketListener removes the socket file it was moved to when closed.
+type socketListener struct {
+	net.Listener
+	path string
+}
+
+func (l *socketListener) Close() error {
+	err := l.Listener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+// Serve answers control requests until the listener is closed.
+func Serve(listener net.Listener, controller Controller) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go handle(conn, controller)
+	}
+}
+
+func handle(conn net.Conn, controller Controller) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	var req Request
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+	resp := Response{OK: true}
+	if err == nil {
+		err = dispatch(req, controller, &resp)
+	}
+	if err != nil {
+		resp = Response{Error: err.Error()}
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+func dispatch(req Request, controller Controller, resp *Response) error {
+	switch req.Command {
+	case "status":
+	case "start":
+		if err := controller.Start(); err != nil {
+			return err
+		}
+	case "pause":
+		if err := controller.Pause(); err != nil {
+			return err
+		}
+	case "resume":
+		if err := controller.Resume(); err != nil {
+			return err
+		}
+	case "set-rate":
+		rate, err := configs.ParseRate(req.Rate)
+		if err != nil {
+			return err
+		}
+		if err := controller.SetRate(rate); err != nil {
+			return err
+		}
+	case "stop":
+		if err := controller.Stop(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown command %q", req.Command)
+	}
+	status := controller.Status()
+	resp.Status = &status
+	return nil
+}
+
+// Send delivers a request to the daemon listening on path.
+func Send(path string, req Request) (Response, error) {
+	var resp Response
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return resp, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return resp, err
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, err
+	}
+	if !resp.OK {
+		return resp, fmt.Errorf("%s", resp.Error)
+	}
+	return resp, nil
+}
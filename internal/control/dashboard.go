@@ -0,0 +1,62 @@
+package control
+
+// dashboardPage is a live view of the process, fed by /events.
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>dataconsumer</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.3em 1em; border-bottom: 1px solid #ddd; text-align: left; }
+#events td { font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>dataconsumer</h1>
+<table>
+<tr><th>State</th><td id="state">connecting</td></tr>
+<tr><th>Consumed</th><td id="consumed"></td></tr>
+<tr><th>Current rate</th><td id="current"></td></tr>
+<tr><th>Average rate</th><td id="average"></td></tr>
+<tr><th>Peak rate</th><td id="peak"></td></tr>
+<tr><th>Rate limit</th><td id="limit"></td></tr>
+<tr><th>Running for</th><td id="elapsed"></td></tr>
+<tr id="footprint-row" hidden><th>Estimated footprint</th><td id="footprint"></td></tr>
+</table>
+<h2>Events</h2>
+<table id="events"></table>
+<script>
+const text = (id, value) => document.getElementById(id).textContent = value;
+const rate = mb => mb.toFixed(2) + " MB/min";
+const source = new EventSource("events" + location.search);
+source.addEventListener("stats", e => {
+	const status = JSON.parse(e.data), stats = status.stats;
+	text("state", status.state);
+	text("consumed", (stats.BytesTransferred / 1048576).toFixed(2) + " MB");
+	text("current", rate(stats.CurrentRate));
+	text("average", rate(stats.AverageRate));
+	text("peak", rate(stats.PeakRate));
+	text("limit", status.rate_limit);
+	text("elapsed", Math.round(stats.ElapsedTime / 1e9) + " s");
+	if (stats.Footprint) {
+		document.getElementById("footprint-row").hidden = false;
+		text("footprint", stats.Footprint.EnergyKWh.toFixed(3) + " kWh, " + stats.Footprint.CO2eGrams.toFixed(1) + " g CO2e");
+	}
+});
+source.onerror = () => text("state", "disconnected");
+const events = document.getElementById("events");
+for (const type of ["session_started", "session_ended", "paused", "resumed", "rate_changed", "stop_requested", "setting_changed", "clock_stepped", "source_draining", "source_drained"]) {
+	source.addEventListener(type, e => {
+		const event = JSON.parse(e.data);
+		const row = events.insertRow(0);
+		row.insertCell().textContent = new Date(event.time).toLocaleTimeString();
+		row.insertCell().textContent = event.type;
+		row.insertCell().textContent = event.detail ? JSON.stringify(event.detail) : "";
+	});
+}
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,71 @@
+package control
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is something that happened to the controlled process, such as a
+// session starting or a setting changing.
+type Event struct {
+	Type   string         `json:"type"`
+	Time   time.Time      `json:"time"`
+	Detail map[string]any `json:"detail,omitempty"`
+}
+
+// EventSource is implemented by controllers that publish events. Their
+// events are streamed by the HTTP API's /events endpoint.
+type EventSource interface {
+	// Subscribe returns a channel receiving events from now on and a
+	// function ending the subscription.
+	Subscribe() (<-chan Event, func())
+}
+
+// subscriberBuffer is the number of events a subscriber can fall behind
+// before it misses events.
+const subscriberBuffer = 16
+
+// Broadcaster fans events out to subscribers. The zero value is ready to
+// use. A subscriber that falls behind misses events rather than blocking
+// the publisher.
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// Publish sends an event of the given type to all subscribers. detail
+// holds alternating keys and values.
+func (b *Broadcaster) Publish(eventType string, detail ...any) {
+	event := Event{Type: eventType, Time: time.Now()}
+	if len(detail) > 0 {
+		event.Detail = make(map[string]any, len(detail)/2)
+		for i := 0; i+1 < len(detail); i += 2 {
+			key, _ := detail[i].(string)
+			event.Detail[key] = detail[i+1]
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe implements EventSource.
+func (b *Broadcaster) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan Event]struct{})
+	}
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, ch)
+	}
+}
@@ -0,0 +1,286 @@
+package control
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/secure"
+)
+
+// The gRPC service carries the same JSON messages as the HTTP API using a
+// "json" codec (content type application/grpc+json) instead of protobuf,
+// so no generated code is needed on either side.
+const grpcServiceName = "dataconsumer.control.v1.Control"
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type Empty struct{}
+
+type SetRateRequest struct {
+	Rate configs.Rate `json:"rate"`
+}
+
+type SourcesResponse struct {
+	Sources []configs.Source `json:"sources"`
+}
+
+type WatchRequest struct {
+	IntervalMillis int64 `json:"interval_ms"`
+}
+
+type grpcServer struct {
+	controller Controller
+}
+
+// ServeGRPC answers gRPC control requests until the listener is closed.
+// If token is set, requests must carry it as a bearer token; tlsConfig, if
+// not nil, serves over TLS.
+func ServeGRPC(listener net.Listener, controller Controller, token string, tlsConfig *tls.Config) error {
+	var options []grpc.ServerOption
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if token != "" {
+		options = append(options,
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if err := checkToken(ctx, token); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := checkToken(stream.Context(), token); err != nil {
+					return err
+				}
+				return handler(srv, stream)
+			}))
+	}
+	server := grpc.NewServer(options...)
+	server.RegisterService(&grpcServiceDesc, &grpcServer{controller: controller})
+	return server.Serve(listener)
+}
+
+func checkToken(ctx context.Context, token string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if presented, ok := strings.CutPrefix(value, "Bearer "); ok && secure.ValidToken(token, presented) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid token")
+}
+
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Status", Handler: unaryHandler(func(s *grpcServer, _ *Empty) (interface{}, error) {
+			st := s.controller.Status()
+			return &st, nil
+		})},
+		{MethodName: "Start", Handler: actionGRPC(func(c Controller) error { return c.Start() })},
+		{MethodName: "Stop", Handler: actionGRPC(func(c Controller) error { return c.Stop() })},
+		{MethodName: "Pause", Handler: actionGRPC(func(c Controller) error { return c.Pause() })},
+		{MethodName: "Resume", Handler: actionGRPC(func(c Controller) error { return c.Resume() })},
+		{MethodName: "SetRate", Handler: unaryHandler(func(s *grpcServer, req *SetRateRequest) (interface{}, error) {
+			if err := s.controller.SetRate(req.Rate); err != nil {
+				return nil, grpcError(err)
+			}
+			st := s.controller.Status()
+			return &st, nil
+		})},
+		{MethodName: "Sources", Handler: unaryHandler(func(s *grpcServer, _ *Empty) (interface{}, error) {
+			return &SourcesResponse{Sources: s.controller.Sources()}, nil
+		})},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "WatchStats", Handler: watchStatsHandler, ServerStreams: true},
+	},
+}
+
+func unaryHandler[Req any](fn func(*grpcServer, *Req) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := new(Req)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return fn(srv.(*grpcServer), req)
+		}
+		method, _ := grpc.Method(ctx)
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: method}
+		return interceptor(ctx, req, info, func(_ context.Context, req interface{}) (interface{}, error) {
+			return fn(srv.(*grpcServer), req.(*Req))
+		})
+	}
+}
+
+func actionGRPC(action func(Controller) error) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return unaryHandler(func(s *grpcServer, _ *Empty) (interface{}, error) {
+		if err := action(s.controller); err != nil {
+			return nil, grpcError(err)
+		}
+		st := s.controller.Status()
+		return &st, nil
+	})
+}
+
+func watchStatsHandler(srv interface{}, stream grpc.ServerStream) error {
+	var req WatchRequest
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+	interval := time.Duration(req.IntervalMillis) * time.Millisecond
+	if interval < 100*time.Millisecond {
+		interval = time.Second
+	}
+	controller := srv.(*grpcServer).controller
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		st := controller.Status()
+		if err := stream.SendMsg(&st); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func grpcError(err error) error {
+	if errors.Is(err, ErrConflict) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// GRPCClient talks to a ServeGRPC endpoint.
+type GRPCClient struct {
+	conn *grpc.ClientConn
+}
+
+// DialGRPC connects to addr, over TLS if tlsConfig is not nil, sending
+// token with every call if it is set.
+func DialGRPC(addr, token string, tlsConfig *tls.Config) (*GRPCClient, error) {
+	options := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(jsonCodec{}.Name())),
+	}
+	if tlsConfig != nil {
+		options[0] = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
+	if token != "" {
+		options = append(options, grpc.WithPerRPCCredentials(bearerCredentials{token: token, secure: tlsConfig != nil}))
+	}
+	conn, err := grpc.NewClient(addr, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCClient{conn: conn}, nil
+}
+
+// bearerCredentials sends a bearer token with every call.
+type bearerCredentials struct {
+	token  string
+	secure bool
+}
+
+func (c bearerCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+func (c bearerCredentials) RequireTransportSecurity() bool {
+	return c.secure
+}
+
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *GRPCClient) call(ctx context.Context, method string, req interface{}) (Status, error) {
+	var st Status
+	err := c.conn.Invoke(ctx, "/"+grpcServiceName+"/"+method, req, &st)
+	return st, err
+}
+
+func (c *GRPCClient) Status(ctx context.Context) (Status, error) {
+	return c.call(ctx, "Status", &Empty{})
+}
+
+func (c *GRPCClient) Start(ctx context.Context) (Status, error) {
+	return c.call(ctx, "Start", &Empty{})
+}
+
+func (c *GRPCClient) Stop(ctx context.Context) (Status, error) {
+	return c.call(ctx, "Stop", &Empty{})
+}
+
+func (c *GRPCClient) Pause(ctx context.Context) (Status, error) {
+	return c.call(ctx, "Pause", &Empty{})
+}
+
+func (c *GRPCClient) Resume(ctx context.Context) (Status, error) {
+	return c.call(ctx, "Resume", &Empty{})
+}
+
+func (c *GRPCClient) SetRate(ctx context.Context, rate configs.Rate) (Status, error) {
+	return c.call(ctx, "SetRate", &SetRateRequest{Rate: rate})
+}
+
+func (c *GRPCClient) Sources(ctx context.Context) ([]configs.Source, error) {
+	var resp SourcesResponse
+	err := c.conn.Invoke(ctx, "/"+grpcServiceName+"/Sources", &Empty{}, &resp)
+	return resp.Sources, err
+}
+
+// StatsStream yields status snapshots from WatchStats.
+type StatsStream struct {
+	stream grpc.ClientStream
+}
+
+func (s *StatsStream) Recv() (Status, error) {
+	var st Status
+	err := s.stream.RecvMsg(&st)
+	return st, err
+}
+
+// WatchStats streams a status snapshot every interval until ctx is done.
+func (c *GRPCClient) WatchStats(ctx context.Context, interval time.Duration) (*StatsStream, error) {
+	desc := &grpcServiceDesc.Streams[0]
+	stream, err := c.conn.NewStream(ctx, desc, "/"+grpcServiceName+"/WatchStats")
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(&WatchRequest{IntervalMillis: interval.Milliseconds()}); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &StatsStream{stream: stream}, nil
+}
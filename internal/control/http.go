@@ -0,0 +1,204 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/jobs"
+)
+
+// ErrConflict is returned by controllers when a request does not apply to
+// the current state, e.g. starting a session that is already running.
+var ErrConflict = errors.New("conflict")
+
+// ErrInvalid is returned by controllers when a request is malformed, e.g. a
+// settings patch with an invalid source.
+var ErrInvalid = errors.New("invalid request")
+
+type conflictError struct {
+	msg string
+}
+
+func (e conflictError) Error() string        { return e.msg }
+func (e conflictError) Is(target error) bool { return target == ErrConflict }
+
+// Conflict returns an error with the given message that matches ErrConflict.
+func Conflict(msg string) error {
+	return conflictError{msg: msg}
+}
+
+type invalidError struct {
+	err error
+}
+
+func (e invalidError) Error() string        { return e.err.Error() }
+func (e invalidError) Unwrap() error        { return e.err }
+func (e invalidError) Is(target error) bool { return target == ErrInvalid }
+
+// Invalid wraps err so that it matches ErrInvalid.
+func Invalid(err error) error {
+	return invalidError{err: err}
+}
+
+type rateBody struct {
+	Rate configs.Rate `json:"rate"`
+}
+
+// NewHTTPHandler exposes the controller as a small REST API:
+//
+//	GET  /status    current state and stats
+//	POST /start     start a session
+//	POST /stop      stop the current session
+//	POST /pause     pause consumption
+//	POST /resume    resume consumption
+//	GET  /rate      current rate limit
+//	PUT  /rate      set the rate limit, body {"rate": "500 MB/min"}
+//	GET  /sources   configured data sources
+//	GET  /config    settings that can be changed at runtime
+//	PATCH /config   change some of them, body e.g. {"target_rate": "2 GB/min"}
+//	GET  /events    Server-Sent Events with stats and controller events
+//	GET  /jobs      submitted jobs, if the controller accepts jobs
+//	POST /jobs      submit a job, body e.g. {"max_data": "10GB", "start_at": "02:00"}
+//	GET  /jobs/{id} one job and its result
+//	DELETE /jobs/{id} cancel a queued or running job
+//	GET  /          dashboard showing the /events stream
+//	GET  /healthz   liveness, always 200 while the process is serving
+//	GET  /readyz    readiness checks, 503 unless all pass
+func NewHTTPHandler(controller Controller) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, dashboardPage)
+	})
+	mux.HandleFunc("/events", eventsHandler(controller))
+	if queue, ok := controller.(JobQueue); ok {
+		mux.HandleFunc("/jobs", jobsHandler(queue))
+		mux.HandleFunc("/jobs/", jobsHandler(queue))
+	}
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		readiness := controller.Readiness()
+		code := http.StatusOK
+		if !readiness.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, readiness)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, controller.Status())
+	})
+	mux.HandleFunc("/start", actionHandler(controller, controller.Start))
+	mux.HandleFunc("/stop", actionHandler(controller, controller.Stop))
+	mux.HandleFunc("/pause", actionHandler(controller, controller.Pause))
+	mux.HandleFunc("/resume", actionHandler(controller, controller.Resume))
+	mux.HandleFunc("/rate", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodPost) {
+			return
+		}
+		if r.Method != http.MethodGet {
+			var body rateBody
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			if err := controller.SetRate(body.Rate); err != nil {
+				writeControllerError(w, err)
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, rateBody{Rate: controller.Status().RateLimit})
+	})
+	mux.HandleFunc("/sources", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, controller.Sources())
+	})
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, http.MethodGet, http.MethodPatch) {
+			return
+		}
+		if r.Method == http.MethodGet {
+			writeJSON(w, http.StatusOK, controller.Settings())
+			return
+		}
+		var patch SettingsPatch
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&patch); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		settings, err := controller.UpdateSettings(patch, r.RemoteAddr)
+		if err != nil {
+			writeControllerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, settings)
+	})
+	return mux
+}
+
+func actionHandler(controller Controller, action func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, http.MethodPost) {
+			return
+		}
+		if err := action(); err != nil {
+			writeControllerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, controller.Status())
+	}
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", methods[0])
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	return false
+}
+
+func writeControllerError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, jobs.ErrNotFound):
+		status = http.StatusNotFound
+	}
+	writeError(w, status, err)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, Response{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
@@ -0,0 +1,69 @@
+package control
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"dataconsumer/internal/jobs"
+)
+
+// JobQueue is implemented by controllers that accept consumption jobs.
+// Its jobs are served by the HTTP API's /jobs endpoints.
+type JobQueue interface {
+	SubmitJob(spec jobs.Spec) (jobs.Job, error)
+	Jobs() ([]jobs.Job, error)
+	Job(id string) (jobs.Job, error)
+	// CancelJob cancels a queued job or stops a running one.
+	CancelJob(id string) (jobs.Job, error)
+}
+
+// jobsHandler serves GET and POST /jobs and GET and DELETE /jobs/{id}.
+func jobsHandler(queue JobQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+		if id == "" {
+			if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+				return
+			}
+			if r.Method == http.MethodGet {
+				list, err := queue.Jobs()
+				if err != nil {
+					writeControllerError(w, err)
+					return
+				}
+				writeJSON(w, http.StatusOK, list)
+				return
+			}
+			var spec jobs.Spec
+			decoder := json.NewDecoder(r.Body)
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&spec); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			job, err := queue.SubmitJob(spec)
+			if err != nil {
+				writeControllerError(w, err)
+				return
+			}
+			w.Header().Set("Location", "/jobs/"+job.ID)
+			writeJSON(w, http.StatusCreated, job)
+			return
+		}
+
+		if !allowMethods(w, r, http.MethodGet, http.MethodDelete) {
+			return
+		}
+		get := queue.Job
+		if r.Method == http.MethodDelete {
+			get = queue.CancelJob
+		}
+		job, err := get(id)
+		if err != nil {
+			writeControllerError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	}
+}
@@ -0,0 +1,70 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// eventsHandler streams Server-Sent Events: a "stats" event with the
+// status every interval (?interval=, default 1s) and the controller's
+// events under their own type, if it publishes any.
+func eventsHandler(controller Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+			return
+		}
+		interval := time.Second
+		if value := r.URL.Query().Get("interval"); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 100*time.Millisecond {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid interval %q (want a duration of at least 100ms)", value))
+				return
+			}
+			interval = d
+		}
+
+		var events <-chan Event
+		if source, ok := controller.(EventSource); ok {
+			var unsubscribe func()
+			events, unsubscribe = source.Subscribe()
+			defer unsubscribe()
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// EventSource in pages served from elsewhere needs CORS.
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.WriteHeader(http.StatusOK)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		send := func(eventType string, data any) bool {
+			encoded, err := json.Marshal(data)
+			if err != nil {
+				return false
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, encoded); err != nil {
+				return false
+			}
+			flusher.Flush()
+			return true
+		}
+		for ok := send("stats", controller.Status()); ok; {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				ok = send("stats", controller.Status())
+			case event := <-events:
+				ok = send(event.Type, event)
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Package dnsload sends a steady rate of DNS queries for random
+// subdomains to a resolver and counts the outcomes.
+package dnsload
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+const (
+	// tick is how often queries are started; each tick starts the
+	// queries due since the last one.
+	tick = 10 * time.Millisecond
+	// maxInFlight bounds the queries awaiting an answer, so that a
+	// resolver that stops answering does not pile up goroutines.
+	maxInFlight = 4096
+	// defaultTimeout is how long a query waits for an answer by default.
+	defaultTimeout = 5 * time.Second
+)
+
+// epoch is what start and stop times are measured from, on the monotonic
+// clock so that a stepped wall clock does not distort the elapsed time.
+var epoch = time.Now()
+
+// Stats counts the queries of a Load.
+type Stats struct {
+	Sent     int64
+	Answered int64
+	// NotFound counts NXDOMAIN and empty answers, which is what random
+	// subdomains usually get.
+	NotFound int64
+	Failed   int64
+	// Dropped counts queries not sent because too many were awaiting an
+	// answer.
+	Dropped int64
+	// Latency is the mean time to an answer or NXDOMAIN.
+	Latency time.Duration
+	Elapsed time.Duration
+}
+
+// QPS returns the rate at which queries were sent.
+func (s Stats) QPS() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Sent) / s.Elapsed.Seconds()
+}
+
+// Load generates DNS queries until its context is done.
+type Load struct {
+	config   configs.DNSLoadConfig
+	resolver *net.Resolver
+	timeout  time.Duration
+
+	sent, answered, notFound, failed, dropped atomic.Int64
+	latency                                   atomic.Int64 // total nanoseconds
+	started, stopped                          atomic.Int64 // nanoseconds since epoch
+}
+
+// New returns a load for config, which must be valid.
+func New(config configs.DNSLoadConfig) *Load {
+	address := config.Resolver
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "53")
+	}
+	if len(config.Types) == 0 {
+		config.Types = []string{"A"}
+	}
+	timeout := defaultTimeout
+	if config.Timeout > 0 {
+		timeout = time.Duration(config.Timeout) * time.Second
+	}
+	var dialer net.Dialer
+	return &Load{
+		config:  config,
+		timeout: timeout,
+		resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+		},
+	}
+}
+
+// Run sends queries at the configured rate until ctx is done, then waits
+// for the queries in flight.
+func (l *Load) Run(ctx context.Context) {
+	l.started.Store(int64(time.Since(epoch)))
+	defer func() { l.stopped.Store(int64(time.Since(epoch))) }()
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	inFlight := make(chan struct{}, maxInFlight)
+	due, last := 0.0, time.Now()
+	for n := 0; ; {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			due += now.Sub(last).Seconds() * l.config.QPS
+			last = now
+		}
+		for ; due >= 1; due-- {
+			select {
+			case inFlight <- struct{}{}:
+			default:
+				l.dropped.Add(1)
+				continue
+			}
+			wg.Add(1)
+			go func(queryType string) {
+				defer wg.Done()
+				defer func() { <-inFlight }()
+				l.query(queryType)
+			}(l.config.Types[n%len(l.config.Types)])
+			n++
+		}
+	}
+}
+
+// query sends one query of queryType for a random subdomain.
+func (l *Load) query(queryType string) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+	// The trailing dot keeps the resolver from trying search domains.
+	name := strconv.FormatUint(rand.Uint64(), 36) + "." + strings.TrimSuffix(l.config.Domain, ".") + "."
+	l.sent.Add(1)
+	started := time.Now()
+	var err error
+	switch queryType {
+	case "AAAA":
+		_, err = l.resolver.LookupIP(ctx, "ip6", name)
+	case "TXT":
+		_, err = l.resolver.LookupTXT(ctx, name)
+	default:
+		_, err = l.resolver.LookupIP(ctx, "ip4", name)
+	}
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+		l.answered.Add(1)
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		l.notFound.Add(1)
+	default:
+		l.failed.Add(1)
+		return
+	}
+	l.latency.Add(int64(time.Since(started)))
+}
+
+// Stats returns the counts so far.
+func (l *Load) Stats() Stats {
+	s := Stats{
+		Sent:     l.sent.Load(),
+		Answered: l.answered.Load(),
+		NotFound: l.notFound.Load(),
+		Failed:   l.failed.Load(),
+		Dropped:  l.dropped.Load(),
+	}
+	if answers := s.Answered + s.NotFound; answers > 0 {
+		s.Latency = time.Duration(l.latency.Load() / answers)
+	}
+	end := int64(time.Since(epoch))
+	if stopped := l.stopped.Load(); stopped != 0 {
+		end = stopped
+	}
+	if started := l.started.Load(); started != 0 {
+		s.Elapsed = time.Duration(end - started)
+	}
+	return s
+}
@@ -0,0 +1,35 @@
+package fleet
+
+import (
+	"html/template"
+
+	"dataconsumer/configs"
+)
+
+var dashboard = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"rate":  func(mbPerMinute float64) string { return configs.RateFromMBPerMinute(mbPerMinute).String() },
+	"bytes": func(n int64) string { return configs.Size(n).String() },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>dataconsumer fleet</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.3em 1em; border-bottom: 1px solid #ddd; text-align: left; }
+</style>
+</head>
+<body>
+<h1>dataconsumer fleet</h1>
+<p>{{.LiveAgents}} of {{len .Agents}} agents alive, {{bytes .BytesTransferred}} consumed, {{rate .CurrentRate}} now
+{{- if .TargetRate}}, target {{.TargetRate}}{{end}}
+{{- if .MaxBandwidth}}, ceiling {{.MaxBandwidth}}{{end}}</p>
+<table>
+<tr><th>Agent</th><th>State</th><th>Consumed</th><th>Current rate</th><th>Average rate</th><th>Last report</th></tr>
+{{range .Agents}}<tr><td>{{.ID}}</td><td>{{.State}}</td><td>{{bytes .BytesTransferred}}</td><td>{{rate .CurrentRate}}</td><td>{{rate .AverageRate}}</td><td>{{if not .LastReport.IsZero}}{{.LastReport.Format "15:04:05"}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,257 @@
+// Package fleet runs dataconsumer as a fleet: agents register with a
+// controller, which hands out the source list and each agent's share of
+// the fleet's target rate and bandwidth ceiling, and collects the agents'
+// metrics into one summary. Agents report at the controller's heartbeat
+// interval; an agent that misses MissedHeartbeats reports in a row is
+// considered lost and its share goes to the live agents.
+package fleet
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/metrics"
+)
+
+// MissedHeartbeats is how many heartbeat intervals an agent may stay
+// silent before the controller considers it lost.
+const MissedHeartbeats = 3
+
+// Assignment is what an agent consumes: the sources and its target rate
+// and bandwidth ceiling. Zero rates are left unset. HeartbeatInterval is
+// how often the agent must report.
+type Assignment struct {
+	DataSources       []configs.Source `json:"data_sources"`
+	TargetRate        configs.Rate     `json:"target_rate,omitempty"`
+	MaxBandwidth      configs.Rate     `json:"max_bandwidth,omitempty"`
+	HeartbeatInterval time.Duration    `json:"heartbeat_interval,omitempty"`
+}
+
+// Report is an agent's current state and metrics. Rates are in MB/min like
+// metrics.Stats.
+type Report struct {
+	State            string  `json:"state"`
+	BytesTransferred int64   `json:"bytes_transferred"`
+	CurrentRate      float64 `json:"current_rate"`
+	AverageRate      float64 `json:"average_rate"`
+	// Stats are the agent's full session stats, without the rate
+	// history, for the fleet's aggregated stats.
+	Stats *metrics.Stats `json:"stats,omitempty"`
+}
+
+// Agent is a registered agent as seen by the controller.
+type Agent struct {
+	ID           string    `json:"id"`
+	RegisteredAt time.Time `json:"registered_at"`
+	LastReport   time.Time `json:"last_report,omitempty"`
+	// Alive is false once the agent has left or missed too many
+	// heartbeats. It becomes true again when the agent reports.
+	Alive bool `json:"alive"`
+	Report
+}
+
+// Summary aggregates the metrics of all agents. Lost agents, and those
+// replaced by a new agent under their ID, still count towards the bytes
+// consumed.
+type Summary struct {
+	Agents           []Agent      `json:"agents"`
+	LiveAgents       int          `json:"live_agents"`
+	TargetRate       configs.Rate `json:"target_rate,omitempty"`
+	MaxBandwidth     configs.Rate `json:"max_bandwidth,omitempty"`
+	BytesTransferred int64        `json:"bytes_transferred"`
+	CurrentRate      float64      `json:"current_rate"`
+}
+
+// Controller keeps track of the registered agents.
+type Controller struct {
+	plan Assignment
+
+	mu     sync.Mutex
+	agents map[string]*Agent
+	// peakRate is the highest combined current rate reported, in MB/min.
+	peakRate float64
+	// lost are the agents found lost since the last call to Expire.
+	lost []string
+	// retiredBytes and retired accumulate what agents consumed before a
+	// new agent took over their ID.
+	retiredBytes int64
+	retired      *metrics.Stats
+}
+
+// NewController returns a controller that gives every agent the sources of
+// plan and splits its fleet-wide rates evenly between the live agents.
+// Agents report every plan.HeartbeatInterval, or every 5 seconds if unset.
+func NewController(plan Assignment) *Controller {
+	if plan.HeartbeatInterval <= 0 {
+		plan.HeartbeatInterval = 5 * time.Second
+	}
+	return &Controller{plan: plan, agents: make(map[string]*Agent)}
+}
+
+// Register adds an agent under name and returns the ID it was registered
+// as. An agent that is no longer alive is replaced by the new one, keeping
+// its bytes in the totals; if a live agent uses name, a numbered variant of
+// it is used.
+func (c *Controller) Register(name string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(time.Now())
+	id := name
+	for n := 2; c.agents[id] != nil && c.agents[id].Alive; n++ {
+		id = fmt.Sprintf("%s-%d", name, n)
+	}
+	if old := c.agents[id]; old != nil {
+		c.retire(old)
+	}
+	c.agents[id] = &Agent{ID: id, RegisteredAt: time.Now(), Alive: true, Report: Report{State: "registered"}}
+	return id
+}
+
+// Deregister marks an agent that is shutting down as gone, so that its
+// share goes to the other agents right away.
+func (c *Controller) Deregister(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	agent := c.agents[id]
+	if agent == nil {
+		return fmt.Errorf("unknown agent %q", id)
+	}
+	agent.Alive = false
+	agent.State = "left"
+	agent.CurrentRate = 0
+	return nil
+}
+
+// Report records an agent's metrics, which also serve as its heartbeat,
+// and returns its current assignment.
+func (c *Controller) Report(id string, report Report) (Assignment, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	agent := c.agents[id]
+	if agent == nil {
+		return Assignment{}, fmt.Errorf("unknown agent %q", id)
+	}
+	agent.Report = report
+	agent.LastReport = time.Now()
+	agent.Alive = true
+	c.expire(agent.LastReport)
+	var rate float64
+	for _, agent := range c.agents {
+		if agent.Alive {
+			rate += agent.CurrentRate
+		}
+	}
+	c.peakRate = max(c.peakRate, rate)
+	return c.assignment(), nil
+}
+
+// Expire marks the agents that missed too many heartbeats as lost and
+// returns the IDs of all agents found lost since the previous call. Their
+// shares go to the live agents with the next assignment each of those
+// receives.
+func (c *Controller) Expire() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(time.Now())
+	lost := c.lost
+	c.lost = nil
+	sort.Strings(lost)
+	return lost
+}
+
+func (c *Controller) expire(now time.Time) {
+	deadline := now.Add(-MissedHeartbeats * c.plan.HeartbeatInterval)
+	for id, agent := range c.agents {
+		seen := agent.LastReport
+		if seen.IsZero() {
+			seen = agent.RegisteredAt
+		}
+		if agent.Alive && seen.Before(deadline) {
+			agent.Alive = false
+			agent.State = "lost"
+			agent.CurrentRate = 0
+			c.lost = append(c.lost, id)
+		}
+	}
+}
+
+// retire adds what a replaced agent consumed to the retired totals.
+func (c *Controller) retire(agent *Agent) {
+	c.retiredBytes += agent.BytesTransferred
+	if agent.Stats == nil {
+		return
+	}
+	stats := *agent.Stats
+	stats.CurrentRate = 0
+	if c.retired != nil {
+		stats = metrics.Merge(*c.retired, stats)
+	}
+	c.retired = &stats
+}
+
+// assignment splits the plan's rates evenly between the live agents.
+func (c *Controller) assignment() Assignment {
+	a := Assignment{DataSources: c.plan.DataSources, HeartbeatInterval: c.plan.HeartbeatInterval}
+	if n := configs.Rate(c.live()); n > 0 {
+		a.TargetRate = c.plan.TargetRate / n
+		a.MaxBandwidth = c.plan.MaxBandwidth / n
+	}
+	return a
+}
+
+func (c *Controller) live() int {
+	n := 0
+	for _, agent := range c.agents {
+		if agent.Alive {
+			n++
+		}
+	}
+	return n
+}
+
+// Summary returns the agents, sorted by ID, and their combined metrics.
+func (c *Controller) Summary() Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(time.Now())
+	s := Summary{TargetRate: c.plan.TargetRate, MaxBandwidth: c.plan.MaxBandwidth, LiveAgents: c.live(), BytesTransferred: c.retiredBytes}
+	for _, agent := range c.agents {
+		s.Agents = append(s.Agents, *agent)
+		s.BytesTransferred += agent.BytesTransferred
+		s.CurrentRate += agent.CurrentRate
+	}
+	sort.Slice(s.Agents, func(i, j int) bool { return s.Agents[i].ID < s.Agents[j].ID })
+	return s
+}
+
+// Stats combines the stats reported by all agents, as if the fleet were a
+// single consumer: see metrics.Merge. Agents that are not alive or were
+// replaced keep their bytes but no longer add to the current rate. PeakRate is the
+// highest combined current rate seen in the agents' reports and
+// TargetRate is the fleet's target.
+func (c *Controller) Stats() metrics.Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(time.Now())
+	all := make([]metrics.Stats, 0, len(c.agents)+1)
+	if c.retired != nil {
+		all = append(all, *c.retired)
+	}
+	for _, agent := range c.agents {
+		if agent.Stats == nil {
+			continue
+		}
+		stats := *agent.Stats
+		if !agent.Alive {
+			stats.CurrentRate = 0
+		}
+		all = append(all, stats)
+	}
+	merged := metrics.Merge(all...)
+	merged.PeakRate = c.peakRate
+	merged.TargetRate = c.plan.TargetRate.MBPerMinute()
+	return merged
+}
@@ -0,0 +1,145 @@
+package fleet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/metrics"
+)
+
+// silence makes an agent look as if it last reported long ago.
+func silence(c *Controller, id string) {
+	long := time.Now().Add(-time.Hour)
+	c.agents[id].RegisteredAt = long
+	c.agents[id].LastReport = long
+}
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(c *Controller)
+		want  string
+	}{
+		{"new name", func(c *Controller) {}, "a"},
+		{"live agent with the name", func(c *Controller) { c.Register("a") }, "a-2"},
+		{"two live agents with the name", func(c *Controller) { c.Register("a"); c.Register("a") }, "a-3"},
+		{"agent that left", func(c *Controller) { c.Deregister(c.Register("a")) }, "a"},
+		{"lost agent", func(c *Controller) { silence(c, c.Register("a")) }, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewController(Assignment{})
+			tt.setup(c)
+			if got := c.Register("a"); got != tt.want {
+				t.Errorf("Register = %q, want %q", got, tt.want)
+			}
+			if agent := c.agents[tt.want]; !agent.Alive || agent.State != "registered" {
+				t.Errorf("agent = %+v, want a live registered one", agent)
+			}
+		})
+	}
+}
+
+// TestRegisterKeepsReplacedTotals checks that an agent taking over the ID
+// of one that left does not drop what the old one consumed.
+func TestRegisterKeepsReplacedTotals(t *testing.T) {
+	c := NewController(Assignment{})
+	id := c.Register("a")
+	c.Report(id, Report{BytesTransferred: 100, CurrentRate: 10, Stats: &metrics.Stats{BytesTransferred: 100, CurrentRate: 10}})
+	c.Deregister(id)
+	c.Register("a")
+	c.Report(id, Report{BytesTransferred: 30, CurrentRate: 5, Stats: &metrics.Stats{BytesTransferred: 30, CurrentRate: 5}})
+
+	// A second replacement adds to the retired totals.
+	other := c.Register("b")
+	c.Report(other, Report{BytesTransferred: 7, Stats: &metrics.Stats{BytesTransferred: 7}})
+	silence(c, other)
+	c.Register("b")
+
+	summary := c.Summary()
+	if summary.BytesTransferred != 137 || summary.CurrentRate != 5 {
+		t.Errorf("summary bytes = %d, rate = %g, want 137 and 5", summary.BytesTransferred, summary.CurrentRate)
+	}
+	if len(summary.Agents) != 2 {
+		t.Errorf("summary has %d agents, want 2", len(summary.Agents))
+	}
+	stats := c.Stats()
+	if stats.BytesTransferred != 137 || stats.CurrentRate != 5 {
+		t.Errorf("stats bytes = %d, rate = %g, want 137 and 5", stats.BytesTransferred, stats.CurrentRate)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	c := NewController(Assignment{HeartbeatInterval: time.Second})
+	a := c.Register("a")
+	b := c.Register("b")
+	c.Report(a, Report{State: "running", BytesTransferred: 50, CurrentRate: 20})
+	c.Report(b, Report{State: "running", CurrentRate: 30})
+
+	silence(c, a)
+	if lost := c.Expire(); !reflect.DeepEqual(lost, []string{"a"}) {
+		t.Errorf("Expire = %v, want [a]", lost)
+	}
+	if lost := c.Expire(); lost != nil {
+		t.Errorf("second Expire = %v, want none", lost)
+	}
+	agent := c.agents[a]
+	if agent.Alive || agent.State != "lost" || agent.CurrentRate != 0 {
+		t.Errorf("lost agent = %+v", agent)
+	}
+	summary := c.Summary()
+	if summary.LiveAgents != 1 || summary.BytesTransferred != 50 || summary.CurrentRate != 30 {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	// Reporting again brings a lost agent back.
+	c.Report(a, Report{State: "running", BytesTransferred: 60})
+	if !c.agents[a].Alive || c.Summary().LiveAgents != 2 {
+		t.Error("agent still lost after reporting")
+	}
+}
+
+func TestRedistribution(t *testing.T) {
+	plan := Assignment{
+		DataSources:  []configs.Source{{URL: "http://example.com/a"}},
+		TargetRate:   120,
+		MaxBandwidth: 240,
+	}
+	c := NewController(plan)
+	a := c.Register("a")
+	b := c.Register("b")
+	d := c.Register("d")
+
+	tests := []struct {
+		name   string
+		change func()
+		live   int
+	}{
+		{"all live", func() {}, 3},
+		{"one left", func() { c.Deregister(d) }, 2},
+		{"one lost", func() { silence(c, b) }, 1},
+		{"lost one back", func() { c.Report(b, Report{}) }, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.change()
+			got, err := c.Report(a, Report{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := configs.Rate(tt.live)
+			if got.TargetRate != plan.TargetRate/n || got.MaxBandwidth != plan.MaxBandwidth/n {
+				t.Errorf("assignment rates = %v and %v, want a share of %d", got.TargetRate, got.MaxBandwidth, tt.live)
+			}
+			if !reflect.DeepEqual(got.DataSources, plan.DataSources) || got.HeartbeatInterval != 5*time.Second {
+				t.Errorf("assignment = %+v", got)
+			}
+		})
+	}
+
+	if _, err := c.Report("nobody", Report{}); err == nil {
+		t.Error("Report of an unknown agent succeeded")
+	}
+}
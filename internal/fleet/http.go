@@ -0,0 +1,180 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type registration struct {
+	Name string `json:"name,omitempty"`
+	ID   string `json:"id,omitempty"`
+}
+
+// NewHTTPHandler exposes the controller:
+//
+//	POST /agents              register, body {"name": "..."}, returns {"id": "..."}
+//	POST /agents/{id}/report  report metrics (the heartbeat), returns the agent's assignment
+//	DELETE /agents/{id}       deregister an agent that is shutting down
+//	GET  /summary             fleet summary as JSON
+//	GET  /stats               the agents' stats combined into one metrics.Stats
+//	GET  /                    fleet dashboard
+func NewHTTPHandler(c *Controller) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/agents", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		var body registration
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
+			http.Error(w, "expected {\"name\": ...}", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, registration{ID: c.Register(body.Name)})
+	})
+	mux.HandleFunc("/agents/", func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, "/agents/")
+		id, ok := strings.CutSuffix(rest, "/report")
+		if !ok && rest != "" && !strings.Contains(rest, "/") {
+			if r.Method != http.MethodDelete {
+				methodNotAllowed(w, http.MethodDelete)
+				return
+			}
+			if err := c.Deregister(rest); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !ok || id == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		var report Report
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		assignment, err := c.Report(id, report)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, assignment)
+	})
+	mux.HandleFunc("/summary", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Summary())
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Stats())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		dashboard.Execute(w, c.Summary())
+	})
+	return mux
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// ErrUnknownAgent is returned by Client.Report when the controller does not
+// know the agent, e.g. because it was restarted.
+var ErrUnknownAgent = errors.New("agent is not registered")
+
+// Client talks to a controller on behalf of one agent.
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewClient returns a client for the controller at baseURL, e.g.
+// http://10.0.0.5:9400. client may be nil for http.DefaultClient.
+func NewClient(baseURL string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), client: client}
+}
+
+// Register registers an agent named name and returns its ID.
+func (c *Client) Register(ctx context.Context, name string) (string, error) {
+	var reg registration
+	if err := c.post(ctx, "/agents", registration{Name: name}, &reg); err != nil {
+		return "", err
+	}
+	return reg.ID, nil
+}
+
+// Report sends the agent's metrics and returns its assignment.
+func (c *Client) Report(ctx context.Context, id string, report Report) (Assignment, error) {
+	var assignment Assignment
+	err := c.post(ctx, "/agents/"+url.PathEscape(id)+"/report", report, &assignment)
+	return assignment, err
+}
+
+// Deregister tells the controller that the agent is shutting down.
+func (c *Client) Deregister(ctx context.Context, id string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.baseURL+"/agents/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("controller returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, path string, body, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound && strings.HasSuffix(path, "/report"):
+		return ErrUnknownAgent
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("controller returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,72 @@
+// Package history keeps an index of finished consumption sessions, one
+// JSON object per line so that appending never rewrites earlier entries.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Session is the index entry of one finished session. Rates are in MB/min
+// like metrics.Stats.
+type Session struct {
+	RunID            string    `json:"run_id,omitempty"`
+	Window           string    `json:"window,omitempty"`
+	Start            time.Time `json:"start"`
+	End              time.Time `json:"end"`
+	Reason           string    `json:"reason"`
+	BytesTransferred int64     `json:"bytes_transferred"`
+	AverageRate      float64   `json:"average_rate"`
+	PeakRate         float64   `json:"peak_rate"`
+	MetricsFile      string    `json:"metrics_file"`
+	// PublicIPs lists the public addresses the egress checks saw.
+	PublicIPs []string `json:"public_ips,omitempty"`
+}
+
+// Append adds session to the index at path, creating it if needed.
+func Append(path string, session Session) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Load reads all sessions in the index at path, oldest first.
+func Load(path string) ([]Session, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var sessions []Session
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var session Session
+		if err := json.Unmarshal(scanner.Bytes(), &session); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, scanner.Err()
+}
@@ -0,0 +1,334 @@
+// Package jobs queues consumption jobs submitted through the control API,
+// such as "consume 10 GB at 500 MB/min starting 02:00", and keeps their
+// results in a file so they can be retrieved after the job has ended.
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// ErrNotFound is returned for an unknown job ID.
+var ErrNotFound = errors.New("no such job")
+
+// ErrFinished is returned when cancelling a job that has already ended.
+var ErrFinished = errors.New("job has already ended")
+
+// keepFinished is how many finished jobs a queue keeps. Older ones are
+// dropped, so that a long-running daemon's job file does not grow without
+// bound.
+const keepFinished = 100
+
+// Spec describes a job as submitted.
+type Spec struct {
+	Name string `json:"name,omitempty"`
+	// MaxData and Duration end the job; at least one is required.
+	MaxData  configs.Size     `json:"max_data,omitempty"`
+	Duration configs.Duration `json:"duration,omitempty"`
+	// Rate, if set, is both the target rate and the bandwidth ceiling.
+	Rate configs.Rate `json:"rate,omitempty"`
+	// StartAt is a time of day ("02:00", the next occurrence in local
+	// time) or an RFC 3339 timestamp; empty starts as soon as possible.
+	StartAt string `json:"start_at,omitempty"`
+	// DataSources replace the configured sources if set.
+	DataSources []configs.Source `json:"data_sources,omitempty"`
+}
+
+// State is where a job is in its lifecycle.
+type State string
+
+const (
+	Queued      State = "queued"
+	Running     State = "running"
+	Completed   State = "completed"
+	Failed      State = "failed"
+	Canceled    State = "canceled"
+	Interrupted State = "interrupted"
+)
+
+// Result is the outcome of a job that ran. Rates are in MB/min like
+// metrics.Stats.
+type Result struct {
+	// Reason is why the session ended, e.g. "data_cap" or "duration".
+	Reason           string        `json:"reason"`
+	BytesTransferred int64         `json:"bytes_transferred"`
+	Elapsed          time.Duration `json:"elapsed"`
+	AverageRate      float64       `json:"average_rate"`
+	PeakRate         float64       `json:"peak_rate"`
+	MetricsFile      string        `json:"metrics_file,omitempty"`
+}
+
+// Job is a queued, running or finished job.
+type Job struct {
+	ID          string     `json:"id"`
+	Spec        Spec       `json:"spec"`
+	State       State      `json:"state"`
+	SubmittedAt time.Time  `json:"submitted_at"`
+	StartAt     time.Time  `json:"start_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	EndedAt     *time.Time `json:"ended_at,omitempty"`
+	Result      *Result    `json:"result,omitempty"`
+}
+
+// Finished reports whether the job has ended, one way or another.
+func (j Job) Finished() bool {
+	return j.State != Queued && j.State != Running
+}
+
+// Queue holds the queued and running jobs and the most recent finished
+// ones in submission order, and saves them to its file after every change.
+type Queue struct {
+	mu      sync.Mutex
+	path    string
+	jobs    []*Job
+	nextID  int
+	keep    int
+	changed chan struct{}
+}
+
+// Open loads the jobs saved at path, if any. Jobs that were running when
+// the file was last written are marked interrupted. An empty path keeps
+// the jobs in memory only.
+func Open(path string) (*Queue, error) {
+	q := &Queue{path: path, nextID: 1, keep: keepFinished, changed: make(chan struct{}, 1)}
+	if path == "" {
+		return q, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &q.jobs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, job := range q.jobs {
+		if id, err := strconv.Atoi(job.ID); err == nil && id >= q.nextID {
+			q.nextID = id + 1
+		}
+		if job.State == Running {
+			job.State = Interrupted
+		}
+	}
+	q.pruneLocked()
+	return q, nil
+}
+
+// Validate checks that the job will end and that its start time can be
+// parsed.
+func (s Spec) Validate() error {
+	if s.MaxData < 0 || s.Duration < 0 || s.Rate < 0 {
+		return errors.New("max_data, duration and rate must not be negative")
+	}
+	if s.MaxData == 0 && s.Duration == 0 {
+		return errors.New("a job needs max_data or duration")
+	}
+	_, err := ParseStart(s.StartAt, time.Now())
+	return err
+}
+
+// Submit validates spec and queues it. If the queue cannot be saved, the
+// job is queued anyway and the error is returned with it.
+func (q *Queue) Submit(spec Spec, now time.Time) (Job, error) {
+	if err := spec.Validate(); err != nil {
+		return Job{}, err
+	}
+	startAt, err := ParseStart(spec.StartAt, now)
+	if err != nil {
+		return Job{}, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := &Job{
+		ID:          strconv.Itoa(q.nextID),
+		Spec:        spec,
+		State:       Queued,
+		SubmittedAt: now,
+		StartAt:     startAt,
+	}
+	q.nextID++
+	q.jobs = append(q.jobs, job)
+	return *job, q.saveLocked()
+}
+
+// List returns all jobs in submission order.
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, len(q.jobs))
+	for i, job := range q.jobs {
+		jobs[i] = *job
+	}
+	return jobs
+}
+
+// Get returns the job with the given ID.
+func (q *Queue) Get(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.findLocked(id)
+	if job == nil {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// Cancel cancels a queued job. A running job is returned unchanged; the
+// caller stops its session and reports the outcome through Finish.
+func (q *Queue) Cancel(id string, now time.Time) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.findLocked(id)
+	switch {
+	case job == nil:
+		return Job{}, ErrNotFound
+	case job.Finished():
+		return *job, ErrFinished
+	case job.State == Queued:
+		job.State = Canceled
+		job.EndedAt = &now
+		return *job, q.saveLocked()
+	}
+	return *job, nil
+}
+
+// Next returns the queued job that is due first.
+func (q *Queue) Next() (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queued := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		if job.State == Queued {
+			queued = append(queued, job)
+		}
+	}
+	if len(queued) == 0 {
+		return Job{}, false
+	}
+	sort.SliceStable(queued, func(i, j int) bool { return queued[i].StartAt.Before(queued[j].StartAt) })
+	return *queued[0], true
+}
+
+// Changed is signalled whenever a job is submitted or cancelled.
+func (q *Queue) Changed() <-chan struct{} {
+	return q.changed
+}
+
+// Start marks a queued job as running.
+func (q *Queue) Start(id string, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.findLocked(id)
+	if job == nil {
+		return ErrNotFound
+	}
+	job.State = Running
+	job.StartedAt = &now
+	return q.saveLocked()
+}
+
+// Finish records the outcome of a running job.
+func (q *Queue) Finish(id string, state State, result Result, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.findLocked(id)
+	if job == nil {
+		return ErrNotFound
+	}
+	job.State = state
+	job.EndedAt = &now
+	job.Result = &result
+	return q.saveLocked()
+}
+
+func (q *Queue) findLocked(id string) *Job {
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// pruneLocked drops the oldest finished jobs beyond q.keep.
+func (q *Queue) pruneLocked() {
+	finished := 0
+	for _, job := range q.jobs {
+		if job.Finished() {
+			finished++
+		}
+	}
+	jobs := q.jobs[:0]
+	for _, job := range q.jobs {
+		if job.Finished() && finished > q.keep {
+			finished--
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	clear(q.jobs[len(jobs):])
+	q.jobs = jobs
+}
+
+// saveLocked drops old finished jobs, writes the rest atomically and
+// signals Changed.
+func (q *Queue) saveLocked() error {
+	q.pruneLocked()
+	select {
+	case q.changed <- struct{}{}:
+	default:
+	}
+	if q.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(q.jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), filepath.Base(q.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path)
+}
+
+// ParseStart resolves a job's start_at relative to now: empty means now,
+// "HH:MM" the next time the local clock shows it, and anything else must
+// be an RFC 3339 timestamp.
+func ParseStart(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now, nil
+	}
+	if t, err := time.ParseInLocation("15:04", value, now.Location()); err == nil {
+		start := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+		if start.Before(now) {
+			start = start.AddDate(0, 0, 1)
+		}
+		return start, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start_at %q (want HH:MM or an RFC 3339 time)", value)
+	}
+	return t, nil
+}
@@ -0,0 +1,211 @@
+package jobs
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec Spec
+		// want is part of the error, or empty if the spec is valid.
+		want string
+	}{
+		{"max_data", Spec{MaxData: 1 << 30}, ""},
+		{"duration", Spec{Duration: configs.Minutes(5)}, ""},
+		{"neither", Spec{Rate: 1 << 20}, "needs max_data or duration"},
+		{"negative max_data", Spec{MaxData: -5, Duration: configs.Minutes(5)}, "must not be negative"},
+		{"negative duration", Spec{MaxData: 1 << 30, Duration: -configs.Minutes(5)}, "must not be negative"},
+		{"negative rate", Spec{MaxData: 1 << 30, Rate: -1}, "must not be negative"},
+		{"bad start", Spec{MaxData: 1 << 30, StartAt: "soon"}, "soon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.spec.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStart(t *testing.T) {
+	now := time.Date(2025, 6, 1, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+		// wantErr is part of the error, or empty if value is valid.
+		wantErr string
+	}{
+		{"", now, ""},
+		{"18:00", time.Date(2025, 6, 1, 18, 0, 0, 0, time.UTC), ""},
+		{"14:30", now, ""},
+		{"02:00", time.Date(2025, 6, 2, 2, 0, 0, 0, time.UTC), ""},
+		{"00:00", time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), ""},
+		{"2025-07-01T02:00:00+02:00", time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), ""},
+		{"2025-05-01T00:00:00Z", time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), ""},
+		{"25:00", time.Time{}, `invalid start_at "25:00"`},
+		{"2pm", time.Time{}, `invalid start_at "2pm"`},
+		{"2025-07-01", time.Time{}, `invalid start_at "2025-07-01"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseStart(tt.value, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseStart(%q) error = %v, want one containing %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseStart(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// states returns the state of every job in q in submission order.
+func states(q *Queue) []State {
+	var states []State
+	for _, job := range q.List() {
+		states = append(states, job.State)
+	}
+	return states
+}
+
+func TestQueue(t *testing.T) {
+	now := time.Date(2025, 6, 1, 14, 30, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	q, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := Spec{MaxData: 1 << 30}
+	if _, err := q.Submit(Spec{}, now); err == nil {
+		t.Error("Submit accepted an invalid spec")
+	}
+	later := spec
+	later.StartAt = "18:00"
+	first, _ := q.Submit(later, now)
+	second, _ := q.Submit(spec, now)
+	third, err := q.Submit(spec, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != "1" || second.ID != "2" || third.ID != "3" || first.State != Queued {
+		t.Errorf("submitted %+v, %+v, %+v", first, second, third)
+	}
+	select {
+	case <-q.Changed():
+	default:
+		t.Error("Submit did not signal Changed")
+	}
+
+	// The job due first runs next, not the one submitted first.
+	if next, ok := q.Next(); !ok || next.ID != "2" {
+		t.Errorf("Next = %+v, %v, want job 2", next, ok)
+	}
+	if err := q.Start("2", now); err != nil {
+		t.Fatal(err)
+	}
+	if next, ok := q.Next(); !ok || next.ID != "3" {
+		t.Errorf("Next = %+v, %v, want job 3", next, ok)
+	}
+
+	tests := []struct {
+		name, id string
+		wantErr  error
+		want     State
+	}{
+		{"queued", "3", nil, Canceled},
+		{"running", "2", nil, Running},
+		{"finished", "3", ErrFinished, Canceled},
+		{"unknown", "9", ErrNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run("cancel "+tt.name, func(t *testing.T) {
+			job, err := q.Cancel(tt.id, now)
+			if !errors.Is(err, tt.wantErr) || job.State != tt.want {
+				t.Errorf("Cancel = %s, %v, want %s, %v", job.State, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	if err := q.Finish("9", Completed, Result{}, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Finish of an unknown job = %v", err)
+	}
+	if err := q.Finish("2", Completed, Result{Reason: "data_cap", BytesTransferred: 1 << 30}, now); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := q.Get("2"); job.State != Completed || job.Result.Reason != "data_cap" || job.EndedAt == nil {
+		t.Errorf("finished job = %+v", job)
+	}
+	if got, want := states(q), []State{Queued, Completed, Canceled}; !reflect.DeepEqual(got, want) {
+		t.Errorf("states = %v, want %v", got, want)
+	}
+
+	// Reopening keeps the jobs, marks running ones interrupted and goes on
+	// numbering after the last ID.
+	if err := q.Start("1", now); err != nil {
+		t.Fatal(err)
+	}
+	q, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := states(q), []State{Interrupted, Completed, Canceled}; !reflect.DeepEqual(got, want) {
+		t.Errorf("states after Open = %v, want %v", got, want)
+	}
+	if _, ok := q.Next(); ok {
+		t.Error("Next returned a job with none queued")
+	}
+	if job, _ := q.Submit(spec, now); job.ID != "4" {
+		t.Errorf("ID after Open = %s, want 4", job.ID)
+	}
+}
+
+func TestQueueRetention(t *testing.T) {
+	now := time.Date(2025, 6, 1, 14, 30, 0, 0, time.UTC)
+	q, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.keep = 2
+	spec := Spec{MaxData: 1 << 30}
+	for i := 0; i < 3; i++ {
+		job, _ := q.Submit(spec, now)
+		q.Start(job.ID, now)
+		q.Finish(job.ID, Completed, Result{}, now)
+	}
+	q.Submit(spec, now)
+	q.Cancel("4", now)
+	q.Submit(spec, now)
+
+	// Queued jobs stay however many finished ones there are.
+	var ids []string
+	for _, job := range q.List() {
+		ids = append(ids, job.ID)
+	}
+	if want := []string{"3", "4", "5"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("jobs = %v, want %v", ids, want)
+	}
+	if _, err := q.Get("1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a dropped job = %v", err)
+	}
+}
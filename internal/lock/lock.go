@@ -0,0 +1,34 @@
+// Package lock keeps two processes from using the same files at once.
+package lock
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupported is returned by Acquire on platforms without locking.
+var ErrUnsupported = errors.New("locking is not supported on this platform")
+
+// HeldError is returned by Acquire when another process holds the lock.
+type HeldError struct {
+	Path string
+	// PID is the process holding the lock, or 0 if unknown.
+	PID int
+}
+
+func (e *HeldError) Error() string {
+	if e.PID > 0 {
+		return fmt.Sprintf("%s is locked by another instance (pid %d)", e.Path, e.PID)
+	}
+	return fmt.Sprintf("%s is locked by another instance", e.Path)
+}
+
+// Lock is a held lock. It is released by Release or when the process exits.
+type Lock struct {
+	release func() error
+}
+
+// Release gives up the lock.
+func (l *Lock) Release() error {
+	return l.release()
+}
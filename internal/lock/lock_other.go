@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd || windows)
+
+package lock
+
+// Acquire always fails with ErrUnsupported.
+func Acquire(path string) (*Lock, error) {
+	return nil, ErrUnsupported
+}
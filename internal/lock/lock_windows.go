@@ -0,0 +1,38 @@
+package lock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// Acquire creates a named mutex derived from the absolute path, so that
+// instances in any session of the machine contend for the same lock. The
+// file itself is not created.
+func Acquire(path string) (*Lock, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(abs)))
+	name, err := windows.UTF16PtrFromString(`Global\dataconsumer-` + hex.EncodeToString(sum[:16]))
+	if err != nil {
+		return nil, err
+	}
+	handle, err := windows.CreateMutex(nil, true, name)
+	if errors.Is(err, windows.ERROR_ALREADY_EXISTS) {
+		windows.CloseHandle(handle)
+		return nil, &HeldError{Path: path}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Lock{release: func() error {
+		windows.ReleaseMutex(handle)
+		return windows.CloseHandle(handle)
+	}}, nil
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package logging
+
+func openEventLog() (sink, error) {
+	return nil, ErrUnsupportedTarget
+}
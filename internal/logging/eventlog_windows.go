@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"log/slog"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// eventID is the ID of every event written; the source registered by
+// "service install" shows the message text as is.
+const eventID = 1
+
+type eventLogSink struct {
+	log *eventlog.Log
+}
+
+func openEventLog() (sink, error) {
+	l, err := eventlog.Open(Identifier)
+	if err != nil {
+		return nil, err
+	}
+	return eventLogSink{log: l}, nil
+}
+
+func (s eventLogSink) emit(level slog.Level, message string) error {
+	switch severity(level) {
+	case 3:
+		return s.log.Error(eventID, message)
+	case 4:
+		return s.log.Warning(eventID, message)
+	}
+	return s.log.Info(eventID, message)
+}
+
+func (s eventLogSink) Close() error {
+	return s.log.Close()
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalSink sends records to journald using its native protocol, so
+// they carry a priority and identifier without a syslog daemon.
+type journalSink struct {
+	conn *net.UnixConn
+}
+
+func openJournald() (sink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalSink{conn: conn}, nil
+}
+
+func (s *journalSink) emit(level slog.Level, message string) error {
+	var b bytes.Buffer
+	journalField(&b, "PRIORITY", strconv.Itoa(severity(level)))
+	journalField(&b, "SYSLOG_IDENTIFIER", Identifier)
+	journalField(&b, "MESSAGE", message)
+	_, err := s.conn.Write(b.Bytes())
+	return err
+}
+
+func (s *journalSink) Close() error {
+	return s.conn.Close()
+}
+
+// journalField appends a field, switching to the length-prefixed form
+// for values that contain a newline.
+func journalField(b *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(key + "=" + value + "\n")
+		return
+	}
+	b.WriteString(key + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
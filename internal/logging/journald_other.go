@@ -0,0 +1,7 @@
+//go:build !linux
+
+package logging
+
+func openJournald() (sink, error) {
+	return nil, ErrUnsupportedTarget
+}
@@ -0,0 +1,51 @@
+// Package logging builds the slog loggers used by the consumer, collector
+// and command line.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"dataconsumer/configs"
+)
+
+// LevelTrace is below slog.LevelDebug and used for per-connection and
+// per-request detail.
+const LevelTrace = slog.LevelDebug - 4
+
+// LevelFor returns the minimum level logged at the given verbosity.
+func LevelFor(v configs.Verbosity) slog.Level {
+	switch {
+	case v <= configs.Quiet:
+		return slog.LevelWarn
+	case v == configs.Normal:
+		return slog.LevelInfo
+	case v == configs.Verbose:
+		return slog.LevelDebug
+	}
+	return LevelTrace
+}
+
+// New returns a logger writing records at or above level to w, formatted
+// as "text" (key=value pairs) or "json".
+func New(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceLevel}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+}
+
+// replaceLevel names LevelTrace "TRACE" instead of "DEBUG-4".
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := a.Value.Any().(slog.Level); ok && level == LevelTrace {
+			a.Value = slog.StringValue("TRACE")
+		}
+	}
+	return a
+}
@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// RotateOptions controls when a RotatingFile starts a new file and which
+// old files it keeps. Zero values disable the corresponding limit.
+type RotateOptions struct {
+	// MaxSize rotates the file before it would grow beyond this many bytes.
+	MaxSize int64
+	// Interval rotates the file once it has been written to for this long.
+	Interval time.Duration
+	// MaxBackups is the number of rotated files kept.
+	MaxBackups int
+	// Retention removes rotated files older than this.
+	Retention time.Duration
+}
+
+// RotatingFile is an io.Writer that appends to a log file and rotates it
+// by size and age. Rotated files are renamed with a timestamp, e.g.
+// dataconsumer-20240101T120000.000.log, next to the original.
+type RotatingFile struct {
+	path    string
+	options RotateOptions
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// NewRotatingFile opens path for appending, creating it if needed.
+func NewRotatingFile(path string, options RotateOptions) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, options: options}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.prune()
+	return r, nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.shouldRotate(len(p)) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *RotatingFile) shouldRotate(n int) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.options.MaxSize > 0 && r.size+int64(n) > r.options.MaxSize {
+		return true
+	}
+	return r.options.Interval > 0 && time.Since(r.opened) >= r.options.Interval
+}
+
+func (r *RotatingFile) open() error {
+	if dir := filepath.Dir(r.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	r.opened = time.Now()
+	return nil
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+	prefix, ext := r.backupPattern()
+	backup := prefix + time.Now().Format(backupTimeFormat) + ext
+	renameErr := os.Rename(r.path, backup)
+	// Keep logging to the original file if it could not be renamed.
+	if err := r.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	r.prune()
+	return nil
+}
+
+// backupPattern returns the name prefix and extension of rotated files.
+func (r *RotatingFile) backupPattern() (string, string) {
+	ext := filepath.Ext(r.path)
+	return strings.TrimSuffix(r.path, ext) + "-", ext
+}
+
+// prune removes rotated files beyond MaxBackups or older than Retention.
+func (r *RotatingFile) prune() {
+	prefix, ext := r.backupPattern()
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return
+	}
+	var backups []string
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ext)
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	// The timestamp format sorts chronologically; newest first.
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i, backup := range backups {
+		remove := r.options.MaxBackups > 0 && i >= r.options.MaxBackups
+		if !remove && r.options.Retention > 0 {
+			if info, err := os.Stat(backup); err == nil && time.Since(info.ModTime()) > r.options.Retention {
+				remove = true
+			}
+		}
+		if remove {
+			os.Remove(backup)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Identifier names the program in the host's logging system.
+const Identifier = "dataconsumer"
+
+// ErrUnsupportedTarget is returned by OpenTarget for a log target that is
+// not available on this platform.
+var ErrUnsupportedTarget = errors.New("log target is not supported on this platform")
+
+// sink is a host logging system receiving one line per record.
+type sink interface {
+	emit(level slog.Level, message string) error
+	Close() error
+}
+
+// OpenTarget returns a logger writing records at or above level to the
+// host's logging system: "syslog" for the local syslog daemon,
+// "syslog://host:port" for a remote one over UDP, "journald" or
+// "eventlog" for the Windows Event Log. The returned function closes the
+// connection.
+func OpenTarget(target string, level slog.Leveler) (*slog.Logger, func() error, error) {
+	var s sink
+	var err error
+	switch {
+	case target == "syslog":
+		s, err = openSyslog("", "")
+	case strings.HasPrefix(target, "syslog://"):
+		s, err = openSyslog("udp", strings.TrimPrefix(target, "syslog://"))
+	case target == "journald":
+		s, err = openJournald()
+	case target == "eventlog":
+		s, err = openEventLog()
+	default:
+		return nil, nil, fmt.Errorf("unknown log target %q", target)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening %s: %w", target, err)
+	}
+	return slog.New(newSinkHandler(s, level)), s.Close, nil
+}
+
+// severity maps a level to its syslog severity, which journald uses too.
+func severity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	}
+	return 7
+}
+
+// sinkHandler formats records as the message followed by key=value
+// pairs. Time and level are left to the sink, which records them itself.
+type sinkHandler struct {
+	sink  sink
+	level slog.Leveler
+	text  slog.Handler
+	// mu guards buf, which text writes to and which handlers derived by
+	// WithAttrs and WithGroup share.
+	mu  *sync.Mutex
+	buf *bytes.Buffer
+}
+
+func newSinkHandler(s sink, level slog.Leveler) *sinkHandler {
+	buf := new(bytes.Buffer)
+	text := slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level:       LevelTrace,
+		ReplaceAttr: dropBuiltins,
+	})
+	return &sinkHandler{sink: s, level: level, text: text, mu: new(sync.Mutex), buf: buf}
+}
+
+func (h *sinkHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *sinkHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	h.buf.Reset()
+	err := h.text.Handle(ctx, r)
+	attrs := strings.TrimSuffix(h.buf.String(), "\n")
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	message := r.Message
+	if attrs != "" {
+		message += " " + attrs
+	}
+	return h.sink.emit(r.Level, message)
+}
+
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.text = h.text.WithAttrs(attrs)
+	return &c
+}
+
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.text = h.text.WithGroup(name)
+	return &c
+}
+
+// dropBuiltins removes the time, level and message attributes.
+func dropBuiltins(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 {
+		switch a.Key {
+		case slog.TimeKey, slog.LevelKey, slog.MessageKey:
+			return slog.Attr{}
+		}
+	}
+	return a
+}
@@ -0,0 +1,7 @@
+//go:build windows || plan9
+
+package logging
+
+func openSyslog(network, addr string) (sink, error) {
+	return nil, ErrUnsupportedTarget
+}
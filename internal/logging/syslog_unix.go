@@ -0,0 +1,38 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"log/slog"
+	"log/syslog"
+)
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// openSyslog connects to the syslog daemon at addr, or the local one if
+// network is empty.
+func openSyslog(network, addr string) (sink, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_DAEMON|syslog.LOG_INFO, Identifier)
+	if err != nil {
+		return nil, err
+	}
+	return syslogSink{w: w}, nil
+}
+
+func (s syslogSink) emit(level slog.Level, message string) error {
+	switch severity(level) {
+	case 3:
+		return s.w.Err(message)
+	case 4:
+		return s.w.Warning(message)
+	case 6:
+		return s.w.Info(message)
+	}
+	return s.w.Debug(message)
+}
+
+func (s syslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,376 @@
+// Package pac evaluates proxy auto-config (PAC) files, the JavaScript
+// files corporate networks publish to tell clients which proxy to use for
+// each destination.
+//
+// Scripts run in a small interpreter for a documented subset of
+// JavaScript: top-level functions, var, assignment, if, else and return,
+// strings, numbers and booleans, the usual operators and a few string
+// methods, with the standard PAC functions such as shExpMatch, dnsDomainIs
+// and isInNet. Loops, switch, arrays, objects and regular expressions are
+// rejected when the file is parsed, and dateRange is not supported. Without
+// loops every evaluation ends; scripts are also limited in nesting, steps,
+// call depth and string length, so that a hostile one fails instead of
+// exhausting the process. See script.go for the exact subset.
+package pac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// maxSize bounds the PAC files Load reads.
+	maxSize = 1 << 20
+	// dnsTimeout bounds the lookups of dnsResolve, isResolvable and
+	// isInNet.
+	dnsTimeout = 5 * time.Second
+	// maxLookups bounds the names one evaluation may look up, so that a
+	// script cannot hold a request for many DNS timeouts.
+	maxLookups = 8
+)
+
+// lookupIP resolves host names; tests replace it to stay off the network.
+var lookupIP = net.DefaultResolver.LookupIP
+
+// Script is a parsed PAC file. It is safe for concurrent use; every call
+// of FindProxy runs the file in a fresh global scope.
+type Script struct {
+	body  []stmt
+	funcs map[string]*function
+}
+
+// Parse parses the PAC file src, which must define FindProxyForURL.
+func Parse(src string) (*Script, error) {
+	if len(src) > maxSize {
+		return nil, fmt.Errorf("pac: file larger than %d bytes", maxSize)
+	}
+	body, funcs, err := parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("pac: %w", err)
+	}
+	if _, ok := funcs["FindProxyForURL"]; !ok {
+		return nil, errors.New("pac: FindProxyForURL is not defined")
+	}
+	return &Script{body: body, funcs: funcs}, nil
+}
+
+// Load reads the PAC file at location, an http or https URL, a file URL or
+// a path, and parses it. URLs are fetched directly, not through a proxy.
+func Load(ctx context.Context, location string) (*Script, error) {
+	src, err := read(ctx, location)
+	if err != nil {
+		return nil, fmt.Errorf("pac %s: %w", location, err)
+	}
+	script, err := Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	return script, nil
+}
+
+func read(ctx context.Context, location string) (string, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		path := location
+		if err == nil && u.Scheme == "file" {
+			path = u.Path
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		src, err := io.ReadAll(io.LimitReader(f, maxSize))
+		return string(src), err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return "", err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	src, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
+	return string(src), err
+}
+
+// FindProxy runs the top level of the script in a fresh global scope, then
+// calls FindProxyForURL(rawURL, host) and returns its result, e.g.
+// "PROXY proxy.example.com:8080; DIRECT".
+func (s *Script) FindProxy(rawURL, host string) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(jsError)
+			if !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("pac: %s", e.msg)
+		}
+	}()
+	r := &run{globals: make(map[string]value), funcs: s.funcs, builtins: builtins()}
+	execAll(scope{run: r}, s.body)
+	v := r.callFunction(s.funcs["FindProxyForURL"], []value{rawURL, host})
+	if v == nil || v == (null{}) {
+		return "", nil
+	}
+	return toString(v), nil
+}
+
+// Proxies parses the result of FindProxyForURL into the proxies to try in
+// order, with nil for DIRECT. PROXY and HTTP entries are HTTP proxies,
+// HTTPS entries HTTPS proxies and SOCKS and SOCKS5 entries SOCKS5 proxies;
+// SOCKS4 entries are skipped. An empty result means DIRECT.
+func Proxies(result string) ([]*url.URL, error) {
+	var proxies []*url.URL
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		kind := strings.ToUpper(fields[0])
+		if kind == "DIRECT" {
+			proxies = append(proxies, nil)
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("pac: invalid proxy %q", strings.TrimSpace(entry))
+		}
+		var scheme string
+		switch kind {
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS5":
+			scheme = "socks5"
+		case "SOCKS4":
+			continue
+		default:
+			return nil, fmt.Errorf("pac: unknown proxy type %q", fields[0])
+		}
+		proxies = append(proxies, &url.URL{Scheme: scheme, Host: fields[1]})
+	}
+	if strings.TrimSpace(result) == "" {
+		return []*url.URL{nil}, nil
+	}
+	if len(proxies) == 0 {
+		return nil, fmt.Errorf("pac: no supported proxy in %q", result)
+	}
+	return proxies, nil
+}
+
+// builtins returns the PAC functions for one evaluation.
+func builtins() map[string]builtin {
+	str := func(args []value, i int) string {
+		if i < len(args) {
+			return toString(args[i])
+		}
+		return ""
+	}
+	// resolved caches lookups, as scripts often test the same host against
+	// several networks.
+	resolved := make(map[string]net.IP)
+	resolve := func(host string) net.IP {
+		if ip := net.ParseIP(host); ip != nil {
+			return ip.To4()
+		}
+		if ip, ok := resolved[host]; ok {
+			return ip
+		}
+		if len(resolved) == maxLookups {
+			throw("script looked up more than %d names", maxLookups)
+		}
+		ip := lookup(host)
+		resolved[host] = ip
+		return ip
+	}
+	return map[string]builtin{
+		"isPlainHostName": func(args []value) value {
+			return !strings.Contains(str(args, 0), ".")
+		},
+		"dnsDomainIs": func(args []value) value {
+			return strings.HasSuffix(strings.ToLower(str(args, 0)), strings.ToLower(str(args, 1)))
+		},
+		"localHostOrDomainIs": func(args []value) value {
+			host, hostdom := strings.ToLower(str(args, 0)), strings.ToLower(str(args, 1))
+			return host == hostdom || !strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+".")
+		},
+		"isResolvable": func(args []value) value {
+			return resolve(str(args, 0)) != nil
+		},
+		"isInNet": func(args []value) value {
+			ip := resolve(str(args, 0))
+			pattern := net.ParseIP(str(args, 1)).To4()
+			mask := net.ParseIP(str(args, 2)).To4()
+			if ip == nil || pattern == nil || mask == nil {
+				return false
+			}
+			m := net.IPMask(mask)
+			return ip.Mask(m).Equal(pattern.Mask(m))
+		},
+		"dnsResolve": func(args []value) value {
+			if ip := resolve(str(args, 0)); ip != nil {
+				return ip.String()
+			}
+			return null{}
+		},
+		"convert_addr": func(args []value) value {
+			ip := net.ParseIP(str(args, 0)).To4()
+			if ip == nil {
+				return float64(0)
+			}
+			return float64(uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3]))
+		},
+		"myIpAddress": func([]value) value {
+			return myIPAddress()
+		},
+		"dnsDomainLevels": func(args []value) value {
+			return float64(strings.Count(str(args, 0), "."))
+		},
+		"shExpMatch": func(args []value) value {
+			return shExpMatch(str(args, 0), str(args, 1))
+		},
+		"weekdayRange": func(args []value) value {
+			return weekdayRange(args, time.Now())
+		},
+		"timeRange": func(args []value) value {
+			return timeRange(args, time.Now())
+		},
+		"dateRange": func([]value) value {
+			throw("dateRange is not supported")
+			return nil
+		},
+		"alert": func([]value) value {
+			return nil
+		},
+	}
+}
+
+// lookup returns the first IPv4 address of the name host, or nil if it
+// has none.
+func lookup(host string) net.IP {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+	addrs, err := lookupIP(ctx, "ip4", host)
+	if err != nil || len(addrs) == 0 {
+		return nil
+	}
+	return addrs[0].To4()
+}
+
+// myIPAddress returns the address of the interface that routes to the
+// internet. No packet is sent to find it.
+func myIPAddress() string {
+	conn, err := net.Dial("udp4", "198.51.100.1:53")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+// shExpMatch matches s against a shell expression, in which * matches
+// any characters and ? one character. On a mismatch it only backtracks to
+// the last *, so it takes time proportional to len(s) * len(pattern).
+func shExpMatch(s, pattern string) bool {
+	i, j := 0, 0
+	star, next := -1, 0
+	for i < len(s) {
+		switch {
+		case j < len(pattern) && (pattern[j] == '?' || pattern[j] == s[i]):
+			i++
+			j++
+		case j < len(pattern) && pattern[j] == '*':
+			star, next = j, i
+			j++
+		case star >= 0:
+			next++
+			i, j = next, star+1
+		default:
+			return false
+		}
+	}
+	for j < len(pattern) && pattern[j] == '*' {
+		j++
+	}
+	return j == len(pattern)
+}
+
+var weekdays = map[string]time.Weekday{
+	"SUN": time.Sunday, "MON": time.Monday, "TUE": time.Tuesday, "WED": time.Wednesday,
+	"THU": time.Thursday, "FRI": time.Friday, "SAT": time.Saturday,
+}
+
+// gmt strips a trailing "GMT" argument and returns now in UTC if there was
+// one.
+func gmt(args []value, now time.Time) ([]value, time.Time) {
+	if len(args) > 0 && toString(args[len(args)-1]) == "GMT" {
+		return args[:len(args)-1], now.UTC()
+	}
+	return args, now
+}
+
+func weekdayRange(args []value, now time.Time) bool {
+	args, now = gmt(args, now)
+	if len(args) == 0 || len(args) > 2 {
+		throw("weekdayRange takes one or two days")
+	}
+	var days []time.Weekday
+	for _, arg := range args {
+		day, ok := weekdays[strings.ToUpper(toString(arg))]
+		if !ok {
+			throw("weekdayRange: invalid day %q", toString(arg))
+		}
+		days = append(days, day)
+	}
+	today := now.Weekday()
+	if len(days) == 1 {
+		return today == days[0]
+	}
+	if days[0] <= days[1] {
+		return days[0] <= today && today <= days[1]
+	}
+	return today >= days[0] || today <= days[1]
+}
+
+func timeRange(args []value, now time.Time) bool {
+	args, now = gmt(args, now)
+	n := make([]int, len(args))
+	for i, arg := range args {
+		n[i] = int(toNumber(arg))
+	}
+	seconds := func(h, m, s int) int { return h*3600 + m*60 + s }
+	current := seconds(now.Hour(), now.Minute(), now.Second())
+	var from, to int
+	switch len(n) {
+	case 1:
+		return now.Hour() == n[0]
+	case 2:
+		from, to = seconds(n[0], 0, 0), seconds(n[1], 0, 0)-1
+	case 4:
+		from, to = seconds(n[0], n[1], 0), seconds(n[2], n[3], 0)
+	case 6:
+		from, to = seconds(n[0], n[1], n[2]), seconds(n[3], n[4], n[5])
+	default:
+		throw("timeRange takes 1, 2, 4 or 6 numbers")
+	}
+	if from <= to {
+		return from <= current && current <= to
+	}
+	return current >= from || current <= to
+}
@@ -0,0 +1,457 @@
+package pac
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// corporatePAC is laid out like the PAC files corporate networks publish:
+// intranet and private addresses go direct, the rest through a list of
+// proxies with fallbacks.
+const corporatePAC = `
+// Proxy auto-config for Example Corp.
+var fallback = "PROXY proxy1.example.com:8080; PROXY proxy2.example.com:8080; DIRECT";
+
+function isPrivate(host) {
+	if (!shExpMatch(host, "*.*.*.*") || dnsDomainLevels(host) != 3)
+		return false;
+	return isInNet(host, "10.0.0.0", "255.0.0.0") ||
+		isInNet(host, "172.16.0.0", "255.240.0.0") ||
+		isInNet(host, "192.168.0.0", "255.255.0.0") ||
+		isInNet(host, "127.0.0.0", "255.0.0.0");
+}
+
+function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	if (isPlainHostName(host) || shExpMatch(host, "*.local") || isPrivate(host))
+		return "DIRECT";
+	if (dnsDomainIs(host, ".corp.example.com") ||
+	    localHostOrDomainIs(host, "intranet.example.com"))
+		return "DIRECT";
+	if (url.substring(0, 4) == "ftp:")
+		return "PROXY ftp-proxy.example.com:2121";
+	return fallback;
+}
+`
+
+// schemePAC picks the proxy by scheme with an else if chain and a helper
+// function, and sends CDN hosts direct.
+const schemePAC = `
+function scheme(url) {
+	return url.substring(0, url.indexOf(":"));
+}
+
+function FindProxyForURL(url, host) {
+	var s = scheme(url);
+	if (s === "https" || s === "wss") {
+		return "PROXY secure.example.com:3128";
+	} else if (s == "ftp") {
+		return "DIRECT";
+	} else if (dnsDomainIs(host.toLowerCase(), ".cdn.example.net")) {
+		return "DIRECT";
+	}
+	var port = 3100;
+	return "PROXY web.example.com:" + (port + 28);
+}
+`
+
+func TestFindProxy(t *testing.T) {
+	tests := []struct {
+		name, script, url, host, want string
+	}{
+		{"plain host", corporatePAC, "http://wiki/", "wiki", "DIRECT"},
+		{"local domain", corporatePAC, "http://printer.local/", "printer.local", "DIRECT"},
+		{"private address", corporatePAC, "http://10.1.2.3/", "10.1.2.3", "DIRECT"},
+		{"private range edge", corporatePAC, "http://172.31.255.255/", "172.31.255.255", "DIRECT"},
+		{"intranet domain", corporatePAC, "http://Jira.Corp.Example.com/", "Jira.Corp.Example.com", "DIRECT"},
+		{"intranet host", corporatePAC, "http://intranet/", "intranet", "DIRECT"},
+		{"ftp", corporatePAC, "ftp://files.example.org/x", "files.example.org", "PROXY ftp-proxy.example.com:2121"},
+		{"internet", corporatePAC, "http://8.8.8.8/", "8.8.8.8", "PROXY proxy1.example.com:8080; PROXY proxy2.example.com:8080; DIRECT"},
+		{"scheme", schemePAC, "https://example.org/", "example.org", "PROXY secure.example.com:3128"},
+		{"other scheme", schemePAC, "wss://example.org/", "example.org", "PROXY secure.example.com:3128"},
+		{"else if", schemePAC, "ftp://example.org/", "example.org", "DIRECT"},
+		{"helper domain", schemePAC, "http://img.CDN.example.net/a.png", "img.CDN.example.net", "DIRECT"},
+		{"arithmetic", schemePAC, "http://example.org/", "example.org", "PROXY web.example.com:3128"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := Parse(tt.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := script.FindProxy(tt.url, tt.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("FindProxy(%q, %q) = %q, want %q", tt.url, tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{`"port " + 8080`, "port 8080"},
+		{`1 + 2 + "3"`, "33"},
+		{`"1" + 2 + 3`, "123"},
+		{`10 - "4"`, "6"},
+		{`-(1 - 3)`, "2"},
+		{`0.1 + 0.2`, "0.30000000000000004"},
+		{`"abc" < "abd"`, "true"},
+		{`"10" == 10`, "true"},
+		{`"10" === 10`, "false"},
+		{`null == undefined`, "true"},
+		{`null === undefined`, "false"},
+		{`!"" && !0`, "true"},
+		{`"" || "fallback"`, "fallback"},
+		{`host.length > 5 ? "long" : "short"`, "long"},
+		{`host.toUpperCase()`, "EXAMPLE.COM"},
+		{`host.substring(8, 2)`, "ample."},
+		{`host.substring(8)`, "com"},
+		{`host.indexOf(".") + host.lastIndexOf("m")`, "17"},
+		{`host.charAt(0) + host.charAt(99)`, "e"},
+		{`url.substring(0, url.indexOf("://"))`, "http"},
+		{`dnsDomainLevels("a.b.example.com")`, "3"},
+		{`convert_addr("10.0.0.1")`, "167772161"},
+		{`dnsResolve("192.0.2.1")`, "192.0.2.1"},
+		{`isInNet("192.0.2.1", "192.0.2.0", "255.255.255.0")`, "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			script, err := Parse("function FindProxyForURL(url, host) { return " + tt.expr + "; }")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := script.FindProxy("http://example.com/", "example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopes(t *testing.T) {
+	script, err := Parse(`
+var calls = 0;
+var last;
+
+function remember(host) {
+	var seen = host;
+	calls += 1;
+	last = seen;
+}
+
+function FindProxyForURL(url, host) {
+	remember(host);
+	remember(host + "!");
+	if (leaked()) return "leaked";
+	return last + " " + calls;
+}
+
+function leaked() {
+	return host == "a";
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		// Each call starts from fresh globals, and the parameters of one
+		// function are not visible in another.
+		_, err := script.FindProxy("http://a/", "a")
+		if err == nil || !strings.Contains(err.Error(), "host is not defined") {
+			t.Fatalf("FindProxy error = %v, want host to be undefined in leaked", err)
+		}
+	}
+	script, err = Parse(strings.Replace(corporatePAC, "return fallback;", `fallback = "DIRECT"; return "PROXY once:80";`, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if got, err := script.FindProxy("http://example.org/", "example.org"); err != nil || got != "PROXY once:80" {
+			t.Errorf("call %d = %q, %v, want %q", i, got, err, "PROXY once:80")
+		}
+	}
+}
+
+// offline makes name lookups fail at once for the rest of the test.
+func offline(tb testing.TB) {
+	lookupIP = func(context.Context, string, string) ([]net.IP, error) {
+		return nil, errors.New("offline")
+	}
+	tb.Cleanup(func() { lookupIP = net.DefaultResolver.LookupIP })
+}
+
+func TestShExpMatch(t *testing.T) {
+	tests := []struct {
+		s, pattern string
+		want       bool
+	}{
+		{"", "", true},
+		{"", "*", true},
+		{"a", "", false},
+		{"www.example.com", "*.example.com", true},
+		{"example.com", "*.example.com", false},
+		{"a.b.c.d", "*.*.*.*", true},
+		{"a.b.c", "*.*.*.*", false},
+		{"abc", "a?c", true},
+		{"ac", "a?c", false},
+		{"abcbc", "*bc", true},
+		{"abcbd", "*bc", false},
+		{"mississippi", "m*iss*ppi", true},
+		{"mississippi", "m*iss*ppx", false},
+		{strings.Repeat("a", 1<<16), strings.Repeat("*a", 30) + "b", false},
+	}
+	for _, tt := range tests {
+		if got := shExpMatch(tt.s, tt.pattern); got != tt.want {
+			t.Errorf("shExpMatch(%.20q, %.20q) = %v, want %v", tt.s, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+// TestHostile checks that scripts written to exhaust the parser or the
+// interpreter fail with an error instead of crashing or hanging.
+func TestHostile(t *testing.T) {
+	offline(t)
+	const n = 400_000
+	recurse := func(body string) string {
+		return "function f(n, s) { " + body + " } function FindProxyForURL(url, host) { return f(0, host); }"
+	}
+	tests := []struct {
+		name, script string
+		// parseErr is expected from Parse, runErr from FindProxy.
+		parseErr, runErr string
+	}{
+		{
+			name:     "nested parentheses",
+			script:   "function FindProxyForURL(url, host) { return " + strings.Repeat("(", n) + "1" + strings.Repeat(")", n) + "; }",
+			parseErr: "nested more than",
+		},
+		{
+			name:     "nested blocks",
+			script:   "function FindProxyForURL(url, host) {" + strings.Repeat("{", n) + strings.Repeat("}", n) + "}",
+			parseErr: "nested more than",
+		},
+		{
+			name:     "nested unary operators",
+			script:   "function FindProxyForURL(url, host) { return " + strings.Repeat("!", n) + "1; }",
+			parseErr: "nested more than",
+		},
+		{
+			name:     "nested conditionals",
+			script:   "function FindProxyForURL(url, host) { return " + strings.Repeat("1 ? 1 : ", 10_000) + "1; }",
+			parseErr: "nested more than",
+		},
+		{
+			name:     "nested ifs",
+			script:   "function FindProxyForURL(url, host) { " + strings.Repeat("if (host) ", 10_000) + "return 1; }",
+			parseErr: "nested more than",
+		},
+		{
+			name:   "infinite recursion",
+			script: recurse("return f(n + 1, s);"),
+			runErr: "calls nested more than",
+		},
+		{
+			name:   "mutual recursion",
+			script: "function a() { return b(); } function b() { return a(); } function FindProxyForURL(url, host) { return a(); }",
+			runErr: "calls nested more than",
+		},
+		{
+			name:   "exponential recursion",
+			script: recurse("return n > 60 ? s : f(n + 1, s) && f(n + 1, s);"),
+			runErr: "more than 100000 steps",
+		},
+		{
+			name:   "growing string",
+			script: recurse("return f(n + 1, s + s);"),
+			runErr: "string longer than",
+		},
+		{
+			name:     "loop",
+			script:   "function FindProxyForURL(url, host) { while (true) {} }",
+			parseErr: "while is not supported",
+		},
+		{
+			name:     "for loop",
+			script:   "function FindProxyForURL(url, host) { for (;;) {} }",
+			parseErr: "for is not supported",
+		},
+		{
+			name:     "switch",
+			script:   "function FindProxyForURL(url, host) { switch (host) { default: return 'DIRECT'; } }",
+			parseErr: "switch is not supported",
+		},
+		{
+			name:     "regular expression",
+			script:   "function FindProxyForURL(url, host) { return /a(?=b)/.test(host) ? 'DIRECT' : ''; }",
+			parseErr: `'/' is not supported`,
+		},
+		{
+			name:     "array",
+			script:   "var a = [1]; function FindProxyForURL(url, host) { return 'DIRECT'; }",
+			parseErr: `'[' is not supported`,
+		},
+		{
+			name:     "function expression",
+			script:   "var f = function() {}; function FindProxyForURL(url, host) { return 'DIRECT'; }",
+			parseErr: `unexpected "function"`,
+		},
+		{
+			name:     "nested function",
+			script:   "function FindProxyForURL(url, host) { function g() {} return 'DIRECT'; }",
+			parseErr: "functions must be declared at the top level",
+		},
+		{
+			name:   "calling a variable",
+			script: "var f = 1; function FindProxyForURL(url, host) { return f(); }",
+			runErr: "f is not a function",
+		},
+		{
+			name:   "many lookups",
+			script: recurse("return isInNet(s + n, '10.0.0.0', '255.0.0.0') || f(n + 1, s);"),
+			runErr: "looked up more than 8 names",
+		},
+		{
+			name:   "unknown method",
+			script: "function FindProxyForURL(url, host) { return host.replace('a', 'b'); }",
+			runErr: "method replace is not supported",
+		},
+		{
+			name:   "method of a number",
+			script: "function FindProxyForURL(url, host) { return (1).toLowerCase(); }",
+			runErr: "not a string",
+		},
+		{
+			name:     "file too large",
+			script:   "function FindProxyForURL(url, host) { return 'DIRECT'; }" + strings.Repeat(" ", maxSize),
+			parseErr: "larger than",
+		},
+		{
+			name:   "dateRange",
+			script: "function FindProxyForURL(url, host) { return dateRange('JAN', 'MAR') ? 'DIRECT' : ''; }",
+			runErr: "dateRange is not supported",
+		},
+		{
+			name:     "no FindProxyForURL",
+			script:   "function findProxy(url, host) { return 'DIRECT'; }",
+			parseErr: "FindProxyForURL is not defined",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := Parse(tt.script)
+			if tt.parseErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.parseErr) {
+					t.Fatalf("Parse error = %v, want one containing %q", err, tt.parseErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = script.FindProxy("http://example.com/", "example.com")
+			if err == nil || !strings.Contains(err.Error(), tt.runErr) {
+				t.Fatalf("FindProxy error = %v, want one containing %q", err, tt.runErr)
+			}
+		})
+	}
+}
+
+func TestLongElseIfChain(t *testing.T) {
+	var src strings.Builder
+	src.WriteString("function FindProxyForURL(url, host) {\n\tif (host == 'h0') return 'PROXY p0:80';\n")
+	for i := 1; i < 5000; i++ {
+		src.WriteString("\telse if (host == 'h" + formatNumber(float64(i)) + "') return 'PROXY p" + formatNumber(float64(i)) + ":80';\n")
+	}
+	src.WriteString("\telse return 'DIRECT';\n}\n")
+	script, err := Parse(src.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, want := range map[string]string{"h4999": "PROXY p4999:80", "other": "DIRECT"} {
+		if got, err := script.FindProxy("http://"+host+"/", host); err != nil || got != want {
+			t.Errorf("FindProxy(%q) = %q, %v, want %q", host, got, err, want)
+		}
+	}
+}
+
+func TestProxies(t *testing.T) {
+	tests := []struct {
+		result string
+		want   []string
+	}{
+		{"", []string{"DIRECT"}},
+		{"DIRECT", []string{"DIRECT"}},
+		{"PROXY a:8080; PROXY b:8080; DIRECT", []string{"http://a:8080", "http://b:8080", "DIRECT"}},
+		{"HTTPS secure:443", []string{"https://secure:443"}},
+		{"SOCKS s:1080; SOCKS4 old:1080; SOCKS5 t:1080", []string{"socks5://s:1080", "socks5://t:1080"}},
+	}
+	for _, tt := range tests {
+		proxies, err := Proxies(tt.result)
+		if err != nil {
+			t.Errorf("Proxies(%q): %v", tt.result, err)
+			continue
+		}
+		var got []string
+		for _, p := range proxies {
+			if p == nil {
+				got = append(got, "DIRECT")
+			} else {
+				got = append(got, p.String())
+			}
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("Proxies(%q) = %v, want %v", tt.result, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"PROXY", "GOPHER g:70", "SOCKS4 old:1080"} {
+		if _, err := Proxies(bad); err == nil {
+			t.Errorf("Proxies(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+// FuzzLoad loads arbitrary scripts from a file and runs them, checking that
+// none crashes or hangs. Run it with go test -fuzz FuzzLoad ./internal/pac.
+func FuzzLoad(f *testing.F) {
+	for _, seed := range []string{
+		corporatePAC,
+		schemePAC,
+		"function FindProxyForURL(url, host) { return " + strings.Repeat("(", 5000) + "1" + strings.Repeat(")", 5000) + "; }",
+		"function FindProxyForURL(url, host) { " + strings.Repeat("if (host) ", 5000) + "return 1; }",
+		"function f(n, s) { return f(n + 1, s + s); } function FindProxyForURL(url, host) { return f(0, host); }",
+		"function f(n) { return f(n + 1) && f(n + 1); } function FindProxyForURL(url, host) { return f(0); }",
+		"function FindProxyForURL(url, host) { while (true) {} }",
+		"function FindProxyForURL(url, host) { return '" + strings.Repeat("x", 70000) + "' + host; }",
+		"function FindProxyForURL(url, host) { return host.substring(-1, 1e300) + host.charAt(-5); }",
+		"var a = 'x'; function FindProxyForURL(url, host) { a += a; return a.length; }",
+		"function FindProxyForURL(url, host) { return shExpMatch(host + host + host, '*a*a*a*a*a*a*a*a*b'); }",
+		"function FindProxyForURL(url, host) { return dnsResolve(host + 1) + dnsResolve(host + 2); }",
+	} {
+		f.Add(seed)
+	}
+	offline(f)
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, src string) {
+		path := filepath.Join(dir, "fuzz.pac")
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		script, err := Load(context.Background(), path)
+		if err != nil {
+			return
+		}
+		script.FindProxy("http://192.0.2.1/", "192.0.2.1")
+	})
+}
@@ -0,0 +1,494 @@
+package pac
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	line int
+}
+
+// punctuators lists the operators of the subset, longest first.
+var punctuators = []string{
+	"===", "!==",
+	"==", "!=", "<=", ">=", "&&", "||", "+=",
+	"(", ")", "{", "}", ",", ";", ".", "!", "<", ">", "+", "-", "?", ":", "=",
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], line: line})
+		case isDigit(c):
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			num, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid number %q", line, src[start:i])
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], num: num, line: line})
+		case c == '"' || c == '\'':
+			s, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			tokens = append(tokens, token{kind: tokString, text: s, line: line})
+			i += n
+		default:
+			matched := false
+			for _, p := range punctuators {
+				if strings.HasPrefix(src[i:], p) {
+					tokens = append(tokens, token{kind: tokPunct, text: p, line: line})
+					i += len(p)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				r, _ := utf8.DecodeRuneInString(src[i:])
+				return nil, fmt.Errorf("line %d: %q is not supported", line, r)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, line: line}), nil
+}
+
+// lexString reads the quoted string at the start of src and returns its
+// value and length.
+func lexString(src string) (string, int, error) {
+	quote := src[0]
+	var b strings.Builder
+	for i := 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case c != '\\':
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(src) {
+			break
+		}
+		switch e := src[i]; e {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'x', 'u':
+			size := 2
+			if e == 'u' {
+				size = 4
+			}
+			if i+size >= len(src) {
+				return "", 0, fmt.Errorf("invalid escape in string")
+			}
+			n, err := strconv.ParseUint(src[i+1:i+1+size], 16, 32)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid escape in string")
+			}
+			b.WriteRune(rune(n))
+			i += size
+		case '\n':
+		default:
+			b.WriteByte(e)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// maxDepth bounds how deeply statements and expressions may nest, so that
+// a hostile script cannot exhaust the stack of the parser or interpreter.
+const maxDepth = 100
+
+// parser builds statements from tokens by recursive descent. Syntax errors
+// are raised as jsError and returned by parse.
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+	// funcs are the functions declared at the top level of the script.
+	funcs map[string]*function
+}
+
+// nest enters a nesting level and returns the function that leaves it.
+func (p *parser) nest() func() {
+	p.depth++
+	if p.depth > maxDepth {
+		throw("nested more than %d levels deep", maxDepth)
+	}
+	return func() { p.depth-- }
+}
+
+// parse parses a script into the statements run at its top level and the
+// functions it declares.
+func parse(src string) (body []stmt, funcs map[string]*function, err error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &parser{tokens: tokens, funcs: make(map[string]*function)}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(jsError)
+			if !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("line %d: %s", p.peek().line, e.msg)
+		}
+	}()
+	for p.peek().kind != tokEOF {
+		if p.accept("function") {
+			fn := p.function()
+			if _, ok := p.funcs[fn.name]; ok {
+				throw("function %s is declared twice", fn.name)
+			}
+			p.funcs[fn.name] = fn
+			continue
+		}
+		body = append(body, p.statement())
+	}
+	return body, p.funcs, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the next token is the punctuator or keyword text.
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokPunct || t.kind == tokIdent) && t.text == text
+}
+
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) {
+	if !p.accept(text) {
+		p.unexpected()
+	}
+}
+
+func (p *parser) unexpected() {
+	t := p.peek()
+	if t.kind == tokEOF {
+		throw("unexpected end of script")
+	}
+	if unsupported[t.text] && t.kind == tokIdent {
+		throw("%s is not supported", t.text)
+	}
+	throw("unexpected %q", t.text)
+}
+
+func (p *parser) identifier() string {
+	if t := p.peek(); t.kind != tokIdent || keywords[t.text] || unsupported[t.text] {
+		p.unexpected()
+	}
+	return p.next().text
+}
+
+var keywords = map[string]bool{
+	"var": true, "let": true, "const": true, "function": true, "if": true, "else": true,
+	"return": true, "true": true, "false": true, "null": true, "undefined": true,
+}
+
+// unsupported are the JavaScript keywords outside the subset.
+var unsupported = map[string]bool{
+	"for": true, "while": true, "do": true, "switch": true, "case": true, "default": true,
+	"break": true, "continue": true, "new": true, "typeof": true, "this": true,
+	"try": true, "catch": true, "throw": true, "delete": true, "in": true, "instanceof": true,
+}
+
+// endStatement consumes the semicolon ending a statement, which may be
+// left out before a closing brace, at the end of the script or at the end
+// of a line.
+func (p *parser) endStatement() {
+	if p.accept(";") || p.is("}") || p.peek().kind == tokEOF {
+		return
+	}
+	if p.pos > 0 && p.tokens[p.pos-1].line < p.peek().line {
+		return
+	}
+	p.unexpected()
+}
+
+func (p *parser) statement() stmt {
+	defer p.nest()()
+	switch {
+	case p.accept(";"):
+		return blockStmt{}
+	case p.is("{"):
+		return blockStmt{p.block()}
+	case p.accept("var"), p.accept("let"), p.accept("const"):
+		var st varStmt
+		for {
+			d := varDecl{name: p.identifier()}
+			if p.accept("=") {
+				d.init = p.expression()
+			}
+			st.decls = append(st.decls, d)
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.endStatement()
+		return st
+	case p.is("function"):
+		throw("functions must be declared at the top level")
+	case p.accept("if"):
+		p.expect("(")
+		st := ifStmt{cond: p.expression()}
+		p.expect(")")
+		st.then = p.statement()
+		if p.accept("else") {
+			// The else branch is at the level of the if, so that long
+			// else if chains are not limited.
+			p.depth--
+			st.otherwise = p.statement()
+			p.depth++
+		}
+		return st
+	case p.accept("return"):
+		var st returnStmt
+		if !p.is(";") && !p.is("}") && p.peek().kind != tokEOF && p.peek().line == p.tokens[p.pos-1].line {
+			st.x = p.expression()
+		}
+		p.endStatement()
+		return st
+	}
+	if t := p.peek(); t.kind == tokIdent && !keywords[t.text] && !unsupported[t.text] {
+		if op := p.tokens[p.pos+1]; op.kind == tokPunct && (op.text == "=" || op.text == "+=") {
+			p.pos += 2
+			st := assignStmt{name: t.text, add: op.text == "+=", x: p.expression()}
+			p.endStatement()
+			return st
+		}
+	}
+	st := exprStmt{p.expression()}
+	p.endStatement()
+	return st
+}
+
+func (p *parser) block() []stmt {
+	p.expect("{")
+	var body []stmt
+	for !p.accept("}") {
+		if p.peek().kind == tokEOF {
+			p.unexpected()
+		}
+		body = append(body, p.statement())
+	}
+	return body
+}
+
+// function parses a function declaration after its keyword.
+func (p *parser) function() *function {
+	fn := &function{name: p.identifier()}
+	p.expect("(")
+	for !p.accept(")") {
+		if len(fn.params) > 0 {
+			p.expect(",")
+		}
+		fn.params = append(fn.params, p.identifier())
+	}
+	fn.body = p.block()
+	return fn
+}
+
+func (p *parser) expression() expr {
+	defer p.nest()()
+	x := p.binary(0)
+	if !p.accept("?") {
+		return x
+	}
+	then := p.expression()
+	p.expect(":")
+	return condExpr{cond: x, then: then, otherwise: p.expression()}
+}
+
+// precedence lists the binary operators from the loosest to the tightest.
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "===", "!=="},
+	{"<", ">", "<=", ">="},
+	{"+", "-"},
+}
+
+func (p *parser) binary(level int) expr {
+	if level == len(precedence) {
+		return p.unary()
+	}
+	x := p.binary(level + 1)
+	for {
+		op, ok := p.operator(precedence[level])
+		if !ok {
+			return x
+		}
+		x = binaryExpr{op: op, l: x, r: p.binary(level + 1)}
+	}
+}
+
+func (p *parser) operator(ops []string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokPunct {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) unary() expr {
+	for _, op := range []string{"!", "-"} {
+		if p.accept(op) {
+			defer p.nest()()
+			return unaryExpr{op: op, x: p.unary()}
+		}
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() expr {
+	x := p.primary()
+	for {
+		switch {
+		case p.accept("."):
+			name := p.identifier()
+			if p.accept("(") {
+				x = methodExpr{x: x, name: name, args: p.arguments()}
+			} else if name == "length" {
+				x = lengthExpr{x}
+			} else {
+				throw("property %s is not supported", name)
+			}
+		case p.is("("):
+			id, ok := x.(ident)
+			if !ok {
+				throw("only named functions can be called")
+			}
+			p.pos++
+			x = callExpr{name: id.name, args: p.arguments()}
+		default:
+			return x
+		}
+	}
+}
+
+// arguments parses the arguments of a call after its opening parenthesis.
+func (p *parser) arguments() []expr {
+	var args []expr
+	for !p.accept(")") {
+		if len(args) > 0 {
+			p.expect(",")
+		}
+		args = append(args, p.expression())
+	}
+	return args
+}
+
+func (p *parser) primary() expr {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.pos++
+		return literal{t.num}
+	case tokString:
+		p.pos++
+		return literal{t.text}
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			p.pos++
+			return literal{t.text == "true"}
+		case "null":
+			p.pos++
+			return literal{null{}}
+		case "undefined":
+			p.pos++
+			return literal{nil}
+		}
+		return ident{p.identifier()}
+	case tokPunct:
+		if p.accept("(") {
+			x := p.expression()
+			p.expect(")")
+			return x
+		}
+	}
+	p.unexpected()
+	return nil
+}
@@ -0,0 +1,507 @@
+package pac
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxSteps bounds the statements and calls one evaluation may run, so
+	// that a script recursing in many branches cannot hang a request.
+	maxSteps = 100_000
+	// maxCallDepth bounds the calls in progress, so that a script recursing
+	// without end cannot exhaust the stack.
+	maxCallDepth = 100
+	// maxStringLength bounds the strings built by concatenation, so that a
+	// script cannot exhaust memory within its steps.
+	maxStringLength = 64 << 10
+)
+
+// The interpreter covers the subset of JavaScript that PAC files are
+// usually written in: top-level function declarations, var, assignment,
+// if, else and return, string, number and boolean values, the operators
+// !, -, +, &&, ||, ?:, comparisons and equality, the length of strings
+// and their toLowerCase, toUpperCase, indexOf, lastIndexOf, charAt and
+// substring methods. There are no loops, so every evaluation ends.
+// Values are nil (undefined), null, bool, float64 or string.
+
+type null struct{}
+
+type value interface{}
+
+type function struct {
+	name   string
+	params []string
+	body   []stmt
+}
+
+type builtin func(args []value) value
+
+// jsError is raised with panic while evaluating and recovered at the
+// script's entry points.
+type jsError struct{ msg string }
+
+func throw(format string, args ...any) {
+	panic(jsError{fmt.Sprintf(format, args...)})
+}
+
+// run is the state of one evaluation.
+type run struct {
+	globals  map[string]value
+	funcs    map[string]*function
+	builtins map[string]builtin
+	steps    int
+	depth    int
+}
+
+func (r *run) step() {
+	r.steps++
+	if r.steps > maxSteps {
+		throw("script ran for more than %d steps", maxSteps)
+	}
+}
+
+// frame holds the parameters and variables of a function call, or is nil
+// at the top level.
+type frame map[string]value
+
+type scope struct {
+	run    *run
+	locals frame
+}
+
+func (s scope) lookup(name string) value {
+	if v, ok := s.locals[name]; ok {
+		return v
+	}
+	if v, ok := s.run.globals[name]; ok {
+		return v
+	}
+	throw("%s is not defined", name)
+	return nil
+}
+
+// assign sets name where it is declared, or globally if it is not.
+func (s scope) assign(name string, v value) {
+	if _, ok := s.locals[name]; ok {
+		s.locals[name] = v
+		return
+	}
+	s.run.globals[name] = v
+}
+
+// declare sets name in the function's variables, or globally at the top
+// level.
+func (s scope) declare(name string, v value) {
+	if s.locals != nil {
+		s.locals[name] = v
+		return
+	}
+	s.run.globals[name] = v
+}
+
+// call calls the script's function or the PAC function name.
+func (s scope) call(name string, args []value) value {
+	s.run.step()
+	if fn, ok := s.run.funcs[name]; ok {
+		return s.run.callFunction(fn, args)
+	}
+	if fn, ok := s.run.builtins[name]; ok {
+		return fn(args)
+	}
+	if _, ok := s.run.globals[name]; ok {
+		throw("%s is not a function", name)
+	}
+	throw("%s is not defined", name)
+	return nil
+}
+
+func (r *run) callFunction(fn *function, args []value) value {
+	r.depth++
+	if r.depth > maxCallDepth {
+		throw("calls nested more than %d levels deep", maxCallDepth)
+	}
+	defer func() { r.depth-- }()
+	locals := make(frame, len(fn.params))
+	for i, param := range fn.params {
+		var arg value
+		if i < len(args) {
+			arg = args[i]
+		}
+		locals[param] = arg
+	}
+	_, v := execAll(scope{run: r, locals: locals}, fn.body)
+	return v
+}
+
+// Statements.
+
+type stmt interface {
+	// exec runs the statement and reports whether it returned, and what.
+	exec(s scope) (bool, value)
+}
+
+type (
+	exprStmt  struct{ x expr }
+	varStmt   struct{ decls []varDecl }
+	blockStmt struct{ body []stmt }
+	ifStmt    struct {
+		cond            expr
+		then, otherwise stmt
+	}
+	assignStmt struct {
+		name string
+		add  bool
+		x    expr
+	}
+	returnStmt struct{ x expr }
+)
+
+type varDecl struct {
+	name string
+	init expr
+}
+
+func (st exprStmt) exec(s scope) (bool, value) {
+	st.x.eval(s)
+	return false, nil
+}
+
+func (st varStmt) exec(s scope) (bool, value) {
+	for _, d := range st.decls {
+		var v value
+		if d.init != nil {
+			v = d.init.eval(s)
+		}
+		s.declare(d.name, v)
+	}
+	return false, nil
+}
+
+func (st blockStmt) exec(s scope) (bool, value) {
+	return execAll(s, st.body)
+}
+
+func execAll(s scope, body []stmt) (bool, value) {
+	for _, st := range body {
+		s.run.step()
+		if returned, v := st.exec(s); returned {
+			return true, v
+		}
+	}
+	return false, nil
+}
+
+func (st ifStmt) exec(s scope) (bool, value) {
+	if truthy(st.cond.eval(s)) {
+		return st.then.exec(s)
+	}
+	if st.otherwise != nil {
+		return st.otherwise.exec(s)
+	}
+	return false, nil
+}
+
+func (st assignStmt) exec(s scope) (bool, value) {
+	v := st.x.eval(s)
+	if st.add {
+		v = add(s.lookup(st.name), v)
+	}
+	s.assign(st.name, v)
+	return false, nil
+}
+
+func (st returnStmt) exec(s scope) (bool, value) {
+	if st.x == nil {
+		return true, nil
+	}
+	return true, st.x.eval(s)
+}
+
+// Expressions.
+
+type expr interface {
+	eval(s scope) value
+}
+
+type (
+	literal   struct{ v value }
+	ident     struct{ name string }
+	unaryExpr struct {
+		op string
+		x  expr
+	}
+	binaryExpr struct {
+		op   string
+		l, r expr
+	}
+	condExpr   struct{ cond, then, otherwise expr }
+	lengthExpr struct{ x expr }
+	callExpr   struct {
+		name string
+		args []expr
+	}
+	methodExpr struct {
+		x    expr
+		name string
+		args []expr
+	}
+)
+
+func (e literal) eval(scope) value { return e.v }
+
+func (e ident) eval(s scope) value { return s.lookup(e.name) }
+
+func (e unaryExpr) eval(s scope) value {
+	v := e.x.eval(s)
+	if e.op == "!" {
+		return !truthy(v)
+	}
+	return -toNumber(v)
+}
+
+func (e binaryExpr) eval(s scope) value {
+	switch e.op {
+	case "&&":
+		if l := e.l.eval(s); !truthy(l) {
+			return l
+		}
+		return e.r.eval(s)
+	case "||":
+		if l := e.l.eval(s); truthy(l) {
+			return l
+		}
+		return e.r.eval(s)
+	}
+	l, r := e.l.eval(s), e.r.eval(s)
+	switch e.op {
+	case "+":
+		return add(l, r)
+	case "-":
+		return toNumber(l) - toNumber(r)
+	case "==":
+		return looseEqual(l, r)
+	case "!=":
+		return !looseEqual(l, r)
+	case "===":
+		return l == r
+	case "!==":
+		return l != r
+	}
+	if ls, ok := l.(string); ok {
+		if rs, ok := r.(string); ok {
+			return compare(e.op, strings.Compare(ls, rs))
+		}
+	}
+	ln, rn := toNumber(l), toNumber(r)
+	if math.IsNaN(ln) || math.IsNaN(rn) {
+		return false
+	}
+	c := 0
+	if ln < rn {
+		c = -1
+	} else if ln > rn {
+		c = 1
+	}
+	return compare(e.op, c)
+}
+
+// compare applies the relational operator op to the result c of a
+// three-way comparison.
+func compare(op string, c int) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case ">":
+		return c > 0
+	case "<=":
+		return c <= 0
+	}
+	return c >= 0
+}
+
+// add adds numbers or concatenates strings, like JavaScript's + operator.
+func add(l, r value) value {
+	_, ls := l.(string)
+	_, rs := r.(string)
+	if !ls && !rs {
+		return toNumber(l) + toNumber(r)
+	}
+	a, b := toString(l), toString(r)
+	if len(a)+len(b) > maxStringLength {
+		throw("string longer than %d bytes", maxStringLength)
+	}
+	return a + b
+}
+
+func (e condExpr) eval(s scope) value {
+	if truthy(e.cond.eval(s)) {
+		return e.then.eval(s)
+	}
+	return e.otherwise.eval(s)
+}
+
+func (e lengthExpr) eval(s scope) value {
+	str, ok := e.x.eval(s).(string)
+	if !ok {
+		throw("length of a value that is not a string")
+	}
+	return float64(len(str))
+}
+
+func (e callExpr) eval(s scope) value {
+	args := make([]value, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg.eval(s)
+	}
+	return s.call(e.name, args)
+}
+
+func (e methodExpr) eval(s scope) value {
+	s.run.step()
+	v := e.x.eval(s)
+	str, ok := v.(string)
+	if !ok {
+		throw("%s called on %s, not a string", e.name, toString(v))
+	}
+	args := make([]value, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg.eval(s)
+	}
+	// index returns argument i as an index into str, or def if it is
+	// missing.
+	index := func(i, def int) int {
+		if i >= len(args) || args[i] == nil {
+			return def
+		}
+		f := toNumber(args[i])
+		switch {
+		case math.IsNaN(f) || f < 0:
+			return 0
+		case f > float64(len(str)):
+			return len(str)
+		}
+		return int(f)
+	}
+	search := func() string {
+		if len(args) == 0 {
+			return "undefined"
+		}
+		return toString(args[0])
+	}
+	switch e.name {
+	case "toLowerCase":
+		return strings.ToLower(str)
+	case "toUpperCase":
+		return strings.ToUpper(str)
+	case "indexOf":
+		return float64(strings.Index(str, search()))
+	case "lastIndexOf":
+		return float64(strings.LastIndex(str, search()))
+	case "charAt":
+		if i := index(0, 0); i < len(str) {
+			return str[i : i+1]
+		}
+		return ""
+	case "substring":
+		start, end := index(0, 0), index(1, len(str))
+		if start > end {
+			start, end = end, start
+		}
+		return str[start:end]
+	}
+	throw("method %s is not supported", e.name)
+	return nil
+}
+
+// Conversions.
+
+func truthy(v value) bool {
+	switch v := v.(type) {
+	case nil, null:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+func toNumber(v value) float64 {
+	switch v := v.(type) {
+	case null:
+		return 0
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return v
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 0
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return math.NaN()
+}
+
+func toString(v value) string {
+	switch v := v.(type) {
+	case nil:
+		return "undefined"
+	case null:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return formatNumber(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// formatNumber formats f like JavaScript's Number.prototype.toString.
+func formatNumber(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+	if abs := math.Abs(f); abs >= 1e21 || abs < 1e-6 {
+		s := strconv.FormatFloat(f, 'e', -1, 64)
+		mantissa, exp, _ := strings.Cut(s, "e")
+		sign, digits := exp[:1], strings.TrimLeft(exp[1:], "0")
+		return mantissa + "e" + sign + digits
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func looseEqual(a, b value) bool {
+	aNull := a == nil || a == (null{})
+	bNull := b == nil || b == (null{})
+	if aNull || bNull {
+		return aNull && bNull
+	}
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			return as == bs
+		}
+	}
+	return toNumber(a) == toNumber(b)
+}
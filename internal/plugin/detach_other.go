@@ -0,0 +1,7 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package plugin
+
+import "os/exec"
+
+func detach(cmd *exec.Cmd) {}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package plugin
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach puts cmd in its own process group, so that a Ctrl-C meant for
+// dataconsumer does not kill a sink plugin before it gets the final stats.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,349 @@
+// Package plugin runs configured external programs as source protocols and
+// metrics sinks, so proprietary integrations need no fork.
+//
+// Plugins speak JSON lines over stdio. A source plugin is started for
+// every request with one line on stdin,
+//
+//	{"version":1,"source":{...}}
+//
+// holding the configured source, and writes the body to stdout; exiting
+// non-zero fails the request with the plugin's stderr as the error. A sink
+// plugin is started once per session and reads one line per rate sample,
+//
+//	{"version":1,"event":"sample","stats":{...}}
+//
+// then a final "close" event with the final stats before its stdin is
+// closed. Samples are dropped while a sink plugin is not reading them.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/consumer"
+	"dataconsumer/pkg/metrics"
+)
+
+// Version is the protocol version sent in every message.
+const Version = 1
+
+// closeTimeout is how long a sink plugin may take to read its last events
+// and exit before it is killed. Tests shorten it.
+var closeTimeout = 10 * time.Second
+
+// sinkQueue is how many events may wait for a sink plugin to read them.
+// Samples beyond it are dropped, so a plugin that stops reading cannot
+// hold up the metrics.
+const sinkQueue = 16
+
+// maxStderr bounds the stderr kept for error messages.
+const maxStderr = 4096
+
+// RegisterSources registers every source plugin as the protocol named
+// after it. It is called once, with the plugins of the loaded config.
+func RegisterSources(plugins []configs.Plugin) error {
+	for _, p := range plugins {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, p := range plugins {
+		if p.Kind != configs.SourcePlugin {
+			continue
+		}
+		p := p
+		consumer.RegisterProtocol(p.Name, func(config configs.Source) (consumer.Source, error) {
+			return &source{plugin: p, config: config}, nil
+		})
+	}
+	return nil
+}
+
+// StartSinks starts the sink plugins and adds them to collector. Plugins
+// that fail to start are returned as an error and skipped.
+func StartSinks(plugins []configs.Plugin, collector *metrics.Collector) error {
+	var errs []error
+	for _, p := range plugins {
+		if p.Kind != configs.SinkPlugin {
+			continue
+		}
+		sink, err := newSink(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		collector.AddSink(sink)
+	}
+	return errors.Join(errs...)
+}
+
+func command(ctx context.Context, p configs.Plugin) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Env = os.Environ()
+	for name, value := range p.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+	return cmd
+}
+
+// stderrBuffer keeps the start of a plugin's stderr.
+type stderrBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *stderrBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := maxStderr - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *stderrBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.TrimSpace(b.buf.String())
+}
+
+// exitError describes a plugin that exited with err.
+func exitError(p configs.Plugin, err error, stderr *stderrBuffer) error {
+	if msg := stderr.String(); msg != "" {
+		return fmt.Errorf("plugin %s: %v: %s", p.Name, err, msg)
+	}
+	return fmt.Errorf("plugin %s: %w", p.Name, err)
+}
+
+// source runs the plugin for each request.
+type source struct {
+	plugin configs.Plugin
+	config configs.Source
+}
+
+func (s *source) Config() configs.Source {
+	return s.config
+}
+
+func (s *source) Open(ctx context.Context) (io.ReadCloser, error) {
+	request, err := json.Marshal(struct {
+		Version int            `json:"version"`
+		Source  configs.Source `json:"source"`
+	}{Version, s.config})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := command(ctx, s.plugin)
+	cmd.Stdin = bytes.NewReader(append(request, '\n'))
+	stderr := &stderrBuffer{}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("plugin %s: %w", s.plugin.Name, err)
+	}
+	return &body{plugin: s.plugin, cmd: cmd, stdout: stdout, stderr: stderr, cancel: cancel}, nil
+}
+
+// body is the stdout of a source plugin. Reading to the end reports a
+// failed exit; closing early kills the plugin.
+type body struct {
+	plugin configs.Plugin
+	cmd    *exec.Cmd
+	stdout io.Reader
+	stderr *stderrBuffer
+	cancel context.CancelFunc
+	once   sync.Once
+	err    error
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.stdout.Read(p)
+	if err == io.EOF {
+		if waitErr := b.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (b *body) Close() error {
+	b.cancel()
+	b.wait()
+	return nil
+}
+
+// wait reaps the plugin once and returns how it exited.
+func (b *body) wait() error {
+	b.once.Do(func() {
+		if err := b.cmd.Wait(); err != nil {
+			b.err = exitError(b.plugin, err, b.stderr)
+		}
+		b.cancel()
+	})
+	return b.err
+}
+
+// sink sends the stats of a session to a long-running plugin. Events are
+// written to its stdin by a goroutine of their own.
+type sink struct {
+	plugin  configs.Plugin
+	cmd     *exec.Cmd
+	stderr  *stderrBuffer
+	lines   chan []byte
+	written chan struct{}
+	exited  chan struct{}
+	err     error
+
+	mu       sync.Mutex
+	writeErr error
+}
+
+func newSink(p configs.Plugin) (*sink, error) {
+	cmd := command(context.Background(), p)
+	detach(cmd)
+	stderr := &stderrBuffer{}
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+	}
+	s := &sink{
+		plugin:  p,
+		cmd:     cmd,
+		stderr:  stderr,
+		lines:   make(chan []byte, sinkQueue),
+		written: make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	go s.write(stdin)
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			s.err = exitError(p, err, stderr)
+		}
+		close(s.exited)
+	}()
+	return s, nil
+}
+
+// write writes the queued events to stdin until the queue is closed, then
+// closes stdin. Events after a failed write are discarded.
+func (s *sink) write(stdin io.WriteCloser) {
+	defer close(s.written)
+	for line := range s.lines {
+		if s.failed() != nil {
+			continue
+		}
+		if _, err := stdin.Write(line); err != nil {
+			s.mu.Lock()
+			s.writeErr = err
+			s.mu.Unlock()
+		}
+	}
+	stdin.Close()
+}
+
+// failed returns the error of the last write, explained by the plugin's
+// exit if it has exited.
+func (s *sink) failed() error {
+	s.mu.Lock()
+	err := s.writeErr
+	s.mu.Unlock()
+	if err == nil {
+		return nil
+	}
+	select {
+	case <-s.exited:
+		if s.err != nil {
+			return s.err
+		}
+	default:
+	}
+	return fmt.Errorf("plugin %s: %w", s.plugin.Name, err)
+}
+
+func (s *sink) line(event string, stats metrics.Stats) ([]byte, error) {
+	line, err := json.Marshal(struct {
+		Version int           `json:"version"`
+		Event   string        `json:"event"`
+		Stats   metrics.Stats `json:"stats"`
+	}{Version, event, stats})
+	return append(line, '\n'), err
+}
+
+// Sample queues a sample, or drops it if the plugin is not keeping up.
+func (s *sink) Sample(stats metrics.Stats) error {
+	if err := s.failed(); err != nil {
+		return err
+	}
+	line, err := s.line("sample", stats)
+	if err != nil {
+		return err
+	}
+	select {
+	case s.lines <- line:
+		return nil
+	default:
+		return fmt.Errorf("plugin %s: not reading its input, sample dropped", s.plugin.Name)
+	}
+}
+
+// Close sends the final stats and waits up to closeTimeout for the plugin
+// to read them and exit, then kills it.
+func (s *sink) Close(final metrics.Stats) error {
+	deadline := time.NewTimer(closeTimeout)
+	defer deadline.Stop()
+	line, err := s.line("close", final)
+	if err == nil {
+		select {
+		case s.lines <- line:
+		case <-deadline.C:
+			err = fmt.Errorf("plugin %s: not reading its input, final stats dropped", s.plugin.Name)
+		}
+	}
+	close(s.lines)
+	if err == nil {
+		select {
+		case <-s.exited:
+		case <-deadline.C:
+			err = fmt.Errorf("plugin %s: still running %s after its input was closed, killed", s.plugin.Name, closeTimeout)
+		}
+	}
+	// Killing the plugin also ends a write it is not reading.
+	select {
+	case <-s.exited:
+	default:
+		s.cmd.Process.Kill()
+		<-s.exited
+	}
+	<-s.written
+	if err != nil {
+		return err
+	}
+	if err := s.failed(); err != nil {
+		return err
+	}
+	return s.err
+}
@@ -0,0 +1,160 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/metrics"
+)
+
+// shell returns a plugin running script with sh, skipping the test where
+// there is no sh.
+func shell(t *testing.T, kind, script string) configs.Plugin {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are tested with sh")
+	}
+	return configs.Plugin{Name: "test", Kind: kind, Command: []string{"sh", "-c", script}}
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name, script string
+		want         string
+		wantErr      string
+	}{
+		{name: "body", script: `read request; echo "$request"`, want: `{"version":1,"source":"test://a"}`},
+		{name: "exit status", script: `echo partial; echo "no such object" >&2; exit 3`, want: "partial", wantErr: "plugin test: exit status 3: no such object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &source{plugin: shell(t, configs.SourcePlugin, tt.script), config: configs.Source{URL: "test://a"}}
+			body, err := s.Open(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+			data, err := io.ReadAll(body)
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("body = %q, want it to contain %q", data, tt.want)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("read error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("read error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSourceCloseKills(t *testing.T) {
+	s := &source{plugin: shell(t, configs.SourcePlugin, `echo start; exec sleep 60`)}
+	body, err := s.Open(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := body.Read(make([]byte, 6)); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	body.Close()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Close took %s", elapsed)
+	}
+}
+
+func TestSink(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "events")
+	p := shell(t, configs.SinkPlugin, `cat > "$OUT"`)
+	p.Env = map[string]string{"OUT": out}
+	s, err := newSink(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sample(metrics.Stats{BytesTransferred: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(metrics.Stats{BytesTransferred: 2}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 ||
+		!strings.HasPrefix(lines[0], `{"version":1,"event":"sample","stats":{"BytesTransferred":1,`) ||
+		!strings.HasPrefix(lines[1], `{"version":1,"event":"close","stats":{"BytesTransferred":2,`) {
+		t.Errorf("events =\n%s", data)
+	}
+}
+
+func TestSinkExitError(t *testing.T) {
+	s, err := newSink(shell(t, configs.SinkPlugin, `echo "bad credentials" >&2; exit 1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Close(metrics.Stats{})
+	if err == nil || !strings.Contains(err.Error(), "bad credentials") {
+		t.Errorf("Close error = %v, want one containing the plugin's stderr", err)
+	}
+}
+
+// TestSinkNotReading checks that a plugin that never reads its stdin
+// neither blocks the samples nor the final Close.
+func TestSinkNotReading(t *testing.T) {
+	defer func(timeout time.Duration) { closeTimeout = timeout }(closeTimeout)
+	closeTimeout = 200 * time.Millisecond
+
+	s, err := newSink(shell(t, configs.SinkPlugin, `exec sleep 60`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough samples to fill the pipe as well as the queue.
+	stats := metrics.Stats{RunID: strings.Repeat("x", 64<<10)}
+	start := time.Now()
+	var dropped error
+	for i := 0; i < 4*sinkQueue; i++ {
+		if err := s.Sample(stats); err != nil {
+			dropped = err
+		}
+	}
+	if dropped == nil || !strings.Contains(dropped.Error(), "sample dropped") {
+		t.Errorf("Sample error = %v, want dropped samples", dropped)
+	}
+	if err := s.Close(metrics.Stats{}); err == nil {
+		t.Error("Close of a plugin not reading its input succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("samples and Close took %s", elapsed)
+	}
+}
+
+func TestCollectorStopWithSinkNotReading(t *testing.T) {
+	defer func(timeout time.Duration) { closeTimeout = timeout }(closeTimeout)
+	closeTimeout = 200 * time.Millisecond
+
+	collector := metrics.NewCollector()
+	if err := StartSinks([]configs.Plugin{shell(t, configs.SinkPlugin, `exec sleep 60`)}, collector); err != nil {
+		t.Fatal(err)
+	}
+	collector.Start()
+	stopped := make(chan struct{})
+	go func() {
+		collector.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+}
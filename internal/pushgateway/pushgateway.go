@@ -0,0 +1,131 @@
+// Package pushgateway pushes session metrics to a Prometheus Pushgateway,
+// for runs too short-lived to be scraped.
+package pushgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"dataconsumer/pkg/metrics"
+)
+
+// Pusher pushes to one grouping key of a Pushgateway.
+type Pusher struct {
+	url    string
+	client *http.Client
+}
+
+// New returns a pusher for the Pushgateway at baseURL that groups the
+// metrics under job and the given labels.
+func New(baseURL, job string, labels map[string]string) *Pusher {
+	path := "/metrics/" + pathSegment("job", job)
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path += "/" + pathSegment(name, labels[name])
+	}
+	return &Pusher{
+		url:    strings.TrimSuffix(baseURL, "/") + path,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// pathSegment encodes one label of the grouping key. Values the URL path
+// cannot carry verbatim use the Pushgateway's base64 form.
+func pathSegment(name, value string) string {
+	if value == "" || strings.Contains(value, "/") {
+		encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+		if encoded == "" {
+			encoded = "="
+		}
+		return name + "@base64/" + encoded
+	}
+	return name + "/" + url.PathEscape(value)
+}
+
+// Push replaces the metrics of the grouping key with stats. running tells
+// whether the session is still in progress.
+func (p *Pusher) Push(ctx context.Context, stats metrics.Stats, running bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.url, bytes.NewReader(format(stats, running)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Sink is a metrics.Sink pushing a collector's stats.
+type Sink struct {
+	pusher   *Pusher
+	interval time.Duration
+	last     time.Time
+}
+
+// Sink returns a sink that pushes at the first sample at least interval
+// after the previous push, and pushes the final stats when the collector
+// stops. A zero interval only pushes the final stats.
+func (p *Pusher) Sink(interval time.Duration) *Sink {
+	return &Sink{pusher: p, interval: interval, last: time.Now()}
+}
+
+func (s *Sink) Sample(stats metrics.Stats) error {
+	if s.interval <= 0 || time.Since(s.last) < s.interval {
+		return nil
+	}
+	s.last = time.Now()
+	return s.push(stats, true)
+}
+
+func (s *Sink) Close(final metrics.Stats) error {
+	return s.push(final, false)
+}
+
+func (s *Sink) push(stats metrics.Stats, running bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.pusher.Push(ctx, stats, running)
+}
+
+// format renders stats in the Prometheus text exposition format.
+func format(stats metrics.Stats, running bool) []byte {
+	var b bytes.Buffer
+	metric := func(name, kind, help string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+	}
+	up := 0.0
+	if running {
+		up = 1
+	}
+	const mib = 1024 * 1024
+	metric("dataconsumer_bytes_total", "counter", "Bytes consumed in the session.", float64(stats.BytesTransferred))
+	metric("dataconsumer_rate_bytes_per_second", "gauge", "Current consumption rate.", stats.CurrentRate*mib/60)
+	metric("dataconsumer_average_rate_bytes_per_second", "gauge", "Average consumption rate of the session.", stats.AverageRate*mib/60)
+	metric("dataconsumer_peak_rate_bytes_per_second", "gauge", "Peak consumption rate of the session.", stats.PeakRate*mib/60)
+	metric("dataconsumer_session_duration_seconds", "gauge", "Time since the session started.", stats.ElapsedTime.Seconds())
+	metric("dataconsumer_session_running", "gauge", "Whether the session was still running at the time of the push.", up)
+	metric("dataconsumer_last_push_timestamp_seconds", "gauge", "Unix time of this push.", float64(time.Now().UnixNano())/1e9)
+	if stats.RunID != "" {
+		fmt.Fprintf(&b, "# HELP dataconsumer_run_info The run the metrics are from.\n# TYPE dataconsumer_run_info gauge\ndataconsumer_run_info{run_id=%q} 1\n", stats.RunID)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,88 @@
+package quota
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// NewHTTPHandler exposes the coordinator:
+//
+//	POST /quota   report progress, body {"instance": "...", "bytes": N}
+//	GET  /quota   combined progress
+func NewHTTPHandler(c *Coordinator) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/quota", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, c.Status())
+		case http.MethodPost:
+			var report Report
+			if err := json.NewDecoder(r.Body).Decode(&report); err != nil || report.Instance == "" {
+				http.Error(w, "expected {\"instance\": ..., \"bytes\": ...}", http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, http.StatusOK, c.Report(report))
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Client reports an instance's progress to a coordinator.
+type Client struct {
+	url      string
+	instance string
+	client   *http.Client
+}
+
+// NewClient returns a client for the coordinator at baseURL, e.g.
+// http://10.0.0.5:9300, reporting as instance. client may be nil for
+// http.DefaultClient.
+func NewClient(baseURL, instance string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{
+		url:      strings.TrimSuffix(baseURL, "/") + "/quota",
+		instance: instance,
+		client:   client,
+	}
+}
+
+// Report sends the instance's cumulative byte count and returns its grant.
+func (c *Client) Report(ctx context.Context, bytesTransferred int64) (Grant, error) {
+	body, err := json.Marshal(Report{Instance: c.instance, Bytes: bytesTransferred})
+	if err != nil {
+		return Grant{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return Grant{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Grant{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Grant{}, fmt.Errorf("coordinator returned %s", resp.Status)
+	}
+	var grant Grant
+	if err := json.NewDecoder(resp.Body).Decode(&grant); err != nil {
+		return Grant{}, err
+	}
+	return grant, nil
+}
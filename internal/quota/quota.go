@@ -0,0 +1,103 @@
+// Package quota shares one data cap and bandwidth ceiling between several
+// dataconsumer instances on the same connection. One process runs the
+// Coordinator and every instance reports its progress to it with a Client,
+// receiving its share of the limits in return.
+package quota
+
+import (
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// Limits are the combined limits of all instances. Zero values disable the
+// corresponding limit.
+type Limits struct {
+	MaxData      configs.Size `json:"max_data,omitempty"`
+	MaxBandwidth configs.Rate `json:"max_bandwidth,omitempty"`
+	TargetRate   configs.Rate `json:"target_rate,omitempty"`
+}
+
+// Report is an instance's cumulative progress.
+type Report struct {
+	Instance string `json:"instance"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// Grant is the coordinator's answer to a Report.
+type Grant struct {
+	// RateLimit and TargetRate are this instance's share of the combined
+	// ceiling and target; zero means unlimited or unset.
+	RateLimit  configs.Rate `json:"rate_limit,omitempty"`
+	TargetRate configs.Rate `json:"target_rate,omitempty"`
+	// Instances is the number of instances currently reporting.
+	Instances int `json:"instances"`
+	// TotalBytes is what all instances consumed together.
+	TotalBytes int64 `json:"total_bytes"`
+	// Exhausted is set once TotalBytes reached the combined data cap.
+	Exhausted bool `json:"exhausted"`
+}
+
+// Coordinator tracks the progress of every instance and splits the limits
+// evenly between those that reported recently.
+type Coordinator struct {
+	limits Limits
+	expiry time.Duration
+
+	mu        sync.Mutex
+	instances map[string]*instance
+}
+
+type instance struct {
+	bytes    int64
+	lastSeen time.Time
+}
+
+// NewCoordinator returns a coordinator enforcing limits. Instances that
+// have not reported for expiry no longer get a share of the bandwidth,
+// but what they consumed still counts towards the data cap.
+func NewCoordinator(limits Limits, expiry time.Duration) *Coordinator {
+	return &Coordinator{limits: limits, expiry: expiry, instances: make(map[string]*instance)}
+}
+
+// Report records the progress of an instance and returns its share.
+func (c *Coordinator) Report(report Report) Grant {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	inst, ok := c.instances[report.Instance]
+	if !ok {
+		inst = &instance{}
+		c.instances[report.Instance] = inst
+	}
+	// Reports are cumulative, so a smaller value is a stale retry.
+	if report.Bytes > inst.bytes {
+		inst.bytes = report.Bytes
+	}
+	inst.lastSeen = now
+	return c.grant(now)
+}
+
+// Status returns the combined progress without registering an instance.
+func (c *Coordinator) Status() Grant {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.grant(time.Now())
+}
+
+func (c *Coordinator) grant(now time.Time) Grant {
+	var g Grant
+	for _, inst := range c.instances {
+		g.TotalBytes += inst.bytes
+		if now.Sub(inst.lastSeen) <= c.expiry {
+			g.Instances++
+		}
+	}
+	if g.Instances > 0 {
+		g.RateLimit = c.limits.MaxBandwidth / configs.Rate(g.Instances)
+		g.TargetRate = c.limits.TargetRate / configs.Rate(g.Instances)
+	}
+	g.Exhausted = c.limits.MaxData > 0 && g.TotalBytes >= c.limits.MaxData.Bytes()
+	return g
+}
@@ -0,0 +1,93 @@
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+func TestCoordinatorReport(t *testing.T) {
+	limits := Limits{MaxData: 1000, MaxBandwidth: 60, TargetRate: 30}
+	tests := []struct {
+		name    string
+		reports []Report
+		want    Grant
+	}{
+		{
+			name:    "one instance",
+			reports: []Report{{"a", 100}},
+			want:    Grant{RateLimit: 60, TargetRate: 30, Instances: 1, TotalBytes: 100},
+		},
+		{
+			name:    "cumulative reports",
+			reports: []Report{{"a", 100}, {"a", 300}},
+			want:    Grant{RateLimit: 60, TargetRate: 30, Instances: 1, TotalBytes: 300},
+		},
+		{
+			name:    "stale retry",
+			reports: []Report{{"a", 300}, {"a", 100}},
+			want:    Grant{RateLimit: 60, TargetRate: 30, Instances: 1, TotalBytes: 300},
+		},
+		{
+			name:    "instances share the limits",
+			reports: []Report{{"a", 100}, {"b", 200}, {"c", 0}},
+			want:    Grant{RateLimit: 20, TargetRate: 10, Instances: 3, TotalBytes: 300},
+		},
+		{
+			// Two sessions of one process report under their own names,
+			// each counting from zero.
+			name:    "sessions of one process",
+			reports: []Report{{"host-1-aaaa", 400}, {"host-1-bbbb", 100}},
+			want:    Grant{RateLimit: 30, TargetRate: 15, Instances: 2, TotalBytes: 500},
+		},
+		{
+			name:    "data cap reached",
+			reports: []Report{{"a", 600}, {"b", 400}},
+			want:    Grant{RateLimit: 30, TargetRate: 15, Instances: 2, TotalBytes: 1000, Exhausted: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCoordinator(limits, time.Minute)
+			var got Grant
+			for _, r := range tt.reports {
+				got = c.Report(r)
+			}
+			if got != tt.want {
+				t.Errorf("grant = %+v, want %+v", got, tt.want)
+			}
+			if status := c.Status(); status != tt.want {
+				t.Errorf("status = %+v, want %+v", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoordinatorExpiry(t *testing.T) {
+	c := NewCoordinator(Limits{MaxData: 1000, MaxBandwidth: 60}, time.Minute)
+	c.Report(Report{"a", 500})
+	c.Report(Report{"b", 100})
+	c.instances["a"].lastSeen = time.Now().Add(-2 * time.Minute)
+
+	// An expired instance gets no share, but its bytes still count.
+	want := Grant{RateLimit: 60, Instances: 1, TotalBytes: 600}
+	if got := c.Status(); got != want {
+		t.Errorf("status = %+v, want %+v", got, want)
+	}
+	// It gets its share back once it reports again.
+	want = Grant{RateLimit: 30, Instances: 2, TotalBytes: 700}
+	if got := c.Report(Report{"a", 600}); got != want {
+		t.Errorf("grant = %+v, want %+v", got, want)
+	}
+}
+
+func TestCoordinatorStatusEmpty(t *testing.T) {
+	c := NewCoordinator(Limits{MaxBandwidth: configs.Rate(60)}, time.Minute)
+	if got := c.Status(); got != (Grant{}) {
+		t.Errorf("status = %+v, want none", got)
+	}
+	if len(c.instances) != 0 {
+		t.Error("Status registered an instance")
+	}
+}
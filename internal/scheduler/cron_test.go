@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// at parses a wall-clock time such as "2025-03-10 14:30" in loc.
+func at(t *testing.T, loc *time.Location, s string) time.Time {
+	t.Helper()
+	v, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		expr, after string
+		// want lists the next matches in order, as wall-clock times.
+		want []string
+	}{
+		{"* * * * *", "2025-03-10 14:30", []string{"2025-03-10 14:31", "2025-03-10 14:32"}},
+		{"30 2 * * *", "2025-03-10 02:30", []string{"2025-03-11 02:30", "2025-03-12 02:30"}},
+		{"30 2 * * *", "2025-03-10 02:29", []string{"2025-03-10 02:30"}},
+
+		// Ranges, including names and Sunday as 7.
+		{"0 9-11 * * *", "2025-03-10 10:30", []string{"2025-03-10 11:00", "2025-03-11 09:00"}},
+		{"0 9 * * mon-fri", "2025-03-14 10:00", []string{"2025-03-17 09:00"}},
+		{"0 9 * * 5-7", "2025-03-10 00:00", []string{"2025-03-14 09:00", "2025-03-15 09:00", "2025-03-16 09:00", "2025-03-21 09:00"}},
+		{"0 0 1 jun-aug *", "2025-03-10 00:00", []string{"2025-06-01 00:00", "2025-07-01 00:00", "2025-08-01 00:00", "2026-06-01 00:00"}},
+
+		// Steps over the whole field, a range or from a start.
+		{"*/20 * * * *", "2025-03-10 14:30", []string{"2025-03-10 14:40", "2025-03-10 15:00", "2025-03-10 15:20"}},
+		{"0 8-18/4 * * *", "2025-03-10 13:00", []string{"2025-03-10 16:00", "2025-03-11 08:00", "2025-03-11 12:00"}},
+		{"45/5 * * * *", "2025-03-10 14:50", []string{"2025-03-10 14:55", "2025-03-10 15:45"}},
+
+		// Lists, mixing values, ranges and steps.
+		{"0,15,50-52 * * * *", "2025-03-10 14:10", []string{"2025-03-10 14:15", "2025-03-10 14:50", "2025-03-10 14:51", "2025-03-10 14:52", "2025-03-10 15:00"}},
+		{"0 0 * * sun,wed", "2025-03-10 00:00", []string{"2025-03-12 00:00", "2025-03-16 00:00", "2025-03-19 00:00"}},
+
+		// Days of the month that some months lack are skipped there.
+		{"0 0 31 * *", "2025-03-31 00:00", []string{"2025-05-31 00:00", "2025-07-31 00:00"}},
+		{"0 0 29 2 *", "2025-01-01 00:00", []string{"2028-02-29 00:00"}},
+
+		// With both day fields restricted, either one selects a day.
+		{"0 0 13 * fri", "2025-06-01 00:00", []string{"2025-06-06 00:00", "2025-06-13 00:00", "2025-06-20 00:00", "2025-06-27 00:00", "2025-07-04 00:00"}},
+		// With one of them * or a step over *, a day must match both.
+		{"0 0 13 * *", "2025-06-01 00:00", []string{"2025-06-13 00:00", "2025-07-13 00:00"}},
+		{"0 0 * * fri", "2025-06-01 00:00", []string{"2025-06-06 00:00", "2025-06-13 00:00"}},
+		{"0 0 13 * ?", "2025-06-01 00:00", []string{"2025-06-13 00:00"}},
+		{"0 0 */10 * fri", "2025-06-01 00:00", []string{"2025-07-11 00:00", "2025-08-01 00:00"}},
+
+		// Macros.
+		{"@hourly", "2025-03-10 14:30", []string{"2025-03-10 15:00"}},
+		{"@Daily", "2025-03-10 14:30", []string{"2025-03-11 00:00"}},
+		{"@weekly", "2025-03-10 14:30", []string{"2025-03-16 00:00"}},
+		{"@monthly", "2025-03-10 14:30", []string{"2025-04-01 00:00"}},
+		{"@yearly", "2025-03-10 14:30", []string{"2026-01-01 00:00"}},
+
+		// An impossible date never matches.
+		{"0 0 30 2 *", "2025-01-01 00:00", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr+" after "+tt.after, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := at(t, time.UTC, tt.after)
+			for _, want := range tt.want {
+				next = c.Next(next)
+				if got := next.Format("2006-01-02 15:04"); got != want {
+					t.Fatalf("next = %s, want %s", got, want)
+				}
+				if !c.Matches(next) {
+					t.Errorf("Matches(%s) = false", want)
+				}
+			}
+			if tt.want == nil {
+				if next = c.Next(next); !next.IsZero() {
+					t.Errorf("next = %s, want none", next)
+				}
+			}
+		})
+	}
+}
+
+// TestCronDST checks the days on which the clocks change in New York: on
+// 9 March 2025 they skip from 2:00 to 3:00, and on 2 November 2025 they go
+// back from 2:00 to 1:00.
+func TestCronDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name, expr, after string
+		want              []string
+	}{
+		{
+			name: "skipped hour", expr: "30 2 * * *", after: "2025-03-07 12:00",
+			// There is no 2:30 on 9 March, so that day has no run.
+			want: []string{"2025-03-08 02:30 EST", "2025-03-10 02:30 EDT"},
+		},
+		{
+			name: "hours around the skipped one", expr: "0 1,3 * * *", after: "2025-03-09 00:00",
+			want: []string{"2025-03-09 01:00 EST", "2025-03-09 03:00 EDT", "2025-03-10 01:00 EDT"},
+		},
+		{
+			name: "repeated hour", expr: "30 1 * * *", after: "2025-11-01 12:00",
+			// 1:30 happens twice on 2 November but runs once.
+			want: []string{"2025-11-02 01:30 EDT", "2025-11-03 01:30 EST"},
+		},
+		{
+			name: "every minute across the repeated hour", expr: "59 * * * *", after: "2025-11-02 00:30",
+			want: []string{"2025-11-02 00:59 EDT", "2025-11-02 01:59 EDT", "2025-11-02 02:59 EST"},
+		},
+		{
+			name: "daily across both changes", expr: "@daily", after: "2025-03-08 12:00",
+			want: []string{"2025-03-09 00:00 EST", "2025-03-10 00:00 EDT"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := at(t, loc, tt.after)
+			for _, want := range tt.want {
+				next = c.Next(next)
+				if got := next.Format("2006-01-02 15:04 MST"); got != want {
+					t.Fatalf("next = %s, want %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{"", "expected 5 fields"},
+		{"* * * *", "expected 5 fields"},
+		{"* * * * * *", "expected 5 fields"},
+		{"@reboot", "expected 5 fields"},
+		{"60 * * * *", "minute: value 60 out of range 0-59"},
+		{"* 24 * * *", "hour: value 24 out of range 0-23"},
+		{"* * 0 * *", "day of month: value 0 out of range 1-31"},
+		{"* * * 13 *", "month: value 13 out of range 1-12"},
+		{"* * * * 8", "day of week: value 8 out of range 0-7"},
+		{"* * * foo *", `month: invalid value "foo"`},
+		{"30-10 * * * *", `minute: invalid range "30-10"`},
+		{"*/0 * * * *", `minute: invalid step in "*/0"`},
+		{"*/x * * * *", `minute: invalid step in "*/x"`},
+		{"* * * * fri-mon", `day of week: invalid range "fri-mon"`},
+		{"1,,2 * * * *", `minute: invalid value ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseCron(%q) error = %v, want one containing %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
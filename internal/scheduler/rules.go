@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// Rules decides which profile applies at a given time from the
+// configured profile rules. The first matching rule wins.
+type Rules struct {
+	rules []rule
+}
+
+type rule struct {
+	config   configs.ProfileRule
+	days     uint64
+	from, to int // minutes after midnight
+}
+
+// NewRules parses rules, checking that the profiles they name exist.
+func NewRules(rules []configs.ProfileRule, profiles map[string]configs.Profile) (*Rules, error) {
+	r := &Rules{}
+	for i, config := range rules {
+		days, err := dowField.parse(config.Days)
+		if err != nil {
+			return nil, fmt.Errorf("profile rule %d: days: %w", i, err)
+		}
+		// Sunday may be written as either 0 or 7.
+		if days&(1<<7) != 0 {
+			days |= 1
+		}
+		if _, ok := profiles[config.Profile]; !ok {
+			return nil, fmt.Errorf("profile rule %d: unknown profile %q", i, config.Profile)
+		}
+		parsed := rule{config: config, days: days, to: 24 * 60}
+		if config.From != "" || config.To != "" {
+			if parsed.from, err = parseTimeOfDay(config.From); err != nil {
+				return nil, fmt.Errorf("profile rule %d: from: %w", i, err)
+			}
+			if parsed.to, err = parseTimeOfDay(config.To); err != nil {
+				return nil, fmt.Errorf("profile rule %d: to: %w", i, err)
+			}
+			if parsed.from == parsed.to {
+				return nil, fmt.Errorf("profile rule %d: from and to are equal", i)
+			}
+		}
+		r.rules = append(r.rules, parsed)
+	}
+	return r, nil
+}
+
+// parseTimeOfDay parses "HH:MM" into minutes after midnight.
+func parseTimeOfDay(s string) (int, error) {
+	hour, minute, ok := strings.Cut(s, ":")
+	h, err1 := strconv.Atoi(hour)
+	m, err2 := strconv.Atoi(minute)
+	if !ok || err1 != nil || err2 != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+// At returns the rule in effect at t, or false if none is.
+func (r *Rules) At(t time.Time) (configs.ProfileRule, bool) {
+	minute := t.Hour()*60 + t.Minute()
+	for _, rule := range r.rules {
+		if rule.matches(t.Weekday(), minute) {
+			return rule.config, true
+		}
+	}
+	return configs.ProfileRule{}, false
+}
+
+func (r rule) matches(day time.Weekday, minute int) bool {
+	onDay := func(d time.Weekday) bool { return r.days&(1<<uint(d)) != 0 }
+	if r.from < r.to {
+		return onDay(day) && minute >= r.from && minute < r.to
+	}
+	// The rule runs past midnight into the next day.
+	return (onDay(day) && minute >= r.from) || (onDay((day+6)%7) && minute < r.to)
+}
+
+// Change is the time the profile in effect changes, to Rule or, if ok is
+// false, back to the base settings.
+type Change struct {
+	At   time.Time
+	Rule configs.ProfileRule
+	OK   bool
+}
+
+// Changes returns the changes of the rule in effect after from until
+// until, checked minute by minute.
+func (r *Rules) Changes(from, until time.Time) []Change {
+	var changes []Change
+	current, active := r.At(from)
+	for t := from.Truncate(time.Minute).Add(time.Minute); t.Before(until); t = t.Add(time.Minute) {
+		rule, ok := r.At(t)
+		if ok != active || rule.Profile != current.Profile {
+			changes = append(changes, Change{At: t, Rule: rule, OK: ok})
+			current, active = rule, ok
+		}
+	}
+	return changes
+}
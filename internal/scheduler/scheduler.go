@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// Scheduler decides when the configured consumption windows open.
+type Scheduler struct {
+	entries []entry
+}
+
+type entry struct {
+	schedule configs.Schedule
+	cron     *Cron
+}
+
+func New(schedules []configs.Schedule) (*Scheduler, error) {
+	s := &Scheduler{}
+	for i, schedule := range schedules {
+		cron, err := ParseCron(schedule.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %d (%s): %w", i, schedule.Name, err)
+		}
+		if schedule.Duration <= 0 {
+			return nil, fmt.Errorf("schedule %d (%s): duration must be positive", i, schedule.Name)
+		}
+		s.entries = append(s.entries, entry{schedule: schedule, cron: cron})
+	}
+	return s, nil
+}
+
+// Next returns the schedule whose window opens first after the given time.
+// It returns false when no entry will ever fire again.
+func (s *Scheduler) Next(after time.Time) (configs.Schedule, time.Time, bool) {
+	var next configs.Schedule
+	var at time.Time
+	for _, e := range s.entries {
+		t := e.cron.Next(after)
+		if t.IsZero() {
+			continue
+		}
+		if at.IsZero() || t.Before(at) {
+			next, at = e.schedule, t
+		}
+	}
+	return next, at, !at.IsZero()
+}
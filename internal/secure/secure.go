@@ -0,0 +1,194 @@
+// Package secure adds bearer-token authentication and TLS to the HTTP
+// listeners and to the clients that talk to them.
+package secure
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	// TokenEnv holds the token when none is configured, which keeps it
+	// out of the process list and configuration files.
+	TokenEnv = "DATACONSUMER_TOKEN"
+	// CAFileEnv names a PEM file of certificates clients trust in
+	// addition to the system roots, e.g. a self-signed server certificate.
+	CAFileEnv = "DATACONSUMER_CA_FILE"
+)
+
+// Options secure a listener. The zero value serves plain HTTP without
+// authentication.
+type Options struct {
+	// Token, if set, must be sent as "Authorization: Bearer <token>" or,
+	// by browsers and EventSource which cannot set headers, as an
+	// access_token query parameter.
+	Token string
+	// CertFile and KeyFile enable TLS with the given certificate.
+	CertFile string
+	KeyFile  string
+	// SelfSigned enables TLS with a generated certificate. If CertFile
+	// and KeyFile are set, it is saved there on first use and reused
+	// afterwards, so clients can be told to trust it.
+	SelfSigned bool
+}
+
+// Token returns configured, or the token in $DATACONSUMER_TOKEN if it is
+// empty.
+func Token(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	return os.Getenv(TokenEnv)
+}
+
+// TLS reports whether the options enable TLS.
+func (o Options) TLS() bool {
+	return o.SelfSigned || o.CertFile != ""
+}
+
+// Scheme returns "https" or "http".
+func (o Options) Scheme() string {
+	if o.TLS() {
+		return "https"
+	}
+	return "http"
+}
+
+// Validate reports incomplete TLS settings.
+func (o Options) Validate() error {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return errors.New("TLS needs both a certificate and a key file")
+	}
+	return nil
+}
+
+// Authorized reports whether r carries the token, or whether no token is
+// required.
+func (o Options) Authorized(r *http.Request) bool {
+	if o.Token == "" {
+		return true
+	}
+	presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		presented = r.URL.Query().Get("access_token")
+	}
+	return ValidToken(o.Token, presented)
+}
+
+// ValidToken compares a presented token with the expected one in
+// constant time.
+func ValidToken(expected, presented string) bool {
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(presented)) == 1
+}
+
+// Handler requires the token for every path except public ones, such as a
+// liveness probe.
+func (o Options) Handler(h http.Handler, public ...string) http.Handler {
+	if o.Token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range public {
+			if r.URL.Path == path {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		if !o.Authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dataconsumer"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// TLSConfig returns the server TLS configuration, or nil without TLS. A
+// self-signed certificate is valid for the host of addr and this machine.
+func (o Options) TLSConfig(addr string) (*tls.Config, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	if !o.TLS() {
+		return nil, nil
+	}
+	var cert tls.Certificate
+	var err error
+	if o.SelfSigned {
+		cert, err = selfSigned(o.CertFile, o.KeyFile, addr)
+	} else {
+		cert, err = tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// ListenAndServe serves server with TLS if the options enable it.
+func (o Options) ListenAndServe(server *http.Server) error {
+	tlsConfig, err := o.TLSConfig(server.Addr)
+	if err != nil {
+		return err
+	}
+	if tlsConfig == nil {
+		return server.ListenAndServe()
+	}
+	server.TLSConfig = tlsConfig
+	return server.ListenAndServeTLS("", "")
+}
+
+// ClientTLSConfig trusts the system roots plus the certificates in caFile,
+// if set.
+func ClientTLSConfig(caFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	config.RootCAs = pool
+	return config, nil
+}
+
+// NewClient returns an HTTP client that sends token, if set, with every
+// request and trusts the certificates in caFile in addition to the
+// system roots.
+func NewClient(token, caFile string) (*http.Client, error) {
+	tlsConfig, err := ClientTLSConfig(caFile)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if token == "" {
+		return &http.Client{Transport: transport}, nil
+	}
+	return &http.Client{Transport: bearerTransport{token: token, next: transport}}, nil
+}
+
+type bearerTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(req)
+}
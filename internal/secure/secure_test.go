@@ -0,0 +1,87 @@
+package secure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	tests := []struct {
+		name, token  string
+		path, header string
+		want         int
+	}{
+		{"no token required", "", "/status", "", http.StatusOK},
+		{"missing token", "secret", "/status", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "/status", "Bearer wrong", http.StatusUnauthorized},
+		{"token prefix", "secret", "/status", "Bearer secre", http.StatusUnauthorized},
+		{"bearer header", "secret", "/status", "Bearer secret", http.StatusOK},
+		{"not a bearer header", "secret", "/status", "Basic secret", http.StatusUnauthorized},
+		{"access_token query", "secret", "/events?access_token=secret", "", http.StatusOK},
+		{"wrong access_token query", "secret", "/events?access_token=wrong", "", http.StatusUnauthorized},
+		{"header wins over query", "secret", "/events?access_token=secret", "Bearer wrong", http.StatusUnauthorized},
+		{"healthz", "secret", "/healthz", "", http.StatusOK},
+		{"readyz", "secret", "/readyz", "", http.StatusOK},
+		{"below a public path", "secret", "/healthz/more", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Options{Token: tt.token}
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			o.Handler(ok, "/healthz", "/readyz").ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("no WWW-Authenticate header")
+			}
+			if public := req.URL.Path == "/healthz" || req.URL.Path == "/readyz"; !public {
+				if authorized := o.Authorized(req); authorized != (tt.want == http.StatusOK) {
+					t.Errorf("Authorized = %v", authorized)
+				}
+			}
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		wantTLS bool
+		wantErr string
+	}{
+		{"no TLS", Options{}, false, ""},
+		{"certificate without key", Options{CertFile: "cert.pem"}, false, "needs both a certificate and a key file"},
+		{"key without certificate", Options{KeyFile: "key.pem"}, false, "needs both a certificate and a key file"},
+		{"self-signed certificate without key", Options{SelfSigned: true, CertFile: "cert.pem"}, false, "needs both a certificate and a key file"},
+		{"missing files", Options{CertFile: "missing.pem", KeyFile: "missing.pem"}, false, "loading TLS certificate"},
+		{"self-signed", Options{SelfSigned: true}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := tt.options.TLSConfig("localhost:9300")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("TLSConfig error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (config != nil) != tt.wantTLS {
+				t.Errorf("TLSConfig = %v, want TLS %v", config, tt.wantTLS)
+			}
+		})
+	}
+}
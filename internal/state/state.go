@@ -0,0 +1,96 @@
+// Package state checkpoints the progress of a run so that it can be
+// resumed after a crash or reboot.
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// State is the cumulative progress of a run across restarts.
+type State struct {
+	StartedAt        time.Time     `json:"started_at"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+	BytesTransferred int64         `json:"bytes_transferred"`
+	Elapsed          time.Duration `json:"elapsed"`
+	// MaxData and Duration record the targets the run was working
+	// towards, for reference.
+	MaxData  configs.Size     `json:"max_data,omitempty"`
+	Duration configs.Duration `json:"duration,omitempty"`
+	// Completed is set once the run reached its duration or data cap.
+	Completed bool `json:"completed"`
+}
+
+// DefaultPath returns the state file used by -resume when no other is
+// given, in the user's cache directory: $XDG_CACHE_HOME (or ~/.cache) on
+// Unix, %LocalAppData% on Windows and ~/Library/Caches on macOS.
+func DefaultPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dataconsumer", "state.json"), nil
+}
+
+// Load reads a state file written by Save.
+func Load(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Save writes the state to path, replacing the previous checkpoint
+// atomically so a crash never leaves a truncated file behind. The
+// directory of path is created if needed.
+func (s *State) Save(path string) error {
+	s.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Remaining returns how much of the duration (in minutes, 0 for none) and
+// data cap (0 for none) is left after the recorded progress. A negative
+// or zero result for a set target means it has been reached.
+func (s *State) Remaining(duration configs.Duration, maxData configs.Size) (time.Duration, configs.Size) {
+	var leftTime time.Duration
+	var leftData configs.Size
+	if duration > 0 {
+		leftTime = time.Duration(duration) - s.Elapsed
+	}
+	if maxData > 0 {
+		leftData = maxData - configs.Size(s.BytesTransferred)
+	}
+	return leftTime, leftData
+}
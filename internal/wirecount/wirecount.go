@@ -0,0 +1,15 @@
+// Package wirecount counts the packets a process receives on its sockets
+// with an eBPF socket filter, so that the bytes on the wire can be
+// compared with the bytes the application read. It is only implemented on
+// Linux, where loading the filter needs CAP_BPF or root unless
+// unprivileged BPF is enabled.
+package wirecount
+
+// Totals are the bytes and packets a Counter has seen. Bytes are as the
+// kernel hands them to the socket filter: for TCP, the segment with its
+// TCP header, including duplicates of retransmitted segments, but
+// without the IP header.
+type Totals struct {
+	Bytes   int64
+	Packets int64
+}
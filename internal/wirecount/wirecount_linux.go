@@ -0,0 +1,182 @@
+package wirecount
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Counter is an eBPF socket filter counting into a one-entry array map
+// whose value holds the received bytes and packets. The filter keeps
+// every packet; it only counts.
+type Counter struct {
+	mapFD  int
+	progFD int
+}
+
+// Instruction opcodes used by the filter.
+const (
+	opMovReg   = unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_X
+	opMovImm   = unix.BPF_ALU64 | unix.BPF_MOV | unix.BPF_K
+	opAddImm   = unix.BPF_ALU64 | unix.BPF_ADD | unix.BPF_K
+	opLoadWord = unix.BPF_LDX | unix.BPF_W | unix.BPF_MEM
+	opStoreImm = unix.BPF_ST | unix.BPF_W | unix.BPF_MEM
+	opLoadMap  = unix.BPF_LD | unix.BPF_DW | unix.BPF_IMM
+	opCall     = unix.BPF_JMP | unix.BPF_CALL
+	opJumpEq   = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+	opAtomicDW = unix.BPF_STX | unix.BPF_DW | unix.BPF_ATOMIC
+	opExit     = unix.BPF_JMP | unix.BPF_EXIT
+
+	helperMapLookup = 1
+)
+
+type instruction struct {
+	code uint8
+	regs uint8 // destination register in the low nibble, source in the high
+	off  int16
+	imm  int32
+}
+
+func insn(code uint8, dst, src uint8, off int16, imm int32) instruction {
+	return instruction{code: code, regs: dst | src<<4, off: off, imm: imm}
+}
+
+// program returns the filter for the map mapFD:
+//
+//	r6 = skb; r7 = skb->len; key = 0
+//	value = map_lookup_elem(map, &key)
+//	if value != nil { value[0] += r7; value[1] += 1 }
+//	return r7 // keep the whole packet
+func program(mapFD int) []instruction {
+	return []instruction{
+		insn(opMovReg, 6, 1, 0, 0),
+		insn(opLoadWord, 7, 6, 0, 0), // __sk_buff.len
+		insn(opStoreImm, 10, 0, -4, 0),
+		insn(opLoadMap, 1, unix.BPF_PSEUDO_MAP_FD, 0, int32(mapFD)),
+		insn(0, 0, 0, 0, 0),
+		insn(opMovReg, 2, 10, 0, 0),
+		insn(opAddImm, 2, 0, 0, -4),
+		insn(opCall, 0, 0, 0, helperMapLookup),
+		insn(opJumpEq, 0, 0, 3, 0),
+		insn(opAtomicDW, 0, 7, 0, unix.BPF_ADD),
+		insn(opMovImm, 1, 0, 0, 1),
+		insn(opAtomicDW, 0, 1, 8, unix.BPF_ADD),
+		insn(opMovReg, 0, 7, 0, 0),
+		insn(opExit, 0, 0, 0, 0),
+	}
+}
+
+type mapCreateAttr struct {
+	mapType    uint32
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+}
+
+type progLoadAttr struct {
+	progType    uint32
+	insnCount   uint32
+	insns       uint64
+	license     uint64
+	logLevel    uint32
+	logSize     uint32
+	logBuf      uint64
+	kernVersion uint32
+	progFlags   uint32
+	progName    [16]byte
+}
+
+type mapElemAttr struct {
+	mapFD uint32
+	_     uint32
+	key   uint64
+	value uint64
+	flags uint64
+}
+
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// New loads the filter. It fails on big-endian machines, whose register
+// nibbles are swapped, and without the privileges to load BPF programs.
+func New() (*Counter, error) {
+	probe := uint16(1)
+	if *(*byte)(unsafe.Pointer(&probe)) != 1 {
+		return nil, errors.ErrUnsupported
+	}
+	mapAttr := mapCreateAttr{mapType: unix.BPF_MAP_TYPE_ARRAY, keySize: 4, valueSize: 16, maxEntries: 1}
+	mapFD, err := bpf(unix.BPF_MAP_CREATE, unsafe.Pointer(&mapAttr), unsafe.Sizeof(mapAttr))
+	if err != nil {
+		return nil, fmt.Errorf("creating BPF map: %w", err)
+	}
+
+	insns := program(mapFD)
+	license := []byte("GPL\x00")
+	log := make([]byte, 4096)
+	progAttr := progLoadAttr{
+		progType:  unix.BPF_PROG_TYPE_SOCKET_FILTER,
+		insnCount: uint32(len(insns)),
+		insns:     uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:   uint64(uintptr(unsafe.Pointer(&license[0]))),
+		logLevel:  1,
+		logSize:   uint32(len(log)),
+		logBuf:    uint64(uintptr(unsafe.Pointer(&log[0]))),
+	}
+	copy(progAttr.progName[:], "dataconsumer")
+	progFD, err := bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&progAttr), unsafe.Sizeof(progAttr))
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	if err != nil {
+		unix.Close(mapFD)
+		if n := cString(log); n > 0 {
+			return nil, fmt.Errorf("loading BPF filter: %w: %s", err, log[:n])
+		}
+		return nil, fmt.Errorf("loading BPF filter: %w", err)
+	}
+	return &Counter{mapFD: mapFD, progFD: progFD}, nil
+}
+
+func cString(b []byte) int {
+	for i, c := range b {
+		if c == 0 {
+			return i
+		}
+	}
+	return len(b)
+}
+
+// Attach makes the filter count the packets received on the socket fd.
+func (c *Counter) Attach(fd uintptr) error {
+	return unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_ATTACH_BPF, c.progFD)
+}
+
+// Read returns the totals counted on all sockets so far.
+func (c *Counter) Read() (Totals, error) {
+	var key uint32
+	var value [2]uint64
+	attr := mapElemAttr{
+		mapFD: uint32(c.mapFD),
+		key:   uint64(uintptr(unsafe.Pointer(&key))),
+		value: uint64(uintptr(unsafe.Pointer(&value[0]))),
+	}
+	_, err := bpf(unix.BPF_MAP_LOOKUP_ELEM, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(&key)
+	runtime.KeepAlive(&value)
+	if err != nil {
+		return Totals{}, fmt.Errorf("reading BPF map: %w", err)
+	}
+	return Totals{Bytes: int64(value[0]), Packets: int64(value[1])}, nil
+}
+
+// Close unloads the filter once no socket uses it any more.
+func (c *Counter) Close() error {
+	return errors.Join(unix.Close(c.progFD), unix.Close(c.mapFD))
+}
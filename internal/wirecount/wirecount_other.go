@@ -0,0 +1,25 @@
+//go:build !linux
+
+package wirecount
+
+import "errors"
+
+// Counter is not implemented on this platform.
+type Counter struct{}
+
+// New returns errors.ErrUnsupported.
+func New() (*Counter, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (c *Counter) Attach(fd uintptr) error {
+	return errors.ErrUnsupported
+}
+
+func (c *Counter) Read() (Totals, error) {
+	return Totals{}, errors.ErrUnsupported
+}
+
+func (c *Counter) Close() error {
+	return nil
+}
@@ -0,0 +1,127 @@
+package consumer
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// firstBackoff is how long the workers wait after every source has
+	// become unhealthy before one of them retries.
+	firstBackoff = time.Second
+	// maxBackoff bounds the wait, which doubles after every failed retry.
+	maxBackoff = time.Minute
+)
+
+// Outage describes a period in which every source is failing, e.g.
+// because the machine is offline. During an outage the workers wait for
+// connectivity instead of retrying: one request is sent at RetryAt, with
+// escalating delays, and the first success ends the outage.
+type Outage struct {
+	Since   time.Time
+	RetryAt time.Time
+}
+
+// outageState is the consumer-wide backoff shared by the workers.
+type outageState struct {
+	active  bool
+	outage  Outage
+	delay   time.Duration
+	probing bool
+	// changed is closed and replaced when the outage ends or a retry
+	// fails, waking the waiting workers.
+	changed chan struct{}
+}
+
+// Outage returns the current outage and true if the consumer is waiting
+// for connectivity.
+func (c *Consumer) Outage() (Outage, bool) {
+	c.outageMu.Lock()
+	defer c.outageMu.Unlock()
+	return c.outage.outage, c.outage.active
+}
+
+// awaitConnectivity returns at once unless there is an outage, in which
+// case it blocks until the calling worker may send the next retry or the
+// outage has ended. It returns false if ctx is done first.
+func (c *Consumer) awaitConnectivity(ctx context.Context) bool {
+	for {
+		c.outageMu.Lock()
+		o := &c.outage
+		if !o.active {
+			c.outageMu.Unlock()
+			return true
+		}
+		wait := time.Until(o.outage.RetryAt)
+		if wait <= 0 && !o.probing {
+			o.probing = true
+			c.outageMu.Unlock()
+			return true
+		}
+		changed := o.changed
+		c.outageMu.Unlock()
+
+		var timer *time.Timer
+		var retry <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			retry = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-retry:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+	}
+}
+
+// reportConnectivity updates the outage with the outcome of a request:
+// a success ends it, and a failure while every source is unhealthy starts
+// it or pushes the next retry back.
+func (c *Consumer) reportConnectivity(err error) {
+	c.outageMu.Lock()
+	defer c.outageMu.Unlock()
+	o := &c.outage
+	now := time.Now()
+	switch {
+	case err == nil:
+		if !o.active {
+			return
+		}
+		c.logger.Info("connectivity restored", "outage", now.Sub(o.outage.Since).Round(time.Second))
+		close(o.changed)
+		*o = outageState{}
+	case o.active:
+		if !o.probing {
+			return
+		}
+		o.probing = false
+		o.delay = min(o.delay*2, maxBackoff)
+		o.outage.RetryAt = now.Add(o.delay)
+		c.logger.Debug("still waiting for connectivity", "retry_in", o.delay)
+		close(o.changed)
+		o.changed = make(chan struct{})
+	case c.health.allUnhealthy():
+		c.logger.Warn("all sources failing, waiting for connectivity", "error", reason(err))
+		*o = outageState{
+			active:  true,
+			outage:  Outage{Since: now, RetryAt: now.Add(firstBackoff)},
+			delay:   firstBackoff,
+			changed: make(chan struct{}),
+		}
+	}
+}
+
+// abandonRetry lets another worker retry if the calling worker stopped
+// while retrying.
+func (c *Consumer) abandonRetry() {
+	c.outageMu.Lock()
+	defer c.outageMu.Unlock()
+	c.outage.probing = false
+}
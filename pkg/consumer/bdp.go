@@ -0,0 +1,133 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// rttSamples is how many connections EstimatePipe opens to measure the
+// round-trip time, keeping the fastest.
+const rttSamples = 3
+
+// PipeEstimate is how many parallel streams it takes to fill the pipe to
+// a source at a target rate. A single stream delivers at most its window
+// per round trip, so the streams needed are the bandwidth-delay product
+// divided by the window a stream achieves.
+type PipeEstimate struct {
+	URL string `json:"url"`
+	// RTT is the time to open a TCP connection, to the proxy if the
+	// source is fetched through one.
+	RTT time.Duration `json:"rtt"`
+	// StreamRate is the throughput of one stream requesting the source
+	// back to back, request overhead included.
+	StreamRate configs.Rate `json:"stream_rate"`
+	// BDP is the target rate times the RTT, and Window the bytes a stream
+	// kept in flight per round trip.
+	BDP    configs.Size `json:"bdp"`
+	Window configs.Size `json:"window"`
+	// Streams is the number of streams needed to reach the target rate.
+	Streams   int    `json:"streams"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// EstimatePipe measures the round-trip time to source and the throughput
+// of a single stream over duration, and estimates the streams needed to
+// reach target. Only HTTP sources can be measured.
+func (c *Consumer) EstimatePipe(ctx context.Context, source configs.Source, target configs.Rate, duration time.Duration) PipeEstimate {
+	estimate := PipeEstimate{URL: source.URL}
+	if !isHTTPProtocol(source.Protocol) {
+		estimate.LastError = fmt.Sprintf("protocol %q cannot be measured", source.Protocol)
+		return estimate
+	}
+	rtt, err := c.measureRTT(ctx, source)
+	if err != nil {
+		estimate.LastError = err.Error()
+		return estimate
+	}
+	estimate.RTT = rtt
+	bench := c.Bench(ctx, source, duration)
+	estimate.StreamRate = bench.Rate()
+	if estimate.StreamRate <= 0 {
+		estimate.LastError = bench.LastError
+		if estimate.LastError == "" {
+			estimate.LastError = "no data received"
+		}
+		return estimate
+	}
+	estimate.BDP = configs.Size(target.BytesPerSecond() * rtt.Seconds())
+	estimate.Window = configs.Size(estimate.StreamRate.BytesPerSecond() * rtt.Seconds())
+	estimate.Streams = int(math.Ceil(target.BytesPerSecond() / estimate.StreamRate.BytesPerSecond()))
+	return estimate
+}
+
+// measureRTT returns the fastest of rttSamples TCP connects to the host
+// the consumer connects to for source.
+func (c *Consumer) measureRTT(ctx context.Context, source configs.Source) (time.Duration, error) {
+	u, err := url.Parse(source.URL)
+	if err != nil {
+		return 0, err
+	}
+	proxyURL, err := c.proxies.forSource(source, u)
+	if err != nil {
+		return 0, err
+	}
+	if proxyURL != nil {
+		u = proxyURL
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	// Resolve first so that the DNS lookup does not count.
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return 0, err
+	}
+	if len(ips) == 0 {
+		return 0, fmt.Errorf("%s has no addresses", u.Hostname())
+	}
+	address := net.JoinHostPort(ips[0].String(), port)
+
+	var dialer net.Dialer
+	best := time.Duration(math.MaxInt64)
+	for i := 0; i < rttSamples; i++ {
+		started := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return 0, err
+		}
+		best = min(best, time.Since(started))
+		conn.Close()
+	}
+	return best, nil
+}
+
+// RecommendedStreams returns the streams needed to reach target across
+// the estimates, from their per-stream throughput averaged by weight, or
+// 0 if no estimate succeeded. weights maps URLs to source weights; URLs
+// not in it weigh 1.
+func RecommendedStreams(estimates []PipeEstimate, weights map[string]int, target configs.Rate) int {
+	var rate float64
+	var total int
+	for _, estimate := range estimates {
+		if estimate.StreamRate <= 0 {
+			continue
+		}
+		weight := max(weights[estimate.URL], 1)
+		rate += estimate.StreamRate.BytesPerSecond() * float64(weight)
+		total += weight
+	}
+	if total == 0 {
+		return 0
+	}
+	return int(math.Ceil(target.BytesPerSecond() / (rate / float64(total))))
+}
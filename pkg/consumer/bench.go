@@ -0,0 +1,106 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// BenchResult is the outcome of benchmarking a single source.
+type BenchResult struct {
+	URL      string        `json:"url"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+	Requests int           `json:"requests"`
+	Failures int           `json:"failures"`
+	// Latency is the mean time from sending a request to receiving the
+	// response headers.
+	Latency   time.Duration `json:"latency"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// Rate returns the throughput achieved during the benchmark.
+func (r BenchResult) Rate() configs.Rate {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return configs.Rate(float64(r.Bytes) / r.Duration.Seconds())
+}
+
+// Reliability returns the fraction of requests that succeeded.
+func (r BenchResult) Reliability() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.Requests-r.Failures) / float64(r.Requests)
+}
+
+// Bench downloads from source one request at a time for the given
+// duration, using the consumer's transport, proxy and request settings but
+// none of its workers, rate limit or metrics. Only HTTP sources can be
+// benchmarked.
+func (c *Consumer) Bench(ctx context.Context, source configs.Source, duration time.Duration) BenchResult {
+	result := BenchResult{URL: source.URL}
+	if !isHTTPProtocol(source.Protocol) {
+		result.LastError = fmt.Sprintf("protocol %q cannot be benchmarked", source.Protocol)
+		return result
+	}
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	buffer := c.buffers.get(c.buffers.maxSize())
+	defer c.buffers.put(buffer)
+	var latency time.Duration
+	var answered int
+	started := time.Now()
+	for ctx.Err() == nil {
+		result.Requests++
+		n, headers, err := c.benchRequest(ctx, source, *buffer)
+		result.Bytes += n
+		if headers > 0 {
+			latency += headers
+			answered++
+		}
+		if err != nil && ctx.Err() == nil {
+			result.Failures++
+			result.LastError = err.Error()
+			select {
+			case <-time.After(500 * time.Millisecond):
+			case <-ctx.Done():
+			}
+		}
+	}
+	result.Duration = time.Since(started)
+	if answered > 0 {
+		result.Latency = latency / time.Duration(answered)
+	}
+	return result
+}
+
+// benchRequest performs one request and returns the bytes read and the
+// time until the response headers arrived.
+func (c *Consumer) benchRequest(ctx context.Context, source configs.Source, buffer []byte) (int64, time.Duration, error) {
+	req, err := c.newRequest(ctx, source)
+	if err != nil {
+		return 0, 0, err
+	}
+	sent := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	headers := time.Since(sent)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, headers, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	n, err := io.CopyBuffer(io.Discard, resp.Body, buffer)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	return n, headers, err
+}
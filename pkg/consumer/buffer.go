@@ -0,0 +1,142 @@
+package consumer
+
+import (
+	"io"
+	"sync"
+)
+
+const (
+	// defaultBufferSize is the largest read buffer, which tuning grows
+	// to for fast streams.
+	defaultBufferSize = 2 << 20
+	// minBufferSize is the smallest read buffer, which tuning shrinks to
+	// for trickles.
+	minBufferSize = 16 << 10
+	// startBufferSize is the buffer a source's first request starts
+	// with.
+	startBufferSize = 64 << 10
+	// tuneEvery is how many reads tuning observes before resizing.
+	tuneEvery = 16
+)
+
+// bufferPool hands out read buffers shared by the workers, so cycling
+// requests does not allocate a new buffer for each one. With a fixed size
+// every buffer has that size. Otherwise the buffers come in powers of two
+// from minBufferSize to defaultBufferSize, and each source's size is tuned
+// to its throughput while it downloads.
+type bufferPool struct {
+	fixed int
+	pools map[int]*sync.Pool
+
+	mu    sync.Mutex
+	tuned map[string]int
+}
+
+func newBufferPool(size int) *bufferPool {
+	p := &bufferPool{fixed: size, pools: make(map[int]*sync.Pool), tuned: make(map[string]int)}
+	for size := minBufferSize; size <= defaultBufferSize; size *= 2 {
+		p.addPool(size)
+	}
+	if size > 0 {
+		p.addPool(size)
+	}
+	return p
+}
+
+func (p *bufferPool) addPool(size int) {
+	p.pools[size] = &sync.Pool{New: func() any {
+		buffer := make([]byte, size)
+		return &buffer
+	}}
+}
+
+// maxSize is the size of the largest buffer the pool hands out.
+func (p *bufferPool) maxSize() int {
+	if p.fixed > 0 {
+		return p.fixed
+	}
+	return defaultBufferSize
+}
+
+// get returns a buffer of size, which must be one the pool hands out. It
+// must be given back with put.
+func (p *bufferPool) get(size int) *[]byte {
+	return p.pools[size].Get().(*[]byte)
+}
+
+func (p *bufferPool) put(buffer *[]byte) {
+	p.pools[len(*buffer)].Put(buffer)
+}
+
+// sizeFor returns the buffer size to start a request to url with.
+func (p *bufferPool) sizeFor(url string) int {
+	if p.fixed > 0 {
+		return p.fixed
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if size := p.tuned[url]; size > 0 {
+		return size
+	}
+	return startBufferSize
+}
+
+// copy copies src to dst like io.Copy through a pooled buffer, tuning its
+// size unless it is fixed: reads that keep filling the buffer show it
+// limits a fast stream and double it, and reads that keep using less than
+// a quarter of it halve it. The size reached is remembered for url and
+// returned.
+func (p *bufferPool) copy(dst io.Writer, src io.Reader, url string) (written int64, size int, err error) {
+	size = p.sizeFor(url)
+	buffer := p.get(size)
+	defer func() {
+		p.put(buffer)
+		if p.fixed == 0 {
+			p.mu.Lock()
+			p.tuned[url] = size
+			p.mu.Unlock()
+		}
+	}()
+
+	var reads, full, filled int
+	for {
+		n, readErr := src.Read(*buffer)
+		if n > 0 {
+			m, writeErr := dst.Write((*buffer)[:n])
+			written += int64(m)
+			if writeErr != nil {
+				return written, size, writeErr
+			}
+		}
+		if readErr == io.EOF {
+			return written, size, nil
+		}
+		if readErr != nil {
+			return written, size, readErr
+		}
+		if p.fixed > 0 {
+			continue
+		}
+		reads++
+		filled += n
+		if n == size {
+			full++
+		}
+		if reads < tuneEvery {
+			continue
+		}
+		next := size
+		switch {
+		case full >= tuneEvery*3/4 && size < defaultBufferSize:
+			next = size * 2
+		case filled < reads*size/4 && size > minBufferSize:
+			next = size / 2
+		}
+		if next != size {
+			p.put(buffer)
+			size = next
+			buffer = p.get(size)
+		}
+		reads, full, filled = 0, 0, 0
+	}
+}
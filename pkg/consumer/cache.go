@@ -0,0 +1,31 @@
+package consumer
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// cacheStatus reports whether a response was served from a cache, judging
+// by CF-Cache-Status, X-Cache or Age in that order of preference, and
+// false for known if the response has none of them.
+func cacheStatus(header http.Header) (hit, known bool) {
+	if status := header.Get("CF-Cache-Status"); status != "" {
+		switch strings.ToUpper(status) {
+		case "HIT", "STALE", "UPDATING", "REVALIDATED":
+			return true, true
+		default:
+			// MISS, EXPIRED, BYPASS and DYNAMIC all went to the origin.
+			return false, true
+		}
+	}
+	if status := header.Get("X-Cache"); status != "" {
+		// Tiered caches list one status per layer, e.g. "MISS, HIT" or
+		// "Hit from cloudfront"; a hit in any layer spared the origin.
+		return strings.Contains(strings.ToUpper(status), "HIT"), true
+	}
+	if age, err := strconv.Atoi(header.Get("Age")); err == nil {
+		return age > 0, true
+	}
+	return false, false
+}
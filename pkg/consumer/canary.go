@@ -0,0 +1,187 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+const (
+	// canaryTimeout bounds a canary check.
+	canaryTimeout = 10 * time.Second
+	// portalRecheck is how often the canary is checked while a captive
+	// portal is detected, if the interval is longer.
+	portalRecheck = 10 * time.Second
+	// canaryBodyLimit is how much of the canary's answer is compared.
+	canaryBodyLimit = 64 << 10
+)
+
+// CaptivePortal describes a period in which the canary check found that
+// the network does not reach the internet, e.g. because a captive portal
+// or walled garden intercepts the requests. Reason says what the check
+// saw.
+type CaptivePortal struct {
+	Since  time.Time
+	Reason string
+}
+
+// portalState is the captive portal the workers wait out, if any.
+type portalState struct {
+	active bool
+	portal CaptivePortal
+	// cleared is closed when the portal is no longer detected.
+	cleared chan struct{}
+}
+
+// CaptivePortal returns the current captive portal and true if the
+// consumer is waiting for the canary check to pass.
+func (c *Consumer) CaptivePortal() (CaptivePortal, bool) {
+	c.portalMu.Lock()
+	defer c.portalMu.Unlock()
+	return c.portal.portal, c.portal.active
+}
+
+// awaitPortal returns at once unless a captive portal is detected, in
+// which case it blocks until it is cleared. It returns false if ctx is
+// done first.
+func (c *Consumer) awaitPortal(ctx context.Context) bool {
+	c.portalMu.Lock()
+	active, cleared := c.portal.active, c.portal.cleared
+	c.portalMu.Unlock()
+	if !active {
+		return true
+	}
+	select {
+	case <-cleared:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// startCanary starts checking the canary if one is configured and returns
+// a channel closed once the first check is done, so that no request is
+// sent before it.
+func (c *Consumer) startCanary() <-chan struct{} {
+	checked := make(chan struct{})
+	if c.config.Canary == nil {
+		close(checked)
+		return checked
+	}
+	c.wg.Add(1)
+	go c.watchCanary(c.config.Canary.WithDefaults(), checked)
+	return checked
+}
+
+// watchCanary checks the canary at once and then every interval, or more
+// often while a portal is detected, until the consumer stops.
+func (c *Consumer) watchCanary(canary configs.CanaryConfig, checked chan<- struct{}) {
+	defer c.wg.Done()
+	interval := time.Duration(canary.Interval) * time.Second
+	for {
+		c.checkCanary(canary)
+		if checked != nil {
+			close(checked)
+			checked = nil
+		}
+		wait := interval
+		if _, active := c.CaptivePortal(); active {
+			wait = min(wait, portalRecheck)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// checkCanary runs one check and updates the portal state. A canary that
+// cannot be reached at all leaves it unchanged: being offline is handled
+// by the workers' backoff.
+func (c *Consumer) checkCanary(canary configs.CanaryConfig) {
+	ctx, cancel := context.WithTimeout(c.ctx, canaryTimeout)
+	defer cancel()
+	reason, err := c.probeCanary(ctx, canary)
+	if err != nil {
+		if c.ctx.Err() == nil {
+			c.logger.Debug("canary unreachable", "url", canary.URL, "error", err)
+		}
+		return
+	}
+
+	c.portalMu.Lock()
+	defer c.portalMu.Unlock()
+	p := &c.portal
+	switch {
+	case reason != "" && !p.active:
+		c.logger.Warn("captive portal detected, pausing until the canary check passes", "url", canary.URL, "reason", reason)
+		*p = portalState{active: true, portal: CaptivePortal{Since: time.Now(), Reason: reason}, cleared: make(chan struct{})}
+	case reason != "":
+		p.portal.Reason = reason
+	case p.active:
+		c.logger.Info("captive portal cleared", "duration", time.Since(p.portal.Since).Round(time.Second))
+		close(p.cleared)
+		*p = portalState{}
+	}
+}
+
+// probeCanary fetches the canary without following redirects and returns
+// why the answer shows a captive portal, or "" if it is the known
+// content.
+func (c *Consumer) probeCanary(ctx context.Context, canary configs.CanaryConfig) (string, error) {
+	u, err := url.Parse(canary.URL)
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(u.Hostname()); ip == nil {
+		addrs, err := net.DefaultResolver.LookupIP(ctx, "ip", u.Hostname())
+		if err != nil {
+			return "", err
+		}
+		for _, addr := range addrs {
+			if addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified() {
+				return fmt.Sprintf("%s resolves to the private address %s", u.Hostname(), addr), nil
+			}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", canary.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Cache-Control", "no-cache")
+	client := *c.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, canaryBodyLimit))
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != "":
+		return "redirected to " + resp.Header.Get("Location"), nil
+	case resp.StatusCode != canary.Status:
+		return fmt.Sprintf("answered %s instead of %d", resp.Status, canary.Status), nil
+	case canary.Body != "" && strings.TrimSpace(string(body)) != strings.TrimSpace(canary.Body):
+		return "answered with different content", nil
+	case canary.Body == "" && canary.Status == http.StatusNoContent && len(body) > 0:
+		return fmt.Sprintf("answered %d bytes instead of no content", len(body)), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,53 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// probeWarmup is the part of a capacity probe, at most, that is not
+// measured while connections ramp up to the unlimited rate.
+const probeWarmup = time.Second
+
+// ProbeCapacity lifts the built-in rate limit and the pacing to the target
+// rate for duration and returns the rate the consumer reached meanwhile,
+// an estimate of the link capacity left over by other traffic. The first
+// second, or quarter of duration if shorter, is not measured. A limiter
+// passed to WithRateLimiter stays in effect, and the consumer must be
+// running and not paused.
+func (c *Consumer) ProbeCapacity(ctx context.Context, duration time.Duration) (configs.Rate, error) {
+	if c.Paused() {
+		return 0, errors.New("cannot probe the capacity while paused")
+	}
+	if !c.probing.CompareAndSwap(false, true) {
+		return 0, errors.New("a capacity probe is already running")
+	}
+	defer c.probing.Store(false)
+	defer c.target.skip()
+
+	wait := func(d time.Duration) error {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.ctx.Done():
+			return ErrStopped
+		case <-timer.C:
+			return nil
+		}
+	}
+	warmup := min(probeWarmup, duration/4)
+	if err := wait(warmup); err != nil {
+		return 0, err
+	}
+	startBytes, started := c.metricsCollector.GetStats().BytesTransferred, time.Now()
+	if err := wait(duration - warmup); err != nil {
+		return 0, err
+	}
+	bytes := c.metricsCollector.GetStats().BytesTransferred - startBytes
+	return configs.Rate(float64(bytes) / time.Since(started).Seconds()), nil
+}
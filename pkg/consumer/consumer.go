@@ -0,0 +1,616 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/logging"
+	"dataconsumer/internal/wirecount"
+	"dataconsumer/pkg/metrics"
+)
+
+// Bytes read are counted in the collector in batches of accountBytes, or
+// after accountInterval if fewer arrive, rather than after every read:
+// with many workers on a fast link the shared counter is otherwise
+// contended.
+const (
+	accountBytes    = 1 << 20
+	accountInterval = 100 * time.Millisecond
+)
+
+// countingReader counts the bytes read from a response body.
+type countingReader struct {
+	io.Reader
+	collector *metrics.Collector
+	pending   int64
+	flushed   time.Time
+	// firstByte is when the first byte of the body was read.
+	firstByte time.Time
+	// Nothing is counted until hold bytes have been read, and if the body
+	// fails before that, dropped is set and its bytes are never counted.
+	hold    int64
+	read    int64
+	dropped bool
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 && r.firstByte.IsZero() {
+		r.firstByte = time.Now()
+	}
+	r.pending += int64(n)
+	r.read += int64(n)
+	if r.read < r.hold {
+		if err != nil {
+			r.pending = 0
+			r.dropped = true
+		}
+		return n, err
+	}
+	if r.pending >= accountBytes || err != nil || time.Since(r.flushed) >= accountInterval {
+		r.flush()
+	}
+	return n, err
+}
+
+// flush adds the bytes not counted yet to the collector.
+func (r *countingReader) flush() {
+	if r.pending > 0 {
+		r.collector.AddBytes(r.pending)
+		r.pending = 0
+	}
+	r.flushed = time.Now()
+}
+
+// pacingDiscarder discards data at the pace of the rate limiter, holding
+// it while the consumer is paused.
+type pacingDiscarder struct {
+	ctx      context.Context
+	consumer *Consumer
+	source   configs.Source
+}
+
+func (w *pacingDiscarder) Write(p []byte) (n int, err error) {
+	n = len(p)
+	w.consumer.hooks.read(w.source, n)
+	w.consumer.pace(w.ctx, n)
+	w.consumer.waitIfPaused(w.ctx)
+	return n, nil
+}
+
+// Consumer downloads from its data sources with a pool of workers,
+// discarding the data and counting it in a metrics.Collector. It is safe
+// for concurrent use; the setters take effect while it runs.
+type Consumer struct {
+	config           *configs.Config
+	metricsCollector *metrics.Collector
+	client           *http.Client
+	sourcesMu        sync.Mutex
+	sources          []Source
+	proxies          *proxySelector
+	cancel           context.CancelFunc
+	ctx              context.Context
+	wg               sync.WaitGroup
+	paceMu           sync.Mutex
+	limiter          RateLimiter
+	requests         RateLimiter
+	customLimiter    bool
+	target           *TokenBucket
+	rateLimit        configs.Rate
+	targetRate       configs.Rate
+	pauseMu          sync.Mutex
+	resume           chan struct{}
+	health           *healthTracker
+	logger           *slog.Logger
+	slots            *semaphore
+	memory           *memoryBudget
+	conns            *connTracker
+	hosts            *hostLimiter
+	transfers        transfers
+	roles            roleCredentials
+	buffers          *bufferPool
+	personaSeed      int64
+	runID            string
+	tracer           *Tracer
+	hooks            hooks
+	events           eventStream
+	outageMu         sync.Mutex
+	outage           outageState
+	portalMu         sync.Mutex
+	portal           portalState
+	failOnce         sync.Once
+	failed           chan struct{}
+	cause            error
+	// wire counts the bytes on the wire if wire accounting is enabled.
+	wire *wirecount.Counter
+	// store saves the downloaded objects if save_to is configured.
+	store *objectStore
+	// probing lifts the built-in rate limit and target pacing during
+	// ProbeCapacity.
+	probing atomic.Bool
+}
+
+// NewConsumer returns a consumer configured by opts, e.g.
+//
+//	NewConsumer(WithConfig(config), WithTargetRate(rate))
+//
+// It returns an error if a source, proxy or limit is invalid.
+func NewConsumer(opts ...Option) (*Consumer, error) {
+	var s settings
+	for _, opt := range opts {
+		opt(&s)
+	}
+	config := s.resolve()
+	if err := config.TargetMode.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.ValidateConcurrency(); err != nil {
+		return nil, err
+	}
+	proxies, err := newProxySelector(config.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	memory, err := newMemoryBudget(config.MemoryLimit, int(config.BufferSize.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	if config.MaxConnsPerSource < 0 {
+		return nil, fmt.Errorf("max_conns_per_source must not be negative")
+	}
+
+	collector := s.collector
+	if collector == nil {
+		collector = metrics.NewCollector()
+	}
+	if s.runID != "" {
+		collector.SetRunID(s.runID)
+	}
+	logger := s.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger = logger.With("component", "consumer")
+	store, err := newObjectStore(config.SaveTo, config.ObjectSize, collector, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conns := newConnTracker()
+	var wire *wirecount.Counter
+	var client http.Client
+	if s.client != nil {
+		client = *s.client
+	}
+	switch {
+	case s.transport != nil:
+		client.Transport = s.transport
+	case s.client == nil:
+		tuning := config.Transport.WithDefaults()
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		if config.WireAccounting {
+			wire, dialer.Control = newWireCounter(logger)
+		}
+		transport := &http.Transport{
+			Proxy:                 proxyFromContext,
+			DialContext:           conns.dial(dialer.DialContext),
+			MaxIdleConns:          tuning.MaxIdleConns,
+			MaxConnsPerHost:       tuning.MaxConnsPerHost,
+			MaxIdleConnsPerHost:   tuning.MaxIdleConns,
+			IdleConnTimeout:       time.Duration(tuning.IdleConnTimeout) * time.Second,
+			ResponseHeaderTimeout: time.Duration(tuning.ResponseHeaderTimeout) * time.Second,
+			TLSHandshakeTimeout:   time.Duration(tuning.TLSHandshakeTimeout) * time.Second,
+			DisableKeepAlives:     tuning.DisableKeepAlives,
+			DisableCompression:    true,
+		}
+		client.Transport = transport
+	}
+	client.Transport = chain(client.Transport, s.middleware)
+
+	c := &Consumer{
+		config:           config,
+		metricsCollector: collector,
+		client:           &client,
+		proxies:          proxies,
+		health:           newHealthTracker(config.DataSources),
+		targetRate:       config.TargetRate,
+		rateLimit:        config.MaxBandwidth,
+		limiter:          s.limiter,
+		customLimiter:    s.limiter != nil,
+		requests:         newRequestPacer(config.TargetRPS),
+		conns:            conns,
+		hosts:            newHostLimiter(config.MaxConnsPerSource),
+		slots:            newSemaphore(0),
+		memory:           memory,
+		buffers:          newBufferPool(int(config.BufferSize.Bytes())),
+		personaSeed:      time.Now().UnixNano(),
+		runID:            s.runID,
+		wire:             wire,
+		store:            store,
+		logger:           logger,
+		ctx:              ctx,
+		cancel:           cancel,
+		failed:           make(chan struct{}),
+	}
+	if config.Redirects != nil && c.client.CheckRedirect == nil {
+		c.client.CheckRedirect = c.checkRedirect(*config.Redirects)
+	}
+	if config.TargetRPS <= 0 {
+		c.target = newTargetPacer(config.TargetMode, config.TargetRate, time.Duration(config.TargetCatchUp))
+	}
+	if c.limiter == nil {
+		c.limiter = newLimiter(config.MaxBandwidth)
+	} else if setter, ok := c.limiter.(rateSetter); ok && config.MaxBandwidth > 0 {
+		setter.SetRate(config.MaxBandwidth)
+	}
+	c.sources, err = weightedSources(c, config.DataSources)
+	if err != nil {
+		cancel()
+		c.closeWire()
+		return nil, err
+	}
+	if wire != nil {
+		collector.SetWireCounter(c.wireTotals)
+	}
+	collector.SetHostCounter(c.hosts.stats)
+	if config.Footprint != nil {
+		footprint := config.Footprint.WithDefaults()
+		collector.SetFootprintFactors(footprint.KWhPerGB, footprint.GridIntensity)
+	}
+	return c, nil
+}
+
+// chain wraps transport in middleware, the first outermost.
+func chain(transport http.RoundTripper, middleware []Middleware) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		transport = middleware[i](transport)
+	}
+	return transport
+}
+
+// weightedSources returns the enabled sources, each repeated according to
+// its weight so that round-robin selection honours the weights. HTTP
+// sources download through c.
+func weightedSources(c *Consumer, sources []configs.Source) ([]Source, error) {
+	var weighted []Source
+	for _, source := range sources {
+		if err := source.Validate(); err != nil {
+			return nil, err
+		}
+		if source.Proxy != "" && source.Proxy != configs.DirectProxy {
+			if _, err := parseProxyURL(source.Proxy); err != nil {
+				return nil, fmt.Errorf("source %s: %w", source.URL, err)
+			}
+		}
+		s, err := newSource(c, source)
+		if err != nil {
+			return nil, err
+		}
+		if !source.IsEnabled() {
+			continue
+		}
+		for i := 0; i < source.EffectiveWeight(); i++ {
+			weighted = append(weighted, s)
+		}
+	}
+	if len(weighted) == 0 {
+		return nil, fmt.Errorf("no enabled data sources configured")
+	}
+	return weighted, nil
+}
+
+// SetLogger replaces the logger, which defaults to slog.Default(). Call it
+// before Start.
+func (c *Consumer) SetLogger(logger *slog.Logger) {
+	c.logger = logger.With("component", "consumer")
+}
+
+// Config returns the configuration the consumer was created with, with
+// the options applied.
+func (c *Consumer) Config() *configs.Config {
+	return c.config
+}
+
+// Collector returns the collector counting the consumer's traffic.
+func (c *Consumer) Collector() *metrics.Collector {
+	return c.metricsCollector
+}
+
+// RunHeader is the request header carrying the ID given with WithRunID.
+const RunHeader = "X-DataConsumer-Run"
+
+// DefaultWorkers is how many requests the workers run at once after Start
+// if the config's concurrency_factor is zero.
+const DefaultWorkers = 150
+
+// StartWorkers returns how many requests the workers run at once after
+// Start: concurrency_factor, or DefaultWorkers if it is zero.
+func StartWorkers(config *configs.Config) int {
+	if config.ConcurrencyFactor > 0 {
+		return config.ConcurrencyFactor
+	}
+	return DefaultWorkers
+}
+
+// Start starts the collector and the download workers and returns at once.
+// A consumer can be started only once; Stop ends it.
+func (c *Consumer) Start() {
+	c.metricsCollector.Start()
+	if c.config.TargetRPS <= 0 {
+		c.metricsCollector.SetTargetRate(c.TargetRate().MBPerMinute())
+	}
+	workers := StartWorkers(c.config)
+	c.SetWorkers(workers)
+	c.logger.Info("started workers", "workers", workers, "target_rate", c.TargetRate())
+	c.startEgress()
+	c.wg.Add(1)
+	go c.dispatch(c.startCanary())
+}
+
+// SetWorkers changes how many requests the workers may run at once, also
+// while the consumer is running. Removed workers abandon their current
+// request.
+func (c *Consumer) SetWorkers(n int) {
+	if c.ctx.Err() != nil {
+		return
+	}
+	if previous := c.slots.setLimit(max(n, 0)); previous != n {
+		c.emit(Event{Type: WorkersScaled, Workers: n})
+	}
+}
+
+// Workers returns how many requests the workers may run at once.
+func (c *Consumer) Workers() int {
+	limit, _ := c.slots.size()
+	return limit
+}
+
+// InFlight returns how many requests are running, which is at most
+// Workers.
+func (c *Consumer) InFlight() int {
+	_, held := c.slots.size()
+	return held
+}
+
+// Stop cancels all workers and waits for them to finish. If they have not
+// finished within the configured shutdown grace period, their connections
+// are closed so that stalled reads return. Stop returns the error that
+// stopped the consumer before, such as ErrQuotaExceeded, if any.
+func (c *Consumer) Stop() error {
+	c.cancel()
+	grace := time.Duration(c.config.ShutdownGrace) * time.Second
+	if !waitTimeout(&c.wg, grace) {
+		closed := c.conns.closeAll()
+		c.logger.Warn("shutdown grace period expired, closed connections", "grace", grace, "connections", closed)
+		if !waitTimeout(&c.wg, forcedCloseWait) {
+			c.logger.Warn("workers still running after closing connections")
+		}
+	}
+	c.closeWire()
+	c.metricsCollector.Stop()
+	c.closeEvents()
+	return c.failure()
+}
+
+// dispatch starts a worker for every request as soon as the semaphore has
+// a free slot, taking the sources in turn, until the consumer stops. Idle
+// workers hold no goroutine or buffer. It starts once ready is closed.
+func (c *Consumer) dispatch(ready <-chan struct{}) {
+	defer c.wg.Done()
+	select {
+	case <-ready:
+	case <-c.ctx.Done():
+		return
+	}
+	for next := 0; c.ctx.Err() == nil; next++ {
+		c.waitIfPaused(c.ctx)
+		ctx, cancel := context.WithCancel(c.ctx)
+		held, err := c.slots.acquire(ctx, cancel)
+		if err != nil {
+			cancel()
+			return
+		}
+		unreserve, err := c.memory.reserve(ctx, cancel)
+		if err != nil {
+			c.slots.release(held)
+			cancel()
+			return
+		}
+		src, done, ok := c.hosts.pick(ctx, c.currentSources(), next)
+		if !ok {
+			unreserve()
+			c.slots.release(held)
+			cancel()
+			continue
+		}
+		c.wg.Add(1)
+		if c.config.HeaderPersonas {
+			ctx = withPersona(ctx, c.personaFor(held.id))
+		}
+		go c.worker(ctx, cancel, func() {
+			done()
+			unreserve()
+			c.slots.release(held)
+		}, src)
+	}
+}
+
+// worker downloads from src, retrying failed requests, and then calls
+// release to give its slot and memory back.
+func (c *Consumer) worker(ctx context.Context, cancel context.CancelFunc, release func(), src Source) {
+	defer c.wg.Done()
+	defer release()
+	defer cancel()
+
+	source := src.Config()
+	var total int64
+	ended := c.transfers.start(source.URL, cancel)
+	defer func() { ended(total) }()
+	for attempt := 0; attempt < 3; attempt++ { // Retry up to 3 times
+		if !c.awaitPortal(ctx) || !c.awaitConnectivity(ctx) || !c.paceRequest(ctx) {
+			return
+		}
+		n, err := c.consumeData(ctx, src)
+		total += n
+		if ctx.Err() != nil {
+			c.metricsCollector.AddSourceBytes(source.URL, n)
+			c.abandonRetry()
+			return
+		}
+		if c.health.record(source.URL, err) {
+			c.hooks.disabled(source, err)
+		}
+		c.reportConnectivity(err)
+		c.metricsCollector.RecordRequest(source.URL, n, reason(err))
+		if err == nil {
+			return
+		}
+		c.hooks.failed(source, err)
+		if !c.hasSource(source.URL) {
+			// The source was removed; leave it to drain.
+			return
+		}
+		c.logger.Debug("retrying", "url", source.URL, "attempt", attempt+1)
+		time.Sleep(500 * time.Millisecond) // Brief pause before retry
+	}
+}
+
+func (c *Consumer) consumeData(ctx context.Context, src Source) (n int64, err error) {
+	source := src.Config()
+	url := source.URL
+	if source.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(source.Timeout)*time.Second)
+		defer cancel()
+	}
+	ctx, cancelRead := context.WithCancelCause(ctx)
+	defer cancelRead(nil)
+	c.hooks.requestStarted(source)
+	started := time.Now()
+	tx := c.tracer.begin(source)
+	defer func() {
+		tx.finish(n, err)
+		c.hooks.requestFinished(RequestDone{Source: source, Bytes: n, Duration: time.Since(started), Err: err})
+	}()
+	timeouts := map[error]time.Duration{
+		errRequestTimeout: time.Duration(c.config.RequestTimeout) * time.Second,
+		errReadTimeout:    time.Duration(c.config.ReadTimeout) * time.Second,
+		errBodyTimeout:    time.Duration(c.config.BodyTimeout) * time.Second,
+	}
+	opened := deadline(timeouts[errRequestTimeout], cancelRead, errRequestTimeout)
+	body, err := src.Open(withTransaction(ctx, tx))
+	opened()
+	if err != nil {
+		err = timeoutError(ctx, err, timeouts)
+		c.logger.Debug("download failed", "url", url, "error", err)
+		return 0, sourceError(url, err)
+	}
+	var hold int64
+	if expected, ok := body.(*expectedBody); ok {
+		hold = expected.minSize
+	}
+	body = withReadDeadline(body, timeouts[errReadTimeout], cancelRead)
+	defer body.Close()
+	defer deadline(timeouts[errBodyTimeout], cancelRead, errBodyTimeout)()
+
+	bodyStarted := time.Now()
+	var dst io.Writer = &pacingDiscarder{ctx: ctx, consumer: c, source: source}
+	saving := c.store.open(url, dst)
+	if saving != nil {
+		dst = saving
+	}
+	counter := &countingReader{Reader: c.limitObject(body), collector: c.metricsCollector, flushed: bodyStarted, hold: hold}
+	n, bufferSize, err := c.buffers.copy(dst, counter, url)
+	counter.flush()
+	saving.finish(err)
+	if counter.dropped {
+		n = 0
+	}
+	c.metricsCollector.SetBufferSize(url, bufferSize)
+	var ttfb, latency time.Duration
+	if !counter.firstByte.IsZero() {
+		ttfb = counter.firstByte.Sub(started)
+	}
+	if err == nil {
+		latency = time.Since(started)
+	}
+	c.metricsCollector.RecordTimes(ttfb, latency)
+	err = timeoutError(ctx, err, timeouts)
+	if err != nil && err != context.Canceled {
+		c.logger.Debug("download failed", "url", url, "error", err)
+		return n, sourceError(url, err)
+	}
+	c.logger.Log(ctx, logging.LevelTrace, "download complete", "url", url, "bytes", n, "duration", time.Since(bodyStarted).Round(time.Millisecond))
+	return n, nil
+}
+
+// newRequest builds a GET request for source with its headers, auth,
+// signature and proxy selection applied.
+func (c *Consumer) newRequest(ctx context.Context, source configs.Source) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", source.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	route := c.proxies.route(source)
+	if _, err := route.forURL(req.URL); err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, proxyContextKey{}, route)
+	if c.logger.Enabled(ctx, logging.LevelTrace) {
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				if !info.Reused {
+					c.logger.Log(ctx, logging.LevelTrace, "new connection", "host", req.URL.Host, "proxy", describeProxy(route.last()))
+				}
+			},
+		})
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("Cache-Control", "no-cache")
+	if p, ok := personaFrom(ctx); ok {
+		for name, values := range p.header {
+			req.Header[name] = values
+		}
+	} else if c.runID != "" {
+		req.Header.Set(RunHeader, c.runID)
+	}
+	for name, value := range source.Headers {
+		req.Header.Set(name, value)
+	}
+	if auth := source.Auth; auth != nil {
+		switch auth.Type {
+		case "basic":
+			req.SetBasicAuth(auth.Username, auth.Password)
+		case "bearer":
+			req.Header.Set("Authorization", "Bearer "+auth.Token)
+		}
+	}
+	if c.config.UseRandomization {
+		// Keep the source's own query, which may select the content.
+		cacheBuster := fmt.Sprintf("t=%d", time.Now().UnixNano())
+		if req.URL.RawQuery != "" {
+			cacheBuster = req.URL.RawQuery + "&" + cacheBuster
+		}
+		req.URL.RawQuery = cacheBuster
+	}
+	if err := c.sign(req, source.Auth); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
@@ -0,0 +1,149 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+
+	"dataconsumer/configs"
+)
+
+// SetRateLimit changes the bandwidth ceiling while the consumer is running.
+// A zero rate removes the limit. A limiter passed to WithRateLimiter is
+// only changed if it has a SetRate method.
+func (c *Consumer) SetRateLimit(rate configs.Rate) {
+	c.paceMu.Lock()
+	c.rateLimit = rate
+	if !c.customLimiter {
+		if bucket, ok := c.limiter.(*TokenBucket); ok && rate > 0 {
+			bucket.SetRate(rate)
+		} else {
+			c.limiter = newLimiter(rate)
+		}
+	} else if setter, ok := c.limiter.(rateSetter); ok {
+		setter.SetRate(rate)
+	}
+	target := c.targetRate
+	c.paceMu.Unlock()
+	c.hooks.rateChanged(rate, target)
+}
+
+// RateLimit returns the current bandwidth ceiling, or zero if unlimited.
+func (c *Consumer) RateLimit() configs.Rate {
+	c.paceMu.Lock()
+	defer c.paceMu.Unlock()
+	return c.rateLimit
+}
+
+// SetTargetRate changes the rate the consumer aims for and reports as its
+// target.
+func (c *Consumer) SetTargetRate(rate configs.Rate) {
+	c.paceMu.Lock()
+	c.targetRate = rate
+	if c.target != nil {
+		c.target.SetRate(rate)
+	}
+	c.metricsCollector.SetTargetRate(rate.MBPerMinute())
+	limit := c.rateLimit
+	c.paceMu.Unlock()
+	c.hooks.rateChanged(limit, rate)
+}
+
+// TargetRate returns the rate the consumer aims for.
+func (c *Consumer) TargetRate() configs.Rate {
+	c.paceMu.Lock()
+	defer c.paceMu.Unlock()
+	return c.targetRate
+}
+
+// pace waits for the target pacer and the rate limiter to let n more bytes
+// through, and stops the consumer if the limiter reports the quota
+// exceeded.
+func (c *Consumer) pace(ctx context.Context, n int) {
+	probing := c.probing.Load()
+	if probing && !c.customLimiter {
+		return
+	}
+	if !probing && c.target != nil && c.target.Wait(ctx, n) != nil {
+		return
+	}
+	c.paceMu.Lock()
+	limiter := c.limiter
+	c.paceMu.Unlock()
+	if err := limiter.Wait(ctx, n); errors.Is(err, ErrQuotaExceeded) {
+		c.fail(err)
+	}
+}
+
+// Pause stops all workers from reading further data until Resume is called.
+// In-flight responses stay open but are no longer drained.
+func (c *Consumer) Pause() {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if c.resume == nil {
+		c.resume = make(chan struct{})
+	}
+}
+
+// Resume lets paused workers continue. The built-in rate limiter holds at
+// most a second's worth of traffic, so the pause is not made up for with a
+// burst.
+func (c *Consumer) Resume() {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if c.resume != nil {
+		close(c.resume)
+		c.resume = nil
+		c.target.skip()
+	}
+}
+
+// Paused reports whether the consumer is paused.
+func (c *Consumer) Paused() bool {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	return c.resume != nil
+}
+
+func (c *Consumer) waitIfPaused(ctx context.Context) {
+	c.pauseMu.Lock()
+	resume := c.resume
+	c.pauseMu.Unlock()
+	if resume == nil {
+		return
+	}
+	select {
+	case <-resume:
+	case <-ctx.Done():
+	}
+}
+
+// SetSources replaces the data sources while the consumer is running.
+// Workers switch to the new sources with their next request. Transfers in
+// flight on a removed source may finish for up to drain_grace seconds,
+// reported by SourceDraining and SourceDrained events, before they are
+// canceled.
+func (c *Consumer) SetSources(sources []configs.Source) error {
+	weighted, err := weightedSources(c, sources)
+	if err != nil {
+		return err
+	}
+	c.sourcesMu.Lock()
+	old := c.sources
+	c.sources = weighted
+	c.sourcesMu.Unlock()
+	c.health.track(sources)
+	c.drainRemoved(old, weighted)
+	return nil
+}
+
+func (c *Consumer) currentSources() []Source {
+	c.sourcesMu.Lock()
+	defer c.sourcesMu.Unlock()
+	return c.sources
+}
+
+// ValidateSources reports whether sources could be passed to SetSources.
+func ValidateSources(sources []configs.Source) error {
+	_, err := weightedSources(nil, sources)
+	return err
+}
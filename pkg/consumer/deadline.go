@@ -0,0 +1,74 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// errReadTimeout is the cause a request is canceled with when its body
+// stalls.
+var errReadTimeout = fmt.Errorf("no data received within the read timeout")
+
+// errRequestTimeout and errBodyTimeout are the causes a request is
+// canceled with when its response does not arrive within request_timeout
+// or its body is not read in full within body_timeout.
+var (
+	errRequestTimeout = fmt.Errorf("no response within the request timeout")
+	errBodyTimeout    = fmt.Errorf("body not received within the body timeout")
+)
+
+// deadline cancels a request with cause once timeout has passed, unless
+// the returned function is called first to stop it. A timeout of zero
+// never cancels.
+func deadline(timeout time.Duration, cancel context.CancelCauseFunc, cause error) (stop func()) {
+	if timeout <= 0 {
+		return func() {}
+	}
+	timer := time.AfterFunc(timeout, func() { cancel(cause) })
+	return func() { timer.Stop() }
+}
+
+// timeoutError describes err as the timeout that canceled ctx, if one did.
+func timeoutError(ctx context.Context, err error, timeouts map[error]time.Duration) error {
+	cause := context.Cause(ctx)
+	if timeout, ok := timeouts[cause]; ok && err != nil {
+		return fmt.Errorf("%w of %s", cause, timeout)
+	}
+	return err
+}
+
+// deadlineBody fails a request whose body delivers no data for timeout,
+// so a server that stops sending mid-body without closing the connection
+// does not hold a worker until the connection is reaped. Only time spent
+// in Read counts; waiting for the rate limiter does not.
+type deadlineBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// withReadDeadline wraps body so that a Read taking longer than timeout
+// cancels the request with errReadTimeout. A timeout of zero returns body
+// unchanged.
+func withReadDeadline(body io.ReadCloser, timeout time.Duration, cancel context.CancelCauseFunc) io.ReadCloser {
+	if timeout <= 0 {
+		return body
+	}
+	timer := time.AfterFunc(timeout, func() { cancel(errReadTimeout) })
+	timer.Stop()
+	return &deadlineBody{ReadCloser: body, timeout: timeout, timer: timer}
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	b.timer.Reset(b.timeout)
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Stop()
+	return n, err
+}
+
+func (b *deadlineBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
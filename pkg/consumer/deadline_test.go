@@ -0,0 +1,112 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/consumertest"
+)
+
+func TestTimeouts(t *testing.T) {
+	server := consumertest.NewServer()
+	defer server.Close()
+	tests := []struct {
+		name    string
+		payload consumertest.Payload
+		// request, read and body are the timeouts in seconds.
+		request, read, body int
+		want                error
+	}{
+		{
+			name:    "request timeout",
+			payload: consumertest.Payload{Size: 64 << 10, Delay: 3 * time.Second},
+			request: 1,
+			want:    errRequestTimeout,
+		},
+		{
+			name:    "read timeout",
+			payload: consumertest.Payload{Size: 1 << 20, Stall: 3 * time.Second, StallAfter: 64 << 10},
+			read:    1,
+			want:    errReadTimeout,
+		},
+		{
+			name:    "body timeout",
+			payload: consumertest.Payload{Size: 10 << 20, Rate: configs.Rate(1 << 20)},
+			body:    1,
+			want:    errBodyTimeout,
+		},
+		{
+			name:    "request timeout does not cover the body",
+			payload: consumertest.Payload{Size: 1536 << 10, Rate: configs.Rate(1 << 20)},
+			request: 1,
+		},
+		{
+			name:    "in time",
+			payload: consumertest.Payload{Size: 1 << 20},
+			request: 1, read: 1, body: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := configs.DefaultConfig()
+			config.TargetRate = configs.RateFromMBPerMinute(1 << 20)
+			config.RequestTimeout, config.ReadTimeout, config.BodyTimeout = tt.request, tt.read, tt.body
+			c, err := NewConsumer(WithConfig(config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Stop()
+			src, err := newSource(c, server.Source(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			started := time.Now()
+			n, err := c.consumeData(context.Background(), src)
+			elapsed := time.Since(started)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("consumeData: %v", err)
+				}
+				if n != tt.payload.Size.Bytes() {
+					t.Errorf("read %d bytes, want %d", n, tt.payload.Size.Bytes())
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("consumeData error = %v, want %v", err, tt.want)
+			}
+			if !strings.Contains(err.Error(), "of 1s") {
+				t.Errorf("error %q does not name the timeout", err)
+			}
+			if elapsed < time.Second || elapsed > 2500*time.Millisecond {
+				t.Errorf("timed out after %s, want about 1s", elapsed)
+			}
+		})
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	cause := errors.New("cause")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	stop := deadline(20*time.Millisecond, cancel, cause)
+	<-ctx.Done()
+	stop()
+	if got := timeoutError(ctx, context.Canceled, map[error]time.Duration{cause: 20 * time.Millisecond}); got == nil || got.Error() != "cause of 20ms" {
+		t.Errorf("timeoutError = %v, want cause of 20ms", got)
+	}
+
+	ctx, cancel = context.WithCancelCause(context.Background())
+	deadline(20*time.Millisecond, cancel, cause)()
+	deadline(0, cancel, cause)()
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Error("stopped or zero deadline canceled the context")
+	}
+	if err := timeoutError(ctx, nil, map[error]time.Duration{cause: time.Second}); err != nil {
+		t.Errorf("timeoutError without an error = %v", err)
+	}
+}
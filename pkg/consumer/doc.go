@@ -0,0 +1,56 @@
+// Package consumer is the consumption engine of dataconsumer: it downloads
+// from a set of HTTP(S) sources with many concurrent workers, discards the
+// data and counts it in a metrics.Collector, pacing itself to a target rate
+// and an optional bandwidth ceiling.
+//
+// Programs can embed it instead of running the dataconsumer binary. A
+// configuration file loaded with configs.LoadConfig can be passed with
+// WithConfig; other options set individual settings:
+//
+//	c, err := consumer.NewConsumer(
+//		consumer.WithSources(configs.Source{URL: "https://example.com/big.iso"}),
+//		consumer.WithMaxBandwidth(configs.RateFromMBPerMinute(500)),
+//	)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+//	defer cancel()
+//	result, err := c.Run(ctx)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	fmt.Println(result.Reason, result.Stats.BytesTransferred)
+//
+// Run blocks until its context is done or the configured duration or data
+// cap is reached. Start and Stop run the consumer in the background
+// instead.
+//
+// Sources are HTTP(S) URLs by default. Other kinds of source implement
+// Source and are registered for a protocol name with RegisterProtocol;
+// configured sources with that protocol then use them.
+//
+// Workers are paced by a RateLimiter: the built-in TokenBucket enforces the
+// bandwidth ceiling, and WithRateLimiter substitutes another.
+//
+// Requests can be changed on their way out and responses on their way in
+// with WithMiddleware, and sent through another transport with
+// WithTransport.
+//
+// Errors can be inspected with errors.Is and errors.As: failed requests
+// are *SourceError values, and Run reports ErrSourceUnavailable,
+// ErrRateUnachievable or the error that stopped the consumer, such as
+// ErrQuotaExceeded.
+//
+// Events returns the same kind of information as a channel of Event
+// values, for code that prefers to select on it.
+//
+// Hooks registered with OnRequestStart, OnRequestDone, OnBytes, OnError,
+// OnSourceDisabled and OnRateChange let embedders observe requests and
+// react to them. They run synchronously on the goroutine that triggered
+// them, usually a worker, and may run concurrently with each other, so
+// they must be safe for concurrent use and return quickly.
+//
+// The exported API of this package and of package metrics follows semantic
+// versioning: it only changes incompatibly with a new major version.
+package consumer
@@ -0,0 +1,175 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrDrainTimeout is the Err of a SourceDrained event whose source still
+// had transfers in flight when drain_grace expired. Those were canceled,
+// and the bytes they had read are counted.
+var ErrDrainTimeout = errors.New("drain grace period expired")
+
+// transfers tracks the requests in flight on each source so that those on
+// a removed source can finish while no new work is assigned to it.
+type transfers struct {
+	mu       sync.Mutex
+	bySource map[string]*sourceTransfers
+}
+
+type sourceTransfers struct {
+	cancels map[int]context.CancelFunc
+	next    int
+	// drain is set while the source drains after its removal.
+	drain *drain
+}
+
+type drain struct {
+	started time.Time
+	// requests is how many transfers were in flight when the source was
+	// removed, and bytes what the transfers that ended since have read.
+	requests int
+	bytes    int64
+	// idle is closed once the last transfer on the source has ended.
+	idle chan struct{}
+}
+
+// start records a request on url, which cancel aborts, and returns the
+// function to call with the bytes read when it has ended.
+func (t *transfers) start(url string, cancel context.CancelFunc) func(n int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.bySource == nil {
+		t.bySource = make(map[string]*sourceTransfers)
+	}
+	st := t.bySource[url]
+	if st == nil {
+		st = &sourceTransfers{cancels: make(map[int]context.CancelFunc)}
+		t.bySource[url] = st
+	}
+	id := st.next
+	st.next++
+	st.cancels[id] = cancel
+	return func(n int64) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(st.cancels, id)
+		if st.drain != nil {
+			st.drain.bytes += n
+		}
+		if len(st.cancels) > 0 {
+			return
+		}
+		if st.drain != nil {
+			close(st.drain.idle)
+		}
+		if t.bySource[url] == st {
+			delete(t.bySource, url)
+		}
+	}
+}
+
+// beginDrain marks the transfers in flight on url as draining, and
+// returns nil if there are none or the source is draining already.
+func (t *transfers) beginDrain(url string) *drain {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := t.bySource[url]
+	if st == nil || st.drain != nil || len(st.cancels) == 0 {
+		return nil
+	}
+	st.drain = &drain{started: time.Now(), requests: len(st.cancels), idle: make(chan struct{})}
+	return st.drain
+}
+
+// cancel aborts the transfers in flight on url and returns how many there
+// were.
+func (t *transfers) cancel(url string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := t.bySource[url]
+	if st == nil {
+		return 0
+	}
+	for _, cancel := range st.cancels {
+		cancel()
+	}
+	return len(st.cancels)
+}
+
+// endDrain stops counting the bytes of url's transfers for d.
+func (t *transfers) endDrain(url string, d *drain) (requests int, bytes int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if st := t.bySource[url]; st != nil && st.drain == d {
+		st.drain = nil
+	}
+	return d.requests, d.bytes
+}
+
+// drainRemoved drains every source of old that is not in current.
+func (c *Consumer) drainRemoved(old, current []Source) {
+	kept := make(map[string]bool, len(current))
+	for _, src := range current {
+		kept[src.Config().URL] = true
+	}
+	for _, src := range old {
+		url := src.Config().URL
+		if kept[url] {
+			continue
+		}
+		if d := c.transfers.beginDrain(url); d != nil {
+			go c.drain(url, d)
+		}
+	}
+}
+
+// drain waits up to drain_grace for the transfers on the removed source
+// url to finish, then cancels those left, and reports both as events.
+// Transfers are left running if the source is added back meanwhile.
+func (c *Consumer) drain(url string, d *drain) {
+	c.logger.Info("draining removed source", "url", url, "requests", d.requests)
+	c.emit(Event{Type: SourceDraining, Source: url, Requests: d.requests})
+
+	var expired <-chan time.Time
+	if grace := time.Duration(c.config.DrainGrace) * time.Second; grace > 0 {
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	var err error
+	select {
+	case <-d.idle:
+	case <-c.ctx.Done():
+		// Stop waits for the transfers and counts them.
+		return
+	case <-expired:
+		if c.hasSource(url) {
+			c.transfers.endDrain(url, d)
+			c.logger.Info("removed source added back while draining", "url", url)
+			return
+		}
+		err = ErrDrainTimeout
+		canceled := c.transfers.cancel(url)
+		c.logger.Warn("drain grace period expired, canceled transfers", "url", url, "requests", canceled)
+		select {
+		case <-d.idle:
+		case <-time.After(forcedCloseWait):
+		}
+	}
+	requests, bytes := c.transfers.endDrain(url, d)
+	c.logger.Info("source drained", "url", url, "requests", requests, "bytes", bytes, "duration", time.Since(d.started).Round(time.Millisecond))
+	c.emit(Event{Type: SourceDrained, Source: url, Requests: requests, Bytes: bytes, Duration: time.Since(d.started), Err: err})
+}
+
+// hasSource reports whether url is one of the current sources.
+func (c *Consumer) hasSource(url string) bool {
+	for _, src := range c.currentSources() {
+		if src.Config().URL == url {
+			return true
+		}
+	}
+	return false
+}
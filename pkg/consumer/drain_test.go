@@ -0,0 +1,97 @@
+package consumer_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/consumer"
+	"dataconsumer/pkg/consumertest"
+)
+
+func TestDrainEvents(t *testing.T) {
+	server := consumertest.NewServer()
+	defer server.Close()
+	fast := server.Source(consumertest.Payload{Size: 64 << 10})
+	tests := []struct {
+		name string
+		// removed is the source removed while its transfers run.
+		removed configs.Source
+		grace   int
+		wantErr error
+	}{
+		{
+			name:    "transfers finish",
+			removed: server.Source(consumertest.Payload{Size: 1 << 20, Rate: configs.Rate(1 << 20)}),
+			grace:   10,
+		},
+		{
+			name:    "grace period expires",
+			removed: server.Source(consumertest.Payload{Size: 100 << 20, Rate: configs.Rate(1 << 20)}),
+			grace:   1,
+			wantErr: consumer.ErrDrainTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := configs.DefaultConfig()
+			config.DataSources = []configs.Source{tt.removed}
+			config.TargetMode = configs.Unpaced
+			config.ConcurrencyFactor = 2
+			config.DrainGrace = tt.grace
+			c, err := consumer.NewConsumer(consumer.WithConfig(config), quiet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			events := c.Events()
+			c.Start()
+			defer c.Stop()
+			deadline := time.Now().Add(5 * time.Second)
+			for server.Requests() < 2 {
+				if time.Now().After(deadline) {
+					t.Fatal("the workers did not start")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			time.Sleep(200 * time.Millisecond)
+			removed := time.Now()
+			if err := c.SetSources([]configs.Source{fast}); err != nil {
+				t.Fatal(err)
+			}
+
+			var draining, drained *consumer.Event
+			timeout := time.After(10 * time.Second)
+			for drained == nil {
+				select {
+				case event := <-events:
+					if event.Source != tt.removed.URL {
+						continue
+					}
+					switch event.Type {
+					case consumer.SourceDraining:
+						draining = &event
+					case consumer.SourceDrained:
+						drained = &event
+					}
+				case <-timeout:
+					t.Fatal("no source_drained event")
+				}
+			}
+			if draining == nil || draining.Requests < 1 {
+				t.Fatalf("source_draining = %+v, want one with the requests in flight", draining)
+			}
+			if !errors.Is(drained.Err, tt.wantErr) {
+				t.Errorf("source_drained error = %v, want %v", drained.Err, tt.wantErr)
+			}
+			if drained.Requests != draining.Requests || drained.Bytes <= 0 {
+				t.Errorf("source_drained = %d requests, %d bytes, want the %d requests draining and their bytes", drained.Requests, drained.Bytes, draining.Requests)
+			}
+			if tt.wantErr != nil {
+				if elapsed := time.Since(removed); elapsed < time.Duration(tt.grace)*time.Second {
+					t.Errorf("drained after %s, before the grace period of %ds", elapsed, tt.grace)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package consumer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/metrics"
+)
+
+const (
+	// egressTimeout bounds an egress check.
+	egressTimeout = 10 * time.Second
+	// egressBodyLimit is how much of the echo endpoint's answer is read.
+	egressBodyLimit = 64 << 10
+	// ProbeHeader carries a random token on egress checks, to see whether
+	// something between the consumer and the echo endpoint drops or
+	// rewrites headers.
+	ProbeHeader = "X-DataConsumer-Probe"
+)
+
+// proxyHeaders are the request headers proxies and load balancers add.
+var proxyHeaders = []string{"Via", "Forwarded", "X-Forwarded-For", "X-Real-Ip", "X-Bluecoat-Via", "X-Proxy-Id", "Client-Ip"}
+
+// echo is the answer of an echo endpoint.
+type echo struct {
+	Origin  string            `json:"origin"`
+	Headers map[string]string `json:"headers"`
+}
+
+// startEgress starts the egress checks if they are configured.
+func (c *Consumer) startEgress() {
+	if c.config.Egress == nil {
+		return
+	}
+	c.wg.Add(1)
+	go c.watchEgress(c.config.Egress.WithDefaults())
+}
+
+// watchEgress checks the egress path at once and then every interval
+// until the consumer stops.
+func (c *Consumer) watchEgress(egress configs.EgressConfig) {
+	defer c.wg.Done()
+	interval := time.Duration(egress.Interval) * time.Second
+	for {
+		c.checkEgress(egress)
+		timer := time.NewTimer(interval)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// checkEgress runs one check and records what it saw.
+func (c *Consumer) checkEgress(egress configs.EgressConfig) {
+	ctx, cancel := context.WithTimeout(c.ctx, egressTimeout)
+	defer cancel()
+	seen, err := c.ProbeEgress(ctx, egress.URL)
+	if err != nil {
+		if c.ctx.Err() == nil {
+			c.logger.Debug("egress check failed", "url", egress.URL, "error", err)
+		}
+		return
+	}
+	if c.metricsCollector.RecordEgress(time.Now(), seen) {
+		c.logger.Info("egress changed", "public_ip", seen.PublicIP, "nat", seen.NAT, "intermediaries", seen.Intermediaries)
+	}
+}
+
+// ProbeEgress asks the echo endpoint at rawURL, through the proxy the
+// consumer would use for it, which address the request came from and which
+// headers reached it. The address is behind NAT if no local interface has
+// it. Proxy headers in the echoed request and a probe header or User-Agent
+// that did not arrive as sent are reported as intermediaries.
+func (c *Consumer) ProbeEgress(ctx context.Context, rawURL string) (metrics.Egress, error) {
+	req, err := c.newRequest(ctx, configs.Source{URL: rawURL})
+	if err != nil {
+		return metrics.Egress{}, err
+	}
+	token := make([]byte, 8)
+	rand.Read(token)
+	req.Header.Set(ProbeHeader, hex.EncodeToString(token))
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return metrics.Egress{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return metrics.Egress{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var answer echo
+	if err := json.NewDecoder(io.LimitReader(resp.Body, egressBodyLimit)).Decode(&answer); err != nil {
+		return metrics.Egress{}, fmt.Errorf("invalid echo: %w", err)
+	}
+	// Some endpoints list the addresses the request was forwarded for
+	// before the one it came from.
+	origins := strings.Split(answer.Origin, ",")
+	ip := net.ParseIP(strings.TrimSpace(origins[len(origins)-1]))
+	if ip == nil {
+		return metrics.Egress{}, fmt.Errorf("invalid origin %q", answer.Origin)
+	}
+	return metrics.Egress{
+		PublicIP:       ip.String(),
+		NAT:            !isLocalAddress(ip),
+		Intermediaries: intermediaries(req.Header, answer.Headers),
+	}, nil
+}
+
+// intermediaries describes what the echoed headers reveal about proxies
+// between the consumer and the echo endpoint, given the headers sent.
+func intermediaries(sent http.Header, echoed map[string]string) []string {
+	received := make(http.Header, len(echoed))
+	for name, value := range echoed {
+		received.Set(name, value)
+	}
+	var found []string
+	for _, name := range proxyHeaders {
+		if value := received.Get(name); value != "" {
+			found = append(found, name+": "+value)
+		}
+	}
+	for _, name := range []string{ProbeHeader, "User-Agent"} {
+		switch value := received.Get(name); {
+		case value == "":
+			found = append(found, name+" removed")
+		case value != sent.Get(name):
+			found = append(found, name+" rewritten")
+		}
+	}
+	slices.Sort(found)
+	return found
+}
+
+// isLocalAddress reports whether a local network interface has ip.
+func isLocalAddress(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if prefix, ok := addr.(*net.IPNet); ok && prefix.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrSourceUnavailable is returned by Run when every source was
+	// unhealthy at the end of the run. The error also wraps each source's
+	// last *SourceError.
+	ErrSourceUnavailable = errors.New("no data source available")
+	// ErrRateUnachievable is returned by Run when the run reached its
+	// duration or data cap with an average rate below the target rate, or
+	// below the target requests per second if one is set. In the at_most
+	// mode, averaging 95% of the target rate is enough.
+	ErrRateUnachievable = errors.New("target rate not achieved")
+	// ErrQuotaExceeded stops the consumer when a RateLimiter's Wait
+	// returns an error wrapping it, e.g. because a shared data budget is
+	// spent. Run and Stop then return that error.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrUnexpectedContent is wrapped by the SourceError of a response
+	// that does not meet its source's expect settings, such as an HTML
+	// page from a captive portal. Its bytes are not counted.
+	ErrUnexpectedContent = errors.New("unexpected content")
+	// ErrStopped is returned by Run on a consumer that has already been
+	// stopped.
+	ErrStopped = errors.New("consumer has already been stopped")
+)
+
+// SourceError is a failed request to a source. Hooks, Run and the
+// source's health report it; errors.Is(err, ErrSourceUnavailable) holds
+// for every SourceError.
+type SourceError struct {
+	URL string
+	// StatusCode is the HTTP status the source answered with, or zero if
+	// the request failed without a response or the source is not HTTP.
+	StatusCode int
+	Err        error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("source %s: %v", e.URL, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrSourceUnavailable.
+func (e *SourceError) Is(target error) bool {
+	return target == ErrSourceUnavailable
+}
+
+// reason returns the error a source failed with, without the URL that a
+// *SourceError adds.
+func reason(err error) error {
+	var sourceErr *SourceError
+	if errors.As(err, &sourceErr) {
+		return sourceErr.Err
+	}
+	return err
+}
+
+// sourceError wraps err as a *SourceError for url unless it already is
+// one.
+func sourceError(url string, err error) error {
+	var sourceErr *SourceError
+	if err == nil || errors.As(err, &sourceErr) {
+		return err
+	}
+	return &SourceError{URL: url, Err: err}
+}
+
+// unavailable returns ErrSourceUnavailable wrapping the last error of each
+// source if every source is unhealthy, and nil otherwise.
+func (c *Consumer) unavailable() error {
+	sources := c.health.snapshot()
+	if len(sources) == 0 {
+		return nil
+	}
+	errs := []error{ErrSourceUnavailable}
+	for _, health := range sources {
+		if health.Healthy {
+			return nil
+		}
+		errs = append(errs, health.lastErr)
+	}
+	return errors.Join(errs...)
+}
+
+// failure returns the error the consumer was stopped by, if any.
+func (c *Consumer) failure() error {
+	select {
+	case <-c.failed:
+		return c.cause
+	default:
+		return nil
+	}
+}
+
+// fail stops the workers because of err, which Run and Stop then return.
+// Only the first cause is kept.
+func (c *Consumer) fail(err error) {
+	c.failOnce.Do(func() {
+		c.cause = err
+		c.logger.Warn("stopping", "error", err)
+		close(c.failed)
+		c.cancel()
+	})
+}
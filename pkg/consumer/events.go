@@ -0,0 +1,145 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/metrics"
+)
+
+// eventBuffer is how many events Events buffers for a slow reader.
+const eventBuffer = 256
+
+// EventType identifies what an Event reports.
+type EventType string
+
+const (
+	// TransferCompleted is sent for every successful request, with its
+	// Source, Bytes and Duration.
+	TransferCompleted EventType = "transfer_completed"
+	// SourceFailed is sent when a Source is reported unhealthy after
+	// consecutive failed requests, with the last Err.
+	SourceFailed EventType = "source_failed"
+	// RateTargetMissed is sent when a rate sample, taken every 10
+	// seconds, is below the target rate, with both Rate and TargetRate.
+	RateTargetMissed EventType = "rate_target_missed"
+	// WorkersScaled is sent when the number of Workers changes.
+	WorkersScaled EventType = "workers_scaled"
+	// ClockStepped is sent when a rate sample finds that the wall clock
+	// jumped, with the jump as Duration. Rates are not affected.
+	ClockStepped EventType = "clock_stepped"
+	// SourceDraining is sent when a Source is removed by SetSources while
+	// Requests are in flight on it, which may still finish.
+	SourceDraining EventType = "source_draining"
+	// SourceDrained is sent when the Requests in flight on a removed
+	// Source have ended, with the Bytes they read and the Duration of the
+	// drain. Err is ErrDrainTimeout if some were canceled.
+	SourceDrained EventType = "source_drained"
+)
+
+// Event is something that happened in a consumer. Only the fields named
+// in the description of its Type are set.
+type Event struct {
+	Type       EventType
+	Time       time.Time
+	Source     string
+	Bytes      int64
+	Duration   time.Duration
+	Err        error
+	Rate       configs.Rate
+	TargetRate configs.Rate
+	Workers    int
+	Requests   int
+}
+
+// eventStream delivers events to the channel returned by Events.
+type eventStream struct {
+	mu     sync.Mutex
+	ch     chan Event
+	closed bool
+}
+
+// Events returns a channel of the consumer's events, which is closed when
+// the consumer stops. Events are dropped rather than slowing down the
+// workers if the channel's buffer is full, so read it promptly. Every call
+// returns the same channel; call it before Start to see every event.
+func (c *Consumer) Events() <-chan Event {
+	c.events.mu.Lock()
+	defer c.events.mu.Unlock()
+	if c.events.ch != nil {
+		return c.events.ch
+	}
+	c.events.ch = make(chan Event, eventBuffer)
+	if c.events.closed {
+		close(c.events.ch)
+		return c.events.ch
+	}
+
+	c.OnRequestDone(func(done RequestDone) {
+		if done.Err == nil {
+			c.emit(Event{Type: TransferCompleted, Source: done.Source.URL, Bytes: done.Bytes, Duration: done.Duration})
+		}
+	})
+	c.OnSourceDisabled(func(source configs.Source, err error) {
+		c.emit(Event{Type: SourceFailed, Source: source.URL, Err: err})
+	})
+	c.metricsCollector.AddSink(&rateWatch{consumer: c})
+	return c.events.ch
+}
+
+// emit sends event unless nobody asked for events, the buffer is full or
+// the consumer has stopped.
+func (c *Consumer) emit(event Event) {
+	c.events.mu.Lock()
+	defer c.events.mu.Unlock()
+	if c.events.ch == nil || c.events.closed {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	select {
+	case c.events.ch <- event:
+	default:
+	}
+}
+
+// closeEvents closes the events channel once the workers have stopped.
+func (c *Consumer) closeEvents() {
+	c.events.mu.Lock()
+	defer c.events.mu.Unlock()
+	if !c.events.closed && c.events.ch != nil {
+		close(c.events.ch)
+	}
+	c.events.closed = true
+}
+
+// rateWatch is a metrics.Sink sending RateTargetMissed and ClockStepped
+// events.
+type rateWatch struct {
+	consumer *Consumer
+	// clockSteps and clockStep are the steps seen in earlier samples.
+	clockSteps int
+	clockStep  time.Duration
+}
+
+func (w *rateWatch) Sample(stats metrics.Stats) error {
+	if stats.TargetRate > 0 && w.consumer.belowTarget(stats.CurrentRate, stats.TargetRate) {
+		w.consumer.emit(Event{
+			Type:       RateTargetMissed,
+			Time:       stats.LastUpdated,
+			Rate:       configs.RateFromMBPerMinute(stats.CurrentRate),
+			TargetRate: configs.RateFromMBPerMinute(stats.TargetRate),
+		})
+	}
+	if stats.ClockSteps > w.clockSteps {
+		w.consumer.emit(Event{Type: ClockStepped, Time: stats.LastUpdated, Duration: stats.ClockStep - w.clockStep})
+	}
+	w.clockSteps, w.clockStep = stats.ClockSteps, stats.ClockStep
+	return nil
+}
+
+func (w *rateWatch) Close(metrics.Stats) error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package consumer
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dataconsumer/configs"
+)
+
+// checkContent returns an error wrapping ErrUnexpectedContent if resp
+// does not meet expect, judging by its headers. A response of unknown
+// length passes the size check; its body is checked instead.
+func checkContent(resp *http.Response, expect *configs.Expectation) error {
+	if len(expect.ContentType) > 0 {
+		header := resp.Header.Get("Content-Type")
+		mediaType, _, err := mime.ParseMediaType(header)
+		if err != nil || !matchesMediaType(mediaType, expect.ContentType) {
+			return fmt.Errorf("%w: content type %q, want %s", ErrUnexpectedContent, header, strings.Join(expect.ContentType, " or "))
+		}
+	}
+	if size := objectLength(resp); size >= 0 && size < expect.MinSize.Bytes() {
+		return fmt.Errorf("%w: object of %s, want at least %s", ErrUnexpectedContent, configs.Size(size), expect.MinSize)
+	}
+	return nil
+}
+
+func matchesMediaType(mediaType string, accepted []string) bool {
+	for _, want := range accepted {
+		want = strings.ToLower(want)
+		if prefix, ok := strings.CutSuffix(want, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == want {
+			return true
+		}
+	}
+	return false
+}
+
+// objectLength returns the size of the whole object resp is (part of),
+// from Content-Range for partial responses, or -1 if unknown.
+func objectLength(resp *http.Response) int64 {
+	if resp.StatusCode != http.StatusPartialContent {
+		return resp.ContentLength
+	}
+	_, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	if !ok {
+		return -1
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// expectedBody fails a body of unknown length that ends before minSize
+// bytes. The consumer does not count its bytes until minSize have been
+// read, so a short body is not counted at all.
+type expectedBody struct {
+	io.ReadCloser
+	minSize int64
+	read    int64
+}
+
+func (b *expectedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err == io.EOF && b.read < b.minSize {
+		err = fmt.Errorf("%w: body ended after %s, want at least %s", ErrUnexpectedContent, configs.Size(b.read), configs.Size(b.minSize))
+	}
+	return n, err
+}
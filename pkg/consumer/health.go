@@ -0,0 +1,106 @@
+package consumer
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// unhealthyAfter is the number of consecutive failed requests after which
+// a source is reported as unhealthy.
+const unhealthyAfter = 3
+
+// SourceHealth summarises the recent request outcomes for one source.
+type SourceHealth struct {
+	URL                 string    `json:"url"`
+	Healthy             bool      `json:"healthy"`
+	Successes           int64     `json:"successes"`
+	Failures            int64     `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+
+	lastErr error
+}
+
+type healthTracker struct {
+	mu      sync.Mutex
+	order   []string
+	sources map[string]*SourceHealth
+}
+
+func newHealthTracker(sources []configs.Source) *healthTracker {
+	t := &healthTracker{sources: make(map[string]*SourceHealth)}
+	t.track(sources)
+	return t
+}
+
+// track reports on the enabled sources from now on. Sources tracked before
+// keep their history.
+func (t *healthTracker) track(sources []configs.Source) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.order = nil
+	for _, source := range sources {
+		if !source.IsEnabled() || slices.Contains(t.order, source.URL) {
+			continue
+		}
+		t.order = append(t.order, source.URL)
+		if t.sources[source.URL] == nil {
+			t.sources[source.URL] = &SourceHealth{URL: source.URL, Healthy: true}
+		}
+	}
+}
+
+// record counts a request outcome and reports whether it made the source
+// unhealthy.
+func (t *healthTracker) record(url string, err error) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := t.sources[url]
+	if h == nil {
+		return false
+	}
+	wasHealthy := h.Healthy
+	if err != nil {
+		h.Failures++
+		h.ConsecutiveFailures++
+		h.LastError = reason(err).Error()
+		h.lastErr = err
+	} else {
+		h.Successes++
+		h.ConsecutiveFailures = 0
+		h.LastSuccess = time.Now()
+	}
+	h.Healthy = h.ConsecutiveFailures < unhealthyAfter
+	return wasHealthy && !h.Healthy
+}
+
+// allUnhealthy reports whether every tracked source is unhealthy.
+func (t *healthTracker) allUnhealthy() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, url := range t.order {
+		if t.sources[url].Healthy {
+			return false
+		}
+	}
+	return len(t.order) > 0
+}
+
+func (t *healthTracker) snapshot() []SourceHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]SourceHealth, 0, len(t.order))
+	for _, url := range t.order {
+		result = append(result, *t.sources[url])
+	}
+	return result
+}
+
+// SourceHealth reports the health of every enabled source.
+func (c *Consumer) SourceHealth() []SourceHealth {
+	return c.health.snapshot()
+}
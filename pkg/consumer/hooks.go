@@ -0,0 +1,134 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// RequestDone describes a finished request for OnRequestDone hooks.
+type RequestDone struct {
+	Source configs.Source
+	// Bytes is the size of the body read, which is less than the response
+	// if the request failed or was canceled part way.
+	Bytes    int64
+	Duration time.Duration
+	// Err is nil for a successful request.
+	Err error
+}
+
+// hooks holds the callbacks registered on a consumer. Each kind runs in
+// registration order, without the lock held so that a hook can register
+// further hooks.
+type hooks struct {
+	mu             sync.RWMutex
+	requestStart   []func(configs.Source)
+	requestDone    []func(RequestDone)
+	bytes          []func(configs.Source, int)
+	errors         []func(configs.Source, error)
+	sourceDisabled []func(configs.Source, error)
+	rateChange     []func(limit, target configs.Rate)
+}
+
+// OnRequestStart registers fn to be called before each request is sent.
+func (c *Consumer) OnRequestStart(fn func(source configs.Source)) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	c.hooks.requestStart = append(c.hooks.requestStart, fn)
+}
+
+// OnRequestDone registers fn to be called when a request has ended, whether
+// it succeeded, failed or was canceled.
+func (c *Consumer) OnRequestDone(fn func(done RequestDone)) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	c.hooks.requestDone = append(c.hooks.requestDone, fn)
+}
+
+// OnBytes registers fn to be called for every chunk of a response body
+// read, with the chunk's size.
+func (c *Consumer) OnBytes(fn func(source configs.Source, n int)) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	c.hooks.bytes = append(c.hooks.bytes, fn)
+}
+
+// OnError registers fn to be called for every failed request. Requests
+// abandoned because the consumer stopped are not errors.
+func (c *Consumer) OnError(fn func(source configs.Source, err error)) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	c.hooks.errors = append(c.hooks.errors, fn)
+}
+
+// OnSourceDisabled registers fn to be called when a source is reported
+// unhealthy after consecutive failed requests, with the last error. The
+// consumer keeps trying the source; fn can remove it with SetSources.
+func (c *Consumer) OnSourceDisabled(fn func(source configs.Source, err error)) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	c.hooks.sourceDisabled = append(c.hooks.sourceDisabled, fn)
+}
+
+// OnRateChange registers fn to be called whenever the rate limit or the
+// target rate is set, with both current values.
+func (c *Consumer) OnRateChange(fn func(limit, target configs.Rate)) {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	c.hooks.rateChange = append(c.hooks.rateChange, fn)
+}
+
+func (h *hooks) requestStarted(source configs.Source) {
+	h.mu.RLock()
+	fns := h.requestStart
+	h.mu.RUnlock()
+	for _, fn := range fns {
+		fn(source)
+	}
+}
+
+func (h *hooks) requestFinished(done RequestDone) {
+	h.mu.RLock()
+	fns := h.requestDone
+	h.mu.RUnlock()
+	for _, fn := range fns {
+		fn(done)
+	}
+}
+
+func (h *hooks) read(source configs.Source, n int) {
+	h.mu.RLock()
+	fns := h.bytes
+	h.mu.RUnlock()
+	for _, fn := range fns {
+		fn(source, n)
+	}
+}
+
+func (h *hooks) failed(source configs.Source, err error) {
+	h.mu.RLock()
+	fns := h.errors
+	h.mu.RUnlock()
+	for _, fn := range fns {
+		fn(source, err)
+	}
+}
+
+func (h *hooks) disabled(source configs.Source, err error) {
+	h.mu.RLock()
+	fns := h.sourceDisabled
+	h.mu.RUnlock()
+	for _, fn := range fns {
+		fn(source, err)
+	}
+}
+
+func (h *hooks) rateChanged(limit, target configs.Rate) {
+	h.mu.RLock()
+	fns := h.rateChange
+	h.mu.RUnlock()
+	for _, fn := range fns {
+		fn(limit, target)
+	}
+}
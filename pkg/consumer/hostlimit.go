@@ -0,0 +1,91 @@
+package consumer
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"dataconsumer/pkg/metrics"
+)
+
+// hostLimiter counts the requests in flight to each host, each of which
+// holds a connection, and with a limit keeps the dispatcher from sending
+// more to a host than max_conns_per_source allows.
+type hostLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	active map[string]int
+	peak   map[string]int
+	order  []string
+	// wake is closed and replaced whenever a request finishes.
+	wake chan struct{}
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{
+		limit:  limit,
+		active: make(map[string]int),
+		peak:   make(map[string]int),
+		wake:   make(chan struct{}),
+	}
+}
+
+// sourceHost returns the host requests for src go to, or its URL if it
+// has none.
+func sourceHost(src Source) string {
+	rawURL := src.Config().URL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// pick returns the first source from sources[next:], wrapping around,
+// whose host is below the limit, and the function to call when its
+// request is done. It blocks while every host is at the limit, and
+// returns false if ctx is done first.
+func (h *hostLimiter) pick(ctx context.Context, sources []Source, next int) (Source, func(), bool) {
+	for {
+		h.mu.Lock()
+		for i := range sources {
+			src := sources[(next+i)%len(sources)]
+			host := sourceHost(src)
+			if h.limit > 0 && h.active[host] >= h.limit {
+				continue
+			}
+			if _, seen := h.peak[host]; !seen {
+				h.order = append(h.order, host)
+			}
+			h.active[host]++
+			h.peak[host] = max(h.peak[host], h.active[host])
+			h.mu.Unlock()
+			return src, func() { h.release(host) }, true
+		}
+		wake := h.wake
+		h.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return nil, nil, false
+		}
+	}
+}
+
+func (h *hostLimiter) release(host string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.active[host]--
+	close(h.wake)
+	h.wake = make(chan struct{})
+}
+
+// stats returns the connections of every host requested so far.
+func (h *hostLimiter) stats() []metrics.HostStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hosts := make([]metrics.HostStats, 0, len(h.order))
+	for _, host := range h.order {
+		hosts = append(hosts, metrics.HostStats{Host: host, Connections: h.active[host], PeakConnections: h.peak[host]})
+	}
+	return hosts
+}
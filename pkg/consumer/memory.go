@@ -0,0 +1,82 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"dataconsumer/configs"
+)
+
+// transferOverhead estimates what a transfer holds besides its read
+// buffer: connection and TLS buffers, the request and its bookkeeping.
+const transferOverhead = 64 << 10
+
+// MemoryUsage reports the consumer's memory budget and use.
+type MemoryUsage struct {
+	// Limit is the configured memory_limit in bytes, zero if unlimited.
+	Limit int64 `json:"limit,omitempty"`
+	// Transfers is the number of transfers in flight and MaxTransfers
+	// the number the budget allows, zero if unlimited.
+	Transfers    int `json:"transfers"`
+	MaxTransfers int `json:"max_transfers,omitempty"`
+	// Reserved is the memory reserved by the transfers in flight: a read
+	// buffer and an estimated overhead each.
+	Reserved int64 `json:"reserved"`
+	// Heap is the process's Go heap in use.
+	Heap uint64 `json:"heap"`
+}
+
+// memoryBudget bounds the transfers in flight so that their buffers fit
+// in the configured memory limit, whatever the number of workers.
+type memoryBudget struct {
+	limit       int64
+	perTransfer int64
+	transfers   *semaphore
+}
+
+// newMemoryBudget returns the budget for limit, or nil if limit is zero.
+// It fails if the limit cannot hold a single transfer.
+func newMemoryBudget(limit configs.Size, bufferSize int) (*memoryBudget, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	perTransfer := int64(bufferSize) + transferOverhead
+	max := limit.Bytes() / perTransfer
+	if max < 1 {
+		return nil, fmt.Errorf("memory_limit %s is smaller than a single transfer (%s)", limit, configs.Size(perTransfer))
+	}
+	return &memoryBudget{limit: limit.Bytes(), perTransfer: perTransfer, transfers: newSemaphore(int(max))}, nil
+}
+
+// reserve blocks until the budget has room for another transfer and
+// returns the function giving it back.
+func (b *memoryBudget) reserve(ctx context.Context, cancel context.CancelFunc) (func(), error) {
+	if b == nil {
+		return func() {}, nil
+	}
+	held, err := b.transfers.acquire(ctx, cancel)
+	if err != nil {
+		return nil, err
+	}
+	return func() { b.transfers.release(held) }, nil
+}
+
+// Memory reports the memory budget and how much of it is in use.
+func (c *Consumer) Memory() MemoryUsage {
+	usage := MemoryUsage{Transfers: c.InFlight()}
+	if b := c.memory; b != nil {
+		usage.Limit = b.limit
+		usage.MaxTransfers, usage.Transfers = b.transfers.size()
+		usage.Reserved = int64(usage.Transfers) * b.perTransfer
+	} else {
+		usage.Reserved = int64(usage.Transfers) * (int64(c.buffers.maxSize()) + transferOverhead)
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	usage.Heap = stats.HeapInuse
+	return usage
+}
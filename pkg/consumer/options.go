@@ -0,0 +1,133 @@
+package consumer
+
+import (
+	"log/slog"
+	"net/http"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/metrics"
+)
+
+// Option configures a Consumer created by NewConsumer.
+type Option func(*settings)
+
+type settings struct {
+	config       *configs.Config
+	sources      []configs.Source
+	targetRate   *configs.Rate
+	maxBandwidth *configs.Rate
+	client       *http.Client
+	logger       *slog.Logger
+	collector    *metrics.Collector
+	limiter      RateLimiter
+	transport    http.RoundTripper
+	middleware   []Middleware
+	runID        string
+}
+
+// WithConfig takes the sources, rates and request settings from config,
+// e.g. one loaded with configs.LoadConfig. The other options override the
+// corresponding settings whatever their order. Without WithConfig,
+// configs.DefaultConfig is used.
+func WithConfig(config *configs.Config) Option {
+	return func(s *settings) { s.config = config }
+}
+
+// WithSources sets the data sources to download from.
+func WithSources(sources ...configs.Source) Option {
+	return func(s *settings) { s.sources = sources }
+}
+
+// WithTargetRate sets the rate the consumer aims for.
+func WithTargetRate(rate configs.Rate) Option {
+	return func(s *settings) { s.targetRate = &rate }
+}
+
+// WithMaxBandwidth sets the bandwidth ceiling; zero means none.
+func WithMaxBandwidth(rate configs.Rate) Option {
+	return func(s *settings) { s.maxBandwidth = &rate }
+}
+
+// WithHTTPClient makes the consumer send its requests with client instead
+// of its own. Per-source proxies and closing stalled connections at
+// shutdown only work with the consumer's own transport.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *settings) { s.client = client }
+}
+
+// WithTransport sends the requests through transport, e.g. a recording or
+// canned transport in tests, instead of the consumer's own or that of the
+// client passed to WithHTTPClient. The same limitations apply as for
+// WithHTTPClient.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(s *settings) { s.transport = transport }
+}
+
+// Middleware wraps the transport requests are sent through, to change
+// requests before they are sent or responses before they are read.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to an http.RoundTripper, for writing
+// middleware.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithMiddleware wraps the transport in middleware, e.g. for custom auth
+// schemes or request signing. The first middleware sees each request
+// first and its response last. WithMiddleware can be given several times;
+// the middleware is chained in order.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(s *settings) { s.middleware = append(s.middleware, middleware...) }
+}
+
+// WithLogger sets the logger, which defaults to slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *settings) { s.logger = logger }
+}
+
+// WithCollector counts the traffic in collector, e.g. to share one with
+// other code. By default the consumer creates its own; see Collector.
+func WithCollector(collector *metrics.Collector) Option {
+	return func(s *settings) { s.collector = collector }
+}
+
+// WithRunID tags the run with id, e.g. a UUID, so that its data can be
+// correlated downstream: requests carry it in an X-DataConsumer-Run header
+// (except with header personas, which are meant to look like browsers)
+// and the collector's stats as RunID.
+func WithRunID(id string) Option {
+	return func(s *settings) { s.runID = id }
+}
+
+// WithRateLimiter paces the workers with limiter instead of the built-in
+// token bucket, e.g. to share one budget between several consumers. The
+// configured bandwidth ceiling is passed to its SetRate method, if it has
+// one.
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(s *settings) { s.limiter = limiter }
+}
+
+// resolve returns the configuration with the overrides applied, leaving
+// the one passed to WithConfig untouched.
+func (s *settings) resolve() *configs.Config {
+	var config configs.Config
+	if s.config != nil {
+		config = *s.config
+	} else {
+		config = *configs.DefaultConfig()
+	}
+	if s.sources != nil {
+		config.DataSources = s.sources
+	}
+	if s.targetRate != nil {
+		config.TargetRate = *s.targetRate
+	}
+	if s.maxBandwidth != nil {
+		config.MaxBandwidth = *s.maxBandwidth
+	}
+	return &config
+}
@@ -0,0 +1,117 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+// persona is a coherent set of browser request headers. Each worker keeps
+// the same persona across its requests, as one browser would.
+type persona struct {
+	header http.Header
+}
+
+var personaLanguages = []string{
+	"en-US,en;q=0.9",
+	"en-GB,en;q=0.9",
+	"en-US,en;q=0.9,es;q=0.8",
+	"de-DE,de;q=0.9,en;q=0.8",
+	"fr-FR,fr;q=0.9,en-US;q=0.8,en;q=0.7",
+	"es-ES,es;q=0.9",
+	"pt-BR,pt;q=0.9,en-US;q=0.8,en;q=0.7",
+	"ja-JP,ja;q=0.9,en-US;q=0.8,en;q=0.7",
+}
+
+// newPersona generates a persona from rng: a recent Chrome, Edge,
+// Firefox or Safari on a matching platform, with the headers that browser
+// sends for a top-level download.
+func newPersona(rng *rand.Rand) persona {
+	h := make(http.Header)
+	language := personaLanguages[rng.Intn(len(personaLanguages))]
+	switch rng.Intn(5) {
+	case 0, 1: // Chrome is the most common browser.
+		version := 124 + rng.Intn(8)
+		platform, os := "Windows", "Windows NT 10.0; Win64; x64"
+		if rng.Intn(3) == 0 {
+			platform, os = "macOS", "Macintosh; Intel Mac OS X 10_15_7"
+		}
+		h.Set("User-Agent", fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.0.0 Safari/537.36", os, version))
+		setChromiumHeaders(h, fmt.Sprintf(`"Chromium";v="%d", "Google Chrome";v="%d", "Not-A.Brand";v="99"`, version, version), platform)
+	case 2:
+		version := 124 + rng.Intn(8)
+		h.Set("User-Agent", fmt.Sprintf("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.0.0 Safari/537.36 Edg/%d.0.0.0", version, version))
+		setChromiumHeaders(h, fmt.Sprintf(`"Chromium";v="%d", "Microsoft Edge";v="%d", "Not-A.Brand";v="99"`, version, version), "Windows")
+	case 3:
+		version := 125 + rng.Intn(8)
+		os := "Windows NT 10.0; Win64; x64"
+		if rng.Intn(3) == 0 {
+			os = "X11; Linux x86_64"
+		}
+		h.Set("User-Agent", fmt.Sprintf("Mozilla/5.0 (%s; rv:%d.0) Gecko/20100101 Firefox/%d.0", os, version, version))
+		h.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		h.Set("Accept-Encoding", "gzip, deflate, br, zstd")
+		h.Set("Sec-Fetch-Dest", "document")
+		h.Set("Sec-Fetch-Mode", "navigate")
+		h.Set("Sec-Fetch-Site", "none")
+		h.Set("Sec-Fetch-User", "?1")
+		h.Set("Upgrade-Insecure-Requests", "1")
+		language = firefoxLanguage(language)
+	case 4:
+		h.Set("User-Agent", fmt.Sprintf("Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.%d Safari/605.1.15", rng.Intn(6)))
+		h.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		h.Set("Accept-Encoding", "gzip, deflate, br")
+		h.Set("Sec-Fetch-Dest", "document")
+		h.Set("Sec-Fetch-Mode", "navigate")
+		h.Set("Sec-Fetch-Site", "none")
+	}
+	h.Set("Accept-Language", language)
+	return persona{header: h}
+}
+
+// firefoxLanguage rewrites a Chromium Accept-Language the way Firefox
+// weights the same preferences.
+func firefoxLanguage(language string) string {
+	primary, _, _ := strings.Cut(language, ",")
+	base, _, _ := strings.Cut(primary, "-")
+	if base == "en" {
+		return primary + ",en;q=0.5"
+	}
+	return primary + "," + base + ";q=0.8,en-US;q=0.5,en;q=0.3"
+}
+
+// setChromiumHeaders sets the headers shared by Chromium based browsers,
+// with the client hints of brands on platform.
+func setChromiumHeaders(h http.Header, brands, platform string) {
+	h.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
+	h.Set("Accept-Encoding", "gzip, deflate, br, zstd")
+	h.Set("Sec-Ch-Ua", brands)
+	h.Set("Sec-Ch-Ua-Mobile", "?0")
+	h.Set("Sec-Ch-Ua-Platform", `"`+platform+`"`)
+	h.Set("Sec-Fetch-Dest", "document")
+	h.Set("Sec-Fetch-Mode", "navigate")
+	h.Set("Sec-Fetch-Site", "none")
+	h.Set("Sec-Fetch-User", "?1")
+	h.Set("Upgrade-Insecure-Requests", "1")
+}
+
+// personaFor returns the persona of the worker with id, the same for
+// every request the worker makes during this run.
+func (c *Consumer) personaFor(id int) persona {
+	return newPersona(rand.New(rand.NewSource(c.personaSeed + int64(id))))
+}
+
+type personaKey struct{}
+
+// withPersona carries the persona of the worker making a request.
+func withPersona(ctx context.Context, p persona) context.Context {
+	return context.WithValue(ctx, personaKey{}, p)
+}
+
+// personaFrom returns the persona carried by ctx, if any.
+func personaFrom(ctx context.Context) (persona, bool) {
+	p, ok := ctx.Value(personaKey{}).(persona)
+	return p, ok
+}
@@ -0,0 +1,379 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/pac"
+)
+
+type proxyContextKey struct{}
+
+const (
+	// minPruneRequests is how many requests a pool proxy must have made
+	// before its error rate can take it out of rotation.
+	minPruneRequests = 20
+	// pacTimeout bounds fetching a PAC file.
+	pacTimeout = 10 * time.Second
+	// pacCacheTTL is how long the proxies a PAC file listed for a URL are
+	// reused before the file is asked again.
+	pacCacheTTL = 5 * time.Minute
+	// pacRetry is how long a proxy from a PAC file that could not be
+	// connected to is skipped in favour of the fallbacks listed after it.
+	pacRetry = time.Minute
+)
+
+// proxySelector picks the proxy for each request from the config's proxy
+// block and per-source overrides.
+type proxySelector struct {
+	pool         []*pooledProxy
+	next         atomic.Uint64
+	maxErrorRate float64
+	noProxy      []string
+	// pac picks the proxy for each URL if the config names a PAC file.
+	pac      *pac.Script
+	user     *url.Userinfo
+	pacCache map[string]pacChoice
+	// pacDown holds until when the PAC proxies that could not be connected
+	// to are skipped, by host.
+	pacDown map[string]time.Time
+
+	mu sync.Mutex
+}
+
+// pacChoice is the proxies a PAC file listed for a URL, in order, with nil
+// for DIRECT.
+type pacChoice struct {
+	proxies []*url.URL
+	expires time.Time
+}
+
+// pooledProxy is a global proxy with its request counts, used to prune it.
+type pooledProxy struct {
+	url      *url.URL
+	requests int64
+	failures int64
+	pruned   atomic.Bool
+}
+
+func newProxySelector(config *configs.ProxyConfig) (*proxySelector, error) {
+	selector := &proxySelector{}
+	if config == nil {
+		return selector, nil
+	}
+	if config.PAC != "" {
+		if config.URL != "" || len(config.Pool) > 0 {
+			return nil, fmt.Errorf("proxy pac cannot be combined with url or pool")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), pacTimeout)
+		defer cancel()
+		script, err := pac.Load(ctx, config.PAC)
+		if err != nil {
+			return nil, err
+		}
+		selector.pac = script
+		selector.pacCache = make(map[string]pacChoice)
+		selector.pacDown = make(map[string]time.Time)
+		if config.Username != "" {
+			selector.user = url.UserPassword(config.Username, config.Password)
+		}
+		selector.noProxy = config.NoProxy
+		return selector, nil
+	}
+	if config.URL == "" && len(config.Pool) == 0 {
+		return selector, nil
+	}
+	if config.MaxErrorRate < 0 || config.MaxErrorRate > 100 {
+		return nil, fmt.Errorf("proxy max_error_rate %v is not a percentage", config.MaxErrorRate)
+	}
+	raw := config.Pool
+	if config.URL != "" {
+		raw = append([]string{config.URL}, raw...)
+	}
+	for _, r := range raw {
+		proxyURL, err := parseProxyURL(r)
+		if err != nil {
+			return nil, err
+		}
+		if config.Username != "" && proxyURL.User == nil {
+			proxyURL.User = url.UserPassword(config.Username, config.Password)
+		}
+		selector.pool = append(selector.pool, &pooledProxy{url: proxyURL})
+	}
+	selector.maxErrorRate = config.MaxErrorRate
+	selector.noProxy = config.NoProxy
+	return selector, nil
+}
+
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %q: %w", raw, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy url %q: unsupported scheme %q", raw, proxyURL.Scheme)
+	}
+	return proxyURL, nil
+}
+
+// forSource returns the proxy to use for a request to target made on
+// behalf of source, or nil for a direct connection.
+func (p *proxySelector) forSource(source configs.Source, target *url.URL) (*url.URL, error) {
+	return p.route(source).forURL(target)
+}
+
+// route returns the route of a request made on behalf of source. A pool
+// proxy is picked once for the whole request.
+func (p *proxySelector) route(source configs.Source) *proxyRoute {
+	r := &proxyRoute{selector: p, source: source}
+	if source.Proxy == "" && p.pac == nil && len(p.pool) > 0 {
+		r.pooled = p.pick()
+	}
+	return r
+}
+
+// proxyRoute chooses the proxy for each hop of a request, as redirects may
+// lead to hosts that no_proxy or the PAC file treat differently.
+type proxyRoute struct {
+	selector *proxySelector
+	source   configs.Source
+	pooled   *url.URL
+
+	mu sync.Mutex
+	// used is the proxy of the latest hop.
+	used *url.URL
+}
+
+// forURL returns the proxy for a hop to target, or nil for a direct
+// connection.
+func (r *proxyRoute) forURL(target *url.URL) (*url.URL, error) {
+	if r == nil {
+		return nil, nil
+	}
+	switch r.source.Proxy {
+	case "":
+	case configs.DirectProxy:
+		return nil, nil
+	default:
+		return parseProxyURL(r.source.Proxy)
+	}
+	if r.selector.bypass(target.Hostname()) {
+		return nil, nil
+	}
+	if r.selector.pac != nil {
+		return r.selector.fromPAC(target)
+	}
+	return r.pooled, nil
+}
+
+// last returns the proxy of the latest hop sent, or nil if it went direct.
+func (r *proxyRoute) last() *url.URL {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.used
+}
+
+// routeFrom returns the route carried in a request's context, if any.
+func routeFrom(ctx context.Context) *proxyRoute {
+	route, _ := ctx.Value(proxyContextKey{}).(*proxyRoute)
+	return route
+}
+
+// fromPAC returns the first proxy the PAC file lists for target that is
+// not being skipped after a failed connection, with the configured
+// credentials, or nil for DIRECT. If every proxy listed is being skipped,
+// the first is tried again.
+func (p *proxySelector) fromPAC(target *url.URL) (*url.URL, error) {
+	key := target.String()
+	p.mu.Lock()
+	choice, ok := p.pacCache[key]
+	p.mu.Unlock()
+	if !ok || !time.Now().Before(choice.expires) {
+		result, err := p.pac.FindProxy(key, target.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		proxies, err := pac.Proxies(result)
+		if err != nil {
+			return nil, err
+		}
+		for _, proxy := range proxies {
+			if proxy != nil && p.user != nil {
+				proxy.User = p.user
+			}
+		}
+		choice = pacChoice{proxies: proxies, expires: time.Now().Add(pacCacheTTL)}
+		p.mu.Lock()
+		p.pacCache[key] = choice
+		p.mu.Unlock()
+	}
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, proxy := range choice.proxies {
+		if proxy == nil || !now.Before(p.pacDown[proxy.Host]) {
+			return proxy, nil
+		}
+	}
+	return choice.proxies[0], nil
+}
+
+// pacFailed skips proxyURL for pacRetry if it came from the PAC file, so
+// that the fallbacks listed after it are used. It reports whether the
+// proxy was not being skipped already.
+func (p *proxySelector) pacFailed(proxyURL *url.URL) bool {
+	if p.pac == nil || proxyURL == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	skipped := now.Before(p.pacDown[proxyURL.Host])
+	p.pacDown[proxyURL.Host] = now.Add(pacRetry)
+	return !skipped
+}
+
+// pick returns the next pool proxy in rotation that has not been pruned.
+func (p *proxySelector) pick() *url.URL {
+	n := uint64(len(p.pool))
+	start := p.next.Add(1) - 1
+	for i := uint64(0); i < n; i++ {
+		if proxy := p.pool[(start+i)%n]; !proxy.pruned.Load() {
+			return proxy.url
+		}
+	}
+	return p.pool[start%n].url
+}
+
+// record counts a request through proxyURL and reports whether it got the
+// proxy pruned. Proxies outside the pool are not counted.
+func (p *proxySelector) record(proxyURL *url.URL, failed bool) bool {
+	if p.maxErrorRate == 0 || len(p.pool) < 2 {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var proxy *pooledProxy
+	active := 0
+	for _, pooled := range p.pool {
+		if pooled.url == proxyURL {
+			proxy = pooled
+		}
+		if !pooled.pruned.Load() {
+			active++
+		}
+	}
+	if proxy == nil || proxy.pruned.Load() {
+		return false
+	}
+	proxy.requests++
+	if failed {
+		proxy.failures++
+	}
+	if active < 2 || proxy.requests < minPruneRequests || float64(proxy.failures)/float64(proxy.requests)*100 <= p.maxErrorRate {
+		return false
+	}
+	proxy.pruned.Store(true)
+	return true
+}
+
+func (p *proxySelector) bypass(host string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, entry := range p.noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "*":
+			return true
+		case strings.Contains(entry, "/"):
+			if _, network, err := net.ParseCIDR(entry); err == nil && ip != nil && network.Contains(ip) {
+				return true
+			}
+		case strings.HasPrefix(entry, "."):
+			if strings.HasSuffix(host, entry) {
+				return true
+			}
+		case host == entry || strings.HasSuffix(host, "."+entry):
+			return true
+		}
+	}
+	return false
+}
+
+// proxyFromContext is used as the transport's Proxy function. The route
+// of each request is set up in newRequest and carried in its context;
+// every hop, including redirects, is routed by its own URL.
+func proxyFromContext(req *http.Request) (*url.URL, error) {
+	route := routeFrom(req.Context())
+	if route == nil {
+		return nil, nil
+	}
+	proxyURL, err := route.forURL(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	route.mu.Lock()
+	route.used = proxyURL
+	route.mu.Unlock()
+	return proxyURL, nil
+}
+
+// proxyBody counts the bytes read through a proxy and records the request
+// when closed.
+type proxyBody struct {
+	io.ReadCloser
+	consumer *Consumer
+	proxy    *url.URL
+	latency  time.Duration
+	bytes    int64
+	failed   bool
+	once     sync.Once
+}
+
+func (b *proxyBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	if err != nil && err != io.EOF && b.consumer.ctx.Err() == nil {
+		b.failed = true
+	}
+	return n, err
+}
+
+func (b *proxyBody) Close() error {
+	b.once.Do(func() {
+		b.consumer.recordProxy(b.proxy, b.bytes, b.latency, b.failed)
+	})
+	return b.ReadCloser.Close()
+}
+
+// recordProxy counts a finished request through proxyURL in the metrics
+// and prunes the proxy if it fails too often.
+func (c *Consumer) recordProxy(proxyURL *url.URL, bytes int64, latency time.Duration, failed bool) {
+	proxy := describeProxy(proxyURL)
+	c.metricsCollector.RecordProxyRequest(proxy, bytes, latency, failed)
+	if c.proxies.record(proxyURL, failed) {
+		c.logger.Warn("proxy taken out of rotation", "proxy", proxy, "max_error_rate", c.proxies.maxErrorRate)
+		c.metricsCollector.SetProxyPruned(proxy)
+	}
+}
+
+func describeProxy(proxyURL *url.URL) string {
+	if proxyURL == nil {
+		return "direct"
+	}
+	return proxyURL.Redacted()
+}
@@ -0,0 +1,104 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dataconsumer/configs"
+)
+
+// TestProxyPerHop checks that every hop of a redirected request is routed
+// by its own URL, not by the one the request started with.
+func TestProxyPerHop(t *testing.T) {
+	// The direct server answers for 127.0.0.1 and redirects /away to a
+	// host only the proxy knows.
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/away" {
+			http.Redirect(w, r, "http://far.test/file", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "direct")
+	}))
+	defer direct.Close()
+	// The proxy redirects near.test to the direct server and serves
+	// far.test itself.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Host {
+		case "near.test":
+			http.Redirect(w, r, direct.URL+"/file", http.StatusFound)
+		case "far.test":
+			fmt.Fprint(w, "proxied")
+		default:
+			fmt.Fprintf(w, "proxied %s by mistake", r.URL.Host)
+		}
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pacFile := filepath.Join(t.TempDir(), "proxy.pac")
+	script := fmt.Sprintf(`function FindProxyForURL(url, host) {
+	if (host == "127.0.0.1")
+		return "DIRECT";
+	return "PROXY %s";
+}`, proxyURL.Host)
+	if err := os.WriteFile(pacFile, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	proxyConfigs := []struct {
+		name   string
+		config *configs.ProxyConfig
+	}{
+		{"no_proxy", &configs.ProxyConfig{URL: proxy.URL, NoProxy: []string{"127.0.0.1"}}},
+		{"pac", &configs.ProxyConfig{PAC: pacFile}},
+	}
+	tests := []struct {
+		url, want string
+		// wantProxy is whether the last hop went through the proxy.
+		wantProxy bool
+	}{
+		{"http://near.test/", "direct", false},
+		{direct.URL + "/away", "proxied", true},
+	}
+	for _, pc := range proxyConfigs {
+		selector, err := newProxySelector(pc.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: &http.Transport{Proxy: proxyFromContext}}
+		for _, tt := range tests {
+			t.Run(pc.name+" "+tt.url, func(t *testing.T) {
+				route := selector.route(configs.Source{URL: tt.url})
+				ctx := context.WithValue(context.Background(), proxyContextKey{}, route)
+				req, err := http.NewRequestWithContext(ctx, "GET", tt.url, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(body) != tt.want {
+					t.Errorf("body = %q, want %q", body, tt.want)
+				}
+				if last := route.last(); (last != nil) != tt.wantProxy {
+					t.Errorf("last hop proxy = %v, want proxied %v", last, tt.wantProxy)
+				}
+			})
+		}
+	}
+}
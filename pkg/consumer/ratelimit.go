@@ -0,0 +1,146 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// RateLimiter paces the workers. They call Wait with the size of every
+// chunk read before reading the next, so Wait blocks for as long as the
+// consumer is ahead of its limit. Wait returns ctx's error if ctx is done
+// first.
+//
+// If a limiter also has a SetRate(configs.Rate) method, SetRateLimit calls
+// it, so that live controls such as the keyboard keys keep working.
+type RateLimiter interface {
+	Wait(ctx context.Context, n int) error
+}
+
+// rateSetter is implemented by limiters whose rate can be changed.
+type rateSetter interface {
+	SetRate(rate configs.Rate)
+}
+
+// Unlimited is a RateLimiter that never waits.
+type Unlimited struct{}
+
+// Wait returns at once.
+func (Unlimited) Wait(ctx context.Context, n int) error {
+	return nil
+}
+
+// TokenBucket is a RateLimiter letting bytes through at a steady rate. It
+// holds up to a second's worth of tokens, so after an idle spell such as a
+// pause the consumer bursts for at most a second. A chunk larger than the
+// bucket is let through once the bucket has refilled.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64 // seconds' worth of tokens the bucket holds
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket for rate. A zero rate lets
+// everything through.
+func NewTokenBucket(rate configs.Rate) *TokenBucket {
+	return newTokenBucket(rate, time.Second)
+}
+
+// newTokenBucket returns a bucket for rate holding up to burst's worth of
+// tokens, starting with a second's worth.
+func newTokenBucket(rate configs.Rate, burst time.Duration) *TokenBucket {
+	return &TokenBucket{rate: rate.BytesPerSecond(), burst: burst.Seconds(), tokens: rate.BytesPerSecond(), last: time.Now()}
+}
+
+// SetRate changes the rate, keeping at most a second's worth of the tokens
+// already in the bucket.
+func (b *TokenBucket) SetRate(rate configs.Rate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillLocked(time.Now())
+	b.rate = rate.BytesPerSecond()
+	b.tokens = min(b.tokens, b.rate)
+}
+
+// Rate returns the rate of the bucket.
+func (b *TokenBucket) Rate() configs.Rate {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return configs.Rate(b.rate)
+}
+
+// Wait takes n tokens, waiting until the bucket is no longer in debt.
+func (b *TokenBucket) Wait(ctx context.Context, n int) error {
+	b.mu.Lock()
+	if b.rate <= 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	b.refillLocked(time.Now())
+	b.tokens -= float64(n)
+	wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// skip forgets the time since the last refill, so that a pause or a
+// capacity probe does not fill the bucket. It does nothing on a nil bucket.
+func (b *TokenBucket) skip() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.last = time.Now()
+}
+
+func (b *TokenBucket) refillLocked(now time.Time) {
+	b.tokens = min(b.rate*b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// newLimiter returns the built-in limiter for a rate limit.
+func newLimiter(rate configs.Rate) RateLimiter {
+	if rate <= 0 {
+		return Unlimited{}
+	}
+	return NewTokenBucket(rate)
+}
+
+// DefaultCatchUp is how much time spent below the target the at_least mode
+// makes up for if the config's target_catch_up is zero.
+const DefaultCatchUp = 30 * time.Second
+
+// newTargetPacer returns the token bucket holding the consumer to its
+// target rate, or nil if the consumer is not paced to its target. In the
+// at_most mode it holds a second's worth of tokens like any TokenBucket,
+// while in the at_least mode the tokens of up to catchUp spent below the
+// target pile up, so the workers catch up at full speed before settling at
+// the target. A longer shortfall, such as a stall of the sources, is not
+// made up for beyond catchUp.
+func newTargetPacer(mode configs.TargetMode, rate configs.Rate, catchUp time.Duration) *TokenBucket {
+	switch {
+	case mode == configs.Unpaced:
+		return nil
+	case mode == configs.AtMost:
+		catchUp = time.Second
+	case catchUp <= 0:
+		catchUp = DefaultCatchUp
+	}
+	return newTokenBucket(rate, catchUp)
+}
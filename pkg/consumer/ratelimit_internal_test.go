@@ -0,0 +1,43 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// TestTargetCatchUp checks how much of a long stall the target pacer makes
+// up for in each mode.
+func TestTargetCatchUp(t *testing.T) {
+	const rate = 1 << 20
+	tests := []struct {
+		name    string
+		mode    configs.TargetMode
+		catchUp time.Duration
+		// free is how many bytes go through at once after the stall.
+		free int
+	}{
+		{"at_least", configs.AtLeast, 0, int(DefaultCatchUp.Seconds()) * rate},
+		{"at_least with target_catch_up", configs.AtLeast, 5 * time.Second, 5 * rate},
+		{"at_most", configs.AtMost, time.Minute, rate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pacer := newTargetPacer(tt.mode, configs.Rate(rate), tt.catchUp)
+			pacer.last = time.Now().Add(-time.Hour)
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			if err := pacer.Wait(ctx, tt.free); err != nil {
+				t.Fatalf("the first %d bytes after a stall waited: %v", tt.free, err)
+			}
+			if err := pacer.Wait(ctx, rate/2); err != context.DeadlineExceeded {
+				t.Errorf("half a second's worth more = %v, want it to wait", err)
+			}
+		})
+	}
+	if pacer := newTargetPacer(configs.Unpaced, configs.Rate(rate), 0); pacer != nil {
+		t.Errorf("unpaced mode has a pacer")
+	}
+}
@@ -0,0 +1,101 @@
+package consumer_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/consumer"
+	"dataconsumer/pkg/consumertest"
+)
+
+// quiet keeps the consumers under test from logging.
+var quiet = consumer.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+func TestTokenBucket(t *testing.T) {
+	bucket := consumer.NewTokenBucket(configs.Rate(1 << 20))
+	ctx := context.Background()
+	started := time.Now()
+	// The bucket starts full, so a second's worth goes through at once.
+	if err := bucket.Wait(ctx, 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed > 100*time.Millisecond {
+		t.Errorf("first second's worth waited %s", elapsed)
+	}
+	if err := bucket.Wait(ctx, 512<<10); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 400*time.Millisecond || elapsed > 700*time.Millisecond {
+		t.Errorf("half a second's worth more took %s, want about 500ms", elapsed)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := bucket.Wait(canceled, 1<<20); err != context.Canceled {
+		t.Errorf("Wait on a canceled context = %v, want %v", err, context.Canceled)
+	}
+	if err := consumer.NewTokenBucket(0).Wait(ctx, 1<<30); err != nil {
+		t.Errorf("zero rate bucket: %v", err)
+	}
+}
+
+// TestPacing runs consumers against a local server that could go much
+// faster and checks that they consume at their target or bandwidth limit.
+func TestPacing(t *testing.T) {
+	server := consumertest.NewServer()
+	defer server.Close()
+	const (
+		run     = 3 * time.Second
+		rate    = configs.Rate(1 << 20)
+		workers = 4
+		payload = 256 << 10
+	)
+	tests := []struct {
+		name      string
+		configure func(*configs.Config)
+	}{
+		{"target at_most", func(c *configs.Config) {
+			c.TargetMode = configs.AtMost
+			c.TargetRate = rate
+		}},
+		{"target at_least", func(c *configs.Config) {
+			c.TargetMode = configs.AtLeast
+			c.TargetRate = rate
+		}},
+		{"max_bandwidth", func(c *configs.Config) {
+			c.TargetMode = configs.Unpaced
+			c.TargetRate = 100 * rate
+			c.MaxBandwidth = rate
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := configs.DefaultConfig()
+			config.DataSources = []configs.Source{server.Source(consumertest.Payload{Size: payload})}
+			config.ConcurrencyFactor = workers
+			tt.configure(config)
+			c, err := consumer.NewConsumer(consumer.WithConfig(config), quiet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Start()
+			time.Sleep(run)
+			c.Stop()
+			got := float64(c.Collector().GetStats().BytesTransferred)
+			// Up to a second's worth may go through at the start, and
+			// each worker may be ahead by up to a payload.
+			low := rate.BytesPerSecond() * run.Seconds() * 0.8
+			high := rate.BytesPerSecond()*(run.Seconds()+1) + workers*payload
+			if got < low || got > high {
+				t.Errorf("consumed %.0f bytes in %s, want %.0f to %.0f", got, run, low, high)
+			}
+			if server.Requests() == 0 {
+				t.Error("no request reached the server")
+			}
+		})
+	}
+}
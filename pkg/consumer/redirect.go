@@ -0,0 +1,41 @@
+package consumer
+
+import (
+	"fmt"
+	"net/http"
+
+	"dataconsumer/configs"
+)
+
+// defaultMaxRedirects is how many redirects are followed unless the
+// redirect policy says otherwise.
+const defaultMaxRedirects = 10
+
+// checkRedirect returns the client's CheckRedirect enforcing policy.
+func (c *Consumer) checkRedirect(policy configs.RedirectPolicy) func(*http.Request, []*http.Request) error {
+	maxHops := policy.MaxHops
+	if maxHops <= 0 {
+		maxHops = defaultMaxRedirects
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxHops {
+			return fmt.Errorf("stopped after %d redirects", maxHops)
+		}
+		if origin := via[0].URL.Host; policy.SameHost && req.URL.Host != origin {
+			return fmt.Errorf("redirect from %s to another host %s not allowed", origin, req.URL.Host)
+		}
+		if policy.Log {
+			c.logger.Info("following redirect", "from", via[len(via)-1].URL.String(), "to", req.URL.String(), "hop", len(via))
+		}
+		return nil
+	}
+}
+
+// redirectHops returns how many redirects led to resp.
+func redirectHops(resp *http.Response) int {
+	hops := 0
+	for r := resp.Request.Response; r != nil; r = r.Request.Response {
+		hops++
+	}
+	return hops
+}
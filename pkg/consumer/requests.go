@@ -0,0 +1,49 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"dataconsumer/configs"
+)
+
+// newRequestPacer returns the limiter starting requests at rps requests
+// per second, or Unlimited for zero.
+func newRequestPacer(rps float64) RateLimiter {
+	if rps <= 0 {
+		return Unlimited{}
+	}
+	// The bucket counts requests rather than bytes.
+	return NewTokenBucket(configs.Rate(rps))
+}
+
+// paceRequest waits until the target requests per second let another
+// request start, and reports false if ctx is done first.
+func (c *Consumer) paceRequest(ctx context.Context) bool {
+	return c.requests.Wait(ctx, 1) == nil
+}
+
+// TargetRPS returns the requests per second the consumer aims for, or
+// zero if it aims for a data rate.
+func (c *Consumer) TargetRPS() float64 {
+	return c.config.TargetRPS
+}
+
+// limitObject cuts body off after the configured object size, for servers
+// that ignore the Range header asking for just that much.
+func (c *Consumer) limitObject(body io.Reader) io.Reader {
+	if c.config.ObjectSize <= 0 {
+		return body
+	}
+	return io.LimitReader(body, c.config.ObjectSize.Bytes())
+}
+
+// objectRange returns the Range header requesting the configured object
+// size, or "" if whole responses are downloaded.
+func (c *Consumer) objectRange() string {
+	if c.config.ObjectSize <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("bytes=0-%d", c.config.ObjectSize.Bytes()-1)
+}
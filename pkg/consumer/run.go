@@ -0,0 +1,124 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/metrics"
+)
+
+// capCheckInterval is how often Run compares the bytes consumed with the
+// data cap.
+const capCheckInterval = 200 * time.Millisecond
+
+// StopReason says why Run returned.
+type StopReason string
+
+const (
+	// StoppedByContext means the context passed to Run was done.
+	StoppedByContext StopReason = "canceled"
+	// StoppedByDuration means the configured duration elapsed.
+	StoppedByDuration StopReason = "duration"
+	// StoppedByDataCap means the configured amount of data was consumed.
+	StoppedByDataCap StopReason = "data_cap"
+	// StoppedByError means an error such as ErrQuotaExceeded stopped the
+	// consumer; Run returns it.
+	StoppedByError StopReason = "error"
+)
+
+// Result is the outcome of Run.
+type Result struct {
+	Reason StopReason
+	// Stats are the final statistics of the run.
+	Stats metrics.Stats
+	// Health is the health of the sources when the run ended.
+	Health []SourceHealth
+}
+
+// ReachedTarget reports whether the run ended because its duration
+// elapsed or its data cap was reached.
+func (r Result) ReachedTarget() bool {
+	return r.Reason == StoppedByDuration || r.Reason == StoppedByDataCap
+}
+
+// Run starts the consumer and blocks until ctx is done or the configured
+// Duration or MaxData is reached, then stops the consumer and returns the
+// outcome. The consumer can be controlled with its setters while Run
+// blocks. Like Start, Run can be called only once.
+//
+// The result is returned even with an error: the error that stopped the
+// consumer, ErrSourceUnavailable if no source was healthy at the end, or
+// ErrRateUnachievable if the run reached its target below its target rate.
+func (c *Consumer) Run(ctx context.Context) (Result, error) {
+	if c.ctx.Err() != nil {
+		return Result{}, ErrStopped
+	}
+	c.Start()
+
+	var deadline <-chan time.Time
+	if c.config.Duration > 0 {
+		timer := time.NewTimer(time.Duration(c.config.Duration))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	var capCheck <-chan time.Time
+	if c.config.MaxData > 0 {
+		ticker := time.NewTicker(capCheckInterval)
+		defer ticker.Stop()
+		capCheck = ticker.C
+	}
+
+	var result Result
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			result.Reason = StoppedByContext
+			break wait
+		case <-c.failed:
+			result.Reason = StoppedByError
+			break wait
+		case <-deadline:
+			result.Reason = StoppedByDuration
+			break wait
+		case <-capCheck:
+			if c.metricsCollector.GetStats().BytesTransferred >= c.config.MaxData.Bytes() {
+				result.Reason = StoppedByDataCap
+				break wait
+			}
+		}
+	}
+	err := c.Stop()
+	result.Stats = c.metricsCollector.GetStats()
+	result.Health = c.SourceHealth()
+	if err != nil {
+		return result, err
+	}
+	if err := c.unavailable(); err != nil {
+		return result, err
+	}
+	if target := c.config.TargetRPS; result.ReachedTarget() && target > 0 {
+		if rps := result.Stats.RequestRate(); rps < target {
+			return result, fmt.Errorf("%w: averaged %.1f of %.1f requests/s", ErrRateUnachievable, rps, target)
+		}
+		return result, nil
+	}
+	if target := result.Stats.TargetRate; result.ReachedTarget() && target > 0 && c.belowTarget(result.Stats.AverageRate, target) {
+		return result, fmt.Errorf("%w: averaged %.2f of %.2f MB/min", ErrRateUnachievable, result.Stats.AverageRate, target)
+	}
+	return result, nil
+}
+
+// atMostSlack is the share of the target rate a consumer in the at_most
+// mode must reach, since it never runs faster to make up for a slow start.
+const atMostSlack = 0.95
+
+// belowTarget reports whether rate falls short of target, both in MB/min.
+func (c *Consumer) belowTarget(rate, target float64) bool {
+	if c.config.TargetMode == configs.AtMost {
+		target *= atMostSlack
+	}
+	return rate < target
+}
@@ -0,0 +1,101 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+)
+
+// semaphore bounds how many requests run at once. Its limit can change at
+// any time: raising it admits waiting requests at once, and lowering it
+// cancels the newest requests above the new limit.
+type semaphore struct {
+	mu      sync.Mutex
+	limit   int
+	holders []*slot
+	// wake is closed and replaced whenever a slot may have become free.
+	wake chan struct{}
+}
+
+// slot is a held place in a semaphore. Its id is the lowest not held by
+// another slot, so a worker keeps its id from one request to the next.
+type slot struct {
+	id     int
+	cancel context.CancelFunc
+}
+
+func newSemaphore(limit int) *semaphore {
+	return &semaphore{limit: limit, wake: make(chan struct{})}
+}
+
+// acquire blocks until a slot is free or ctx is done. cancel is called if
+// the slot is taken back by lowering the limit.
+func (s *semaphore) acquire(ctx context.Context, cancel context.CancelFunc) (*slot, error) {
+	for {
+		s.mu.Lock()
+		if len(s.holders) < s.limit {
+			held := &slot{id: s.freeID(), cancel: cancel}
+			s.holders = append(s.holders, held)
+			s.mu.Unlock()
+			return held, nil
+		}
+		wake := s.wake
+		s.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// release frees held.
+func (s *semaphore) release(held *slot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, h := range s.holders {
+		if h == held {
+			s.holders = append(s.holders[:i], s.holders[i+1:]...)
+			s.signal()
+			return
+		}
+	}
+}
+
+// setLimit changes the limit and returns the previous one.
+func (s *semaphore) setLimit(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.limit
+	s.limit = n
+	for i := n; i < len(s.holders); i++ {
+		s.holders[i].cancel()
+	}
+	if n > previous {
+		s.signal()
+	}
+	return previous
+}
+
+func (s *semaphore) size() (limit, held int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit, len(s.holders)
+}
+
+// freeID returns the lowest id not held. The caller must hold s.mu.
+func (s *semaphore) freeID() int {
+	taken := make(map[int]bool, len(s.holders))
+	for _, h := range s.holders {
+		taken[h.id] = true
+	}
+	id := 0
+	for taken[id] {
+		id++
+	}
+	return id
+}
+
+func (s *semaphore) signal() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
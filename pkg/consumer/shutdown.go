@@ -0,0 +1,89 @@
+package consumer
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// forcedCloseWait is how long Stop waits for workers after force-closing
+// their connections.
+const forcedCloseWait = 2 * time.Second
+
+// connTracker records the open connections of the transport so that a
+// stalled shutdown can close them.
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: make(map[*trackedConn]struct{})}
+}
+
+// dial wraps dial so that every connection it opens is tracked.
+func (t *connTracker) dial(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tracked := &trackedConn{Conn: conn, tracker: t}
+		t.mu.Lock()
+		t.conns[tracked] = struct{}{}
+		t.mu.Unlock()
+		return tracked, nil
+	}
+}
+
+// closeAll closes every open connection and returns how many there were.
+func (t *connTracker) closeAll() int {
+	t.mu.Lock()
+	conns := make([]*trackedConn, 0, len(t.conns))
+	for conn := range t.conns {
+		conns = append(conns, conn)
+	}
+	t.mu.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	return len(conns)
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.tracker.mu.Lock()
+		delete(c.tracker.conns, c)
+		c.tracker.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// waitTimeout waits for wg and reports whether it finished within d. A
+// non-positive d waits indefinitely.
+func waitTimeout(wg *sync.WaitGroup, d time.Duration) bool {
+	if d <= 0 {
+		wg.Wait()
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
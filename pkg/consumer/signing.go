@@ -0,0 +1,314 @@
+package consumer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+const (
+	// emptySHA256 is the hash of an empty payload, which is what GET
+	// requests carry.
+	emptySHA256   = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	amzDateFormat = "20060102T150405Z"
+	// credentialRefresh is how long before they expire assumed role
+	// credentials are renewed.
+	credentialRefresh = 5 * time.Minute
+	// assumeRoleTimeout bounds a call to STS.
+	assumeRoleTimeout = 10 * time.Second
+)
+
+// awsCredentials sign SigV4 requests. Expires is zero for long-term
+// credentials.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time
+}
+
+// roleCredentials caches the credentials of assumed roles by the auth
+// settings they were assumed for.
+type roleCredentials struct {
+	mu    sync.Mutex
+	creds map[configs.SourceAuth]awsCredentials
+}
+
+// sign adds the signature auth asks for to req. Basic and bearer auth are
+// set when the request is built.
+func (c *Consumer) sign(req *http.Request, auth *configs.SourceAuth) error {
+	if auth == nil {
+		return nil
+	}
+	switch auth.Type {
+	case "sigv4":
+		creds, err := c.awsCredentials(req.Context(), *auth)
+		if err != nil {
+			return fmt.Errorf("sigv4: %w", err)
+		}
+		signV4(req, creds, auth.Region, awsService(*auth), time.Now())
+	case "hmac":
+		signHMAC(req, *auth, time.Now())
+	}
+	return nil
+}
+
+func awsService(auth configs.SourceAuth) string {
+	if auth.Service == "" {
+		return "s3"
+	}
+	return auth.Service
+}
+
+// awsCredentials returns the credentials to sign with: the configured or
+// environment credentials, or those of the role they assume.
+func (c *Consumer) awsCredentials(ctx context.Context, auth configs.SourceAuth) (awsCredentials, error) {
+	base := awsCredentials{AccessKeyID: auth.AccessKeyID, SecretAccessKey: auth.SecretAccessKey, SessionToken: auth.SessionToken}
+	if base.AccessKeyID == "" {
+		base = awsCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if base.AccessKeyID == "" || base.SecretAccessKey == "" {
+		return awsCredentials{}, fmt.Errorf("no credentials; set access_key_id and secret_access_key or $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY")
+	}
+	if auth.RoleARN == "" {
+		return base, nil
+	}
+
+	c.roles.mu.Lock()
+	defer c.roles.mu.Unlock()
+	if creds, ok := c.roles.creds[auth]; ok && time.Until(creds.Expires) > credentialRefresh {
+		return creds, nil
+	}
+	creds, err := c.assumeRole(ctx, base, auth)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	if c.roles.creds == nil {
+		c.roles.creds = make(map[configs.SourceAuth]awsCredentials)
+	}
+	c.roles.creds[auth] = creds
+	c.logger.Info("assumed role", "role", auth.RoleARN, "expires", creds.Expires)
+	return creds, nil
+}
+
+// assumeRole calls STS in the auth's region, or at $AWS_ENDPOINT_URL_STS,
+// for temporary credentials of the auth's role.
+func (c *Consumer) assumeRole(ctx context.Context, base awsCredentials, auth configs.SourceAuth) (awsCredentials, error) {
+	ctx, cancel := context.WithTimeout(ctx, assumeRoleTimeout)
+	defer cancel()
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_STS")
+	if endpoint == "" {
+		endpoint = "https://sts." + auth.Region + ".amazonaws.com"
+	}
+	query := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {auth.RoleARN},
+		"RoleSessionName": {"dataconsumer"},
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(endpoint, "/")+"/?"+query.Encode(), nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	signV4(req, base, auth.Region, "sts", time.Now())
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("assume role %s: %w", auth.RoleARN, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("assume role %s: %w", auth.RoleARN, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("assume role %s: %s: %s", auth.RoleARN, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleResult>Credentials"`
+	}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return awsCredentials{}, fmt.Errorf("assume role %s: %w", auth.RoleARN, err)
+	}
+	creds := result.Credentials
+	if creds.AccessKeyID == "" {
+		return awsCredentials{}, fmt.Errorf("assume role %s: no credentials in the response", auth.RoleARN)
+	}
+	return awsCredentials{AccessKeyID: creds.AccessKeyID, SecretAccessKey: creds.SecretAccessKey, SessionToken: creds.SessionToken, Expires: creds.Expiration}, nil
+}
+
+// signV4 signs req, which must have no body, with AWS Signature Version 4.
+func signV4(req *http.Request, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format(amzDateFormat)
+	scope := strings.Join([]string{amzDate[:8], region, service, "aws4_request"}, "/")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": emptySHA256,
+		"x-amz-date":           amzDate,
+	}
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+		headers["x-amz-security-token"] = creds.SessionToken
+	}
+	canonicalRequest, signedHeaders := v4CanonicalRequest(req.Method, req.URL, headers, service)
+	signature := v4Signature(creds.SecretAccessKey, scope, v4StringToSign(amzDate, scope, canonicalRequest))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// v4CanonicalRequest returns the canonical form of a request without a
+// body and the names of its signed headers, which are given in lower case.
+func v4CanonicalRequest(method string, u *url.URL, headers map[string]string, service string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	return strings.Join([]string{
+		method,
+		canonicalPath(u, service != "s3"),
+		canonicalQuery(u),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptySHA256,
+	}, "\n"), signedHeaders
+}
+
+func v4StringToSign(amzDate, scope, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	return "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+}
+
+// v4Signature signs stringToSign with a key derived from secret and each
+// part of scope in turn.
+func v4Signature(secret, scope, stringToSign string) string {
+	key := []byte("AWS4" + secret)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSum(sha256.New, key, part)
+	}
+	return hex.EncodeToString(hmacSum(sha256.New, key, stringToSign))
+}
+
+// canonicalPath encodes every segment of u's path, twice for services
+// other than S3.
+func canonicalPath(u *url.URL, twice bool) string {
+	if u.Path == "" {
+		return "/"
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+		if twice {
+			segments[i] = awsEscape(segments[i])
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery encodes u's query parameters sorted by name and value.
+func canonicalQuery(u *url.URL) string {
+	var pairs []string
+	for name, values := range u.Query() {
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything but the unreserved characters, as
+// SigV4 requires.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if 'A' <= ch && ch <= 'Z' || 'a' <= ch && ch <= 'z' || '0' <= ch && ch <= '9' || strings.IndexByte("-._~", ch) >= 0 {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func hmacSum(newHash func() hash.Hash, key []byte, data string) []byte {
+	mac := hmac.New(newHash, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signHMAC signs req with the generic HMAC scheme described by auth.
+func signHMAC(req *http.Request, auth configs.SourceAuth, now time.Time) {
+	date := now.UTC().Format(http.TimeFormat)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	fields := []string{
+		"{method}", req.Method,
+		"{host}", req.URL.Host,
+		"{path}", req.URL.EscapedPath(),
+		"{query}", req.URL.RawQuery,
+		"{date}", date,
+		"{timestamp}", timestamp,
+		"{key_id}", auth.KeyID,
+	}
+	newHash := sha256.New
+	switch auth.Algorithm {
+	case "sha1":
+		newHash = sha1.New
+	case "sha512":
+		newHash = sha512.New
+	}
+	sum := hmacSum(newHash, []byte(auth.Key), strings.NewReplacer(fields...).Replace(auth.StringToSign))
+	signature := hex.EncodeToString(sum)
+	if auth.Encoding == "base64" {
+		signature = base64.StdEncoding.EncodeToString(sum)
+	}
+
+	header, value := auth.Header, auth.Value
+	if header == "" {
+		header = "Authorization"
+	}
+	if value == "" {
+		value = "{signature}"
+	}
+	req.Header.Set(header, strings.NewReplacer(append(fields, "{signature}", signature)...).Replace(value))
+	if auth.DateHeader != "" {
+		req.Header.Set(auth.DateHeader, date)
+	}
+	if auth.TimestampHeader != "" {
+		req.Header.Set(auth.TimestampHeader, timestamp)
+	}
+}
@@ -0,0 +1,146 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// Source is something the workers download from. Each call to Open starts
+// one request; the worker drains the returned body and closes it. Open
+// must honour ctx, which is canceled when the request times out or the
+// consumer stops.
+type Source interface {
+	Open(ctx context.Context) (io.ReadCloser, error)
+	// Config returns the configuration the source was created from. Its
+	// URL identifies the source in metrics, health reports and hooks, and
+	// its Weight and Timeout apply to every protocol.
+	Config() configs.Source
+}
+
+// SourceFactory creates the Source for a configured source. It is called
+// whenever sources are validated or set, so it should not do I/O.
+type SourceFactory func(config configs.Source) (Source, error)
+
+var (
+	protocolsMu sync.RWMutex
+	protocols   = make(map[string]SourceFactory)
+)
+
+// RegisterProtocol makes configured sources whose protocol is protocol use
+// factory, e.g. for gRPC streams, cloud storage SDKs or generated data.
+// The built-in protocols are "http" and "https". RegisterProtocol panics
+// if protocol is already registered.
+func RegisterProtocol(protocol string, factory SourceFactory) {
+	protocolsMu.Lock()
+	defer protocolsMu.Unlock()
+	if _, ok := protocols[protocol]; ok || isHTTPProtocol(protocol) {
+		panic("consumer: protocol " + protocol + " registered twice")
+	}
+	protocols[protocol] = factory
+}
+
+func isHTTPProtocol(protocol string) bool {
+	return protocol == "" || protocol == "http" || protocol == "https"
+}
+
+// newSource returns the Source for config: an HTTP source downloading
+// through c, or one made by the factory registered for its protocol. c
+// may be nil when only validating.
+func newSource(c *Consumer, config configs.Source) (Source, error) {
+	if isHTTPProtocol(config.Protocol) {
+		if u, err := url.Parse(config.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("source %s: not an http or https url", config.URL)
+		}
+		return &httpSource{consumer: c, config: config}, nil
+	}
+	protocolsMu.RLock()
+	factory := protocols[config.Protocol]
+	protocolsMu.RUnlock()
+	if factory == nil {
+		return nil, fmt.Errorf("source %s: unsupported protocol %q", config.URL, config.Protocol)
+	}
+	source, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("source %s: %w", config.URL, err)
+	}
+	return source, nil
+}
+
+// httpSource downloads a URL with GET requests through the consumer's
+// client, with the source's headers, auth and proxy.
+type httpSource struct {
+	consumer *Consumer
+	config   configs.Source
+}
+
+func (s *httpSource) Config() configs.Source {
+	return s.config
+}
+
+func (s *httpSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	c := s.consumer
+	tx := transactionFrom(ctx)
+	req, err := c.newRequest(tx.attach(ctx), s.config)
+	if err != nil {
+		return nil, err
+	}
+	if r := c.objectRange(); r != "" && req.Header.Get("Range") == "" {
+		req.Header.Set("Range", r)
+	}
+	tx.request(req)
+
+	route := routeFrom(req.Context())
+	sent := time.Now()
+	resp, err := c.client.Do(req)
+	// The proxy of the last hop is the one the response came through.
+	proxyURL := route.last()
+	if err != nil {
+		if proxyURL != nil && c.ctx.Err() == nil && ctx.Err() == nil {
+			c.recordProxy(proxyURL, 0, 0, true)
+			var opErr *net.OpError
+			if errors.As(err, &opErr) && opErr.Op == "proxyconnect" && c.proxies.pacFailed(proxyURL) {
+				c.logger.Warn("cannot connect to the proxy from the PAC file, using its fallbacks", "proxy", describeProxy(proxyURL), "retry_in", pacRetry)
+			}
+		}
+		return nil, err
+	}
+	tx.response(resp)
+	if hops := redirectHops(resp); hops > 0 {
+		c.metricsCollector.RecordRedirects(s.config.URL, hops, resp.Request.URL.Host)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		if proxyURL != nil {
+			c.recordProxy(proxyURL, 0, time.Since(sent), true)
+		}
+		return nil, &SourceError{URL: s.config.URL, StatusCode: resp.StatusCode, Err: fmt.Errorf("unexpected status %s", resp.Status)}
+	}
+	if expect := s.config.Expect; expect != nil {
+		if err := checkContent(resp, expect); err != nil {
+			resp.Body.Close()
+			if proxyURL != nil {
+				c.recordProxy(proxyURL, 0, time.Since(sent), true)
+			}
+			return nil, &SourceError{URL: s.config.URL, StatusCode: resp.StatusCode, Err: err}
+		}
+	}
+	if hit, ok := cacheStatus(resp.Header); ok {
+		c.metricsCollector.RecordCache(s.config.URL, hit)
+	}
+	body := resp.Body
+	if proxyURL != nil {
+		body = &proxyBody{ReadCloser: body, consumer: c, proxy: proxyURL, latency: time.Since(sent)}
+	}
+	if expect := s.config.Expect; expect != nil && expect.MinSize > 0 && objectLength(resp) < 0 {
+		body = &expectedBody{ReadCloser: body, minSize: expect.MinSize.Bytes()}
+	}
+	return body, nil
+}
@@ -0,0 +1,319 @@
+package consumer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"dataconsumer/configs"
+	"dataconsumer/pkg/metrics"
+)
+
+// partialPattern names the files objects are written to before they are
+// complete, so that a crash leaves no truncated object under its real name.
+const partialPattern = ".dataconsumer-*.part"
+
+// objectStore saves downloaded objects for save_to. Each URL is saved
+// once per run; the files already in the directory count towards the
+// quota and, with dedup, are hashed before the first object is saved.
+type objectStore struct {
+	dir       string
+	quota     int64
+	dedup     bool
+	collector *metrics.Collector
+	logger    *slog.Logger
+	indexOnce sync.Once
+	// stored is the size of the files in dir, and used that plus the
+	// bytes written to partial files so far.
+	stored   atomic.Int64
+	used     atomic.Int64
+	full     atomic.Bool
+	mu       sync.Mutex
+	saved    map[string]bool
+	byHash   map[string]string
+	hashOf   map[string]string
+	indexErr error
+}
+
+// newObjectStore returns the store for config, or nil if objects are
+// discarded.
+func newObjectStore(config *configs.SaveToConfig, objectSize configs.Size, collector *metrics.Collector, logger *slog.Logger) (*objectStore, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.Dir == "" {
+		return nil, fmt.Errorf("save_to: dir is required")
+	}
+	if objectSize > 0 {
+		return nil, fmt.Errorf("save_to cannot be combined with object_size, which downloads only part of each object")
+	}
+	if config.Quota < 0 {
+		return nil, fmt.Errorf("save_to: quota must not be negative")
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("save_to: %w", err)
+	}
+	return &objectStore{
+		dir:       config.Dir,
+		quota:     config.Quota.Bytes(),
+		dedup:     config.Dedup,
+		collector: collector,
+		logger:    logger,
+		saved:     make(map[string]bool),
+		byHash:    make(map[string]string),
+		hashOf:    make(map[string]string),
+	}, nil
+}
+
+// index adds up the files already in the directory, hashing them for
+// dedup, and removes partial files left behind by an earlier run.
+func (s *objectStore) index() {
+	var files int
+	s.indexErr = filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if ok, _ := filepath.Match(partialPattern, d.Name()); ok {
+			return os.Remove(p)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		s.stored.Add(info.Size())
+		s.used.Add(info.Size())
+		files++
+		if s.dedup {
+			sum, err := hashFile(p)
+			if err != nil {
+				return err
+			}
+			s.remember(p, sum)
+		}
+		return nil
+	})
+	if s.indexErr != nil {
+		s.logger.Warn("cannot index save_to directory, objects are not saved", "dir", s.dir, "error", s.indexErr)
+		return
+	}
+	s.logger.Info("saving objects", "dir", s.dir, "existing_files", files, "existing_bytes", s.stored.Load())
+}
+
+func hashFile(p string) (string, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remember records that the file at p has the hash sum. The caller must
+// hold s.mu or be indexing.
+func (s *objectStore) remember(p, sum string) {
+	if old, ok := s.hashOf[p]; ok && s.byHash[old] == p {
+		delete(s.byHash, old)
+	}
+	s.hashOf[p] = sum
+	if _, ok := s.byHash[sum]; !ok {
+		s.byHash[sum] = p
+	}
+}
+
+// target returns where the object at rawURL is saved: the host, with the
+// port separated by an underscore, and the cleaned path below the
+// directory, "index" standing in for a directory's own name.
+func (s *objectStore) target(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	host := u.Host
+	if host == "" {
+		host = u.Scheme
+	}
+	name := path.Clean("/" + u.Path)
+	if name == "/" || strings.HasSuffix(u.Path, "/") {
+		name = path.Join(name, "index")
+	}
+	return filepath.Join(s.dir, strings.ReplaceAll(host, ":", "_"), filepath.FromSlash(name)), true
+}
+
+// open returns a writer that saves what is written to it and passes it on
+// to dst, or nil if the object at rawURL is not to be saved because it
+// was saved already this run or the quota is used up. Call finish with
+// the download's error when the body has been copied.
+func (s *objectStore) open(rawURL string, dst io.Writer) *savingWriter {
+	if s == nil {
+		return nil
+	}
+	s.indexOnce.Do(s.index)
+	if s.indexErr != nil || s.full.Load() {
+		return nil
+	}
+	target, ok := s.target(rawURL)
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	if s.saved[target] {
+		s.mu.Unlock()
+		return nil
+	}
+	s.saved[target] = true
+	s.mu.Unlock()
+
+	file, err := os.CreateTemp(s.dir, partialPattern)
+	if err == nil {
+		// CreateTemp makes the file private; saved objects are for sharing.
+		err = file.Chmod(0644)
+	}
+	if err != nil {
+		s.logger.Warn("cannot save object", "url", rawURL, "error", err)
+		s.forget(target)
+		return nil
+	}
+	w := &savingWriter{store: s, dst: dst, file: file, hash: sha256.New(), target: target, url: rawURL}
+	if info, err := os.Stat(target); err == nil {
+		w.replaces = info.Size()
+	}
+	return w
+}
+
+// forget lets target be saved again by a later request.
+func (s *objectStore) forget(target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.saved, target)
+}
+
+// savingWriter writes an object to a partial file while passing it on.
+// Failing to save never fails the download: the object is then only
+// consumed.
+type savingWriter struct {
+	store   *objectStore
+	dst     io.Writer
+	file    *os.File
+	hash    hash.Hash
+	target  string
+	url     string
+	written int64
+	// replaces is the size of the file saved earlier under the same
+	// name, whose space the object takes over.
+	replaces int64
+	// needed is how much of the quota the object needed when it did not
+	// fit.
+	needed int64
+	// err is why the object is not saved, if writing it failed.
+	err error
+}
+
+var (
+	errQuotaReached = errors.New("save_to quota reached")
+	errDuplicate    = errors.New("duplicate object")
+)
+
+func (w *savingWriter) Write(p []byte) (int, error) {
+	if w.err == nil {
+		w.err = w.save(p)
+	}
+	return w.dst.Write(p)
+}
+
+func (w *savingWriter) save(p []byte) error {
+	n := int64(len(p))
+	if used := w.store.used.Add(n); w.store.quota > 0 && used-w.replaces > w.store.quota {
+		w.store.used.Add(-n)
+		w.needed = w.written + n
+		return errQuotaReached
+	}
+	w.written += n
+	w.hash.Write(p)
+	_, err := w.file.Write(p)
+	return err
+}
+
+// finish keeps the object if it was downloaded completely and saved
+// without error, and otherwise removes the partial file.
+func (w *savingWriter) finish(downloadErr error) {
+	if w == nil {
+		return
+	}
+	s := w.store
+	err := w.file.Close()
+	if w.err != nil {
+		err = w.err
+	}
+	if downloadErr == nil && err == nil {
+		err = w.keep()
+	}
+	if err == nil {
+		return
+	}
+	os.Remove(w.file.Name())
+	s.used.Add(-w.written)
+	switch {
+	case downloadErr != nil:
+		s.forget(w.target)
+	case err == errDuplicate:
+	case err == errQuotaReached:
+		// Objects being saved at the same time may have taken the space;
+		// only stop saving once the finished files leave too little.
+		if s.stored.Load()-w.replaces+w.needed <= s.quota {
+			s.forget(w.target)
+		} else if !s.full.Swap(true) {
+			s.logger.Warn("save_to quota reached, objects are no longer saved", "dir", s.dir, "quota", configs.Size(s.quota))
+		}
+	default:
+		s.logger.Warn("cannot save object", "url", w.url, "error", err)
+		s.forget(w.target)
+	}
+}
+
+// keep moves the partial file to its target, unless dedup finds that an
+// identical object is saved under another name.
+func (w *savingWriter) keep() error {
+	s := w.store
+	sum := hex.EncodeToString(w.hash.Sum(nil))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dedup {
+		if existing, ok := s.byHash[sum]; ok && existing != w.target {
+			s.collector.RecordSaved(w.written, true)
+			return errDuplicate
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(w.target), 0755); err != nil {
+		return err
+	}
+	replaced, statErr := os.Stat(w.target)
+	if err := os.Rename(w.file.Name(), w.target); err != nil {
+		return err
+	}
+	s.stored.Add(w.written)
+	if statErr == nil {
+		s.stored.Add(-replaced.Size())
+		s.used.Add(-replaced.Size())
+	}
+	if s.dedup {
+		s.remember(w.target, sum)
+	}
+	s.collector.RecordSaved(w.written, false)
+	return nil
+}
@@ -0,0 +1,218 @@
+package consumer
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// redactedHeaders are replaced in traces so that trace files can be shared.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Tracer records the HTTP transactions of a sampled fraction of requests
+// as JSON lines.
+type Tracer struct {
+	sample float64
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewTracer returns a tracer writing to w that traces each request with
+// probability sample.
+func NewTracer(w io.Writer, sample float64) *Tracer {
+	return &Tracer{sample: sample, encoder: json.NewEncoder(w)}
+}
+
+// SetTracer enables tracing of sampled requests. Call it before Start.
+func (c *Consumer) SetTracer(tracer *Tracer) {
+	c.tracer = tracer
+}
+
+type transactionKey struct{}
+
+// withTransaction carries tx to the source opening the request.
+func withTransaction(ctx context.Context, tx *transaction) context.Context {
+	if tx == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, transactionKey{}, tx)
+}
+
+// transactionFrom returns the transaction carried by ctx, or nil if the
+// request is not traced.
+func transactionFrom(ctx context.Context) *transaction {
+	tx, _ := ctx.Value(transactionKey{}).(*transaction)
+	return tx
+}
+
+// transaction is the trace of one request, including its redirects.
+type transaction struct {
+	tracer  *Tracer
+	started time.Time
+
+	mu              sync.Mutex
+	Time            time.Time       `json:"time"`
+	URL             string          `json:"url"`
+	Proxy           string          `json:"proxy"`
+	RequestHeaders  http.Header     `json:"request_headers,omitempty"`
+	Events          []traceEvent    `json:"events"`
+	Redirects       []traceRedirect `json:"redirects,omitempty"`
+	Status          int             `json:"status,omitempty"`
+	ResponseHeaders http.Header     `json:"response_headers,omitempty"`
+	Bytes           int64           `json:"bytes"`
+	DurationMS      float64         `json:"duration_ms"`
+	Error           string          `json:"error,omitempty"`
+}
+
+type traceEvent struct {
+	AtMS   float64 `json:"at_ms"`
+	Event  string  `json:"event"`
+	Detail string  `json:"detail,omitempty"`
+}
+
+type traceRedirect struct {
+	Status   int    `json:"status"`
+	Location string `json:"location"`
+}
+
+// begin starts tracing a request to source if it is sampled, returning
+// nil otherwise.
+func (t *Tracer) begin(source configs.Source) *transaction {
+	if t == nil || rand.Float64() >= t.sample {
+		return nil
+	}
+	now := time.Now()
+	return &transaction{tracer: t, started: now, Time: now, URL: source.URL}
+}
+
+func (tx *transaction) event(name, detail string) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.Events = append(tx.Events, traceEvent{
+		AtMS:   float64(time.Since(tx.started).Microseconds()) / 1000,
+		Event:  name,
+		Detail: detail,
+	})
+}
+
+// attach adds the connection event hooks to ctx.
+func (tx *transaction) attach(ctx context.Context) context.Context {
+	if tx == nil {
+		return ctx
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(hostPort string) { tx.event("get_conn", hostPort) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			detail := info.Conn.LocalAddr().String() + " -> " + info.Conn.RemoteAddr().String()
+			if info.Reused {
+				detail += " (reused)"
+			}
+			tx.event("got_conn", detail)
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) { tx.event("dns_start", info.Host) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err != nil {
+				tx.event("dns_done", info.Err.Error())
+				return
+			}
+			detail := ""
+			for i, addr := range info.Addrs {
+				if i > 0 {
+					detail += ", "
+				}
+				detail += addr.String()
+			}
+			tx.event("dns_done", detail)
+		},
+		ConnectStart: func(network, addr string) { tx.event("connect_start", addr) },
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				tx.event("connect_done", err.Error())
+				return
+			}
+			tx.event("connect_done", addr)
+		},
+		TLSHandshakeStart: func() { tx.event("tls_start", "") },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				tx.event("tls_done", err.Error())
+				return
+			}
+			tx.event("tls_done", tls.VersionName(state.Version)+" "+tls.CipherSuiteName(state.CipherSuite))
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err != nil {
+				tx.event("wrote_request", info.Err.Error())
+				return
+			}
+			tx.event("wrote_request", "")
+		},
+		GotFirstResponseByte: func() { tx.event("first_byte", "") },
+	})
+}
+
+// request records the request as it will be sent.
+func (tx *transaction) request(req *http.Request) {
+	if tx == nil {
+		return
+	}
+	proxyURL, _ := routeFrom(req.Context()).forURL(req.URL)
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.URL = req.URL.String()
+	tx.Proxy = describeProxy(proxyURL)
+	tx.RequestHeaders = redact(req.Header)
+}
+
+// response records the final response and the redirects that led to it.
+func (tx *transaction) response(resp *http.Response) {
+	if tx == nil {
+		return
+	}
+	var redirects []traceRedirect
+	for r := resp.Request.Response; r != nil; r = r.Request.Response {
+		redirects = append([]traceRedirect{{Status: r.StatusCode, Location: r.Header.Get("Location")}}, redirects...)
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.Redirects = redirects
+	tx.Status = resp.StatusCode
+	tx.ResponseHeaders = redact(resp.Header)
+}
+
+// finish writes the transaction to the trace.
+func (tx *transaction) finish(bytes int64, err error) {
+	if tx == nil {
+		return
+	}
+	tx.mu.Lock()
+	tx.Bytes = bytes
+	tx.DurationMS = float64(time.Since(tx.started).Microseconds()) / 1000
+	if err != nil {
+		tx.Error = err.Error()
+	}
+	tx.mu.Unlock()
+
+	tx.tracer.mu.Lock()
+	defer tx.tracer.mu.Unlock()
+	tx.tracer.encoder.Encode(tx)
+}
+
+func redact(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range redactedHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, "REDACTED")
+		}
+	}
+	return header
+}
@@ -0,0 +1,72 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"dataconsumer/configs"
+)
+
+// SourceCheck is the result of checking that a source can be downloaded.
+type SourceCheck struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"`
+	// Size is the advertised Content-Length, or -1 if unknown.
+	Size         int64 `json:"size"`
+	AcceptRanges bool  `json:"accept_ranges"`
+	// RedirectedTo is the final URL if the request was redirected.
+	RedirectedTo string `json:"redirected_to,omitempty"`
+	// TLSExpiry is when the server certificate expires, for HTTPS sources.
+	TLSExpiry time.Time `json:"tls_expiry,omitempty"`
+	// ServerTime is the server's Date header, if it sent one.
+	ServerTime time.Time `json:"server_time,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// OK reports whether the source answered with a 2xx status.
+func (s SourceCheck) OK() bool {
+	return s.Error == ""
+}
+
+// Check requests source once with the consumer's transport and request
+// settings and reports what the server returned without downloading the
+// body. Certificate and connection errors are reported in Error. Only
+// HTTP sources can be checked.
+func (c *Consumer) Check(ctx context.Context, source configs.Source) SourceCheck {
+	check := SourceCheck{URL: source.URL, Size: -1}
+	if !isHTTPProtocol(source.Protocol) {
+		check.Error = fmt.Sprintf("protocol %q cannot be checked", source.Protocol)
+		return check
+	}
+	req, err := c.newRequest(ctx, source)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	requested := req.URL.String()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	resp.Body.Close()
+
+	check.StatusCode = resp.StatusCode
+	check.Size = resp.ContentLength
+	check.AcceptRanges = resp.Header.Get("Accept-Ranges") == "bytes"
+	if final := resp.Request.URL.String(); final != requested {
+		check.RedirectedTo = final
+	}
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		check.ServerTime = date
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		check.TLSExpiry = resp.TLS.PeerCertificates[0].NotAfter
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		check.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+	return check
+}
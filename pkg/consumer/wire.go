@@ -0,0 +1,49 @@
+package consumer
+
+import (
+	"log/slog"
+	"syscall"
+
+	"dataconsumer/internal/wirecount"
+)
+
+// newWireCounter loads the wire accounting filter and returns it with a
+// dialer Control function attaching it to every connection. Wire
+// accounting is best effort: without the filter, e.g. on other systems or
+// without the privilege to load it, both are nil.
+func newWireCounter(logger *slog.Logger) (*wirecount.Counter, func(network, address string, conn syscall.RawConn) error) {
+	counter, err := wirecount.New()
+	if err != nil {
+		logger.Warn("wire accounting unavailable", "error", err)
+		return nil, nil
+	}
+	return counter, func(_, _ string, conn syscall.RawConn) error {
+		return conn.Control(func(fd uintptr) {
+			if err := counter.Attach(fd); err != nil {
+				logger.Debug("wire accounting not attached", "error", err)
+			}
+		})
+	}
+}
+
+// wireTotals returns what the filter has counted, or zeros if it cannot
+// be read.
+func (c *Consumer) wireTotals() (bytes, packets int64) {
+	totals, err := c.wire.Read()
+	if err != nil {
+		c.logger.Debug("wire accounting", "error", err)
+	}
+	return totals.Bytes, totals.Packets
+}
+
+// closeWire fixes the collector's wire totals at their final values and
+// unloads the filter.
+func (c *Consumer) closeWire() {
+	if c.wire == nil {
+		return
+	}
+	bytes, packets := c.wireTotals()
+	c.metricsCollector.SetWireCounter(func() (int64, int64) { return bytes, packets })
+	c.wire.Close()
+	c.wire = nil
+}
@@ -0,0 +1,87 @@
+package consumertest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake metrics.Clock whose time only moves when Advance is
+// called. It is safe for concurrent use.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*ticker
+}
+
+type ticker struct {
+	period time.Duration
+	next   time.Time
+	c      chan time.Time
+	done   chan struct{}
+}
+
+// NewClock returns a clock showing start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the clock's time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker returns a ticker firing every d of the clock's time.
+func (c *Clock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &ticker{period: d, next: c.now.Add(d), c: make(chan time.Time), done: make(chan struct{})}
+	c.tickers = append(c.tickers, t)
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			for i, other := range c.tickers {
+				if other == t {
+					c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+					break
+				}
+			}
+			close(t.done)
+		})
+	}
+	return t.c, stop
+}
+
+// Advance moves the clock forward by d, firing the ticks that fall due on
+// the way in order. Advance returns once every tick has been received,
+// though not necessarily acted on; a metrics.Sink tells when a Collector
+// has taken its sample.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	for {
+		var due *ticker
+		for _, t := range c.tickers {
+			if !t.next.After(target) && (due == nil || t.next.Before(due.next)) {
+				due = t
+			}
+		}
+		if due == nil {
+			break
+		}
+		c.now = due.next
+		due.next = due.next.Add(due.period)
+		now := c.now
+		c.mu.Unlock()
+		select {
+		case due.c <- now:
+		case <-due.done:
+		}
+		c.mu.Lock()
+	}
+	c.now = target
+	c.mu.Unlock()
+}
@@ -0,0 +1,82 @@
+package consumertest_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"dataconsumer/pkg/consumertest"
+)
+
+func TestServer(t *testing.T) {
+	server := consumertest.NewServer()
+	defer server.Close()
+	tests := []struct {
+		payload    consumertest.Payload
+		wantStatus int
+		// wantSize is the size of a 2xx response's body.
+		wantSize int64
+	}{
+		{consumertest.Payload{Size: 12345}, http.StatusOK, 12345},
+		{consumertest.Payload{Size: 3 << 20, Content: "zeros"}, http.StatusOK, 3 << 20},
+		{consumertest.Payload{Size: 1000, Chunked: true}, http.StatusOK, 1000},
+		{consumertest.Payload{Status: http.StatusServiceUnavailable}, http.StatusServiceUnavailable, 0},
+	}
+	for i, tt := range tests {
+		resp, err := http.Get(server.PayloadURL(tt.payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.wantStatus || tt.wantStatus == http.StatusOK && n != tt.wantSize {
+			t.Errorf("%+v: got %d with %d bytes, want %d with %d", tt.payload, resp.StatusCode, n, tt.wantStatus, tt.wantSize)
+		}
+		if got := server.Requests(); got != int64(i+1) {
+			t.Errorf("Requests() = %d, want %d", got, i+1)
+		}
+	}
+}
+
+func TestClock(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := consumertest.NewClock(start)
+	fast, stopFast := clock.NewTicker(2 * time.Second)
+	slow, stopSlow := clock.NewTicker(3 * time.Second)
+
+	var ticks []string
+	quit, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case now := <-fast:
+				ticks = append(ticks, "fast "+now.Sub(start).String())
+			case now := <-slow:
+				ticks = append(ticks, "slow "+now.Sub(start).String())
+			case <-quit:
+				return
+			}
+		}
+	}()
+	// Advance returns once every tick due has been received.
+	clock.Advance(6 * time.Second)
+	close(quit)
+	<-done
+	want := "[fast 2s slow 3s fast 4s fast 6s slow 6s]"
+	if got := fmt.Sprint(ticks); got != want {
+		t.Fatalf("ticks = %s, want %s", got, want)
+	}
+	stopFast()
+	stopSlow()
+	if got := clock.Now(); !got.Equal(start.Add(6 * time.Second)) {
+		t.Errorf("Now() = %s, want 6s after the start", got)
+	}
+	// Stopped tickers no longer hold up Advance.
+	clock.Advance(10 * time.Second)
+}
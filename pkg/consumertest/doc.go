@@ -0,0 +1,23 @@
+// Package consumertest helps test code built on packages consumer and
+// metrics without network access or real time passing.
+//
+// A Server serves payloads of a given size, at a given rate or with a
+// given status code from an in-process HTTP server:
+//
+//	server := consumertest.NewServer()
+//	defer server.Close()
+//	c, err := consumer.NewConsumer(consumer.WithSources(
+//		server.Source(consumertest.Payload{Size: 10 << 20}),
+//		server.Source(consumertest.Payload{Status: http.StatusServiceUnavailable}),
+//	))
+//
+// A Clock is a fake clock for a metrics.Collector, whose rate samples are
+// then taken when the test advances the clock:
+//
+//	clock := consumertest.NewClock(time.Now())
+//	collector := metrics.NewCollector()
+//	collector.SetClock(clock)
+//	collector.Start()
+//	collector.AddBytes(600 << 20)
+//	clock.Advance(10 * time.Second) // samples a rate of 3600 MB/min
+package consumertest
@@ -0,0 +1,101 @@
+package consumertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"dataconsumer/configs"
+	"dataconsumer/internal/byteserver"
+)
+
+// Payload describes what a source served by a Server returns.
+type Payload struct {
+	// Size is the size of the body, 100 MiB if zero.
+	Size configs.Size
+	// Rate limits how fast the body is sent; zero sends it at once.
+	Rate configs.Rate
+	// Status is the response status, 200 if zero. Other than 2xx
+	// statuses are sent without a body.
+	Status int
+	// Content is "zeros" for a body that compresses well, random bytes if
+	// empty.
+	Content string
+	// Encoding compresses the body with "gzip", "deflate" or "zstd", or
+	// with the best one the request accepts if "auto". Size is the size
+	// before compression.
+	Encoding string
+	// Chunked sends the body without a Content-Length.
+	Chunked bool
+	// Delay holds back the response, and Stall stops sending the body for
+	// that long once StallAfter bytes of it have been sent.
+	Delay      time.Duration
+	Stall      time.Duration
+	StallAfter configs.Size
+}
+
+// Server is an in-process HTTP server serving test payloads in the same
+// way as the dataconsumer serve command. Close it when done.
+type Server struct {
+	*httptest.Server
+	requests atomic.Int64
+}
+
+// NewServer starts a server on a local port.
+func NewServer() *Server {
+	s := &Server{}
+	handler := byteserver.New(0).Handler()
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		handler.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+// PayloadURL returns the URL serving payload.
+func (s *Server) PayloadURL(payload Payload) string {
+	query := url.Values{}
+	if payload.Size > 0 {
+		query.Set("size", strconv.FormatInt(payload.Size.Bytes(), 10))
+	}
+	if payload.Rate > 0 {
+		query.Set("rate", payload.Rate.String())
+	}
+	if payload.Status != 0 {
+		query.Set("status", strconv.Itoa(payload.Status))
+	}
+	if payload.Content != "" {
+		query.Set("content", payload.Content)
+	}
+	if payload.Encoding != "" {
+		query.Set("encoding", payload.Encoding)
+	}
+	if payload.Chunked {
+		query.Set("length", "none")
+	}
+	if payload.Delay > 0 {
+		query.Set("delay", payload.Delay.String())
+	}
+	if payload.Stall > 0 {
+		query.Set("stall", payload.Stall.String())
+		query.Set("stall_after", strconv.FormatInt(payload.StallAfter.Bytes(), 10))
+	}
+	u := s.URL + "/bytes"
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// Source returns a data source downloading payload from the server.
+func (s *Server) Source(payload Payload) configs.Source {
+	return configs.Source{URL: s.PayloadURL(payload)}
+}
+
+// Requests returns the number of requests the server has received.
+func (s *Server) Requests() int64 {
+	return s.requests.Load()
+}
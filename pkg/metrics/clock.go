@@ -0,0 +1,25 @@
+package metrics
+
+import "time"
+
+// Clock tells a Collector the time. Tests can substitute a fake clock,
+// such as the one in package consumertest, to make rate samples
+// deterministic.
+type Clock interface {
+	Now() time.Time
+	// NewTicker returns a channel delivering the time every d, and a
+	// function stopping the ticker.
+	NewTicker(d time.Duration) (<-chan time.Time, func())
+}
+
+// systemClock is the Clock of the operating system.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
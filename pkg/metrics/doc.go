@@ -0,0 +1,6 @@
+// Package metrics counts the traffic of a consumption run and reports it
+// as Stats, the format of dataconsumer's metrics files. Stats written by
+// SaveStatsToFile can be read back with LoadStatsFromFile, and the stats of
+// runs that happened side by side combined with Merge. A Collector can
+// also export its stats as it samples them to Sinks such as CSVSink.
+package metrics
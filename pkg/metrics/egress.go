@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"slices"
+	"time"
+)
+
+// Egress is what an egress check saw: the public address the requests
+// left from, whether that address is behind NAT, and the proxies or other
+// intermediaries the echoed request revealed. Since and LastSeen span the
+// consecutive checks that saw the same.
+type Egress struct {
+	Since          time.Time
+	LastSeen       time.Time
+	PublicIP       string
+	NAT            bool
+	Intermediaries []string `json:",omitempty"`
+}
+
+// same reports whether e and other describe the same egress path.
+func (e Egress) same(other Egress) bool {
+	return e.PublicIP == other.PublicIP && e.NAT == other.NAT && slices.Equal(e.Intermediaries, other.Intermediaries)
+}
+
+// RecordEgress records the egress path seen by a check at time at. It
+// returns true if the path differs from the one seen last, which starts a
+// new entry; otherwise the last entry is extended.
+func (m *Collector) RecordEgress(at time.Time, egress Egress) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n := len(m.egress); n > 0 && m.egress[n-1].same(egress) {
+		m.egress[n-1].LastSeen = at
+		return false
+	}
+	egress.Since, egress.LastSeen = at, at
+	m.egress = append(m.egress, egress)
+	return true
+}
+
+// mergeEgress lists the egress paths of all stats in the order they were
+// first seen.
+func mergeEgress(all []Stats) []Egress {
+	var merged []Egress
+	for _, s := range all {
+		merged = append(merged, s.Egress...)
+	}
+	slices.SortStableFunc(merged, func(a, b Egress) int {
+		return a.Since.Compare(b.Since)
+	})
+	return merged
+}
@@ -0,0 +1,50 @@
+package metrics
+
+// Footprint estimates the energy used and CO2e emitted to transfer a
+// run's data from the factors it was configured with. Gigabytes are
+// decimal (10^9 bytes), as the published factors use them.
+type Footprint struct {
+	// KWhPerGB and GridIntensity (grams of CO2e per kWh) are the factors
+	// used; they are zero after merging stats that used different ones.
+	KWhPerGB      float64
+	GridIntensity float64
+	EnergyKWh     float64
+	CO2eGrams     float64
+}
+
+// SetFootprintFactors makes the stats estimate the footprint of the bytes
+// transferred with kwhPerGB and gridIntensity.
+func (m *Collector) SetFootprintFactors(kwhPerGB, gridIntensity float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.footprint = &Footprint{KWhPerGB: kwhPerGB, GridIntensity: gridIntensity}
+}
+
+// estimate returns the footprint of transferring bytes, or nil if no
+// factors are set.
+func (f *Footprint) estimate(bytes int64) *Footprint {
+	if f == nil {
+		return nil
+	}
+	estimate := *f
+	estimate.EnergyKWh = float64(bytes) / 1e9 * f.KWhPerGB
+	estimate.CO2eGrams = estimate.EnergyKWh * f.GridIntensity
+	return &estimate
+}
+
+// mergeFootprint adds f to merged.
+func mergeFootprint(merged, f *Footprint) *Footprint {
+	if f == nil {
+		return merged
+	}
+	if merged == nil {
+		sum := *f
+		return &sum
+	}
+	if merged.KWhPerGB != f.KWhPerGB || merged.GridIntensity != f.GridIntensity {
+		merged.KWhPerGB, merged.GridIntensity = 0, 0
+	}
+	merged.EnergyKWh += f.EnergyKWh
+	merged.CO2eGrams += f.CO2eGrams
+	return merged
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// percentileTicksPerHalf is how many percentile lines WritePercentiles
+// prints for each halving of the distance to 100%, as HdrHistogram does.
+const percentileTicksPerHalf = 5
+
+// WriteHistogramLog writes h to w as an HdrHistogram log (format version
+// 1.3) with a single interval from start to end, for tools such as
+// HistogramLogProcessor. The interval's max value is in milliseconds.
+func WriteHistogramLog(w io.Writer, h *Histogram, start, end time.Time) error {
+	encoded, err := h.Encode()
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#[Histogram log format version 1.3]\n")
+	fmt.Fprintf(bw, "#[StartTime: %.3f (seconds since epoch), %s]\n", float64(start.UnixMilli())/1000, start.Format(time.UnixDate))
+	fmt.Fprintf(bw, "\"StartTimestamp\",\"Interval_Length\",\"Interval_Max\",\"Interval_Compressed_Histogram\"\n")
+	fmt.Fprintf(bw, "%.3f,%.3f,%.3f,%s\n", 0.0, end.Sub(start).Seconds(), milliseconds(h.Max()), encoded)
+	return bw.Flush()
+}
+
+// WritePercentiles writes the percentile distribution of h to w in
+// milliseconds, in the .hgrm layout of HdrHistogram's
+// outputPercentileDistribution that its plotters read.
+func WritePercentiles(w io.Writer, h *Histogram) error {
+	bw := bufio.NewWriter(w)
+	const scale = 1000 // microseconds per millisecond
+	fmt.Fprintf(bw, "%12s %14s %10s %14s\n\n", "Value", "Percentile", "TotalCount", "1/(1-Percentile)")
+	if h.total > 0 {
+		level := 0.0
+		var seen int64
+	buckets:
+		for i, count := range h.counts {
+			if count == 0 {
+				continue
+			}
+			seen += count
+			value := float64(h.highestEquivalent(h.valueAt(i))) / scale
+			for float64(seen)/float64(h.total)*100 >= level {
+				fmt.Fprintf(bw, "%12.3f %2.12f %10d %14.2f\n", value, level/100, seen, 1/(1-level/100))
+				if seen == h.total {
+					break buckets
+				}
+				ticks := percentileTicksPerHalf << (int(math.Log2(100/(100-level))) + 1)
+				level += 100 / float64(ticks)
+			}
+		}
+		fmt.Fprintf(bw, "%12.3f %2.12f %10d\n", float64(h.valueAtPercentile(100))/scale, 1.0, h.total)
+	}
+	fmt.Fprintf(bw, "#[Mean    = %12.3f, StdDeviation   = %12.3f]\n", h.mean()/scale, h.stdDev()/scale)
+	fmt.Fprintf(bw, "#[Max     = %12.3f, Total count    = %12d]\n", milliseconds(h.Max()), h.total)
+	fmt.Fprintf(bw, "#[Buckets = %12d, SubBuckets     = %12d]\n", len(h.counts)/int(h.subBucketCount/2)-1, h.subBucketCount)
+	return bw.Flush()
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,386 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Histograms record durations in microseconds from 1µs to an hour, to
+// three significant digits.
+const (
+	histogramLowest  = 1
+	histogramHighest = int64(time.Hour / time.Microsecond)
+	histogramDigits  = 3
+)
+
+// Cookies of HdrHistogram's V2 encoding with ZigZag LEB128 counts.
+const (
+	encodingCookie           = 0x1c849303 | 0x10
+	compressedEncodingCookie = 0x1c849304 | 0x10
+	encodingHeaderSize       = 40
+)
+
+// Histogram is a distribution of durations with the bucket layout of
+// HdrHistogram, so that it can be written in HdrHistogram's formats and
+// read by its tools. In metrics files it is encoded the way HdrHistogram
+// logs encode intervals.
+type Histogram struct {
+	lowest, highest int64
+	digits          int
+	unitMagnitude   uint
+	halfMagnitude   uint
+	subBucketCount  int64
+	counts          []int64
+	total           int64
+}
+
+// NewHistogram returns an empty histogram for durations from 1µs to an
+// hour.
+func NewHistogram() *Histogram {
+	h, _ := newHistogram(histogramLowest, histogramHighest, histogramDigits)
+	return h
+}
+
+func newHistogram(lowest, highest int64, digits int) (*Histogram, error) {
+	if lowest < 1 || highest < 2*lowest || digits < 0 || digits > 5 {
+		return nil, fmt.Errorf("invalid histogram range %d-%d with %d digits", lowest, highest, digits)
+	}
+	singleUnit := 2 * int64(math.Pow10(digits))
+	subBucketMagnitude := uint(math.Ceil(math.Log2(float64(singleUnit))))
+	h := &Histogram{
+		lowest:         lowest,
+		highest:        highest,
+		digits:         digits,
+		unitMagnitude:  uint(math.Floor(math.Log2(float64(lowest)))),
+		halfMagnitude:  max(subBucketMagnitude, 1) - 1,
+		subBucketCount: 1 << max(subBucketMagnitude, 1),
+	}
+	smallestUntrackable := h.subBucketCount << h.unitMagnitude
+	buckets := int64(1)
+	for smallestUntrackable <= highest {
+		if smallestUntrackable > math.MaxInt64/2 {
+			buckets++
+			break
+		}
+		smallestUntrackable <<= 1
+		buckets++
+	}
+	h.counts = make([]int64, (buckets+1)*(h.subBucketCount/2))
+	return h, nil
+}
+
+// Record adds a duration, capped to the histogram's range.
+func (h *Histogram) Record(d time.Duration) {
+	v := min(max(d.Microseconds(), 0), h.highest)
+	h.counts[h.index(v)]++
+	h.total++
+}
+
+// Merge adds the durations recorded in other.
+func (h *Histogram) Merge(other *Histogram) {
+	for i, count := range other.counts {
+		if count > 0 {
+			h.counts[h.index(other.valueAt(i))] += count
+			h.total += count
+		}
+	}
+}
+
+// Count returns the number of durations recorded.
+func (h *Histogram) Count() int64 {
+	if h == nil {
+		return 0
+	}
+	return h.total
+}
+
+// Percentile returns the duration below which p percent of the recorded
+// durations fall.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	return microseconds(h.valueAtPercentile(p))
+}
+
+// Max returns the longest duration recorded.
+func (h *Histogram) Max() time.Duration {
+	for i := len(h.counts) - 1; i >= 0; i-- {
+		if h.counts[i] > 0 {
+			return microseconds(h.highestEquivalent(h.valueAt(i)))
+		}
+	}
+	return 0
+}
+
+// Mean returns the mean of the recorded durations.
+func (h *Histogram) Mean() time.Duration {
+	return microseconds(int64(h.mean()))
+}
+
+func (h *Histogram) mean() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	var sum float64
+	for i, count := range h.counts {
+		if count > 0 {
+			sum += float64(count) * float64(h.medianEquivalent(h.valueAt(i)))
+		}
+	}
+	return sum / float64(h.total)
+}
+
+// StdDev returns the standard deviation of the recorded durations.
+func (h *Histogram) StdDev() time.Duration {
+	return microseconds(int64(h.stdDev()))
+}
+
+func (h *Histogram) stdDev() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	mean := h.mean()
+	var sum float64
+	for i, count := range h.counts {
+		if count > 0 {
+			deviation := float64(h.medianEquivalent(h.valueAt(i))) - mean
+			sum += deviation * deviation * float64(count)
+		}
+	}
+	return math.Sqrt(sum / float64(h.total))
+}
+
+func (h *Histogram) valueAtPercentile(p float64) int64 {
+	if h.total == 0 {
+		return 0
+	}
+	target := max(int64(math.Min(p, 100)/100*float64(h.total)+0.5), 1)
+	var seen int64
+	for i, count := range h.counts {
+		seen += count
+		if seen >= target {
+			return h.highestEquivalent(h.valueAt(i))
+		}
+	}
+	return 0
+}
+
+func microseconds(v int64) time.Duration {
+	return time.Duration(v) * time.Microsecond
+}
+
+func (h *Histogram) bucketIndex(v int64) int {
+	mask := uint64(h.subBucketCount-1) << h.unitMagnitude
+	return 64 - int(h.unitMagnitude) - int(h.halfMagnitude) - 1 - bits.LeadingZeros64(uint64(v)|mask)
+}
+
+func (h *Histogram) index(v int64) int {
+	bucket := h.bucketIndex(v)
+	subBucket := v >> (uint(bucket) + h.unitMagnitude)
+	return int(int64(bucket+1)<<h.halfMagnitude + subBucket - h.subBucketCount/2)
+}
+
+func (h *Histogram) valueAt(i int) int64 {
+	bucket := i>>h.halfMagnitude - 1
+	subBucket := int64(i)&(h.subBucketCount/2-1) + h.subBucketCount/2
+	if bucket < 0 {
+		subBucket -= h.subBucketCount / 2
+		bucket = 0
+	}
+	return subBucket << (uint(bucket) + h.unitMagnitude)
+}
+
+func (h *Histogram) equivalentRange(v int64) int64 {
+	bucket := h.bucketIndex(v)
+	if v>>(uint(bucket)+h.unitMagnitude) >= h.subBucketCount {
+		bucket++
+	}
+	return 1 << (h.unitMagnitude + uint(bucket))
+}
+
+func (h *Histogram) lowestEquivalent(v int64) int64 {
+	bucket := h.bucketIndex(v)
+	return v >> (uint(bucket) + h.unitMagnitude) << (uint(bucket) + h.unitMagnitude)
+}
+
+func (h *Histogram) highestEquivalent(v int64) int64 {
+	return h.lowestEquivalent(v) + h.equivalentRange(v) - 1
+}
+
+func (h *Histogram) medianEquivalent(v int64) int64 {
+	return h.lowestEquivalent(v) + h.equivalentRange(v)/2
+}
+
+// clone returns a copy of h, or nil if h is nil or empty.
+func (h *Histogram) clone() *Histogram {
+	if h.Count() == 0 {
+		return nil
+	}
+	c := *h
+	c.counts = append([]int64(nil), h.counts...)
+	return &c
+}
+
+// Encode returns the histogram in HdrHistogram's compressed V2 encoding,
+// base64 encoded as in HdrHistogram logs.
+func (h *Histogram) Encode() (string, error) {
+	var payload bytes.Buffer
+	limit := 0
+	for i, count := range h.counts {
+		if count > 0 {
+			limit = i + 1
+		}
+	}
+	var varint [9]byte
+	for i := 0; i < limit; {
+		count := h.counts[i]
+		i++
+		if count == 0 {
+			zeros := int64(1)
+			for i < limit && h.counts[i] == 0 {
+				zeros++
+				i++
+			}
+			if zeros > 1 {
+				count = -zeros
+			}
+		}
+		payload.Write(varint[:putZigZag(varint[:], count)])
+	}
+
+	raw := make([]byte, encodingHeaderSize, encodingHeaderSize+payload.Len())
+	binary.BigEndian.PutUint32(raw, encodingCookie)
+	binary.BigEndian.PutUint32(raw[4:], uint32(payload.Len()))
+	// raw[8:12] is the normalizing index offset, which is zero.
+	binary.BigEndian.PutUint32(raw[12:], uint32(h.digits))
+	binary.BigEndian.PutUint64(raw[16:], uint64(h.lowest))
+	binary.BigEndian.PutUint64(raw[24:], uint64(h.highest))
+	binary.BigEndian.PutUint64(raw[32:], math.Float64bits(1)) // integer to double conversion ratio
+	raw = append(raw, payload.Bytes()...)
+
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(raw)
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	out := make([]byte, 8, 8+compressed.Len())
+	binary.BigEndian.PutUint32(out, compressedEncodingCookie)
+	binary.BigEndian.PutUint32(out[4:], uint32(compressed.Len()))
+	out = append(out, compressed.Bytes()...)
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// DecodeHistogram reads a histogram written by Encode or by HdrHistogram.
+func DecodeHistogram(encoded string) (*Histogram, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 || binary.BigEndian.Uint32(data)&^0xf0 != compressedEncodingCookie&^0xf0 {
+		return nil, errors.New("not a compressed V2 histogram")
+	}
+	length := binary.BigEndian.Uint32(data[4:])
+	if int(length) > len(data)-8 {
+		return nil, errors.New("truncated histogram")
+	}
+	r, err := zlib.NewReader(bytes.NewReader(data[8 : 8+length]))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(io.LimitReader(r, 64<<20))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < encodingHeaderSize || binary.BigEndian.Uint32(raw)&^0xf0 != encodingCookie&^0xf0 {
+		return nil, errors.New("not a V2 histogram")
+	}
+	// Like HdrHistogram's own Go port, ignore the normalizing index
+	// offset, which is only used by shifted histograms.
+	payloadLength := int(binary.BigEndian.Uint32(raw[4:]))
+	h, err := newHistogram(int64(binary.BigEndian.Uint64(raw[16:])), int64(binary.BigEndian.Uint64(raw[24:])), int(binary.BigEndian.Uint32(raw[12:])))
+	if err != nil {
+		return nil, err
+	}
+	if payloadLength > len(raw)-encodingHeaderSize {
+		return nil, errors.New("truncated histogram")
+	}
+	payload := raw[encodingHeaderSize : encodingHeaderSize+payloadLength]
+	for i := 0; len(payload) > 0; {
+		count, n := zigZag(payload)
+		if n == 0 {
+			return nil, errors.New("truncated histogram")
+		}
+		payload = payload[n:]
+		if count < 0 {
+			i += int(-count)
+			continue
+		}
+		if i >= len(h.counts) {
+			return nil, errors.New("histogram counts out of range")
+		}
+		h.counts[i] = count
+		h.total += count
+		i++
+	}
+	return h, nil
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	encoded, err := h.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(`"` + encoded + `"`), nil
+}
+
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return errors.New("histogram is not a string")
+	}
+	decoded, err := DecodeHistogram(string(data[1 : len(data)-1]))
+	if err != nil {
+		return err
+	}
+	*h = *decoded
+	return nil
+}
+
+// putZigZag writes v in HdrHistogram's ZigZag LEB128 form, which uses
+// all 8 bits of a ninth byte, and returns the number of bytes written.
+func putZigZag(buf []byte, v int64) int {
+	u := uint64(v<<1) ^ uint64(v>>63)
+	for i := 0; i < 8; i++ {
+		if u < 0x80 {
+			buf[i] = byte(u)
+			return i + 1
+		}
+		buf[i] = byte(u) | 0x80
+		u >>= 7
+	}
+	buf[8] = byte(u)
+	return 9
+}
+
+// zigZag reads a value written by putZigZag and returns it with the
+// number of bytes read, which is zero if buf is truncated.
+func zigZag(buf []byte) (int64, int) {
+	var u uint64
+	for i := 0; i < 9 && i < len(buf); i++ {
+		if i == 8 {
+			u |= uint64(buf[i]) << 56
+			return int64(u>>1) ^ -int64(u&1), 9
+		}
+		u |= uint64(buf[i]&0x7f) << (7 * i)
+		if buf[i] < 0x80 {
+			return int64(u>>1) ^ -int64(u&1), i + 1
+		}
+	}
+	return 0, 0
+}
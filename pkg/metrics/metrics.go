@@ -0,0 +1,742 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// clockStepThreshold is how far the wall clock must move apart from the
+// monotonic clock between two rate samples to count as a clock step.
+const clockStepThreshold = time.Second
+
+// Stats is a snapshot of a Collector, and the format of metrics files.
+// Rates are in MB/min (MiB per minute).
+type Stats struct {
+	// RunID identifies the run of the program the stats are from, if it
+	// was given one.
+	RunID            string `json:",omitempty"`
+	BytesTransferred int64
+	ElapsedTime      time.Duration
+	StartTime        time.Time
+	CurrentRate      float64
+	PeakRate         float64
+	AverageRate      float64
+	TotalMegabytes   float64
+	RateHistory      []RatePoint
+	LastUpdated      time.Time
+	// TargetRate is the rate in MB/min the run aimed for.
+	TargetRate float64 `json:",omitempty"`
+	// Sources breaks the traffic down by data source.
+	Sources []SourceStats `json:",omitempty"`
+	// Proxies breaks the traffic down by proxy, if any were used.
+	Proxies []ProxyStats `json:",omitempty"`
+	// TTFB is the distribution of times from starting a request to the
+	// first byte of its body, and Latency that of the durations of whole
+	// successful requests.
+	TTFB    *Histogram `json:",omitempty"`
+	Latency *Histogram `json:",omitempty"`
+	// WireBytes and WirePackets are what the kernel received on the
+	// consumer's connections, counted when wire accounting is enabled. The
+	// bytes include TCP headers and retransmitted duplicates, so they
+	// exceed BytesTransferred by the protocol overhead.
+	WireBytes   int64 `json:",omitempty"`
+	WirePackets int64 `json:",omitempty"`
+	// SavedBytes and SavedObjects count the responses written to disk when
+	// save_to is configured, and DuplicateObjects those not kept because
+	// an identical object had already been saved.
+	SavedBytes       int64 `json:",omitempty"`
+	SavedObjects     int64 `json:",omitempty"`
+	DuplicateObjects int64 `json:",omitempty"`
+	// Footprint is the estimated energy and carbon footprint of the
+	// bytes transferred, if footprint factors were set.
+	Footprint *Footprint `json:",omitempty"`
+	// ClockSteps counts the times the wall clock jumped during the run,
+	// e.g. when NTP stepped it, and ClockStep adds up the jumps. Rates and
+	// ElapsedTime come from the monotonic clock and are not affected; only
+	// the timestamps are.
+	ClockSteps int           `json:",omitempty"`
+	ClockStep  time.Duration `json:",omitempty"`
+	// Hosts counts the connections to each source host.
+	Hosts []HostStats `json:",omitempty"`
+	// Egress lists the egress paths the egress checks saw, in order.
+	Egress []Egress `json:",omitempty"`
+}
+
+// HostStats is the connections to one source host: those in use by a
+// request now, and the most that were at once.
+type HostStats struct {
+	Host            string
+	Connections     int
+	PeakConnections int
+}
+
+// SourceStats is the traffic from one data source.
+type SourceStats struct {
+	URL              string
+	BytesTransferred int64
+	Requests         int64
+	Failures         int64
+	// LastError is the error of the last failed request.
+	LastError string `json:",omitempty"`
+	// BufferSize is the read buffer size in bytes the last request used,
+	// tuned to the source's throughput unless buffer_size is set.
+	BufferSize int `json:",omitempty"`
+	// CacheHits and CacheMisses count the responses whose CF-Cache-Status,
+	// X-Cache or Age header said they were or were not served from a
+	// cache such as a CDN edge.
+	CacheHits   int64 `json:",omitempty"`
+	CacheMisses int64 `json:",omitempty"`
+	// Redirected counts the responses that came at the end of a chain of
+	// redirects, RedirectHops the redirects in those chains, and
+	// RedirectHosts the responses by the host the chains ended at.
+	Redirected    int64            `json:",omitempty"`
+	RedirectHops  int64            `json:",omitempty"`
+	RedirectHosts map[string]int64 `json:",omitempty"`
+}
+
+// CacheHitRatio returns the percentage of responses from all sources
+// that were served from a cache, or false if none reported its cache
+// status.
+func (s Stats) CacheHitRatio() (float64, bool) {
+	var total SourceStats
+	for _, source := range s.Sources {
+		total.CacheHits += source.CacheHits
+		total.CacheMisses += source.CacheMisses
+	}
+	return total.CacheHitRatio()
+}
+
+// CacheHitRatio returns the percentage of responses served from a cache,
+// or false if no response reported its cache status.
+func (s SourceStats) CacheHitRatio() (float64, bool) {
+	total := s.CacheHits + s.CacheMisses
+	if total == 0 {
+		return 0, false
+	}
+	return float64(s.CacheHits) / float64(total) * 100, true
+}
+
+// Attainment returns the average rate as a percentage of the target rate,
+// or false if no target was recorded.
+func (s Stats) Attainment() (float64, bool) {
+	if s.TargetRate <= 0 {
+		return 0, false
+	}
+	return s.AverageRate / s.TargetRate * 100, true
+}
+
+// RequestRate returns the average number of requests per second, failed
+// ones included.
+func (s Stats) RequestRate() float64 {
+	if s.ElapsedTime <= 0 {
+		return 0
+	}
+	var requests int64
+	for _, source := range s.Sources {
+		requests += source.Requests
+	}
+	return float64(requests) / s.ElapsedTime.Seconds()
+}
+
+// ErrorRate returns the percentage of failed requests, or false if no
+// requests were recorded.
+func (s Stats) ErrorRate() (float64, bool) {
+	var requests, failures int64
+	for _, source := range s.Sources {
+		requests += source.Requests
+		failures += source.Failures
+	}
+	if requests == 0 {
+		return 0, false
+	}
+	return float64(failures) / float64(requests) * 100, true
+}
+
+// Merge combines the stats of collectors that ran side by side, such as
+// the agents of a fleet. Byte counts, rates, target rates and per-source
+// traffic are summed, and the result spans from the earliest start to the
+// latest update. PeakRate is the sum of the peaks, an upper bound of the
+// combined peak. Rate histories are not merged.
+func Merge(all ...Stats) Stats {
+	var merged Stats
+	sources := make(map[string]int)
+	for _, s := range all {
+		merged.BytesTransferred += s.BytesTransferred
+		merged.CurrentRate += s.CurrentRate
+		merged.PeakRate += s.PeakRate
+		merged.AverageRate += s.AverageRate
+		merged.TotalMegabytes += s.TotalMegabytes
+		merged.TargetRate += s.TargetRate
+		merged.WireBytes += s.WireBytes
+		merged.WirePackets += s.WirePackets
+		merged.SavedBytes += s.SavedBytes
+		merged.SavedObjects += s.SavedObjects
+		merged.DuplicateObjects += s.DuplicateObjects
+		merged.ClockSteps += s.ClockSteps
+		merged.ClockStep += s.ClockStep
+		if !s.StartTime.IsZero() && (merged.StartTime.IsZero() || s.StartTime.Before(merged.StartTime)) {
+			merged.StartTime = s.StartTime
+		}
+		if s.LastUpdated.After(merged.LastUpdated) {
+			merged.LastUpdated = s.LastUpdated
+		}
+		for _, source := range s.Sources {
+			i, ok := sources[source.URL]
+			if !ok {
+				i = len(merged.Sources)
+				sources[source.URL] = i
+				merged.Sources = append(merged.Sources, SourceStats{URL: source.URL})
+			}
+			merged.Sources[i].BytesTransferred += source.BytesTransferred
+			merged.Sources[i].Requests += source.Requests
+			merged.Sources[i].Failures += source.Failures
+			merged.Sources[i].CacheHits += source.CacheHits
+			merged.Sources[i].CacheMisses += source.CacheMisses
+			merged.Sources[i].Redirected += source.Redirected
+			merged.Sources[i].RedirectHops += source.RedirectHops
+			for host, n := range source.RedirectHosts {
+				if merged.Sources[i].RedirectHosts == nil {
+					merged.Sources[i].RedirectHosts = make(map[string]int64)
+				}
+				merged.Sources[i].RedirectHosts[host] += n
+			}
+			if source.LastError != "" {
+				merged.Sources[i].LastError = source.LastError
+			}
+		}
+	}
+	merged.Proxies = mergeProxies(all)
+	merged.Hosts = mergeHosts(all)
+	merged.RunID = mergeRunIDs(all)
+	merged.Egress = mergeEgress(all)
+	for _, s := range all {
+		merged.TTFB = mergeHistogram(merged.TTFB, s.TTFB)
+		merged.Latency = mergeHistogram(merged.Latency, s.Latency)
+		merged.Footprint = mergeFootprint(merged.Footprint, s.Footprint)
+	}
+	if !merged.StartTime.IsZero() {
+		merged.ElapsedTime = merged.LastUpdated.Sub(merged.StartTime)
+	}
+	// The timestamps come from wall clocks, which may have been stepped or
+	// disagree between machines; the span is at least the longest run.
+	for _, s := range all {
+		merged.ElapsedTime = max(merged.ElapsedTime, s.ElapsedTime)
+	}
+	return merged
+}
+
+// mergeRunIDs returns the run ID of the stats if they all share one, as
+// the jobs of one run do, and "" otherwise.
+func mergeRunIDs(all []Stats) string {
+	if len(all) == 0 {
+		return ""
+	}
+	for _, s := range all[1:] {
+		if s.RunID != all[0].RunID {
+			return ""
+		}
+	}
+	return all[0].RunID
+}
+
+// mergeHosts sums the connections per host. The peaks are summed too, an
+// upper bound of the combined peak.
+func mergeHosts(all []Stats) []HostStats {
+	var merged []HostStats
+	index := make(map[string]int)
+	for _, s := range all {
+		for _, host := range s.Hosts {
+			i, ok := index[host.Host]
+			if !ok {
+				i = len(merged)
+				index[host.Host] = i
+				merged = append(merged, HostStats{Host: host.Host})
+			}
+			merged[i].Connections += host.Connections
+			merged[i].PeakConnections += host.PeakConnections
+		}
+	}
+	return merged
+}
+
+// mergeProxies sums the proxy stats of all, averaging latencies weighted
+// by requests.
+func mergeProxies(all []Stats) []ProxyStats {
+	var merged []ProxyStats
+	index := make(map[string]int)
+	for _, s := range all {
+		for _, proxy := range s.Proxies {
+			i, ok := index[proxy.Proxy]
+			if !ok {
+				i = len(merged)
+				index[proxy.Proxy] = i
+				merged = append(merged, ProxyStats{Proxy: proxy.Proxy})
+			}
+			m := &merged[i]
+			if requests := m.Requests + proxy.Requests; requests > 0 {
+				m.Latency = (m.Latency*time.Duration(m.Requests) + proxy.Latency*time.Duration(proxy.Requests)) / time.Duration(requests)
+			}
+			m.BytesTransferred += proxy.BytesTransferred
+			m.Requests += proxy.Requests
+			m.Failures += proxy.Failures
+			m.Pruned = m.Pruned || proxy.Pruned
+		}
+	}
+	return merged
+}
+
+// mergeHistogram returns the sum of merged and h, either of which may be
+// nil.
+func mergeHistogram(merged, h *Histogram) *Histogram {
+	if h.Count() == 0 {
+		return merged
+	}
+	if merged == nil {
+		return h.clone()
+	}
+	merged.Merge(h)
+	return merged
+}
+
+// RatePoint is one sample of the rate history.
+type RatePoint struct {
+	Timestamp time.Time
+	RateMBPS  float64
+}
+
+// Collector counts the bytes of a consumption run and samples its rate
+// every 10 seconds. It is safe for concurrent use.
+type Collector struct {
+	bytesTransferred int64
+	startTime        time.Time
+	lastSample       time.Time
+	lastBytes        int64
+	running          bool
+	peakRate         float64
+	rateHistory      []RatePoint
+	historyLimit     int
+	mu               sync.Mutex
+	sinks            []Sink
+	clock            Clock
+	// exportMu keeps a sink from being sampled after it was closed.
+	exportMu    sync.Mutex
+	logger      *slog.Logger
+	targetRate  float64
+	sources     map[string]*SourceStats
+	sourceOrder []string
+	// done is closed by Stop to end the sampler, which closes sampled
+	// when it has returned.
+	done       chan struct{}
+	sampled    chan struct{}
+	proxies    map[string]*proxyEntry
+	proxyOrder []string
+	ttfb       *Histogram
+	latency    *Histogram
+	wire       func() (bytes, packets int64)
+	saved      Stats
+	footprint  *Footprint
+	clockSteps int
+	clockStep  time.Duration
+	hosts      func() []HostStats
+	runID      string
+	egress     []Egress
+}
+
+// NewCollector returns a collector keeping the last 60 rate samples.
+func NewCollector() *Collector {
+	return &Collector{
+		historyLimit: 60,
+		clock:        systemClock{},
+		logger:       slog.Default().With("component", "metrics"),
+	}
+}
+
+// SetLogger replaces the logger, which defaults to slog.Default().
+func (m *Collector) SetLogger(logger *slog.Logger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logger = logger.With("component", "metrics")
+}
+
+// SetClock replaces the clock the collector reads the time from and
+// samples the rate with, which defaults to the system clock. Call it
+// before Start.
+func (m *Collector) SetClock(clock Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = clock
+}
+
+// AddSink makes the collector pass its stats to sink after every rate
+// sample, and close sink when it stops.
+func (m *Collector) AddSink(sink Sink) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sinks = append(m.sinks, sink)
+}
+
+// EnableFileLogging writes every rate sample to filename as a CSV line,
+// with a CSVSink. The file is closed by Stop.
+func (m *Collector) EnableFileLogging(filename string) error {
+	sink, err := NewCSVFileSink(filename)
+	if err != nil {
+		return err
+	}
+	m.AddSink(sink)
+	return nil
+}
+
+// Start resets the counters and starts sampling. It does nothing if the
+// collector is already running. A stopped collector can be started
+// again, with new sinks, to reuse it for another session.
+func (m *Collector) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.running {
+		now := m.clock.Now()
+		m.startTime = now
+		m.lastSample = now
+		atomic.StoreInt64(&m.bytesTransferred, 0)
+		m.lastBytes = 0
+		m.peakRate = 0
+		m.rateHistory = make([]RatePoint, 0, m.historyLimit)
+		m.sources = nil
+		m.sourceOrder = nil
+		m.proxies = nil
+		m.proxyOrder = nil
+		m.ttfb = nil
+		m.latency = nil
+		m.saved = Stats{}
+		m.clockSteps, m.clockStep = 0, 0
+		m.egress = nil
+		m.running = true
+		m.done = make(chan struct{})
+		m.sampled = make(chan struct{})
+		ticks, stop := m.clock.NewTicker(10 * time.Second)
+		go m.sampleMetrics(ticks, stop, m.done, m.sampled)
+	}
+}
+
+// sampleMetrics samples the rate at every tick until done is closed, and
+// then closes sampled.
+func (m *Collector) sampleMetrics(ticks <-chan time.Time, stop func(), done, sampled chan struct{}) {
+	defer close(sampled)
+	defer stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticks:
+		}
+		m.mu.Lock()
+		now := m.clock.Now()
+		currentBytes := atomic.LoadInt64(&m.bytesTransferred)
+		bytesDelta := currentBytes - m.lastBytes
+		// Sub uses the monotonic clock readings of both times; Round(0)
+		// strips them to see how far the wall clock moved.
+		timeDelta := now.Sub(m.lastSample).Seconds()
+		if step := now.Round(0).Sub(m.lastSample.Round(0)) - now.Sub(m.lastSample); step > clockStepThreshold || step < -clockStepThreshold {
+			m.clockSteps++
+			m.clockStep += step
+			m.logger.Warn("wall clock stepped, rates are unaffected", "step", step.Round(time.Millisecond))
+		}
+		if timeDelta > 0 {
+			rateMBPS := float64(bytesDelta) / timeDelta / 1024 / 1024
+			if len(m.rateHistory) >= m.historyLimit {
+				m.rateHistory = m.rateHistory[1:]
+			}
+			m.rateHistory = append(m.rateHistory, RatePoint{Timestamp: now, RateMBPS: rateMBPS * 60})
+			if rateMBPS*60 > m.peakRate {
+				m.peakRate = rateMBPS * 60
+			}
+			m.lastSample = now
+			m.lastBytes = currentBytes
+		}
+		m.mu.Unlock()
+		m.export()
+	}
+}
+
+// export passes the current stats to the sinks.
+func (m *Collector) export() {
+	m.exportMu.Lock()
+	defer m.exportMu.Unlock()
+	m.mu.Lock()
+	sinks := m.sinks
+	m.mu.Unlock()
+	if len(sinks) == 0 {
+		return
+	}
+	stats := m.GetStats()
+	for _, sink := range sinks {
+		if err := sink.Sample(stats); err != nil {
+			m.logger.Warn("exporting metrics sample failed", "sink", fmt.Sprintf("%T", sink), "error", err)
+		}
+	}
+}
+
+// Stop stops sampling, waits for a sample in progress and closes the
+// sinks with the final stats, removing them. The stats remain available
+// until the next Start. Stopping a stopped collector does nothing more.
+func (m *Collector) Stop() {
+	m.mu.Lock()
+	if m.running {
+		m.running = false
+		close(m.done)
+	}
+	sampled := m.sampled
+	m.mu.Unlock()
+	if sampled != nil {
+		<-sampled
+	}
+
+	m.exportMu.Lock()
+	defer m.exportMu.Unlock()
+	m.mu.Lock()
+	sinks := m.sinks
+	m.sinks = nil
+	m.mu.Unlock()
+
+	if len(sinks) > 0 {
+		final := m.GetStats()
+		for _, sink := range sinks {
+			if err := sink.Close(final); err != nil {
+				m.logger.Warn("closing metrics sink failed", "sink", fmt.Sprintf("%T", sink), "error", err)
+			}
+		}
+	}
+}
+
+// AddBytes counts bytes received.
+func (m *Collector) AddBytes(bytes int64) {
+	atomic.AddInt64(&m.bytesTransferred, bytes)
+}
+
+// SetRunID records the ID of the run the stats are from.
+func (m *Collector) SetRunID(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runID = id
+}
+
+// SetTargetRate records the rate in MB/min the run aims for.
+func (m *Collector) SetTargetRate(mbPerMinute float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.targetRate = mbPerMinute
+}
+
+// RecordRequest counts a completed request to a source and the bytes it
+// delivered.
+func (m *Collector) RecordRequest(url string, bytes int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	source := m.source(url)
+	source.Requests++
+	source.BytesTransferred += bytes
+	if err != nil {
+		source.Failures++
+		source.LastError = err.Error()
+	}
+}
+
+// AddSourceBytes counts bytes from a request that was abandoned, e.g. at
+// shutdown, without counting the request.
+func (m *Collector) AddSourceBytes(url string, bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.source(url).BytesTransferred += bytes
+}
+
+// SetBufferSize records the read buffer size last used for url.
+func (m *Collector) SetBufferSize(url string, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.source(url).BufferSize = size
+}
+
+// RecordCache counts a response from url that was or was not served from
+// a cache.
+func (m *Collector) RecordCache(url string, hit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hit {
+		m.source(url).CacheHits++
+	} else {
+		m.source(url).CacheMisses++
+	}
+}
+
+// RecordRedirects counts a response to a request for url that was
+// redirected hops times, ending at host.
+func (m *Collector) RecordRedirects(url string, hops int, host string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	source := m.source(url)
+	source.Redirected++
+	source.RedirectHops += int64(hops)
+	if source.RedirectHosts == nil {
+		source.RedirectHosts = make(map[string]int64)
+	}
+	source.RedirectHosts[host]++
+}
+
+// RecordTimes adds a request's time to first byte and, if it succeeded,
+// its duration to their distributions. A zero duration is not recorded.
+func (m *Collector) RecordTimes(ttfb, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ttfb > 0 {
+		if m.ttfb == nil {
+			m.ttfb = NewHistogram()
+		}
+		m.ttfb.Record(ttfb)
+	}
+	if latency > 0 {
+		if m.latency == nil {
+			m.latency = NewHistogram()
+		}
+		m.latency.Record(latency)
+	}
+}
+
+// RecordSaved counts an object written to disk, or one that was not kept
+// because it duplicated an object already saved.
+func (m *Collector) RecordSaved(bytes int64, duplicate bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if duplicate {
+		m.saved.DuplicateObjects++
+		return
+	}
+	m.saved.SavedBytes += bytes
+	m.saved.SavedObjects++
+}
+
+// SetWireCounter makes the stats report the bytes and packets on the wire
+// returned by counter.
+func (m *Collector) SetWireCounter(counter func() (bytes, packets int64)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.wire = counter
+}
+
+// SetHostCounter makes the stats report the connections per host returned
+// by counter.
+func (m *Collector) SetHostCounter(counter func() []HostStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hosts = counter
+}
+
+// source returns the stats of url, adding them on first use. The caller
+// must hold m.mu.
+func (m *Collector) source(url string) *SourceStats {
+	source := m.sources[url]
+	if source == nil {
+		if m.sources == nil {
+			m.sources = make(map[string]*SourceStats)
+		}
+		source = &SourceStats{URL: url}
+		m.sources[url] = source
+		m.sourceOrder = append(m.sourceOrder, url)
+	}
+	return source
+}
+
+// GetStats returns the current stats.
+func (m *Collector) GetStats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	currentBytes := atomic.LoadInt64(&m.bytesTransferred)
+	now := m.clock.Now()
+	elapsed := max(now.Sub(m.startTime), 0)
+	var currentRate float64
+	if len(m.rateHistory) > 0 {
+		currentRate = m.rateHistory[len(m.rateHistory)-1].RateMBPS
+	} else if elapsed.Seconds() > 0 {
+		currentRate = float64(currentBytes) / elapsed.Seconds() * 60 / 1024 / 1024
+	}
+	averageRate := float64(0)
+	if elapsed.Minutes() > 0 {
+		averageRate = float64(currentBytes) / 1024 / 1024 / elapsed.Minutes()
+	}
+	var sources []SourceStats
+	for _, url := range m.sourceOrder {
+		source := *m.sources[url]
+		source.RedirectHosts = maps.Clone(source.RedirectHosts)
+		sources = append(sources, source)
+	}
+	var wireBytes, wirePackets int64
+	if m.wire != nil {
+		wireBytes, wirePackets = m.wire()
+	}
+	var hosts []HostStats
+	if m.hosts != nil {
+		hosts = m.hosts()
+	}
+	return Stats{
+		RunID:            m.runID,
+		BytesTransferred: currentBytes,
+		ElapsedTime:      elapsed,
+		StartTime:        m.startTime,
+		CurrentRate:      currentRate,
+		PeakRate:         m.peakRate,
+		AverageRate:      averageRate,
+		TotalMegabytes:   float64(currentBytes) / 1024 / 1024,
+		RateHistory:      m.rateHistory,
+		LastUpdated:      now,
+		TargetRate:       m.targetRate,
+		Sources:          sources,
+		Proxies:          m.proxyStats(),
+		TTFB:             m.ttfb.clone(),
+		Latency:          m.latency.clone(),
+		WireBytes:        wireBytes,
+		WirePackets:      wirePackets,
+		SavedBytes:       m.saved.SavedBytes,
+		SavedObjects:     m.saved.SavedObjects,
+		DuplicateObjects: m.saved.DuplicateObjects,
+		Footprint:        m.footprint.estimate(currentBytes),
+		ClockSteps:       m.clockSteps,
+		ClockStep:        m.clockStep,
+		Hosts:            hosts,
+		Egress:           slices.Clone(m.egress),
+	}
+}
+
+// SaveStatsToFile writes the current stats to filename as indented JSON.
+func (m *Collector) SaveStatsToFile(filename string) error {
+	return SaveStats(filename, m.GetStats())
+}
+
+// SaveStats writes stats to filename as indented JSON, e.g. stats merged
+// from several collectors.
+func SaveStats(filename string, stats Stats) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(stats)
+}
+
+// LoadStatsFromFile reads stats written by SaveStatsToFile.
+func LoadStatsFromFile(filename string) (Stats, error) {
+	var stats Stats
+	file, err := os.Open(filename)
+	if err != nil {
+		return stats, err
+	}
+	defer file.Close()
+	err = json.NewDecoder(file).Decode(&stats)
+	return stats, err
+}
@@ -0,0 +1,113 @@
+package metrics_test
+
+import (
+	"testing"
+	"time"
+
+	"dataconsumer/pkg/consumertest"
+	"dataconsumer/pkg/metrics"
+)
+
+// recorder is a metrics.Sink passing on what it receives.
+type recorder struct {
+	samples chan metrics.Stats
+	closed  chan metrics.Stats
+}
+
+func newRecorder() *recorder {
+	return &recorder{samples: make(chan metrics.Stats, 16), closed: make(chan metrics.Stats, 1)}
+}
+
+func (r *recorder) Sample(stats metrics.Stats) error {
+	r.samples <- stats
+	return nil
+}
+
+func (r *recorder) Close(final metrics.Stats) error {
+	r.closed <- final
+	return nil
+}
+
+// sample advances clock to the next rate sample and returns it.
+func sample(t *testing.T, clock *consumertest.Clock, sink *recorder) metrics.Stats {
+	t.Helper()
+	clock.Advance(10 * time.Second)
+	select {
+	case stats := <-sink.samples:
+		return stats
+	case <-time.After(5 * time.Second):
+		t.Fatal("no sample after advancing the clock")
+		return metrics.Stats{}
+	}
+}
+
+func TestCollectorSamples(t *testing.T) {
+	clock := consumertest.NewClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	collector := metrics.NewCollector()
+	collector.SetClock(clock)
+	sink := newRecorder()
+	collector.AddSink(sink)
+	collector.Start()
+	defer collector.Stop()
+
+	collector.AddBytes(600 << 20)
+	stats := sample(t, clock, sink)
+	if stats.CurrentRate != 3600 {
+		t.Errorf("rate after 600 MiB in 10s = %v MB/min, want 3600", stats.CurrentRate)
+	}
+	collector.AddBytes(300 << 20)
+	stats = sample(t, clock, sink)
+	if stats.CurrentRate != 1800 || stats.PeakRate != 3600 {
+		t.Errorf("rate, peak = %v, %v MB/min, want 1800, 3600", stats.CurrentRate, stats.PeakRate)
+	}
+	if stats.ElapsedTime != 20*time.Second || len(stats.RateHistory) != 2 {
+		t.Errorf("elapsed %s with %d samples, want 20s with 2", stats.ElapsedTime, len(stats.RateHistory))
+	}
+}
+
+func TestCollectorRestart(t *testing.T) {
+	clock := consumertest.NewClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	collector := metrics.NewCollector()
+	collector.SetClock(clock)
+
+	first := newRecorder()
+	collector.AddSink(first)
+	collector.Start()
+	collector.AddBytes(600 << 20)
+	sample(t, clock, first)
+	collector.Stop()
+	final := <-first.closed
+	if final.BytesTransferred != 600<<20 {
+		t.Errorf("final bytes of the first session = %d, want %d", final.BytesTransferred, 600<<20)
+	}
+	// Stopping again neither blocks nor closes the sinks again.
+	collector.Stop()
+	if stats := collector.GetStats(); stats.BytesTransferred != 600<<20 {
+		t.Errorf("stats after Stop = %d bytes, want them kept until the next Start", stats.BytesTransferred)
+	}
+
+	second := newRecorder()
+	collector.AddSink(second)
+	collector.Start()
+	if stats := collector.GetStats(); stats.BytesTransferred != 0 || stats.PeakRate != 0 || len(stats.RateHistory) != 0 {
+		t.Errorf("restarted collector kept %d bytes, peak %v and %d samples", stats.BytesTransferred, stats.PeakRate, len(stats.RateHistory))
+	}
+	collector.AddBytes(60 << 20)
+	if stats := sample(t, clock, second); stats.CurrentRate != 360 || stats.ElapsedTime != 10*time.Second {
+		t.Errorf("second session sampled %v MB/min after %s, want 360 after 10s", stats.CurrentRate, stats.ElapsedTime)
+	}
+	select {
+	case <-first.samples:
+		t.Error("the first session's sink still gets samples")
+	default:
+	}
+	collector.Stop()
+	if final := <-second.closed; final.BytesTransferred != 60<<20 {
+		t.Errorf("final bytes of the second session = %d, want %d", final.BytesTransferred, 60<<20)
+	}
+	select {
+	case <-first.closed:
+		t.Error("the first session's sink was closed twice")
+	default:
+	}
+}
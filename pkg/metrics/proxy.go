@@ -0,0 +1,88 @@
+package metrics
+
+import "time"
+
+// ProxyStats is the traffic through one proxy.
+type ProxyStats struct {
+	// Proxy is the proxy URL without its password.
+	Proxy            string
+	BytesTransferred int64
+	Requests         int64
+	Failures         int64
+	// Latency is the mean time from sending a request to receiving the
+	// response headers through the proxy.
+	Latency time.Duration
+	// Pruned is set once the proxy was taken out of rotation for failing
+	// too often.
+	Pruned bool `json:",omitempty"`
+}
+
+// ErrorRate returns the percentage of failed requests through the proxy,
+// or false if it had none.
+func (s ProxyStats) ErrorRate() (float64, bool) {
+	if s.Requests == 0 {
+		return 0, false
+	}
+	return float64(s.Failures) / float64(s.Requests) * 100, true
+}
+
+// proxyEntry accumulates a proxy's stats.
+type proxyEntry struct {
+	stats     ProxyStats
+	latency   time.Duration
+	responses int64
+}
+
+// RecordProxyRequest counts a finished request through proxy: the bytes
+// of its body, the time to its response headers if it got a response, and
+// whether it failed.
+func (m *Collector) RecordProxyRequest(proxy string, bytes int64, latency time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := m.proxy(proxy)
+	entry.stats.BytesTransferred += bytes
+	entry.stats.Requests++
+	if failed {
+		entry.stats.Failures++
+	}
+	if latency > 0 {
+		entry.latency += latency
+		entry.responses++
+	}
+}
+
+// SetProxyPruned records that proxy was taken out of rotation.
+func (m *Collector) SetProxyPruned(proxy string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.proxy(proxy).stats.Pruned = true
+}
+
+// proxy returns the entry of proxy, adding it on first use. The caller
+// must hold m.mu.
+func (m *Collector) proxy(proxy string) *proxyEntry {
+	entry := m.proxies[proxy]
+	if entry == nil {
+		if m.proxies == nil {
+			m.proxies = make(map[string]*proxyEntry)
+		}
+		entry = &proxyEntry{stats: ProxyStats{Proxy: proxy}}
+		m.proxies[proxy] = entry
+		m.proxyOrder = append(m.proxyOrder, proxy)
+	}
+	return entry
+}
+
+// proxyStats returns the stats of every proxy. The caller must hold m.mu.
+func (m *Collector) proxyStats() []ProxyStats {
+	var proxies []ProxyStats
+	for _, proxy := range m.proxyOrder {
+		entry := m.proxies[proxy]
+		stats := entry.stats
+		if entry.responses > 0 {
+			stats.Latency = entry.latency / time.Duration(entry.responses)
+		}
+		proxies = append(proxies, stats)
+	}
+	return proxies
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Sink exports the stats of a Collector, e.g. to a file or a monitoring
+// system. Sinks are added with Collector.AddSink.
+type Sink interface {
+	// Sample is called with the stats after every rate sample, whose rate
+	// is the stats' CurrentRate.
+	Sample(stats Stats) error
+	// Close is called once by Collector.Stop with the final stats.
+	Close(final Stats) error
+}
+
+// CSVSink writes every rate sample as a CSV line with the timestamp, the
+// bytes transferred so far, the rate in MB/s and the total in MB.
+type CSVSink struct {
+	w io.Writer
+}
+
+// NewCSVSink returns a sink writing to w, starting with a header line. If
+// w is an io.Closer it is closed with the sink.
+func NewCSVSink(w io.Writer) (*CSVSink, error) {
+	if _, err := io.WriteString(w, "timestamp,bytes_transferred,rate_mbps,total_mb\n"); err != nil {
+		return nil, err
+	}
+	return &CSVSink{w: w}, nil
+}
+
+// NewCSVFileSink creates filename and returns a sink writing to it.
+func NewCSVFileSink(filename string) (*CSVSink, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := NewCSVSink(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (s *CSVSink) Sample(stats Stats) error {
+	timestamp := stats.LastUpdated
+	if n := len(stats.RateHistory); n > 0 {
+		timestamp = stats.RateHistory[n-1].Timestamp
+	}
+	_, err := fmt.Fprintf(s.w, "%s,%d,%.2f,%.2f\n", timestamp.Format(time.RFC3339), stats.BytesTransferred, stats.CurrentRate/60, stats.TotalMegabytes)
+	return err
+}
+
+func (s *CSVSink) Close(Stats) error {
+	if closer, ok := s.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// FileSink keeps a metrics file up to date: it rewrites the file with the
+// stats after every sample and once more with the final stats.
+type FileSink struct {
+	filename string
+}
+
+// NewFileSink returns a sink writing to filename in the format of
+// SaveStatsToFile.
+func NewFileSink(filename string) *FileSink {
+	return &FileSink{filename: filename}
+}
+
+func (s *FileSink) Sample(stats Stats) error {
+	return SaveStats(s.filename, stats)
+}
+
+func (s *FileSink) Close(final Stats) error {
+	return SaveStats(s.filename, final)
+}